@@ -0,0 +1,166 @@
+package main
+
+import (
+	"api-gateway/internal/config"
+	"api-gateway/internal/proxy"
+	"context"
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"net/http"
+	"shared/auth"
+	sharedconfig "shared/config"
+	"shared/health"
+	"shared/httpclient"
+	"shared/lifecycle"
+	"shared/logging"
+	"shared/metrics"
+	"shared/mtls"
+	"shared/ratelimit"
+	"shared/tracing"
+	"time"
+)
+
+var logger = logging.Logger
+
+func main() {
+	configFile := sharedconfig.File("config.yaml")
+	gatewayConfig, err := config.Load(configFile)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to load config")
+	}
+	logging.Setup("api-gateway", gatewayConfig.Log)
+
+	// on SIGTERM proxied requests are drained, health checks stop and connections are closed
+	app := lifecycle.New(time.Duration(gatewayConfig.Server.ShutdownTimeout), time.Duration(gatewayConfig.Server.ShutdownDelay))
+
+	// spans are flushed after everything else is closed
+	shutdownTracing, err := tracing.Setup("api-gateway", gatewayConfig.Tracing)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to set up tracing")
+	}
+	app.OnShutdown("tracing", shutdownTracing)
+
+	// Prometheus scrapes /metrics on its own port
+	app.Go(func(ctx context.Context) {
+		if err := metrics.Serve(ctx, gatewayConfig.Metrics.Addr()); err != nil {
+			logger.Error().Err(err).Msg("Metrics server stopped")
+		}
+	})
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr:     gatewayConfig.Redis.Addr,
+		Password: gatewayConfig.Redis.Password,
+		DB:       gatewayConfig.Redis.DB,
+	})
+	app.Close("redis", rdb)
+	rdb.AddHook(tracing.RedisHook())
+
+	// requests are forwarded with the caller's credentials, over mutual TLS when it is configured
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if gatewayConfig.TLS.Enabled() {
+		tlsConfig, err := mtls.ClientConfig(gatewayConfig.TLS)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to load TLS certificates")
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	upstreams := make(map[string]*proxy.Upstream)
+	for name, upstreamConfig := range gatewayConfig.Upstreams {
+		// health checks go through the service client, over mutual TLS when it is configured
+		healthClient, err := httpclient.ForService(gatewayConfig.ServiceClient, gatewayConfig.TLS, name)
+		if err != nil {
+			logger.Fatal().Err(err).Msgf("Failed to create %s client", name)
+		}
+		upstream, err := proxy.NewUpstream(name, upstreamConfig.Targets, upstreamConfig.HealthPath, tracing.Transport(transport), healthClient)
+		if err != nil {
+			logger.Fatal().Err(err).Msgf("Failed to configure upstream %s", name)
+		}
+		upstreams[name] = upstream
+		app.Go(func(ctx context.Context) {
+			upstream.Balancer.Run(ctx, time.Duration(gatewayConfig.HealthCheckInterval))
+		})
+	}
+
+	// access tokens and API keys are checked once here, the upstreams still verify them
+	userClient, err := httpclient.ForService(gatewayConfig.ServiceClient, gatewayConfig.TLS, "user-management-service")
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to create user-management client")
+	}
+	apiKeys := auth.NewAPIKeyResolver(gatewayConfig.UserServiceURL+"/api-keys/introspect", userClient)
+	authenticated := auth.VerifierWithAPIKeys(auth.NewKeySet(gatewayConfig.Auth.JWKSURL), auth.NewRevocationList(rdb), "api-gateway", apiKeys)
+
+	e := echo.New()
+	// the gateway is the edge, forwarded-for headers sent by clients can't be trusted
+	e.IPExtractor = echo.ExtractIPDirect()
+
+	// limits are shared by all gateway instances through Redis
+	limiter := ratelimit.NewLimiter(rdb, "api-gateway", &gatewayConfig.RateLimits)
+	limited := ratelimit.Middleware(limiter)
+	limitedBeforeAuth := ratelimit.BeforeAuth(limiter)
+
+	// rate limits and the log level are picked up from the config file while the gateway runs
+	app.Go(func(ctx context.Context) {
+		sharedconfig.Watch(ctx, configFile, 10*time.Second, func(reloaded *config.Config) {
+			reloaded.Log.Apply()
+			limiter.SetConfig(&reloaded.RateLimits)
+			logger.Info().Msgf("Reloaded rate limits and log level from %s", configFile)
+		}, func(err error) {
+			logger.Error().Err(err).Msg("Failed to reload config, keeping the current one")
+		})
+	})
+
+	e.Use(middleware.RequestIDWithConfig(middleware.RequestIDConfig{
+		// the upstreams log the same request ID
+		RequestIDHandler: func(c echo.Context, requestID string) {
+			c.Request().Header.Set(echo.HeaderXRequestID, requestID)
+		},
+	}))
+	e.Use(logging.Middleware())
+	e.Use(middleware.Recover())
+	e.Use(metrics.Middleware())
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Request().Header.Del(echo.HeaderXForwardedFor)
+			// traces and orders are tracked from the edge, clients can't set them
+			for _, header := range []string{"Traceparent", "Tracestate", "Baggage", logging.HeaderOrderID} {
+				c.Request().Header.Del(header)
+			}
+			return next(c)
+		}
+	})
+	e.Use(tracing.Middleware())
+
+	for _, route := range gatewayConfig.Routes {
+		handler := upstreams[route.Upstream].Handler(time.Duration(route.Timeout))
+		// authenticated callers are rate limited per user or API key, the others per IP. Failed
+		// authentications count against the IP, which is checked before the credentials are.
+		var middlewares []echo.MiddlewareFunc
+		if !route.Public {
+			middlewares = append(middlewares, limitedBeforeAuth, authenticated)
+		}
+		middlewares = append(middlewares, limited)
+
+		if len(route.Methods) == 0 {
+			e.Any(route.Path, handler, middlewares...)
+		} else {
+			e.Match(route.Methods, route.Path, handler, middlewares...)
+		}
+	}
+
+	// an upstream without healthy replicas only degrades the gateway, the other routes still work
+	checker := health.NewChecker("api-gateway", app.Context())
+	checker.Add("redis", true, health.Redis(rdb))
+	for name, upstream := range upstreams {
+		checker.Add("upstream:"+name, false, upstream.Balancer.Check)
+	}
+	checker.Register(e, "/gateway/health")
+
+	err = app.Serve(e, func() error {
+		return e.Start(gatewayConfig.Server.Addr())
+	})
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Server stopped")
+	}
+}
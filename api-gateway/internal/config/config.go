@@ -0,0 +1,90 @@
+// Package config is the gateway's configuration: the upstream services and routes, and the rate
+// limits, which are reloaded while the gateway runs.
+package config
+
+import (
+	"fmt"
+	sharedconfig "shared/config"
+	"shared/httpclient"
+	"shared/logging"
+	"shared/metrics"
+	"shared/mtls"
+	"shared/ratelimit"
+	"shared/tracing"
+	"strings"
+	"time"
+)
+
+// Upstream is a service the gateway forwards to, with the replicas requests are balanced across.
+// Replicas are taken out of rotation while HealthPath doesn't answer 200.
+type Upstream struct {
+	Targets    []string `yaml:"targets"`
+	HealthPath string   `yaml:"health_path"`
+}
+
+// Route forwards requests matching an Echo path pattern, e.g. "/orders/*", to an upstream.
+// Routes are authenticated at the edge unless they are public.
+type Route struct {
+	Path     string                `yaml:"path"`
+	Methods  []string              `yaml:"methods"` // All methods if empty
+	Upstream string                `yaml:"upstream"`
+	Public   bool                  `yaml:"public"`
+	Timeout  sharedconfig.Duration `yaml:"timeout"` // DefaultTimeout if zero
+}
+
+type Config struct {
+	Server        sharedconfig.Server    `yaml:"server"`
+	Metrics       metrics.Config         `yaml:"metrics"`
+	Tracing       tracing.Config         `yaml:"tracing"`
+	Log           logging.Config         `yaml:"log"`
+	Redis         sharedconfig.Redis     `yaml:"redis"`
+	Auth          sharedconfig.Auth      `yaml:"auth"`
+	TLS           mtls.Files             `yaml:"tls"`
+	ServiceClient httpclient.Credentials `yaml:"service_client"`
+
+	UserServiceURL      string                `yaml:"user_service_url" env:"USER_SERVICE_URL" default:"http://localhost:8080"`
+	Upstreams           map[string]Upstream   `yaml:"upstreams"`
+	Routes              []Route               `yaml:"routes"`
+	DefaultTimeout      sharedconfig.Duration `yaml:"default_timeout" default:"10s"`
+	HealthCheckInterval sharedconfig.Duration `yaml:"health_check_interval" default:"5s"`
+
+	RateLimits ratelimit.Config `yaml:"rate_limits"`
+}
+
+// Load reads and checks the config file, see sharedconfig.Load.
+func Load(path string) (*Config, error) {
+	config := &Config{}
+	if err := sharedconfig.Load(path, config); err != nil {
+		return nil, err
+	}
+
+	for i, route := range config.Routes {
+		if route.Timeout == 0 {
+			config.Routes[i].Timeout = config.DefaultTimeout
+		}
+	}
+	return config, nil
+}
+
+func (c *Config) Validate() error {
+	if err := sharedconfig.URL("user_service_url", c.UserServiceURL); err != nil {
+		return err
+	}
+	for name, upstream := range c.Upstreams {
+		if len(upstream.Targets) == 0 {
+			return fmt.Errorf("upstream %s has no targets", name)
+		}
+	}
+	for i, route := range c.Routes {
+		if !strings.HasPrefix(route.Path, "/") {
+			return fmt.Errorf("route %d: path %q must start with /", i, route.Path)
+		}
+		if _, ok := c.Upstreams[route.Upstream]; !ok {
+			return fmt.Errorf("route %s: unknown upstream %q", route.Path, route.Upstream)
+		}
+	}
+	if time.Duration(c.HealthCheckInterval) <= 0 {
+		return fmt.Errorf("health_check_interval must be positive")
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Balancer spreads requests round-robin across the healthy replicas of an upstream. Replicas
+// are probed periodically, and taken out of rotation as soon as a request to them fails, until
+// their health check passes again. It implements Echo's ProxyBalancer and TargetProvider.
+type Balancer struct {
+	name       string
+	healthPath string
+	client     *http.Client // For health checks
+
+	mu      sync.Mutex
+	targets []*target
+	next    int
+}
+
+type target struct {
+	*middleware.ProxyTarget
+	healthy bool
+}
+
+// NewBalancer creates a balancer for the upstream name. client is used for the health checks.
+func NewBalancer(name, healthPath string, client *http.Client) *Balancer {
+	return &Balancer{name: name, healthPath: healthPath, client: client}
+}
+
+// AddTarget adds a replica. Replicas start healthy, so the gateway can serve before the first check.
+func (b *Balancer) AddTarget(proxyTarget *middleware.ProxyTarget) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, t := range b.targets {
+		if t.Name == proxyTarget.Name {
+			return false
+		}
+	}
+	b.targets = append(b.targets, &target{ProxyTarget: proxyTarget, healthy: true})
+	return true
+}
+
+// RemoveTarget removes the replica with the given name.
+func (b *Balancer) RemoveTarget(name string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i, t := range b.targets {
+		if t.Name == name {
+			b.targets = append(b.targets[:i], b.targets[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns the next healthy replica, or nil if there is none.
+func (b *Balancer) Next(c echo.Context) *middleware.ProxyTarget {
+	proxyTarget, _ := b.NextTarget(c)
+	return proxyTarget
+}
+
+// NextTarget returns the next healthy replica, or a 503 error if there is none.
+func (b *Balancer) NextTarget(c echo.Context) (*middleware.ProxyTarget, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for range b.targets {
+		b.next = (b.next + 1) % len(b.targets)
+		if t := b.targets[b.next]; t.healthy {
+			return t.ProxyTarget, nil
+		}
+	}
+	return nil, echo.NewHTTPError(http.StatusServiceUnavailable, "no healthy "+b.name+" replica")
+}
+
+// Check is a health check passing while at least one replica is healthy.
+func (b *Balancer) Check(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, t := range b.targets {
+		if t.healthy {
+			return nil
+		}
+	}
+	return errors.New("no healthy " + b.name + " replica")
+}
+
+// MarkDown takes a replica out of rotation until its next successful health check.
+func (b *Balancer) MarkDown(name string) {
+	b.setHealthy(name, false)
+}
+
+func (b *Balancer) setHealthy(name string, healthy bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, t := range b.targets {
+		if t.Name == name {
+			if t.healthy != healthy {
+				logger.Info().Msgf("Replica %s of %s is now healthy: %t", name, b.name, healthy)
+			}
+			t.healthy = healthy
+		}
+	}
+}
+
+// Run checks the health of every replica each interval until ctx is done.
+func (b *Balancer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		b.checkAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (b *Balancer) checkAll(ctx context.Context) {
+	b.mu.Lock()
+	targets := make([]*middleware.ProxyTarget, len(b.targets))
+	for i, t := range b.targets {
+		targets[i] = t.ProxyTarget
+	}
+	b.mu.Unlock()
+
+	for _, t := range targets {
+		b.setHealthy(t.Name, b.check(ctx, t.URL))
+	}
+}
+
+func (b *Balancer) check(ctx context.Context, target *url.URL) bool {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.JoinPath(b.healthPath).String(), nil)
+	if err != nil {
+		return false
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
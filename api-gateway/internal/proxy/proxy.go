@@ -0,0 +1,105 @@
+// Package proxy forwards requests to the upstream services, balancing them across healthy replicas.
+package proxy
+
+import (
+	"context"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"net/http"
+	"net/url"
+	"shared/logging"
+	"time"
+)
+
+var logger = logging.Logger
+
+// targetKey is the context key the proxy stores the chosen replica under.
+const targetKey = "target"
+
+// Upstream forwards requests to the replicas of one service.
+type Upstream struct {
+	Name     string
+	Balancer *Balancer
+	proxy    echo.MiddlewareFunc
+}
+
+// NewUpstream creates an upstream for the replicas at targets. transport is used to forward
+// requests, e.g. with mutual TLS, and client for the health checks.
+func NewUpstream(name string, targets []string, healthPath string, transport http.RoundTripper, client *http.Client) (*Upstream, error) {
+	balancer := NewBalancer(name, healthPath, client)
+	for _, target := range targets {
+		targetURL, err := url.Parse(target)
+		if err != nil {
+			return nil, err
+		}
+		balancer.AddTarget(&middleware.ProxyTarget{Name: target, URL: targetURL})
+	}
+
+	upstream := &Upstream{Name: name, Balancer: balancer}
+	upstream.proxy = middleware.ProxyWithConfig(middleware.ProxyConfig{
+		Balancer:   balancer,
+		Transport:  transport,
+		ContextKey: targetKey,
+		// only requests without a body can be sent again to another replica
+		RetryCount: 1,
+		RetryFilter: func(c echo.Context, err error) bool {
+			upstream.markFailed(c, err)
+			method := c.Request().Method
+			return isBadGateway(err) && (method == http.MethodGet || method == http.MethodHead)
+		},
+		ErrorHandler: upstream.handleError,
+	})
+	return upstream, nil
+}
+
+// Handler returns the handler forwarding a route's requests, cut off after timeout.
+func (u *Upstream) Handler(timeout time.Duration) echo.HandlerFunc {
+	forward := u.proxy(func(c echo.Context) error {
+		return c.JSON(404, map[string]string{"error": "Not found"})
+	})
+
+	return func(c echo.Context) error {
+		ctx, cancel := context.WithTimeout(c.Request().Context(), timeout)
+		defer cancel()
+		c.SetRequest(c.Request().WithContext(ctx))
+		return forward(c)
+	}
+}
+
+// markFailed takes the replica a request couldn't reach out of rotation. Timeouts are left
+// alone, a slow request doesn't make the replica unhealthy.
+func (u *Upstream) markFailed(c echo.Context, err error) {
+	if !isBadGateway(err) || c.Request().Context().Err() != nil {
+		return
+	}
+	if target, ok := c.Get(targetKey).(*middleware.ProxyTarget); ok && target != nil {
+		u.Balancer.MarkDown(target.Name)
+	}
+}
+
+func (u *Upstream) handleError(c echo.Context, err error) error {
+	if errors.Is(c.Request().Context().Err(), context.DeadlineExceeded) {
+		logger.Warn().Ctx(c.Request().Context()).Msgf("Request to %s %s timed out", u.Name, c.Request().URL.Path)
+		return c.JSON(504, map[string]string{"error": u.Name + " timed out"})
+	}
+
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		if httpErr.Code == middleware.StatusCodeContextCanceled {
+			return nil
+		}
+		if httpErr.Code == http.StatusServiceUnavailable {
+			return c.JSON(503, map[string]string{"error": u.Name + " is unavailable"})
+		}
+	}
+
+	u.markFailed(c, err)
+	logger.Error().Ctx(c.Request().Context()).Err(err).Msgf("Error forwarding to %s", u.Name)
+	return c.JSON(502, map[string]string{"error": u.Name + " is unreachable"})
+}
+
+func isBadGateway(err error) bool {
+	var httpErr *echo.HTTPError
+	return errors.As(err, &httpErr) && httpErr.Code == http.StatusBadGateway
+}
@@ -1,21 +1,35 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"dynamic-pricing-service/internal/api"
+	"dynamic-pricing-service/internal/config"
 	"dynamic-pricing-service/internal/repository"
 	"dynamic-pricing-service/internal/service"
+	"dynamic-pricing-service/migrations"
 	"github.com/go-redis/redis/v8"
 	_ "github.com/go-sql-driver/mysql"
-	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
-	"os"
+	"shared/auth"
+	sharedconfig "shared/config"
+	"shared/health"
+	"shared/httpclient"
+	"shared/lifecycle"
+	"shared/logging"
+	"shared/metrics"
+	"shared/mtls"
+	"shared/ratelimit"
+	"shared/sqldb"
+	"shared/tracing"
 	"time"
 )
 
-func connectDB() (*sql.DB, error) {
-	db, err := sql.Open("mysql", "root:@tcp(127.0.0.1:3306)/dynamic-pricing-db")
+var logger = logging.Logger
+
+func connectDB(database sharedconfig.Database) (*sql.DB, error) {
+	db, err := sqldb.Open("mysql", database.DSN(), database.Name)
 	if err != nil {
 		return nil, err
 	}
@@ -23,42 +37,138 @@ func connectDB() (*sql.DB, error) {
 }
 
 func main() {
-	db, err := connectDB()
+	configFile := sharedconfig.File("config.yaml")
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to load config")
+	}
+	logging.Setup("dynamic-pricing-service", cfg.Log)
+
+	// on SIGTERM requests are drained and connections closed
+	app := lifecycle.New(time.Duration(cfg.Server.ShutdownTimeout), time.Duration(cfg.Server.ShutdownDelay))
+
+	// spans are flushed after everything else is closed
+	shutdownTracing, err := tracing.Setup("dynamic-pricing-service", cfg.Tracing)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to set up tracing")
+	}
+	app.OnShutdown("tracing", shutdownTracing)
+
+	// Prometheus scrapes /metrics on its own port
+	app.Go(func(ctx context.Context) {
+		if err := metrics.Serve(ctx, cfg.Metrics.Addr()); err != nil {
+			logger.Error().Err(err).Msg("Metrics server stopped")
+		}
+	})
+
+	db, err := connectDB(cfg.Database)
 	if err != nil {
 		panic(err)
 	}
+	app.Close("database", db)
+
+	err = migrations.AutoMigrateMoneyColumns(db)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to migrate money columns")
+	}
+
+	err = migrations.AutoMigrateRuleCurrency(db)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to migrate pricing rule currency")
+	}
+
+	err = migrations.AutoMigrateCurrencyTables(db)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to migrate currency tables")
+	}
 
 	rdb := redis.NewClient(&redis.Options{
-		Addr: "localhost:6379",
+		Addr:     cfg.Redis.Addr,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
 	})
+	app.Close("redis", rdb)
+	rdb.AddHook(tracing.RedisHook())
+	// hit ratio of the pricing rule cache
+	rdb.AddHook(metrics.CacheHook("pricing_rule:"))
 
 	// Initialize product service
 	pricingRepo := repository.NewPricingRepository(db)
-	pricingService := service.NewPricingService(pricingRepo, rdb, "http://localhost:8081")
+	productClient, err := httpclient.ForService(cfg.ServiceClient, cfg.TLS, "product-catalog-service")
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to create product-catalog client")
+	}
+	// backtests read the order history from order-service
+	orderClient, err := httpclient.ForService(cfg.ServiceClient, cfg.TLS, "order-service")
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to create order-service client")
+	}
+	pricingService := service.NewPricingService(pricingRepo, rdb, cfg.ProductServiceURL, httpclient.Resilient(productClient, "product-catalog-service", cfg.HTTPClient), cfg.OrderServiceURL, httpclient.Resilient(orderClient, "order-service", cfg.HTTPClient))
 	pricingHandler := api.NewPricingHandler(pricingService)
 
+	// Load exchange rates from a file, a new version is only created if the rates changed
+	if ratesFile := cfg.ExchangeRatesFile; ratesFile != "" {
+		rates, err := pricingService.LoadExchangeRatesFile(context.Background(), ratesFile)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to load exchange rates")
+		}
+		logger.Info().Msgf("Loaded exchange rates version %d from %s", rates.Version, ratesFile)
+	}
+
 	// Initialize echo
 	e := echo.New()
+	// client IPs are only read from X-Forwarded-For when the gateway sends it
+	e.IPExtractor = cfg.Server.IPExtractor()
+
+	// a backstop per client IP, the gateway applies the limits per caller
+	limiter := ratelimit.NewLimiter(rdb, "dynamic-pricing-service", &cfg.RateLimits)
+
+	// the log level and rate limits can be changed without a restart
+	app.Go(func(ctx context.Context) {
+		sharedconfig.Watch(ctx, configFile, 10*time.Second, func(reloaded *config.Config) {
+			reloaded.Log.Apply()
+			limiter.SetConfig(&reloaded.RateLimits)
+		}, func(err error) {
+			logger.Error().Err(err).Msg("Failed to reload config, keeping the current one")
+		})
+	})
 	// Middleware
-	e.Use(middleware.Logger())
+	e.Use(logging.Middleware())
 	e.Use(middleware.Recover())
-	e.Use(echojwt.JWT([]byte("secret")))
+	e.Use(metrics.Middleware())
+	e.Use(tracing.Middleware())
+	e.Use(ratelimit.Middleware(limiter))
+	// access tokens are verified with the public keys of user-management-service
+	authenticated := auth.Verifier(auth.NewKeySet(cfg.Auth.JWKSURL), auth.NewRevocationList(rdb), "dynamic-pricing-service")
 
 	// Routes
-	e.POST("/pricing", pricingHandler.GetPricing)
+	pricingRead := []echo.MiddlewareFunc{authenticated, auth.RequirePermission("pricing:read")}
+	pricingAdmin := []echo.MiddlewareFunc{authenticated, auth.RequirePermission("pricing:admin")}
+	e.POST("/pricing", pricingHandler.GetPricing, pricingRead...)
+	pricingHandler.RegisterContract(e, pricingRead...)
+	e.POST("/pricing/simulate", pricingHandler.SimulatePricing, pricingAdmin...)
+	e.POST("/pricing/backtest", pricingHandler.BacktestPricing, pricingAdmin...)
+	e.PUT("/pricing/overrides", pricingHandler.SetPriceOverride, pricingAdmin...)
+	e.DELETE("/pricing/overrides/:product_id/:currency", pricingHandler.DeletePriceOverride, pricingAdmin...)
+	e.POST("/pricing/rates", pricingHandler.LoadExchangeRates, pricingAdmin...)
+	e.GET("/pricing/rates", pricingHandler.GetExchangeRates, pricingRead...)
+	e.GET("/pricing/rates/:version", pricingHandler.GetExchangeRates, pricingRead...)
 
-	e.GET("/pricing/health", func(c echo.Context) error {
-		return c.JSON(200, map[string]interface{}{
-			"status":  "ok",
-			"service": "dynamic-pricing-service",
-			"time":    time.Now().Format(time.RFC3339),
-		})
-	})
+	// probes don't carry tokens, so the health endpoints are open
+	checker := health.NewChecker("dynamic-pricing-service", app.Context())
+	checker.Add("mysql", true, health.DB(db))
+	checker.Add("redis", true, health.Redis(rdb))
+	checker.Add("product-catalog-service", false, health.HTTP(productClient, cfg.ProductServiceURL+"/products/health/live"))
+	checker.Add("circuit:product-catalog-service", false, httpclient.Circuit("product-catalog-service"))
+	checker.Add("order-service", false, health.HTTP(orderClient, cfg.OrderServiceURL+"/orders/health/live"))
+	checker.Add("circuit:order-service", false, httpclient.Circuit("order-service"))
+	checker.Register(e, "/pricing/health")
 
 	// Start the server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8083" // default jika PORT tidak di-set
+	err = app.Serve(e, func() error {
+		return mtls.Start(e, cfg.Server.Addr(), cfg.TLS)
+	})
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Server stopped")
 	}
-	e.Logger.Fatal(e.Start(":" + port))
 }
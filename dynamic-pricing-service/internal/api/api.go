@@ -1,8 +1,10 @@
 package api
 
 import (
+	"dynamic-pricing-service/internal/entity"
 	"dynamic-pricing-service/internal/service"
 	"github.com/labstack/echo/v4"
+	"strconv"
 )
 
 // PricingHandler handles pricing-related requests.
@@ -19,10 +21,8 @@ func NewPricingHandler(pricingService *service.PricingService) *PricingHandler {
 
 // GetPricing handles the pricing request from the Order Service.
 func (h *PricingHandler) GetPricing(c echo.Context) error {
-	// Get the product ID and quantity from the request
-	var pricingRequest struct {
-		ProductID int `json:"product_id"`
-	}
+	// Get the product ID and currency from the request
+	var pricingRequest entity.PricingRequest
 
 	if err := c.Bind(&pricingRequest); err != nil {
 		return c.JSON(400, map[string]string{"error": "invalid request payload"})
@@ -30,7 +30,7 @@ func (h *PricingHandler) GetPricing(c echo.Context) error {
 	}
 
 	// Calculate the pricing
-	pricing, err := h.pricingService.CalculatePricing(c.Request().Context(), pricingRequest.ProductID)
+	pricing, err := h.pricingService.CalculatePricing(c.Request().Context(), &pricingRequest)
 	if err != nil {
 		return c.JSON(500, map[string]string{"error": err.Error()})
 
@@ -39,3 +39,101 @@ func (h *PricingHandler) GetPricing(c echo.Context) error {
 	// Return the pricing
 	return c.JSON(200, pricing)
 }
+
+// SimulatePricing previews prices for proposed rules and stock levels --> /pricing/simulate
+func (h *PricingHandler) SimulatePricing(c echo.Context) error {
+	var simulationRequest entity.SimulationRequest
+	if err := c.Bind(&simulationRequest); err != nil {
+		return c.JSON(400, map[string]string{"error": "invalid request payload"})
+	}
+
+	result, err := h.pricingService.Simulate(c.Request().Context(), &simulationRequest)
+	if err != nil {
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(200, result)
+}
+
+// BacktestPricing replays the orders of a period against proposed rules --> /pricing/backtest
+func (h *PricingHandler) BacktestPricing(c echo.Context) error {
+	var backtestRequest entity.BacktestRequest
+	if err := c.Bind(&backtestRequest); err != nil {
+		return c.JSON(400, map[string]string{"error": "invalid request payload"})
+	}
+	if backtestRequest.From.IsZero() || !backtestRequest.From.Before(backtestRequest.To) {
+		return c.JSON(400, map[string]string{"error": "from and to are required, from before to"})
+	}
+
+	result, err := h.pricingService.Backtest(c.Request().Context(), &backtestRequest)
+	if err != nil {
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(200, result)
+}
+
+// SetPriceOverride sets the price of a product in a currency --> /pricing/overrides
+func (h *PricingHandler) SetPriceOverride(c echo.Context) error {
+	var override entity.PriceOverride
+	if err := c.Bind(&override); err != nil {
+		return c.JSON(400, map[string]string{"error": "invalid request payload"})
+	}
+
+	if err := h.pricingService.SetPriceOverride(c.Request().Context(), &override); err != nil {
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(200, override)
+}
+
+// DeletePriceOverride removes the price of a product in a currency --> /pricing/overrides/:product_id/:currency
+func (h *PricingHandler) DeletePriceOverride(c echo.Context) error {
+	productID, err := strconv.Atoi(c.Param("product_id"))
+	if err != nil {
+		return c.JSON(400, map[string]string{"error": "invalid product ID"})
+	}
+
+	if err := h.pricingService.DeletePriceOverride(c.Request().Context(), productID, c.Param("currency")); err != nil {
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(200, map[string]string{"message": "price override deleted"})
+}
+
+// LoadExchangeRates stores a new version of the exchange rates --> /pricing/rates
+func (h *PricingHandler) LoadExchangeRates(c echo.Context) error {
+	var rates entity.ExchangeRateSet
+	if err := c.Bind(&rates); err != nil {
+		return c.JSON(400, map[string]string{"error": "invalid request payload"})
+	}
+	if rates.Source == "" {
+		rates.Source = "api"
+	}
+
+	stored, err := h.pricingService.LoadExchangeRates(c.Request().Context(), &rates)
+	if err != nil {
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(200, stored)
+}
+
+// GetExchangeRates returns the latest exchange rates or a specific version --> /pricing/rates[/:version]
+func (h *PricingHandler) GetExchangeRates(c echo.Context) error {
+	version := 0
+	if param := c.Param("version"); param != "" {
+		var err error
+		version, err = strconv.Atoi(param)
+		if err != nil {
+			return c.JSON(400, map[string]string{"error": "invalid rate version"})
+		}
+	}
+
+	rates, err := h.pricingService.GetExchangeRates(c.Request().Context(), version)
+	if err != nil {
+		return c.JSON(404, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(200, rates)
+}
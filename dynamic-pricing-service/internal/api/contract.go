@@ -0,0 +1,75 @@
+package api
+
+import (
+	"dynamic-pricing-service/internal/entity"
+	"dynamic-pricing-service/internal/repository"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"shared/pricing"
+)
+
+// RegisterContract adds the routes of the versioned pricing contract, see shared/pricing.
+// middlewares apply to all of them.
+func (h *PricingHandler) RegisterContract(e *echo.Echo, middlewares ...echo.MiddlewareFunc) {
+	e.POST(pricing.QuotePath, h.Quote, middlewares...)
+	e.POST(pricing.CartPath, h.PriceCart, middlewares...)
+}
+
+// Quote returns the price of one unit of a product --> /pricing/v1/quote
+func (h *PricingHandler) Quote(c echo.Context) error {
+	var quoteRequest pricing.QuoteRequest
+	if err := c.Bind(&quoteRequest); err != nil {
+		return contractError(c, http.StatusBadRequest, "invalid request payload")
+	}
+	if quoteRequest.ProductID <= 0 {
+		return contractError(c, http.StatusBadRequest, "product_id is required")
+	}
+
+	productPricing, err := h.pricingService.CalculatePricing(c.Request().Context(), &entity.PricingRequest{
+		ProductID:   quoteRequest.ProductID,
+		Currency:    quoteRequest.Currency,
+		RateVersion: quoteRequest.RateVersion,
+	})
+	if err != nil {
+		return pricingError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, productPricing.Quote())
+}
+
+// PriceCart returns the prices of all items of a cart --> /pricing/v1/cart
+func (h *PricingHandler) PriceCart(c echo.Context) error {
+	var cartRequest pricing.CartRequest
+	if err := c.Bind(&cartRequest); err != nil {
+		return contractError(c, http.StatusBadRequest, "invalid request payload")
+	}
+	if len(cartRequest.Items) == 0 {
+		return contractError(c, http.StatusBadRequest, "items are required")
+	}
+	for i, item := range cartRequest.Items {
+		if item.ProductID <= 0 || item.Quantity <= 0 {
+			return contractError(c, http.StatusBadRequest, fmt.Sprintf("item %d needs a product_id and a positive quantity", i))
+		}
+	}
+
+	cart, err := h.pricingService.PriceCart(c.Request().Context(), &cartRequest)
+	if err != nil {
+		return pricingError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, cart)
+}
+
+// pricingError answers with 404 for products without a pricing rule, 500 for other failures.
+func pricingError(c echo.Context, err error) error {
+	if errors.Is(err, repository.ErrPricingRuleNotFound) {
+		return contractError(c, http.StatusNotFound, err.Error())
+	}
+	return contractError(c, http.StatusInternalServerError, err.Error())
+}
+
+func contractError(c echo.Context, status int, message string) error {
+	return c.JSON(status, pricing.Error{Message: message})
+}
@@ -0,0 +1,215 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"dynamic-pricing-service/internal/api"
+	"dynamic-pricing-service/internal/repository"
+	"dynamic-pricing-service/internal/service"
+	"encoding/json"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"shared/money"
+	"shared/pricing"
+	"slices"
+	"testing"
+	"time"
+)
+
+// The contract tests call an in-process dynamic-pricing-service through the shared client, with
+// MySQL and Redis faked and product-catalog-service answering a stock of 10 for every product.
+// They fail when the routes, the JSON of requests and responses or the error statuses drift
+// from shared/pricing.
+
+type contract struct {
+	mock   sqlmock.Sqlmock
+	client *pricing.Client
+	url    string
+}
+
+func newContract(t *testing.T) *contract {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	products := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"stock": 10}`))
+	}))
+	t.Cleanup(products.Close)
+
+	pricingService := service.NewPricingService(repository.NewPricingRepository(db), rdb, products.URL, products.Client(), products.URL, products.Client())
+	e := echo.New()
+	api.NewPricingHandler(pricingService).RegisterContract(e)
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	return &contract{mock: mock, client: pricing.NewClient(server.URL, server.Client()), url: server.URL}
+}
+
+// expectRule lets the rule of a product be read: 100.00 USD with 10% markup and 5% discount,
+// raised by 5% and lowered by 5% below a stock of 5.
+func (c *contract) expectRule(productID int) {
+	c.mock.ExpectQuery(regexp.QuoteMeta("FROM pricing_rules WHERE product_id = ?")).
+		WithArgs(productID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "product_id", "currency", "product_price", "default_markup", "default_discount", "stock_threshold", "markup_increase", "discount_reduction"}).
+			AddRow(1, productID, "USD", "100.00", 0.1, 0.05, 5, 0.05, 0.05))
+}
+
+func (c *contract) expectNoRule(productID int) {
+	c.mock.ExpectQuery(regexp.QuoteMeta("FROM pricing_rules WHERE product_id = ?")).
+		WithArgs(productID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+}
+
+// expectConversion lets a price of productID be converted to EUR with version 3 of the exchange
+// rates, 0.9 EUR per USD. latest expects the latest version to be looked up first.
+func (c *contract) expectConversion(productID int, latest bool) {
+	c.mock.ExpectQuery(regexp.QuoteMeta("FROM price_overrides WHERE product_id = ? AND currency = ?")).
+		WithArgs(productID, "EUR").
+		WillReturnRows(sqlmock.NewRows([]string{"product_id", "currency", "price"}))
+	if latest {
+		c.mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(MAX(version), 0) FROM exchange_rates")).
+			WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
+	}
+	c.mock.ExpectQuery(regexp.QuoteMeta("FROM exchange_rates WHERE version = ?")).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"base", "currency", "rate", "source", "created_at"}).
+			AddRow("USD", "EUR", 0.9, "test", time.Now()))
+}
+
+func TestQuote(t *testing.T) {
+	c := newContract(t)
+	c.expectRule(7)
+
+	quote, err := c.client.Quote(context.Background(), pricing.QuoteRequest{ProductID: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 100.00 * 1.1 * 0.95
+	want := pricing.Quote{ProductID: 7, Markup: 0.1, Discount: 0.05, UnitPrice: money.New(10450, "USD"), ExchangeRate: 1}
+	if *quote != want {
+		t.Errorf("got %+v, want %+v", *quote, want)
+	}
+}
+
+func TestQuoteConverted(t *testing.T) {
+	c := newContract(t)
+	c.expectRule(7)
+	c.expectConversion(7, true)
+
+	quote, err := c.client.Quote(context.Background(), pricing.QuoteRequest{ProductID: 7, Currency: "EUR"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if quote.UnitPrice != money.New(9405, "EUR") || quote.ExchangeRate != 0.9 || quote.RateVersion != 3 {
+		t.Errorf("got %+v, want 94.05 EUR at rate 0.9 of version 3", *quote)
+	}
+}
+
+func TestQuoteNotFound(t *testing.T) {
+	c := newContract(t)
+	c.expectNoRule(8)
+
+	_, err := c.client.Quote(context.Background(), pricing.QuoteRequest{ProductID: 8})
+	if !errors.Is(err, pricing.ErrNotFound) {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+}
+
+func TestPriceCart(t *testing.T) {
+	c := newContract(t)
+	c.expectRule(7)
+	c.expectConversion(7, true)
+	// the second product is converted with the version of the first one
+	c.expectRule(9)
+	c.expectConversion(9, false)
+
+	cart, err := c.client.PriceCart(context.Background(), pricing.CartRequest{
+		Currency: "eur",
+		Items:    []pricing.CartItem{{ProductID: 7, Quantity: 2}, {ProductID: 9, Quantity: 1}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cart.Currency != "EUR" || cart.RateVersion != 3 || len(cart.Lines) != 2 {
+		t.Fatalf("got %+v, want 2 lines in EUR with version 3", *cart)
+	}
+	if line := cart.Lines[0]; line.ProductID != 7 || line.Quantity != 2 || line.UnitPrice != money.New(9405, "EUR") || line.Total != money.New(18810, "EUR") {
+		t.Errorf("first line is %+v, want 2 x 94.05 EUR", line)
+	}
+	if line := cart.Lines[1]; line.ProductID != 9 || line.Total != money.New(9405, "EUR") {
+		t.Errorf("second line is %+v, want 1 x 94.05 EUR", line)
+	}
+	if cart.Total != money.New(28215, "EUR") {
+		t.Errorf("total is %s, want 282.15 EUR", cart.Total)
+	}
+}
+
+func TestPriceCartInvalid(t *testing.T) {
+	c := newContract(t)
+
+	for _, req := range []pricing.CartRequest{
+		{},
+		{Items: []pricing.CartItem{{ProductID: 7}}},
+		{Items: []pricing.CartItem{{Quantity: 1}}},
+	} {
+		_, err := c.client.PriceCart(context.Background(), req)
+		if !errors.Is(err, pricing.ErrInvalidRequest) {
+			t.Errorf("%+v: got %v, want ErrInvalidRequest", req, err)
+		}
+	}
+}
+
+// TestFields pins the JSON field names, which the typed tests can't see change when both sides
+// rename a field.
+func TestFields(t *testing.T) {
+	c := newContract(t)
+	c.expectRule(7)
+
+	resp, err := http.Post(c.url+pricing.CartPath, "application/json", bytes.NewBufferString(`{"currency": "USD", "items": [{"product_id": 7, "quantity": 1}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var fields map[string]json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&fields); err != nil {
+		t.Fatal(err)
+	}
+	var lines []map[string]json.RawMessage
+	if err := json.Unmarshal(fields["lines"], &lines); err != nil || len(lines) != 1 {
+		t.Fatalf("lines are %s", fields["lines"])
+	}
+
+	assertFields(t, "cart", fields, "currency", "lines", "rate_version", "total")
+	assertFields(t, "line", lines[0], "discount", "exchange_rate", "markup", "product_id", "quantity", "rate_version", "total", "unit_price")
+}
+
+func assertFields(t *testing.T, name string, fields map[string]json.RawMessage, want ...string) {
+	t.Helper()
+	if got := slices.Sorted(maps.Keys(fields)); !slices.Equal(got, want) {
+		t.Errorf("%s has fields %v, want %v", name, got, want)
+	}
+}
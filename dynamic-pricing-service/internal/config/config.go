@@ -0,0 +1,48 @@
+// Package config is the configuration of dynamic-pricing-service.
+package config
+
+import (
+	sharedconfig "shared/config"
+	"shared/httpclient"
+	"shared/logging"
+	"shared/metrics"
+	"shared/mtls"
+	"shared/ratelimit"
+	"shared/tracing"
+)
+
+type Config struct {
+	Server        sharedconfig.Server    `yaml:"server"`
+	Log           logging.Config         `yaml:"log"`
+	Metrics       metrics.Config         `yaml:"metrics"`
+	Tracing       tracing.Config         `yaml:"tracing"`
+	Database      sharedconfig.Database  `yaml:"database" env:"DB_"`
+	Redis         sharedconfig.Redis     `yaml:"redis"`
+	RateLimits    ratelimit.Config       `yaml:"rate_limits"`
+	Auth          sharedconfig.Auth      `yaml:"auth"`
+	TLS           mtls.Files             `yaml:"tls"`
+	ServiceClient httpclient.Credentials `yaml:"service_client"`
+	HTTPClient    httpclient.Policy      `yaml:"http_client"`
+
+	ProductServiceURL string `yaml:"product_service_url" env:"PRODUCT_SERVICE_URL" default:"http://localhost:8081"`
+	// Order history is read from it for backtests
+	OrderServiceURL string `yaml:"order_service_url" env:"ORDER_SERVICE_URL" default:"http://localhost:8082"`
+	// Optional, loaded at startup. A new version is only created if the rates changed.
+	ExchangeRatesFile string `yaml:"exchange_rates_file" env:"EXCHANGE_RATES_FILE"`
+}
+
+// Load reads and checks the config file, see sharedconfig.Load.
+func Load(path string) (*Config, error) {
+	config := &Config{}
+	if err := sharedconfig.Load(path, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (c *Config) Validate() error {
+	if err := sharedconfig.URL("product_service_url", c.ProductServiceURL); err != nil {
+		return err
+	}
+	return sharedconfig.URL("order_service_url", c.OrderServiceURL)
+}
@@ -0,0 +1,77 @@
+package entity
+
+import (
+	"shared/money"
+	"time"
+)
+
+// PricingRequest asks for the price of a product, optionally in another currency.
+type PricingRequest struct {
+	ProductID   int    `json:"product_id"`
+	Currency    string `json:"currency"`     // Defaults to the currency of the pricing rule
+	RateVersion int    `json:"rate_version"` // Exchange rate version to use, 0 for the latest
+}
+
+// PriceOverride is a base price for a product in a specific currency. It replaces the converted
+// rule price, so markets can be priced independently of exchange rates.
+type PriceOverride struct {
+	ProductID int         `json:"product_id"`
+	Price     money.Money `json:"price"`
+}
+
+// ExchangeRateSet is one version of the exchange rate table. Rates are the number of units of
+// each currency per unit of the base currency. Versions are never modified, so an order can
+// always be repriced with the rates it was created with.
+type ExchangeRateSet struct {
+	Version   int                `json:"version"`
+	Base      string             `json:"base"`
+	Source    string             `json:"source"`
+	Rates     map[string]float64 `json:"rates"`
+	CreatedAt time.Time          `json:"created_at"`
+}
+
+// Rate returns the rate to convert from one currency to another, going through the base currency.
+func (s *ExchangeRateSet) Rate(from, to string) (float64, bool) {
+	if from == to {
+		return 1, true
+	}
+	fromRate, ok := s.baseRate(from)
+	if !ok {
+		return 0, false
+	}
+	toRate, ok := s.baseRate(to)
+	if !ok {
+		return 0, false
+	}
+	return toRate / fromRate, true
+}
+
+func (s *ExchangeRateSet) baseRate(currency string) (float64, bool) {
+	if currency == s.Base {
+		return 1, true
+	}
+	rate, ok := s.Rates[currency]
+	return rate, ok && rate > 0
+}
+
+/*
+Mysql Table
+
+CREATE TABLE price_overrides (
+	product_id INT NOT NULL,
+	currency CHAR(3) NOT NULL,
+	price DECIMAL(19,4) NOT NULL,
+	PRIMARY KEY (product_id, currency)
+);
+
+CREATE TABLE exchange_rates (
+	version INT NOT NULL,
+	base CHAR(3) NOT NULL,
+	currency CHAR(3) NOT NULL,
+	rate DECIMAL(19,8) NOT NULL,
+	source VARCHAR(255) NOT NULL,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (version, currency)
+);
+
+*/
@@ -1,9 +1,29 @@
 package entity
 
+import (
+	"shared/money"
+	"shared/pricing"
+)
+
 // Pricing represents the pricing data for a product.
 type Pricing struct {
-	ProductID  int     `json:"product_id"`
-	Markup     float64 `json:"markup"`      // Markup percentage
-	Discount   float64 `json:"discount"`    // Discount percentage
-	FinalPrice float64 `json:"final_price"` // Calculated final price
+	ProductID  int         `json:"product_id"`
+	Markup     float64     `json:"markup"`      // Markup percentage
+	Discount   float64     `json:"discount"`    // Discount percentage
+	FinalPrice money.Money `json:"final_price"` // Calculated final price
+
+	ExchangeRate float64 `json:"exchange_rate"`          // Rate applied to convert the rule price, 1 if none
+	RateVersion  int     `json:"rate_version,omitempty"` // Exchange rate version used for the conversion
+}
+
+// Quote returns the pricing as the quote of the pricing contract.
+func (p *Pricing) Quote() pricing.Quote {
+	return pricing.Quote{
+		ProductID:    p.ProductID,
+		Markup:       p.Markup,
+		Discount:     p.Discount,
+		UnitPrice:    p.FinalPrice,
+		ExchangeRate: p.ExchangeRate,
+		RateVersion:  p.RateVersion,
+	}
 }
@@ -0,0 +1,70 @@
+package entity
+
+import (
+	"shared/money"
+	"time"
+)
+
+// SimulationRequest describes a what-if pricing run. Rules in the request override the
+// live rules for their product, and Stock overrides the live stock level per product ID.
+type SimulationRequest struct {
+	ProductIDs []int         `json:"product_ids"`
+	Rules      []PricingRule `json:"rules"`
+	Stock      map[int]int   `json:"stock"` // Hypothetical stock levels keyed by product ID
+}
+
+// SimulationResult holds the simulated pricing for every requested product.
+type SimulationResult struct {
+	Prices []SimulatedPricing `json:"prices"`
+}
+
+// SimulatedPricing is the pricing for a product under a simulation, along with the inputs used.
+type SimulatedPricing struct {
+	Pricing
+	Stock        int  `json:"stock"`
+	ProposedRule bool `json:"proposed_rule"` // True if a rule from the request was used
+}
+
+// BacktestRequest replays the orders placed from From up to but excluding To against a proposed
+// rule set. The orders are read from the order service.
+type BacktestRequest struct {
+	SimulationRequest
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// HistoricalOrder is an order as recorded by the order service.
+type HistoricalOrder struct {
+	OrderID         int                 `json:"order_id"`
+	ProductRequests []HistoricalRequest `json:"product_requests"`
+	Total           money.Money         `json:"total"`
+	Status          string              `json:"status"`
+}
+
+// HistoricalRequest is a product line of a historical order. FinalPrice is the line total, in the
+// currency of the order.
+type HistoricalRequest struct {
+	ProductID    int         `json:"product_id"`
+	Quantity     int         `json:"quantity"`
+	FinalPrice   money.Money `json:"final_price"`
+	ExchangeRate float64     `json:"exchange_rate"` // Rate the price was converted into the order currency with
+}
+
+// BacktestResult summarizes the revenue impact of a proposed rule set.
+type BacktestResult struct {
+	OrdersReplayed   int               `json:"orders_replayed"`
+	OrdersSkipped    int               `json:"orders_skipped"` // Cancelled orders are not replayed, nor lines without an exchange rate
+	ActualRevenue    money.Money       `json:"actual_revenue"`
+	SimulatedRevenue money.Money       `json:"simulated_revenue"`
+	RevenueDelta     money.Money       `json:"revenue_delta"`
+	Products         []ProductBacktest `json:"products"`
+}
+
+// ProductBacktest is the revenue impact of a proposed rule set for a single product.
+type ProductBacktest struct {
+	ProductID        int         `json:"product_id"`
+	QuantitySold     int         `json:"quantity_sold"`
+	ActualRevenue    money.Money `json:"actual_revenue"`
+	SimulatedRevenue money.Money `json:"simulated_revenue"`
+	RevenueDelta     money.Money `json:"revenue_delta"`
+}
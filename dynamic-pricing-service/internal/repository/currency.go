@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"dynamic-pricing-service/internal/entity"
+	"errors"
+	"fmt"
+	"shared/money"
+)
+
+// UpsertPriceOverride creates or replaces the price of a product in the override's currency
+func (r *PricingRepository) UpsertPriceOverride(ctx context.Context, override *entity.PriceOverride) error {
+	query := `INSERT INTO price_overrides (product_id, currency, price) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE price = VALUES(price)`
+	_, err := r.db.ExecContext(ctx, query, override.ProductID, override.Price.Currency(), override.Price)
+	return err
+}
+
+// DeletePriceOverride deletes the price override of a product in a currency
+func (r *PricingRepository) DeletePriceOverride(ctx context.Context, productID int, currency string) error {
+	query := `DELETE FROM price_overrides WHERE product_id = ? AND currency = ?`
+	_, err := r.db.ExecContext(ctx, query, productID, currency)
+	return err
+}
+
+// GetPriceOverride fetches the price override of a product in a currency. It returns nil if there is none.
+func (r *PricingRepository) GetPriceOverride(ctx context.Context, productID int, currency string) (*entity.PriceOverride, error) {
+	query := `SELECT product_id, currency, price FROM price_overrides WHERE product_id = ? AND currency = ?`
+	override := entity.PriceOverride{}
+	var overrideCurrency string
+	err := r.db.QueryRowContext(ctx, query, productID, currency).Scan(&override.ProductID, &overrideCurrency, money.ScanIn(&overrideCurrency, &override.Price))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &override, nil
+}
+
+// CreateExchangeRateSet stores a new version of the exchange rate table and sets its version
+func (r *PricingRepository) CreateExchangeRateSet(ctx context.Context, set *entity.ExchangeRateSet) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	// Lock the latest version so concurrent loads get distinct versions
+	var latest int
+	err = tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM exchange_rates FOR UPDATE`).Scan(&latest)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	set.Version = latest + 1
+
+	query := `INSERT INTO exchange_rates (version, base, currency, rate, source) VALUES (?, ?, ?, ?, ?)`
+	for currency, rate := range set.Rates {
+		_, err := tx.ExecContext(ctx, query, set.Version, set.Base, currency, rate, set.Source)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetExchangeRateSet fetches a version of the exchange rate table, or the latest one if version is 0
+func (r *PricingRepository) GetExchangeRateSet(ctx context.Context, version int) (*entity.ExchangeRateSet, error) {
+	if version == 0 {
+		err := r.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM exchange_rates`).Scan(&version)
+		if err != nil {
+			return nil, err
+		}
+		if version == 0 {
+			return nil, fmt.Errorf("no exchange rates loaded")
+		}
+	}
+
+	query := `SELECT base, currency, rate, source, created_at FROM exchange_rates WHERE version = ?`
+	rows, err := r.db.QueryContext(ctx, query, version)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	set := &entity.ExchangeRateSet{Version: version, Rates: map[string]float64{}}
+	for rows.Next() {
+		var currency string
+		var rate float64
+		err := rows.Scan(&set.Base, &currency, &rate, &set.Source, &set.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		set.Rates[currency] = rate
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(set.Rates) == 0 {
+		return nil, fmt.Errorf("exchange rate version %d not found", version)
+	}
+	return set, nil
+}
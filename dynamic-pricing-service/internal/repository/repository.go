@@ -6,8 +6,12 @@ import (
 	"dynamic-pricing-service/internal/entity"
 	"errors"
 	"fmt"
+	"shared/money"
 )
 
+// ErrPricingRuleNotFound is returned for products without a pricing rule.
+var ErrPricingRuleNotFound = errors.New("pricing rule not found")
+
 // PricingRepository handles the interactions with the pricing rules database.
 type PricingRepository struct {
 	db *sql.DB
@@ -20,16 +24,16 @@ func NewPricingRepository(db *sql.DB) *PricingRepository {
 
 // CreatePricingRule creates a new pricing rule in the database
 func (r *PricingRepository) CreatePricingRule(ctx context.Context, rule *entity.PricingRule) error {
-	query := `INSERT INTO pricing_rules (product_id, product_price, default_markup, default_discount, stock_threshold, markup_increase, discount_reduction)
-		VALUES (?, ?, ?, ?, ?, ?, ?)`
-	_, err := r.db.ExecContext(ctx, query, rule.ProductID, rule.ProductPrice, rule.DefaultMarkup, rule.DefaultDiscount, rule.StockThreshold, rule.MarkupIncrease, rule.DiscountReduction)
+	query := `INSERT INTO pricing_rules (product_id, currency, product_price, default_markup, default_discount, stock_threshold, markup_increase, discount_reduction)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := r.db.ExecContext(ctx, query, rule.ProductID, rule.ProductPrice.Currency(), rule.ProductPrice, rule.DefaultMarkup, rule.DefaultDiscount, rule.StockThreshold, rule.MarkupIncrease, rule.DiscountReduction)
 	return err
 }
 
 // UpdatePricingRule updates an existing pricing rule in the database
 func (r *PricingRepository) UpdatePricingRule(ctx context.Context, rule *entity.PricingRule) error {
-	query := `UPDATE pricing_rules SET product_price = ?, default_markup = ?, default_discount = ?, stock_threshold = ?, markup_increase = ?, discount_reduction = ? WHERE product_id = ?`
-	_, err := r.db.ExecContext(ctx, query, rule.ProductPrice, rule.DefaultMarkup, rule.DefaultDiscount, rule.StockThreshold, rule.MarkupIncrease, rule.DiscountReduction, rule.ProductID)
+	query := `UPDATE pricing_rules SET currency = ?, product_price = ?, default_markup = ?, default_discount = ?, stock_threshold = ?, markup_increase = ?, discount_reduction = ? WHERE product_id = ?`
+	_, err := r.db.ExecContext(ctx, query, rule.ProductPrice.Currency(), rule.ProductPrice, rule.DefaultMarkup, rule.DefaultDiscount, rule.StockThreshold, rule.MarkupIncrease, rule.DiscountReduction, rule.ProductID)
 	return err
 }
 
@@ -42,14 +46,15 @@ func (r *PricingRepository) DeletePricingRule(ctx context.Context, productID int
 
 // GetPricingRule fetches the pricing rule for a specific product from the database
 func (r *PricingRepository) GetPricingRule(ctx context.Context, productID int) (*entity.PricingRule, error) {
-	query := `SELECT id, product_id, product_price, default_markup, default_discount, stock_threshold, markup_increase, discount_reduction 
+	query := `SELECT id, product_id, currency, product_price, default_markup, default_discount, stock_threshold, markup_increase, discount_reduction 
 		FROM pricing_rules WHERE product_id = ?`
 	row := r.db.QueryRowContext(ctx, query, productID)
 	var rule entity.PricingRule
-	err := row.Scan(&rule.ID, &rule.ProductID, &rule.ProductPrice, &rule.DefaultMarkup, &rule.DefaultDiscount, &rule.StockThreshold, &rule.MarkupIncrease, &rule.DiscountReduction)
+	var currency string
+	err := row.Scan(&rule.ID, &rule.ProductID, &currency, money.ScanIn(&currency, &rule.ProductPrice), &rule.DefaultMarkup, &rule.DefaultDiscount, &rule.StockThreshold, &rule.MarkupIncrease, &rule.DiscountReduction)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("pricing rule not found for product %d", productID)
+			return nil, fmt.Errorf("%w for product %d", ErrPricingRuleNotFound, productID)
 		}
 		return nil, err
 	}
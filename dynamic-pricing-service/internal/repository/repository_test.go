@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"dynamic-pricing-service/internal/entity"
+	"github.com/DATA-DOG/go-sqlmock"
+	"regexp"
+	"shared/money"
+	"testing"
+)
+
+func TestPricingRuleCurrency(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	repo := NewPricingRepository(db)
+
+	price := money.New(8990, "EUR")
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO pricing_rules (product_id, currency, product_price")).
+		WithArgs(7, "EUR", price, 0.1, 0.05, 5, 0.05, 0.05).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE pricing_rules SET currency = ?, product_price = ?")).
+		WithArgs("EUR", price, 0.1, 0.05, 5, 0.05, 0.05, 7).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM pricing_rules WHERE product_id = ?")).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "product_id", "currency", "product_price", "default_markup", "default_discount", "stock_threshold", "markup_increase", "discount_reduction"}).
+			AddRow(1, 7, "EUR", "89.90", 0.1, 0.05, 5, 0.05, 0.05))
+
+	rule := &entity.PricingRule{ProductID: 7, ProductPrice: price, DefaultMarkup: 0.1, DefaultDiscount: 0.05, StockThreshold: 5, MarkupIncrease: 0.05, DiscountReduction: 0.05}
+	if err := repo.CreatePricingRule(context.Background(), rule); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UpdatePricingRule(context.Background(), rule); err != nil {
+		t.Fatal(err)
+	}
+
+	// the price reads back in the currency it was stored in, not the default one
+	stored, err := repo.GetPricingRule(context.Background(), 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.ProductPrice != price {
+		t.Errorf("price read back as %s, want %s", stored.ProductPrice, price)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
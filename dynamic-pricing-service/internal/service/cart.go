@@ -0,0 +1,40 @@
+package service
+
+import (
+	"context"
+	"dynamic-pricing-service/internal/entity"
+	"shared/money"
+	"shared/pricing"
+)
+
+// PriceCart prices all items of a cart in its currency. Once a price was converted, the others are
+// converted with the same exchange rate version, so rates loaded meanwhile don't split the cart.
+func (s *PricingService) PriceCart(ctx context.Context, req *pricing.CartRequest) (*pricing.Cart, error) {
+	currency := money.Zero(req.Currency).Currency()
+	cart := &pricing.Cart{
+		Currency:    currency,
+		RateVersion: req.RateVersion,
+		Lines:       make([]pricing.CartLine, 0, len(req.Items)),
+		Total:       money.Zero(currency),
+	}
+
+	for _, item := range req.Items {
+		productPricing, err := s.CalculatePricing(ctx, &entity.PricingRequest{ProductID: item.ProductID, Currency: currency, RateVersion: cart.RateVersion})
+		if err != nil {
+			return nil, err
+		}
+		if productPricing.RateVersion != 0 {
+			cart.RateVersion = productPricing.RateVersion
+		}
+
+		line := pricing.CartLine{
+			Quote:    productPricing.Quote(),
+			Quantity: item.Quantity,
+			Total:    productPricing.FinalPrice.MulInt(item.Quantity),
+		}
+		cart.Lines = append(cart.Lines, line)
+		cart.Total = cart.Total.Add(line.Total)
+	}
+
+	return cart, nil
+}
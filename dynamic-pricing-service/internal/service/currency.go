@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"dynamic-pricing-service/internal/entity"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// rateScale is the number of decimals the exchange_rates table keeps of a rate, DECIMAL(19,8).
+const rateScale = 8
+
+// convertPricing converts a calculated price to the requested currency with the given exchange
+// rate version, or the latest one if version is 0.
+func (s *PricingService) convertPricing(ctx context.Context, pricing *entity.Pricing, currency string, version int) (*entity.Pricing, error) {
+	from := pricing.FinalPrice.Currency()
+	if currency == "" || currency == from {
+		return pricing, nil
+	}
+
+	rates, err := s.pricingRepo.GetExchangeRateSet(ctx, version)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch exchange rates: %v", err)
+	}
+
+	rate, ok := rates.Rate(from, currency)
+	if !ok {
+		return nil, fmt.Errorf("no exchange rate from %s to %s in version %d", from, currency, rates.Version)
+	}
+
+	converted, err := pricing.FinalPrice.Convert(currency, rate)
+	if err != nil {
+		return nil, fmt.Errorf("could not convert from %s to %s: %w", from, currency, err)
+	}
+	pricing.FinalPrice = converted
+	pricing.ExchangeRate = rate
+	pricing.RateVersion = rates.Version
+	return pricing, nil
+}
+
+// SetPriceOverride sets the base price of a product in a specific currency.
+func (s *PricingService) SetPriceOverride(ctx context.Context, override *entity.PriceOverride) error {
+	if override.ProductID == 0 {
+		return fmt.Errorf("product_id is required")
+	}
+	if override.Price.IsZero() || override.Price.IsNegative() {
+		return fmt.Errorf("price must be positive")
+	}
+	return s.pricingRepo.UpsertPriceOverride(ctx, override)
+}
+
+// DeletePriceOverride removes the price override of a product in a currency.
+func (s *PricingService) DeletePriceOverride(ctx context.Context, productID int, currency string) error {
+	return s.pricingRepo.DeletePriceOverride(ctx, productID, strings.ToUpper(currency))
+}
+
+// GetExchangeRates returns a version of the exchange rate table, or the latest one if version is 0.
+func (s *PricingService) GetExchangeRates(ctx context.Context, version int) (*entity.ExchangeRateSet, error) {
+	return s.pricingRepo.GetExchangeRateSet(ctx, version)
+}
+
+// LoadExchangeRates stores the rates as a new version, unless they match the latest version.
+func (s *PricingService) LoadExchangeRates(ctx context.Context, rates *entity.ExchangeRateSet) (*entity.ExchangeRateSet, error) {
+	rates.Base = strings.ToUpper(rates.Base)
+	if len(rates.Base) != 3 {
+		return nil, fmt.Errorf("base must be a 3-letter currency code")
+	}
+	if len(rates.Rates) == 0 {
+		return nil, fmt.Errorf("rates are required")
+	}
+
+	normalized := make(map[string]float64, len(rates.Rates))
+	for currency, rate := range rates.Rates {
+		currency = strings.ToUpper(currency)
+		if len(currency) != 3 || rate <= 0 {
+			return nil, fmt.Errorf("invalid rate %v for %s", rate, currency)
+		}
+		normalized[currency] = rate
+	}
+	rates.Rates = normalized
+
+	// Don't create a new version if nothing changed, so reloading the same file is a no-op
+	latest, err := s.pricingRepo.GetExchangeRateSet(ctx, 0)
+	if err == nil && latest.Base == rates.Base && sameRates(latest.Rates, rates.Rates) {
+		return latest, nil
+	}
+
+	if err := s.pricingRepo.CreateExchangeRateSet(ctx, rates); err != nil {
+		return nil, fmt.Errorf("could not store exchange rates: %v", err)
+	}
+	return rates, nil
+}
+
+// LoadExchangeRatesFile loads exchange rates from a JSON file, e.g.
+// {"base": "USD", "source": "ecb-2025-01-31", "rates": {"EUR": 0.92, "IDR": 15650}}.
+func (s *PricingService) LoadExchangeRatesFile(ctx context.Context, path string) (*entity.ExchangeRateSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rates entity.ExchangeRateSet
+	if err := json.Unmarshal(data, &rates); err != nil {
+		return nil, fmt.Errorf("could not parse exchange rates file %s: %v", path, err)
+	}
+	if rates.Source == "" {
+		rates.Source = path
+	}
+
+	return s.LoadExchangeRates(ctx, &rates)
+}
+
+// sameRates reports whether two rate tables are equal as stored. Rates read back from the
+// database are rounded to rateScale, so loaded rates are rounded the same way to compare them.
+func sameRates(a, b map[string]float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for currency, rate := range a {
+		other, ok := b[currency]
+		if !ok || strconv.FormatFloat(rate, 'f', rateScale, 64) != strconv.FormatFloat(other, 'f', rateScale, 64) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,24 @@
+package service
+
+import "testing"
+
+func TestSameRates(t *testing.T) {
+	stored := map[string]float64{"EUR": 0.92345679, "IDR": 15650}
+	tests := []struct {
+		name   string
+		loaded map[string]float64
+		want   bool
+	}{
+		{"equal", map[string]float64{"EUR": 0.92345679, "IDR": 15650}, true},
+		// the file has more decimals than the rate column keeps
+		{"rounded when stored", map[string]float64{"EUR": 0.923456789, "IDR": 15650.000000001}, true},
+		{"changed in the last stored decimal", map[string]float64{"EUR": 0.92345678, "IDR": 15650}, false},
+		{"currency added", map[string]float64{"EUR": 0.92345679, "IDR": 15650, "JPY": 151.2}, false},
+		{"currency replaced", map[string]float64{"EUR": 0.92345679, "JPY": 15650}, false},
+	}
+	for _, test := range tests {
+		if got := sameRates(stored, test.loaded); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
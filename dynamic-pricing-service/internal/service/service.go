@@ -5,45 +5,58 @@ import (
 	"dynamic-pricing-service/internal/entity"
 	"dynamic-pricing-service/internal/repository"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/go-redis/redis/v8"
 	"net/http"
+	"strings"
 )
 
 // PricingService handles the pricing logic.
 type PricingService struct {
 	pricingRepo       *repository.PricingRepository
 	productServiceURL string
+	productClient     *http.Client
+	orderServiceURL   string
+	orderClient       *http.Client
 	rdb               *redis.Client
 }
 
-// NewPricingService creates a new instance of PricingService.
-func NewPricingService(pricingRepo *repository.PricingRepository, rdb *redis.Client, productServiceURL string) *PricingService {
+// NewPricingService creates a new instance of PricingService. productClient and orderClient
+// authenticate the calls to product-catalog-service and order-service.
+func NewPricingService(pricingRepo *repository.PricingRepository, rdb *redis.Client, productServiceURL string, productClient *http.Client, orderServiceURL string, orderClient *http.Client) *PricingService {
 	return &PricingService{
 		pricingRepo:       pricingRepo,
 		productServiceURL: productServiceURL,
+		productClient:     productClient,
+		orderServiceURL:   orderServiceURL,
+		orderClient:       orderClient,
 		rdb:               rdb,
 	}
 }
 
-// CalculatePricing calculates the final price for a product based on pricing rules.
-func (s *PricingService) CalculatePricing(ctx context.Context, productID int) (*entity.Pricing, error) {
+// CalculatePricing calculates the final price for a product based on pricing rules, in the
+// requested currency.
+func (s *PricingService) CalculatePricing(ctx context.Context, req *entity.PricingRequest) (*entity.Pricing, error) {
+	productID := req.ProductID
+
 	// Step 1: Get the pricing rule for the product
 	pricingRuleCacheKey := fmt.Sprintf("pricing_rule:%d", productID)
 	pricingRuleCacheData, err := s.rdb.Get(ctx, pricingRuleCacheKey).Result()
-	if err != nil {
+	if err != nil && !errors.Is(err, redis.Nil) {
 		return nil, fmt.Errorf("could not fetch pricing rule from cache: %v", err)
 	}
 
 	var pricingRule *entity.PricingRule
 	if pricingRuleCacheData != "" {
+		pricingRule = &entity.PricingRule{}
 		if err := json.Unmarshal([]byte(pricingRuleCacheData), pricingRule); err != nil {
 			return nil, fmt.Errorf("could not unmarshal pricing rule: %v", err)
 		}
 	} else {
 		pricingRule, err = s.pricingRepo.GetPricingRule(ctx, productID)
 		if err != nil {
-			return nil, fmt.Errorf("could not fetch pricing rule: %v", err)
+			return nil, fmt.Errorf("could not fetch pricing rule: %w", err)
 		}
 	}
 
@@ -57,7 +70,34 @@ func (s *PricingService) CalculatePricing(ctx context.Context, productID int) (*
 		return nil, err
 	}
 
-	// Step 3: Calculate price based on stock
+	// Step 3: Use the price override for the requested currency, if there is one
+	currency := strings.ToUpper(req.Currency)
+	if currency != "" && currency != pricingRule.ProductPrice.Currency() {
+		override, err := s.pricingRepo.GetPriceOverride(ctx, productID, currency)
+		if err != nil {
+			return nil, fmt.Errorf("could not fetch price override: %v", err)
+		}
+		if override != nil {
+			overriddenRule := *pricingRule
+			overriddenRule.ProductPrice = override.Price
+			pricingRule = &overriddenRule
+		}
+	}
+
+	// Step 4: Calculate price based on stock
+	pricing, err := applyPricingRule(pricingRule, available)
+	if err != nil {
+		return nil, err
+	}
+	pricing.ProductID = productID
+
+	// Step 5: Convert to the requested currency if the price isn't in it yet
+	return s.convertPricing(ctx, pricing, currency, req.RateVersion)
+}
+
+// applyPricingRule calculates the pricing for a product from a rule and the available stock.
+// It has no side effects, so it is shared by live pricing and simulations.
+func applyPricingRule(pricingRule *entity.PricingRule, available int) (*entity.Pricing, error) {
 	markup := pricingRule.DefaultMarkup
 	discount := pricingRule.DefaultDiscount
 
@@ -67,16 +107,19 @@ func (s *PricingService) CalculatePricing(ctx context.Context, productID int) (*
 		discount -= pricingRule.DiscountReduction
 	}
 
-	// Step 4: Calculate the final price
+	// Calculate the final price
 	productPrice := pricingRule.ProductPrice
-	finalPrice := productPrice * (1 + markup) * (1 - discount)
+	finalPrice, err := productPrice.Mul(1+markup, 1-discount)
+	if err != nil {
+		return nil, fmt.Errorf("could not apply the pricing rule of product %d: %w", pricingRule.ProductID, err)
+	}
 
-	// Step 5: Return the calculated pricing
 	return &entity.Pricing{
-		ProductID:  productID,
-		Markup:     markup,
-		Discount:   discount,
-		FinalPrice: finalPrice,
+		ProductID:    pricingRule.ProductID,
+		Markup:       markup,
+		Discount:     discount,
+		FinalPrice:   finalPrice,
+		ExchangeRate: 1,
 	}, nil
 }
 
@@ -87,7 +130,7 @@ func (s *PricingService) checkProductStock(ctx context.Context, productID int) (
 		return 0, err
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := s.productClient.Do(req)
 	if err != nil {
 		return 0, err
 	}
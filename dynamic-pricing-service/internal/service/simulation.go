@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"dynamic-pricing-service/internal/entity"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"shared/money"
+	"sort"
+	"time"
+)
+
+// Simulate calculates the prices the given products would get under the proposed rules and
+// hypothetical stock levels. Live rules are read straight from the database for products
+// without a proposed rule; nothing is written to the database or the cache.
+func (s *PricingService) Simulate(ctx context.Context, req *entity.SimulationRequest) (*entity.SimulationResult, error) {
+	productIDs := req.ProductIDs
+	if len(productIDs) == 0 {
+		for _, rule := range req.Rules {
+			productIDs = append(productIDs, rule.ProductID)
+		}
+	}
+	if len(productIDs) == 0 {
+		return nil, fmt.Errorf("no products to simulate")
+	}
+
+	proposed := make(map[int]*entity.PricingRule, len(req.Rules))
+	for i := range req.Rules {
+		proposed[req.Rules[i].ProductID] = &req.Rules[i]
+	}
+
+	result := &entity.SimulationResult{}
+	for _, productID := range productIDs {
+		price, err := s.simulateProduct(ctx, productID, proposed, req.Stock)
+		if err != nil {
+			return nil, err
+		}
+		result.Prices = append(result.Prices, *price)
+	}
+
+	return result, nil
+}
+
+// Backtest replays the orders placed in the requested period with the proposed rules and
+// estimates the revenue impact. The orders are read from order-service. Every product line is
+// repriced at the simulated unit price for its product and compared in the currency of the
+// product's rule, and cancelled orders are skipped.
+func (s *PricingService) Backtest(ctx context.Context, req *entity.BacktestRequest) (*entity.BacktestResult, error) {
+	orders, err := s.orderHistory(ctx, req.From, req.To)
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, fmt.Errorf("no orders to replay from %s to %s", req.From.Format(time.RFC3339), req.To.Format(time.RFC3339))
+	}
+
+	proposed := make(map[int]*entity.PricingRule, len(req.Rules))
+	for i := range req.Rules {
+		proposed[req.Rules[i].ProductID] = &req.Rules[i]
+	}
+
+	prices := make(map[int]*entity.SimulatedPricing)
+	products := make(map[int]*entity.ProductBacktest)
+	result := &entity.BacktestResult{}
+
+	for _, order := range orders {
+		if order.Status == "cancelled" || !convertible(order) {
+			result.OrdersSkipped++
+			continue
+		}
+
+		for _, line := range order.ProductRequests {
+			price, ok := prices[line.ProductID]
+			if !ok {
+				var err error
+				price, err = s.simulateProduct(ctx, line.ProductID, proposed, req.Stock)
+				if err != nil {
+					return nil, err
+				}
+				prices[line.ProductID] = price
+			}
+
+			currency := price.FinalPrice.Currency()
+			product, ok := products[line.ProductID]
+			if !ok {
+				product = &entity.ProductBacktest{
+					ProductID:        line.ProductID,
+					ActualRevenue:    money.Zero(currency),
+					SimulatedRevenue: money.Zero(currency),
+				}
+				products[line.ProductID] = product
+			}
+
+			// the line was converted from the rule's currency, so it is converted back
+			actual := line.FinalPrice
+			if actual.Currency() != currency {
+				var err error
+				actual, err = actual.Convert(currency, 1/line.ExchangeRate)
+				if err != nil {
+					return nil, fmt.Errorf("could not convert order %d back to %s: %w", order.OrderID, currency, err)
+				}
+			}
+			simulated := price.FinalPrice.MulInt(line.Quantity)
+			product.QuantitySold += line.Quantity
+			product.ActualRevenue = product.ActualRevenue.Add(actual)
+			product.SimulatedRevenue = product.SimulatedRevenue.Add(simulated)
+		}
+		result.OrdersReplayed++
+	}
+
+	for _, product := range products {
+		product.RevenueDelta = product.SimulatedRevenue.Sub(product.ActualRevenue)
+		result.Products = append(result.Products, *product)
+	}
+
+	sort.Slice(result.Products, func(i, j int) bool {
+		return result.Products[i].ProductID < result.Products[j].ProductID
+	})
+
+	// the totals only add up if all rules are in one currency
+	if len(result.Products) > 0 {
+		currency := result.Products[0].ActualRevenue.Currency()
+		result.ActualRevenue = money.Zero(currency)
+		result.SimulatedRevenue = money.Zero(currency)
+		for _, product := range result.Products {
+			if product.ActualRevenue.Currency() != currency {
+				return nil, fmt.Errorf("products are priced in %s and %s, the revenue can't be totalled", currency, product.ActualRevenue.Currency())
+			}
+			result.ActualRevenue = result.ActualRevenue.Add(product.ActualRevenue)
+			result.SimulatedRevenue = result.SimulatedRevenue.Add(product.SimulatedRevenue)
+		}
+		result.RevenueDelta = result.SimulatedRevenue.Sub(result.ActualRevenue)
+	}
+
+	return result, nil
+}
+
+// convertible reports whether every line of an order records the rate it was converted with, so
+// its prices can be compared with the rules. Lines that weren't converted have a rate of 1.
+func convertible(order entity.HistoricalOrder) bool {
+	for _, line := range order.ProductRequests {
+		if line.ExchangeRate <= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// orderHistory reads the orders placed from from up to but excluding to from order-service.
+func (s *PricingService) orderHistory(ctx context.Context, from, to time.Time) ([]entity.HistoricalOrder, error) {
+	query := url.Values{}
+	query.Set("from", from.Format(time.RFC3339))
+	query.Set("to", to.Format(time.RFC3339))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.orderServiceURL+"/orders/history?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.orderClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch order history: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var body map[string]string
+		json.NewDecoder(resp.Body).Decode(&body)
+		return nil, fmt.Errorf("could not fetch order history: order-service answered %d: %s", resp.StatusCode, body["error"])
+	}
+
+	var orders []entity.HistoricalOrder
+	if err := json.NewDecoder(resp.Body).Decode(&orders); err != nil {
+		return nil, fmt.Errorf("could not decode order history: %v", err)
+	}
+	return orders, nil
+}
+
+// simulateProduct prices a single product, preferring the proposed rule and hypothetical stock.
+func (s *PricingService) simulateProduct(ctx context.Context, productID int, proposed map[int]*entity.PricingRule, stock map[int]int) (*entity.SimulatedPricing, error) {
+	rule, isProposed := proposed[productID]
+	if !isProposed {
+		var err error
+		rule, err = s.pricingRepo.GetPricingRule(ctx, productID)
+		if err != nil {
+			return nil, fmt.Errorf("could not fetch pricing rule: %v", err)
+		}
+	}
+
+	available, ok := stock[productID]
+	if !ok {
+		var err error
+		available, err = s.checkProductStock(ctx, productID)
+		if err != nil {
+			return nil, fmt.Errorf("could not fetch stock for product %d: %v", productID, err)
+		}
+	}
+
+	pricing, err := applyPricingRule(rule, available)
+	if err != nil {
+		return nil, err
+	}
+	pricing.ProductID = productID
+
+	return &entity.SimulatedPricing{
+		Pricing:      *pricing,
+		Stock:        available,
+		ProposedRule: isProposed,
+	}, nil
+}
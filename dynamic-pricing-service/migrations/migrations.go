@@ -0,0 +1,61 @@
+package migrations
+
+import (
+	"database/sql"
+	"fmt"
+	"shared/money"
+)
+
+// AutoMigrateMoneyColumns converts the pricing_rules price column from DOUBLE to DECIMAL.
+func AutoMigrateMoneyColumns(db *sql.DB) error {
+	return money.ConvertColumn(db, "pricing_rules", "product_price")
+}
+
+// AutoMigrateRuleCurrency adds the currency column to pricing_rules created before rules had a
+// currency. Existing rules are in the default currency.
+func AutoMigrateRuleCurrency(db *sql.DB) error {
+	return addColumnIfMissing(db, "pricing_rules", "currency", fmt.Sprintf("CHAR(3) NOT NULL DEFAULT '%s'", money.DefaultCurrency))
+}
+
+// AutoMigrateCurrencyTables creates the price_overrides and exchange_rates tables if they do not exist.
+func AutoMigrateCurrencyTables(db *sql.DB) error {
+	queries := []string{`
+		CREATE TABLE IF NOT EXISTS price_overrides (
+			product_id INT NOT NULL,
+			currency CHAR(3) NOT NULL,
+			price DECIMAL(19,4) NOT NULL,
+			PRIMARY KEY (product_id, currency)
+		);
+	`, `
+		CREATE TABLE IF NOT EXISTS exchange_rates (
+			version INT NOT NULL,
+			base CHAR(3) NOT NULL,
+			currency CHAR(3) NOT NULL,
+			rate DECIMAL(19,8) NOT NULL,
+			source VARCHAR(255) NOT NULL,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (version, currency)
+		);
+	`}
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addColumnIfMissing adds a column to a table unless information_schema shows it already exists.
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	var count int
+	query := `SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?`
+	if err := db.QueryRow(query, table, column).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	_, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
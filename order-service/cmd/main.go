@@ -1,116 +1,249 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"github.com/go-redis/redis/v8"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
-	"golang.org/x/time/rate"
-	"log"
 	"order-service/internal/api"
 	"order-service/internal/config"
 	"order-service/internal/repository"
 	"order-service/internal/service"
 	"order-service/internal/sharding"
+	"order-service/internal/tax"
 	"order-service/migrations"
-	"os"
+	"shared/auth"
+	sharedconfig "shared/config"
+	"shared/health"
+	"shared/httpclient"
+	"shared/lifecycle"
+	"shared/logging"
+	"shared/metrics"
+	"shared/pricing"
+	"shared/ratelimit"
+	"shared/sqldb"
+	"shared/tracing"
 	"time"
 )
 
-func connectDBEnv(host, port, user, pass, dbname string) (*sql.DB, error) {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s", user, pass, host, port, dbname)
+var logger = logging.Logger
 
+func connectDB(database sharedconfig.Database) (*sql.DB, error) {
 	var db *sql.DB
 	var err error
 	for i := 0; i < 10; i++ {
-		db, err = sql.Open("mysql", dsn)
+		db, err = sqldb.Open("mysql", database.DSN(), database.Name)
 		if err == nil {
 			err = db.Ping()
 			if err == nil {
-				log.Printf("✅ Connected to DB %s", dbname)
+				logger.Info().Msgf("✅ Connected to DB %s", database.Name)
 				return db, nil
 			}
 		}
-		log.Printf("❌ Retry %d: Failed to connect to DB %s (%s:%s): %v", i+1, dbname, host, port, err)
+		logger.Warn().Err(err).Msgf("❌ Retry %d: Failed to connect to DB %s (%s:%d)", i+1, database.Name, database.Host, database.Port)
 		time.Sleep(3 * time.Second)
 	}
-	return nil, fmt.Errorf("failed to connect to DB %s at %s:%s after retries: %v", dbname, host, port, err)
+	return nil, fmt.Errorf("failed to connect to DB %s at %s:%d after retries: %v", database.Name, database.Host, database.Port, err)
 }
 
 func main() {
-	db1, err := connectDBEnv(os.Getenv("DB1_HOST"), os.Getenv("DB1_PORT"), os.Getenv("DB1_USER"), os.Getenv("DB1_PASS"), os.Getenv("DB1_NAME"))
+	configFile := sharedconfig.File("config.yaml")
+	cfg, err := config.Load(configFile)
 	if err != nil {
-		panic(err)
+		logger.Fatal().Err(err).Msg("Failed to load config")
 	}
-	db2, err := connectDBEnv(os.Getenv("DB2_HOST"), os.Getenv("DB2_PORT"), os.Getenv("DB2_USER"), os.Getenv("DB2_PASS"), os.Getenv("DB2_NAME"))
+	logging.Setup("order-service", cfg.Log)
+
+	// on SIGTERM requests are drained, so orders being placed complete, and connections closed
+	app := lifecycle.New(time.Duration(cfg.Server.ShutdownTimeout), time.Duration(cfg.Server.ShutdownDelay))
+
+	// spans are flushed after everything else is closed
+	shutdownTracing, err := tracing.Setup("order-service", cfg.Tracing)
 	if err != nil {
-		panic(err)
+		logger.Fatal().Err(err).Msg("Failed to set up tracing")
 	}
-	db3, err := connectDBEnv(os.Getenv("DB3_HOST"), os.Getenv("DB3_PORT"), os.Getenv("DB3_USER"), os.Getenv("DB3_PASS"), os.Getenv("DB3_NAME"))
-	if err != nil {
-		panic(err)
+	app.OnShutdown("tracing", shutdownTracing)
+
+	// Prometheus scrapes /metrics on its own port
+	app.Go(func(ctx context.Context) {
+		if err := metrics.Serve(ctx, cfg.Metrics.Addr()); err != nil {
+			logger.Error().Err(err).Msg("Metrics server stopped")
+		}
+	})
+
+	dbs := make([]*sql.DB, config.Shards)
+	for i, database := range cfg.Databases {
+		dbs[i], err = connectDB(database)
+		if err != nil {
+			panic(err)
+		}
+		app.Close("database "+database.Name, dbs[i])
 	}
+	db1, db2, db3 := dbs[0], dbs[1], dbs[2]
 
 	err = migrations.AutoMigrateOrders(3, db1, db2, db3)
 	if err != nil {
-		log.Fatalf("Failed to migrate orders table: %v", err)
+		logger.Fatal().Err(err).Msg("Failed to migrate orders table")
 	}
 
 	err = migrations.AutoMigrateProductRequests(3, db1, db2, db3)
 	if err != nil {
-		log.Fatalf("Failed to migrate product_requests table: %v", err)
+		logger.Fatal().Err(err).Msg("Failed to migrate product_requests table")
+	}
+
+	err = migrations.AutoMigrateOrderBreakdown(db1, db2, db3)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to migrate orders breakdown columns")
+	}
+
+	err = migrations.AutoMigrateOrderPromotions(3, db1, db2, db3)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to migrate order_promotions table")
+	}
+
+	// promotions are global, so they are stored on the first shard only
+	err = migrations.AutoMigratePromotions(3, db1)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to migrate promotions tables")
+	}
+
+	err = migrations.AutoMigrateMoneyColumns([]*sql.DB{db1, db2, db3}, db1)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to migrate money columns")
+	}
+
+	err = migrations.AutoMigrateOrderCurrency([]*sql.DB{db1, db2, db3}, db1)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to migrate currency columns")
+	}
+
+	err = migrations.AutoMigrateOrderTaxes(3, db1, db2, db3)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to migrate order tax tables")
+	}
+
+	err = migrations.AutoMigrateOrderAddresses(3, db1, db2, db3)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to migrate order_addresses table")
+	}
+
+	err = migrations.AutoMigrateOrderAPIKeys(db1, db2, db3)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to migrate order API key column")
+	}
+
+	err = migrations.AutoMigrateOrderCreatedAt(db1, db2, db3)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to migrate order created_at column")
+	}
+
+	taxEngine, err := tax.LoadFile(cfg.TaxRatesFile)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to load tax rates")
 	}
 
 	rdb := redis.NewClient(&redis.Options{
-		Addr: os.Getenv("REDIS_ADDR"),
+		Addr:     cfg.Redis.Addr,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
 	})
+	app.Close("redis", rdb)
+	rdb.AddHook(tracing.RedisHook())
 
-	kafkaWriter := config.NewKafkaWriter("order-topic")
+	kafkaWriter := config.NewKafkaWriter(cfg.Kafka.Brokers, "order-topic")
+	app.Close("kafka writer", kafkaWriter)
 
-	router := sharding.NewShardRouter(3)
+	router := sharding.NewShardRouter(config.Shards)
 
-	orderRepo := repository.NewOrderRepository([]*sql.DB{db1, db2, db3}, router)
-	orderService := service.NewOrderService(*orderRepo, "http://localhost:8081", "http://localhost:8083", kafkaWriter, rdb)
+	promotionRepo := repository.NewPromotionRepository(db1)
+	promotionService := service.NewPromotionService(promotionRepo)
+	promotionHandler := api.NewPromotionHandler(promotionService)
+
+	orderRepo := repository.NewOrderRepository(dbs, router)
+	productClient, err := httpclient.ForService(cfg.ServiceClient, cfg.TLS, "product-catalog-service")
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to create product-catalog client")
+	}
+	userClient, err := httpclient.ForService(cfg.ServiceClient, cfg.TLS, "user-management-service")
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to create user-management client")
+	}
+	pricingClient, err := httpclient.ForService(cfg.ServiceClient, cfg.TLS, "dynamic-pricing-service")
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to create dynamic-pricing client")
+	}
+	// orders are placed through resilient clients, the health checks use the plain ones so they
+	// report the other services as they are
+	resilientProductClient := httpclient.Resilient(productClient, "product-catalog-service", cfg.HTTPClient)
+	resilientUserClient := httpclient.Resilient(userClient, "user-management-service", cfg.HTTPClient)
+	prices := pricing.NewClient(cfg.PricingServiceURL, httpclient.Resilient(pricingClient, "dynamic-pricing-service", cfg.HTTPClient))
+	orderService := service.NewOrderService(*orderRepo, cfg.ProductServiceURL, cfg.UserServiceURL, resilientProductClient, resilientUserClient, prices, kafkaWriter, rdb, promotionService, taxEngine)
 	orderHandler := api.NewOrderHandler(*orderService)
 
 	e := echo.New()
-
-	limiterConfig := middleware.RateLimiterConfig{
-		Skipper: middleware.DefaultSkipper,
-		Store: middleware.NewRateLimiterMemoryStoreWithConfig(
-			middleware.RateLimiterMemoryStoreConfig{
-				Rate:      rate.Limit(1),
-				Burst:     3,
-				ExpiresIn: 3 * time.Minute,
-			}),
-		IdentifierExtractor: func(context echo.Context) (string, error) {
-			return context.Request().RemoteAddr, nil
-		},
-		ErrorHandler: func(context echo.Context, err error) error {
-			return context.JSON(429, map[string]string{"error": "rate limit exceeded"})
-		},
-		DenyHandler: func(context echo.Context, identifier string, err error) error {
-			return context.JSON(429, map[string]string{"error": "rate limit exceeded"})
-		},
-	}
-
-	e.Use(middleware.Logger())
-	e.Use(middleware.Recover())
-	e.Use(middleware.RateLimiterWithConfig(limiterConfig))
-
-	e.POST("/orders", orderHandler.CreateOrder)
-	e.PUT("/orders", orderHandler.UpdateOrder)
-	e.DELETE("/orders/:id", orderHandler.CancelOrder)
-
-	e.GET("/orders/health", func(c echo.Context) error {
-		return c.JSON(200, map[string]interface{}{
-			"status":  "ok",
-			"service": "order-service",
-			"time":    time.Now().Format(time.RFC3339),
+	// client IPs are only read from X-Forwarded-For when the gateway sends it
+	e.IPExtractor = cfg.Server.IPExtractor()
+
+	// a backstop per client IP, the gateway applies the limits per caller
+	limiter := ratelimit.NewLimiter(rdb, "order-service", &cfg.RateLimits)
+
+	// the log level and rate limits can be changed without a restart
+	app.Go(func(ctx context.Context) {
+		sharedconfig.Watch(ctx, configFile, 10*time.Second, func(reloaded *config.Config) {
+			reloaded.Log.Apply()
+			limiter.SetConfig(&reloaded.RateLimits)
+		}, func(err error) {
+			logger.Error().Err(err).Msg("Failed to reload config, keeping the current one")
 		})
 	})
 
-	e.Logger.Fatal(e.Start(":8082"))
+	e.Use(logging.Middleware())
+	e.Use(middleware.Recover())
+	e.Use(metrics.Middleware())
+	e.Use(tracing.Middleware())
+	e.Use(ratelimit.Middleware(limiter))
+
+	// access tokens are verified with the public keys of user-management-service
+	// partner integrations can send an API key instead, resolved by user-management-service
+	apiKeys := auth.NewAPIKeyResolver(cfg.UserServiceURL+"/api-keys/introspect", userClient)
+	authenticated := auth.VerifierWithAPIKeys(auth.NewKeySet(cfg.Auth.JWKSURL), auth.NewRevocationList(rdb), "order-service", apiKeys)
+
+	// ownership of :own permissions is checked by the handlers
+	e.POST("/orders", orderHandler.CreateOrder, authenticated, auth.RequirePermission("orders:write:own"))
+	e.GET("/orders/history", orderHandler.GetOrderHistory, authenticated, auth.RequirePermission("orders:read"))
+	e.GET("/orders/:id", orderHandler.GetOrder, authenticated, auth.RequirePermission("orders:read:own"))
+	e.PUT("/orders", orderHandler.UpdateOrder, authenticated, auth.RequirePermission("orders:write:own"))
+	e.DELETE("/orders/:id", orderHandler.CancelOrder, authenticated, auth.RequirePermission("orders:write:own"))
+
+	// called by user-management-service when an account is deleted
+	e.POST("/users/:id/erase", orderHandler.EraseUserData, authenticated, auth.RequirePermission("orders:erase"))
+
+	e.POST("/promotions", promotionHandler.CreatePromotion, authenticated, auth.RequirePermission("promotions:admin"))
+	e.GET("/promotions/:code", promotionHandler.GetPromotion, authenticated)
+
+	// orders can't be stored or announced without a shard, Redis or Kafka; the other services are
+	// only reported, so an outage of one of them doesn't take order-service out of rotation too
+	checker := health.NewChecker("order-service", app.Context())
+	for i, db := range dbs {
+		checker.Add("mysql:"+cfg.Databases[i].Name, true, health.DB(db))
+	}
+	checker.Add("redis", true, health.Redis(rdb))
+	checker.Add("kafka", true, health.TCP(cfg.Kafka.Brokers...))
+	checker.Add("product-catalog-service", false, health.HTTP(productClient, cfg.ProductServiceURL+"/products/health/live"))
+	checker.Add("dynamic-pricing-service", false, health.HTTP(pricingClient, cfg.PricingServiceURL+"/pricing/health/live"))
+	checker.Add("user-management-service", false, health.HTTP(userClient, cfg.UserServiceURL+"/users/health/live"))
+	checker.Add("circuit:product-catalog-service", false, httpclient.Circuit("product-catalog-service"))
+	checker.Add("circuit:dynamic-pricing-service", false, httpclient.Circuit("dynamic-pricing-service"))
+	checker.Add("circuit:user-management-service", false, httpclient.Circuit("user-management-service"))
+	checker.Register(e, "/orders/health")
+
+	err = app.Serve(e, func() error {
+		return e.Start(cfg.Server.Addr())
+	})
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Server stopped")
+	}
 }
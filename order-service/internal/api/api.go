@@ -1,10 +1,14 @@
 package api
 
 import (
+	"errors"
+	"fmt"
 	"github.com/labstack/echo/v4"
 	"order-service/internal/entity"
 	"order-service/internal/service"
+	"shared/auth"
 	"strconv"
+	"time"
 )
 
 type OrderHandler struct {
@@ -23,6 +27,21 @@ func (h *OrderHandler) CreateOrder(c echo.Context) error {
 	}
 	order.IdempotentKey = c.Request().Header.Get("Idempotent-Key")
 
+	// customers order for themselves, only callers allowed to write any order may set the user
+	claims := auth.ClaimsFrom(c)
+	if !claims.HasPermission("orders:write") {
+		userID, err := claims.UserID()
+		if err != nil {
+			return c.JSON(401, map[string]string{"error": "Unauthorized"})
+		}
+		order.UserID = userID
+	}
+	// orders placed with an API key belong to its owner, and record the key
+	order.APIKeyID = 0
+	if claims.APIKeyID != "" {
+		order.APIKeyID, _ = strconv.Atoi(claims.APIKeyID)
+	}
+
 	createdOrder, err := h.orderService.CreateOrder(ctx, &order)
 	if err != nil {
 		return c.JSON(500, map[string]string{"error": err.Error()})
@@ -31,13 +50,56 @@ func (h *OrderHandler) CreateOrder(c echo.Context) error {
 	return c.JSON(200, createdOrder)
 }
 
+// GetOrder returns an order to its owner, or to callers allowed to read any order --> /orders/:id
+func (h *OrderHandler) GetOrder(c echo.Context) error {
+	id := c.Param("id")
+	idInt, err := strconv.Atoi(id)
+	if err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid ID"})
+	}
+
+	order, err := h.orderService.GetOrder(c.Request().Context(), idInt)
+	if err != nil {
+		return c.JSON(404, map[string]string{"error": "Order not found"})
+	}
+
+	// other users' orders look the same as missing ones
+	if !auth.ClaimsFrom(c).CanAccess("orders:read", order.UserID) {
+		return c.JSON(404, map[string]string{"error": "Order not found"})
+	}
+
+	return c.JSON(200, order)
+}
+
+// UpdateOrder changes an order --> PUT /orders. Customers can only make the status changes
+// allowed to owners, e.g. cancel; callers allowed to write any order can change its owner, status
+// and product lines, and the totals are recomputed.
 func (h *OrderHandler) UpdateOrder(c echo.Context) error {
+	ctx := c.Request().Context()
 	order := entity.Order{}
 	if err := c.Bind(&order); err != nil {
 		return c.JSON(400, map[string]string{"error": "Invalid request payload"})
 	}
 
-	updatedOrder, err := h.orderService.UpdateOrder(c.Request().Context(), &order)
+	existing, ok := h.writableOrder(c, order.ID)
+	if !ok {
+		return c.JSON(404, map[string]string{"error": "Order not found"})
+	}
+
+	var updatedOrder *entity.Order
+	var err error
+	if auth.ClaimsFrom(c).HasPermission("orders:write") {
+		updatedOrder, err = h.orderService.UpdateOrder(ctx, existing, &order)
+	} else {
+		if !service.OwnerMayChangeStatus(existing.Status, order.Status) {
+			return c.JSON(403, map[string]string{"error": fmt.Sprintf("Order can't be changed from %s to %s", existing.Status, order.Status)})
+		}
+		// cancelling is the only change owners can make
+		updatedOrder, err = h.orderService.CancelOrder(ctx, existing.ID)
+	}
+	if errors.Is(err, service.ErrInvalidUpdate) {
+		return c.JSON(400, map[string]string{"error": err.Error()})
+	}
 	if err != nil {
 		return c.JSON(500, map[string]string{"error": err.Error()})
 	}
@@ -52,10 +114,75 @@ func (h *OrderHandler) CancelOrder(c echo.Context) error {
 		return c.JSON(400, map[string]string{"error": "Invalid ID"})
 	}
 
+	existing, ok := h.writableOrder(c, idInt)
+	if !ok {
+		return c.JSON(404, map[string]string{"error": "Order not found"})
+	}
+	if !auth.ClaimsFrom(c).HasPermission("orders:write") && !service.OwnerMayChangeStatus(existing.Status, "cancelled") {
+		return c.JSON(403, map[string]string{"error": fmt.Sprintf("Order can't be cancelled when it is %s", existing.Status)})
+	}
+
 	order, err := h.orderService.CancelOrder(c.Request().Context(), idInt)
+	if errors.Is(err, service.ErrInvalidUpdate) {
+		return c.JSON(400, map[string]string{"error": err.Error()})
+	}
 	if err != nil {
 		return c.JSON(500, map[string]string{"error": err.Error()})
 	}
 
 	return c.JSON(200, order)
 }
+
+// EraseUserData anonymizes the orders of a deleted user account --> /users/:id/erase
+func (h *OrderHandler) EraseUserData(c echo.Context) error {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || userID == entity.ErasedUserID {
+		return c.JSON(400, map[string]string{"error": "Invalid ID"})
+	}
+
+	erased, err := h.orderService.EraseUserData(c.Request().Context(), userID)
+	if err != nil {
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(200, map[string]int{"erased_orders": erased})
+}
+
+// maxHistoryRange bounds the orders read at once by GetOrderHistory, which searches every shard.
+const maxHistoryRange = 366 * 24 * time.Hour
+
+// GetOrderHistory returns the orders placed from the RFC 3339 time from up to but excluding to,
+// e.g. for backtesting pricing rules --> /orders/history?from=&to=
+func (h *OrderHandler) GetOrderHistory(c echo.Context) error {
+	from, err := time.Parse(time.RFC3339, c.QueryParam("from"))
+	if err != nil {
+		return c.JSON(400, map[string]string{"error": "from must be an RFC 3339 time"})
+	}
+	to, err := time.Parse(time.RFC3339, c.QueryParam("to"))
+	if err != nil {
+		return c.JSON(400, map[string]string{"error": "to must be an RFC 3339 time"})
+	}
+	if !from.Before(to) || to.Sub(from) > maxHistoryRange {
+		return c.JSON(400, map[string]string{"error": "from must be before to, at most a year apart"})
+	}
+
+	orders, err := h.orderService.OrderHistory(c.Request().Context(), from, to)
+	if err != nil {
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
+	if orders == nil {
+		orders = []entity.Order{}
+	}
+
+	return c.JSON(200, orders)
+}
+
+// writableOrder returns the existing order if the caller may change it: it is theirs, or they
+// are allowed to write any order.
+func (h *OrderHandler) writableOrder(c echo.Context, id int) (*entity.Order, bool) {
+	existing, err := h.orderService.GetOrder(c.Request().Context(), id)
+	if err != nil || !auth.ClaimsFrom(c).CanAccess("orders:write", existing.UserID) {
+		return nil, false
+	}
+	return existing, true
+}
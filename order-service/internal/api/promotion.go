@@ -0,0 +1,38 @@
+package api
+
+import (
+	"github.com/labstack/echo/v4"
+	"order-service/internal/entity"
+	"order-service/internal/service"
+)
+
+type PromotionHandler struct {
+	promotionService *service.PromotionService
+}
+
+func NewPromotionHandler(promotionService *service.PromotionService) *PromotionHandler {
+	return &PromotionHandler{promotionService: promotionService}
+}
+
+func (h *PromotionHandler) CreatePromotion(c echo.Context) error {
+	promo := entity.Promotion{}
+	if err := c.Bind(&promo); err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid request payload"})
+	}
+
+	createdPromo, err := h.promotionService.CreatePromotion(c.Request().Context(), &promo)
+	if err != nil {
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(200, createdPromo)
+}
+
+func (h *PromotionHandler) GetPromotion(c echo.Context) error {
+	promo, err := h.promotionService.GetPromotion(c.Request().Context(), c.Param("code"))
+	if err != nil {
+		return c.JSON(404, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(200, promo)
+}
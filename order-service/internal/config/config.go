@@ -0,0 +1,58 @@
+package config
+
+import (
+	"fmt"
+	sharedconfig "shared/config"
+	"shared/httpclient"
+	"shared/logging"
+	"shared/metrics"
+	"shared/mtls"
+	"shared/ratelimit"
+	"shared/tracing"
+)
+
+// Shards is the number of order databases. Orders are placed by user ID, so it can't change
+// without moving them.
+const Shards = 3
+
+type Config struct {
+	Server        sharedconfig.Server     `yaml:"server"`
+	Metrics       metrics.Config          `yaml:"metrics"`
+	Tracing       tracing.Config          `yaml:"tracing"`
+	Log           logging.Config          `yaml:"log"`
+	Databases     []sharedconfig.Database `yaml:"databases" env:"DB"` // One per shard, DB1_HOST etc.
+	Redis         sharedconfig.Redis      `yaml:"redis"`
+	RateLimits    ratelimit.Config        `yaml:"rate_limits"`
+	Kafka         sharedconfig.Kafka      `yaml:"kafka"`
+	Auth          sharedconfig.Auth       `yaml:"auth"`
+	TLS           mtls.Files              `yaml:"tls"`
+	ServiceClient httpclient.Credentials  `yaml:"service_client"`
+	HTTPClient    httpclient.Policy       `yaml:"http_client"`
+
+	ProductServiceURL string `yaml:"product_service_url" env:"PRODUCT_SERVICE_URL" default:"http://localhost:8081"`
+	PricingServiceURL string `yaml:"pricing_service_url" env:"PRICING_SERVICE_URL" default:"http://localhost:8083"`
+	UserServiceURL    string `yaml:"user_service_url" env:"USER_SERVICE_URL" default:"http://localhost:8080"`
+	TaxRatesFile      string `yaml:"tax_rates_file" env:"TAX_RATES_FILE" default:"data/tax_rates.json"`
+}
+
+// Load reads and checks the config file, see sharedconfig.Load.
+func Load(path string) (*Config, error) {
+	config := &Config{}
+	if err := sharedconfig.Load(path, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (c *Config) Validate() error {
+	if len(c.Databases) != Shards {
+		return fmt.Errorf("databases: %d shards are needed, got %d", Shards, len(c.Databases))
+	}
+	if err := sharedconfig.URL("product_service_url", c.ProductServiceURL); err != nil {
+		return err
+	}
+	if err := sharedconfig.URL("pricing_service_url", c.PricingServiceURL); err != nil {
+		return err
+	}
+	return sharedconfig.URL("user_service_url", c.UserServiceURL)
+}
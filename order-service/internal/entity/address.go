@@ -0,0 +1,46 @@
+package entity
+
+// Address kinds of an order.
+const (
+	AddressShipping = "shipping"
+	AddressBilling  = "billing"
+)
+
+// Address is a copy of an address from the user's address book in user-management-service, taken
+// when the order is created. Later edits to the address book don't change it.
+type Address struct {
+	AddressID  int    `json:"address_id"` // Address book entry it was copied from
+	Name       string `json:"name"`
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2"`
+	City       string `json:"city"`
+	Region     string `json:"region"`
+	PostalCode string `json:"postal_code"`
+	Country    string `json:"country"`
+	Phone      string `json:"phone"`
+
+	// Set on address book entries returned by user-management-service
+	DefaultShipping bool `json:"default_shipping,omitempty"`
+	DefaultBilling  bool `json:"default_billing,omitempty"`
+}
+
+/*
+Mysql Table
+
+CREATE TABLE order_addresses (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	order_id INT NOT NULL,
+	kind VARCHAR(10) NOT NULL, -- shipping or billing
+	address_id INT NOT NULL,
+	name VARCHAR(100) NOT NULL,
+	line1 VARCHAR(255) NOT NULL,
+	line2 VARCHAR(255) NOT NULL DEFAULT '',
+	city VARCHAR(100) NOT NULL,
+	region VARCHAR(100) NOT NULL DEFAULT '',
+	postal_code VARCHAR(20) NOT NULL DEFAULT '',
+	country CHAR(2) NOT NULL,
+	phone VARCHAR(30) NOT NULL DEFAULT '',
+	UNIQUE INDEX order_kind_idx (order_id, kind),
+	FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE
+);
+*/
@@ -1,24 +1,62 @@
 package entity
 
+import (
+	"shared/money"
+	"time"
+)
+
 type Order struct {
-	ID              int              `json:"id"`
-	UserID          int              `json:"user_id"`
-	OrderID         int              `json:"order_id"`
-	ProductRequests []ProductRequest `json:"product_requests"`
-	Quantity        int              `json:"quantity"`
-	Total           float64          `json:"total"`
-	TotalMarkUp     float64          `json:"total_mark_up"`
-	TotalDiscount   float64          `json:"total_discount"`
-	Status          string           `json:"status"` // e.g., "created", "paid", "canceled"
-	IdempotentKey   string           `json:"idempotent_key"`
+	ID                int                `json:"id"` // Unique across shards, see sharding.ShardRouter.GlobalID
+	UserID            int                `json:"user_id"`
+	APIKeyID          int                `json:"api_key_id,omitempty"` // API key of the owner the order was placed with, 0 if none
+	OrderID           int                `json:"order_id"`
+	ProductRequests   []ProductRequest   `json:"product_requests"`
+	Quantity          int                `json:"quantity"`
+	Subtotal          money.Money        `json:"subtotal"` // Sum of the product final prices, before promotions
+	PromotionDiscount money.Money        `json:"promotion_discount"`
+	Total             money.Money        `json:"total"`
+	TotalMarkUp       float64            `json:"total_mark_up"`
+	TotalDiscount     float64            `json:"total_discount"`
+	Status            string             `json:"status"` // e.g., "created", "paid", "canceled"
+	IdempotentKey     string             `json:"idempotent_key"`
+	Currency          string             `json:"currency"`      // Currency of all prices and totals of the order
+	ExchangeRate      float64            `json:"exchange_rate"` // Rate used to convert prices into the order currency, 1 if none
+	RateVersion       int                `json:"rate_version"`  // Exchange rate version used, so the order can be repriced
+	PromotionCodes    []string           `json:"promotion_codes,omitempty"`
+	AppliedPromotions []AppliedPromotion `json:"applied_promotions"`
+	TaxJurisdiction   string             `json:"tax_jurisdiction"`   // e.g. "ID" or "US-CA", from the shipping address or the tax table default
+	PricesIncludeTax  bool               `json:"prices_include_tax"` // Whether the product prices already contain the tax
+	TaxTotal          money.Money        `json:"tax_total"`
+	Taxes             []TaxLine          `json:"taxes"`
+	ShippingAddressID int                `json:"shipping_address_id,omitempty"` // Address book entry to ship to, the default shipping address if 0
+	BillingAddressID  int                `json:"billing_address_id,omitempty"`  // Address book entry to bill, the default billing address if 0
+	ShippingAddress   *Address           `json:"shipping_address,omitempty"`
+	BillingAddress    *Address           `json:"billing_address,omitempty"`
+	CreatedAt         time.Time          `json:"created_at"`
 }
 
+// ErasedUserID replaces the user of orders whose account was deleted. The orders are kept for
+// accounting, but no longer point to a person.
+const ErasedUserID = 0
+
 type ProductRequest struct {
-	ProductID  int     `json:"product_id"`
-	Quantity   int     `json:"quantity"`
-	MarkUp     float64 `json:"mark_up"`
-	Discount   float64 `json:"discount"`
-	FinalPrice float64 `json:"final_price"`
+	ProductID    int         `json:"product_id"`
+	Quantity     int         `json:"quantity"`
+	MarkUp       float64     `json:"mark_up"`
+	Discount     float64     `json:"discount"`
+	FinalPrice   money.Money `json:"final_price"`
+	ExchangeRate float64     `json:"exchange_rate"`
+	TaxCategory  string      `json:"tax_category"`
+	TaxRate      float64     `json:"tax_rate"`
+	Tax          money.Money `json:"tax"`
+}
+
+// TaxLine is the tax of an order for one tax category and rate.
+type TaxLine struct {
+	Category string      `json:"category"`
+	Rate     float64     `json:"rate"`
+	Taxable  money.Money `json:"taxable"` // Amount the rate applies to, after promotions and excluding tax
+	Tax      money.Money `json:"tax"`
 }
 
 /*
@@ -36,7 +74,29 @@ CREATE TABLE product_requests (
 	quantity INT NOT NULL,
 	mark_up DOUBLE NOT NULL,
 	discount DOUBLE NOT NULL,
-	final_price DOUBLE NOT NULL
+	final_price DECIMAL(19,4) NOT NULL,
+	exchange_rate DECIMAL(19,8) NOT NULL DEFAULT 1,
+	tax_category VARCHAR(32) NOT NULL DEFAULT '',
+	tax_rate DECIMAL(7,6) NOT NULL DEFAULT 0,
+	tax DECIMAL(19,4) NOT NULL DEFAULT 0
+);
+
+CREATE TABLE order_promotions (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	order_id INT NOT NULL REFERENCES orders(id),
+	promotion_id INT NOT NULL,
+	code VARCHAR(64) NOT NULL,
+	type VARCHAR(20) NOT NULL,
+	discount DECIMAL(19,4) NOT NULL
+);
+
+CREATE TABLE order_taxes (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	order_id INT NOT NULL REFERENCES orders(id),
+	category VARCHAR(32) NOT NULL,
+	rate DECIMAL(7,6) NOT NULL,
+	taxable DECIMAL(19,4) NOT NULL,
+	tax DECIMAL(19,4) NOT NULL
 );
 
 */
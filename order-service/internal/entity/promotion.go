@@ -0,0 +1,88 @@
+package entity
+
+import (
+	"shared/money"
+	"time"
+)
+
+// PromotionType is the kind of discount a promotion grants.
+type PromotionType string
+
+const (
+	PromotionPercentage PromotionType = "percentage"  // Value is a fraction of the basket, e.g. 0.1 for 10%
+	PromotionFixed      PromotionType = "fixed"       // Amount is taken off the basket
+	PromotionBuyXGetY   PromotionType = "buy_x_get_y" // Buy BuyQuantity of ProductID, get GetQuantity free
+)
+
+type Promotion struct {
+	ID             int           `json:"id"`
+	Code           string        `json:"code"`
+	Type           PromotionType `json:"type"`
+	Value          float64       `json:"value"`      // Only used by percentage promotions
+	Amount         money.Money   `json:"amount"`     // Only used by fixed promotions, in the promotion currency
+	ProductID      int           `json:"product_id"` // Only used by buy_x_get_y promotions
+	BuyQuantity    int           `json:"buy_quantity"`
+	GetQuantity    int           `json:"get_quantity"`
+	MinBasket      money.Money   `json:"min_basket"`        // Minimum subtotal before the code applies, in the promotion currency
+	MaxUses        int           `json:"max_uses"`          // Global redemption limit, 0 for unlimited
+	MaxUsesPerUser int           `json:"max_uses_per_user"` // Per-user redemption limit, 0 for unlimited
+	TimesUsed      int           `json:"times_used"`
+	Stackable      bool          `json:"stackable"` // Whether the code can be combined with other codes
+	Active         bool          `json:"active"`
+	Currency       string        `json:"currency"` // Orders in other currencies can't use amount or min_basket promotions
+	StartsAt       *time.Time    `json:"starts_at,omitempty"`
+	EndsAt         *time.Time    `json:"ends_at,omitempty"`
+}
+
+// AppliedPromotion is a promotion applied to an order, as stored in the order total breakdown.
+type AppliedPromotion struct {
+	PromotionID int           `json:"promotion_id"`
+	Code        string        `json:"code"`
+	Type        PromotionType `json:"type"`
+	Discount    money.Money   `json:"discount"`
+}
+
+// Redemption records a promotion used by an order.
+type Redemption struct {
+	ID          int         `json:"id"`
+	PromotionID int         `json:"promotion_id"`
+	OrderID     int         `json:"order_id"` // ID of the order, not its order ID
+	UserID      int         `json:"user_id"`
+	Discount    money.Money `json:"discount"`
+	CreatedAt   time.Time   `json:"created_at"`
+}
+
+/*
+Mysql Table (stored on the first shard, promotions are global)
+
+CREATE TABLE promotions (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	code VARCHAR(64) NOT NULL UNIQUE,
+	type VARCHAR(20) NOT NULL,
+	value DOUBLE NOT NULL DEFAULT 0,
+	amount DECIMAL(19,4) NOT NULL DEFAULT 0,
+	product_id INT NOT NULL DEFAULT 0,
+	buy_quantity INT NOT NULL DEFAULT 0,
+	get_quantity INT NOT NULL DEFAULT 0,
+	min_basket DECIMAL(19,4) NOT NULL DEFAULT 0,
+	currency CHAR(3) NOT NULL DEFAULT 'USD',
+	max_uses INT NOT NULL DEFAULT 0,
+	max_uses_per_user INT NOT NULL DEFAULT 0,
+	times_used INT NOT NULL DEFAULT 0,
+	stackable BOOLEAN NOT NULL DEFAULT FALSE,
+	active BOOLEAN NOT NULL DEFAULT TRUE,
+	starts_at DATETIME NULL,
+	ends_at DATETIME NULL
+);
+
+CREATE TABLE promotion_redemptions (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	promotion_id INT NOT NULL REFERENCES promotions(id),
+	order_id INT NOT NULL,
+	user_id INT NOT NULL,
+	discount DECIMAL(19,4) NOT NULL,
+	currency CHAR(3) NOT NULL DEFAULT 'USD',
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+*/
@@ -0,0 +1,133 @@
+package promotion
+
+import (
+	"errors"
+	"fmt"
+	"order-service/internal/entity"
+	"shared/money"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotStackable = errors.New("promotion codes cannot be combined")
+	ErrDuplicate    = errors.New("promotion code used more than once")
+)
+
+// NormalizeCode trims and upper-cases a promotion code so lookups are case-insensitive.
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Validate checks that a promotion can be used at the given time for a basket subtotal.
+// Usage limits are enforced when the promotion is redeemed.
+func Validate(promo *entity.Promotion, subtotal money.Money, now time.Time) error {
+	if !promo.Active {
+		return fmt.Errorf("promotion %s is not active", promo.Code)
+	}
+	if promo.StartsAt != nil && now.Before(*promo.StartsAt) {
+		return fmt.Errorf("promotion %s has not started", promo.Code)
+	}
+	if promo.EndsAt != nil && now.After(*promo.EndsAt) {
+		return fmt.Errorf("promotion %s has expired", promo.Code)
+	}
+	if promo.MaxUses > 0 && promo.TimesUsed >= promo.MaxUses {
+		return fmt.Errorf("promotion %s has reached its usage limit", promo.Code)
+	}
+	if (promo.Type == entity.PromotionFixed || !promo.MinBasket.IsZero()) && promo.Currency != subtotal.Currency() {
+		return fmt.Errorf("promotion %s is only valid for %s orders", promo.Code, promo.Currency)
+	}
+	if !promo.MinBasket.IsZero() && subtotal.Cmp(promo.MinBasket) < 0 {
+		return fmt.Errorf("promotion %s requires a minimum basket of %s", promo.Code, promo.MinBasket)
+	}
+	return nil
+}
+
+// Apply calculates the discount of each promotion for the given product lines.
+// Buy-x-get-y promotions are applied first, then fixed amounts, then percentages, each on the
+// amount left after the previous ones, so the total discount never exceeds the subtotal.
+func Apply(promos []*entity.Promotion, lines []entity.ProductRequest, subtotal money.Money, now time.Time) ([]entity.AppliedPromotion, money.Money, error) {
+	if err := checkStacking(promos); err != nil {
+		return nil, money.Money{}, err
+	}
+
+	for _, promo := range promos {
+		if err := Validate(promo, subtotal, now); err != nil {
+			return nil, money.Money{}, err
+		}
+	}
+
+	var applied []entity.AppliedPromotion
+	remaining := subtotal
+	for _, promoType := range []entity.PromotionType{entity.PromotionBuyXGetY, entity.PromotionFixed, entity.PromotionPercentage} {
+		for _, promo := range promos {
+			if promo.Type != promoType {
+				continue
+			}
+
+			discount, err := discountFor(promo, lines, remaining)
+			if err != nil {
+				return nil, money.Money{}, err
+			}
+			discount = money.Min(discount, remaining)
+			remaining = remaining.Sub(discount)
+
+			applied = append(applied, entity.AppliedPromotion{
+				PromotionID: promo.ID,
+				Code:        promo.Code,
+				Type:        promo.Type,
+				Discount:    discount,
+			})
+		}
+	}
+
+	return applied, subtotal.Sub(remaining), nil
+}
+
+// checkStacking rejects duplicate codes and combinations involving a non-stackable code.
+func checkStacking(promos []*entity.Promotion) error {
+	seen := make(map[int]bool, len(promos))
+	for _, promo := range promos {
+		if seen[promo.ID] {
+			return ErrDuplicate
+		}
+		seen[promo.ID] = true
+
+		if len(promos) > 1 && !promo.Stackable {
+			return ErrNotStackable
+		}
+	}
+	return nil
+}
+
+func discountFor(promo *entity.Promotion, lines []entity.ProductRequest, remaining money.Money) (money.Money, error) {
+	switch promo.Type {
+	case entity.PromotionPercentage:
+		return remaining.Mul(promo.Value)
+	case entity.PromotionFixed:
+		return promo.Amount, nil
+	case entity.PromotionBuyXGetY:
+		if promo.BuyQuantity <= 0 || promo.GetQuantity <= 0 {
+			return money.Money{}, fmt.Errorf("promotion %s has an invalid buy/get quantity", promo.Code)
+		}
+		discount := money.Zero(remaining.Currency())
+		for _, line := range lines {
+			if line.ProductID != promo.ProductID || line.Quantity == 0 {
+				continue
+			}
+			// The free items are worth their share of the line total
+			free := line.Quantity / (promo.BuyQuantity + promo.GetQuantity) * promo.GetQuantity
+			share, err := line.FinalPrice.MulFrac(int64(free), int64(line.Quantity))
+			if err != nil {
+				return money.Money{}, err
+			}
+			discount = discount.Add(share)
+		}
+		if discount.IsZero() {
+			return money.Money{}, fmt.Errorf("promotion %s requires buying %d of product %d", promo.Code, promo.BuyQuantity+promo.GetQuantity, promo.ProductID)
+		}
+		return discount, nil
+	default:
+		return money.Money{}, fmt.Errorf("promotion %s has unknown type %s", promo.Code, promo.Type)
+	}
+}
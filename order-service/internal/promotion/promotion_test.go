@@ -0,0 +1,163 @@
+package promotion_test
+
+import (
+	"errors"
+	"order-service/internal/entity"
+	"order-service/internal/promotion"
+	"shared/money"
+	"testing"
+	"time"
+)
+
+// Mixing currencies panics in shared/money, so promotions in another currency than the order
+// have to be rejected before their amounts meet the order's.
+func TestCurrencyMismatch(t *testing.T) {
+	lines := []entity.ProductRequest{{ProductID: 1, Quantity: 2, FinalPrice: money.New(5000, "USD")}}
+	subtotal := money.New(5000, "USD")
+
+	tests := []struct {
+		name  string
+		promo entity.Promotion
+	}{
+		{"fixed", entity.Promotion{Code: "TENEUR", Type: entity.PromotionFixed, Amount: money.New(1000, "EUR"), Currency: "EUR"}},
+		{"min basket", entity.Promotion{Code: "PCTEUR", Type: entity.PromotionPercentage, Value: 0.1, MinBasket: money.New(2000, "EUR"), Currency: "EUR"}},
+	}
+	for _, test := range tests {
+		test.promo.Active = true
+		_, _, err := promotion.Apply([]*entity.Promotion{&test.promo}, lines, subtotal, time.Now())
+		if err == nil {
+			t.Errorf("%s promotion in EUR applied to a USD order", test.name)
+		}
+	}
+}
+
+// Percentage and buy-x-get-y promotions have no amounts of their own, so they apply to orders in
+// any currency.
+func TestOtherCurrency(t *testing.T) {
+	lines := []entity.ProductRequest{{ProductID: 1, Quantity: 3, FinalPrice: money.New(3000, "JPY")}}
+	subtotal := money.New(3000, "JPY")
+	promos := []*entity.Promotion{
+		{ID: 1, Code: "BUY2GET1", Type: entity.PromotionBuyXGetY, ProductID: 1, BuyQuantity: 2, GetQuantity: 1, Stackable: true, Active: true, Currency: "USD"},
+		{ID: 2, Code: "TENPCT", Type: entity.PromotionPercentage, Value: 0.1, Stackable: true, Active: true, Currency: "USD"},
+	}
+
+	_, discount, err := promotion.Apply(promos, lines, subtotal, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// one of three items free, then 10% off the remaining 2000
+	if want := money.New(1200, "JPY"); discount != want {
+		t.Errorf("discount is %s, want %s", discount, want)
+	}
+}
+
+func TestApply(t *testing.T) {
+	usd := func(cents int64) money.Money { return money.New(cents, "USD") }
+	line := func(productID, quantity int, total money.Money) entity.ProductRequest {
+		return entity.ProductRequest{ProductID: productID, Quantity: quantity, FinalPrice: total}
+	}
+	percentage := func(id int, value float64) *entity.Promotion {
+		return &entity.Promotion{ID: id, Code: "PCT", Type: entity.PromotionPercentage, Value: value, Currency: "USD", Stackable: true, Active: true}
+	}
+	fixed := func(id int, amount money.Money) *entity.Promotion {
+		return &entity.Promotion{ID: id, Code: "FIXED", Type: entity.PromotionFixed, Amount: amount, Currency: amount.Currency(), Stackable: true, Active: true}
+	}
+	buy2get1 := func(id, productID int) *entity.Promotion {
+		return &entity.Promotion{ID: id, Code: "BOGO", Type: entity.PromotionBuyXGetY, ProductID: productID, BuyQuantity: 2, GetQuantity: 1, Currency: "USD", Stackable: true, Active: true}
+	}
+	withMinBasket := func(promo *entity.Promotion, minBasket money.Money) *entity.Promotion {
+		promo.MinBasket = minBasket
+		return promo
+	}
+
+	tests := []struct {
+		name      string
+		promos    []*entity.Promotion
+		lines     []entity.ProductRequest
+		discounts []money.Money // Per applied promotion, in the order applied
+	}{
+		{"percentage", []*entity.Promotion{percentage(1, 0.1)}, []entity.ProductRequest{line(1, 1, usd(10000))}, []money.Money{usd(1000)}},
+		// 15% of 9.99 is 1.4985, rounded half away from zero
+		{"percentage rounded", []*entity.Promotion{percentage(1, 0.15)}, []entity.ProductRequest{line(1, 1, usd(999))}, []money.Money{usd(150)}},
+		{"percentage without minor units", []*entity.Promotion{percentage(1, 0.33)}, []entity.ProductRequest{line(1, 1, money.New(1001, "JPY"))}, []money.Money{money.New(330, "JPY")}},
+		{"fixed", []*entity.Promotion{fixed(1, usd(1000))}, []entity.ProductRequest{line(1, 1, usd(5000))}, []money.Money{usd(1000)}},
+		{"fixed above the subtotal", []*entity.Promotion{fixed(1, usd(8000))}, []entity.ProductRequest{line(1, 1, usd(5000))}, []money.Money{usd(5000)}},
+		{"buy 2 get 1", []*entity.Promotion{buy2get1(1, 1)}, []entity.ProductRequest{line(1, 3, usd(3000)), line(2, 1, usd(500))}, []money.Money{usd(1000)}},
+		{"buy 2 get 1 of 5", []*entity.Promotion{buy2get1(1, 1)}, []entity.ProductRequest{line(1, 5, usd(5000))}, []money.Money{usd(1000)}},
+		{"buy 2 get 1 of 6", []*entity.Promotion{buy2get1(1, 1)}, []entity.ProductRequest{line(1, 6, usd(6000))}, []money.Money{usd(2000)}},
+		// a free third of 10.00 is 3.333..., rounded down
+		{"buy 2 get 1 rounded", []*entity.Promotion{buy2get1(1, 1)}, []entity.ProductRequest{line(1, 3, usd(1000))}, []money.Money{usd(333)}},
+		{"min basket reached", []*entity.Promotion{withMinBasket(fixed(1, usd(500)), usd(5000))}, []entity.ProductRequest{line(1, 1, usd(5000))}, []money.Money{usd(500)}},
+		// buy-x-get-y first, then fixed amounts, then percentages of what is left
+		{"stacked", []*entity.Promotion{percentage(1, 0.1), fixed(2, usd(500)), buy2get1(3, 1)}, []entity.ProductRequest{line(1, 3, usd(3000)), line(2, 1, usd(7000))}, []money.Money{usd(1000), usd(500), usd(850)}},
+		// the percentage is of nothing once the fixed amount took the whole basket
+		{"stacked above the subtotal", []*entity.Promotion{fixed(1, usd(6000)), percentage(2, 0.5)}, []entity.ProductRequest{line(1, 1, usd(5000))}, []money.Money{usd(5000), usd(0)}},
+	}
+	for _, test := range tests {
+		subtotal := money.Zero(test.lines[0].FinalPrice.Currency())
+		for _, line := range test.lines {
+			subtotal = subtotal.Add(line.FinalPrice)
+		}
+
+		applied, discount, err := promotion.Apply(test.promos, test.lines, subtotal, time.Now())
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if len(applied) != len(test.discounts) {
+			t.Errorf("%s: %d promotions applied, want %d", test.name, len(applied), len(test.discounts))
+			continue
+		}
+		total := money.Zero(subtotal.Currency())
+		for i, want := range test.discounts {
+			if applied[i].Discount != want {
+				t.Errorf("%s: discount of %s is %s, want %s", test.name, applied[i].Code, applied[i].Discount, want)
+			}
+			total = total.Add(want)
+		}
+		if discount != total {
+			t.Errorf("%s: total discount is %s, want %s", test.name, discount, total)
+		}
+	}
+}
+
+func TestApplyRejected(t *testing.T) {
+	now := time.Now()
+	yesterday, tomorrow := now.Add(-24*time.Hour), now.Add(24*time.Hour)
+	lines := []entity.ProductRequest{{ProductID: 1, Quantity: 2, FinalPrice: money.New(4000, "USD")}}
+	subtotal := money.New(4000, "USD")
+	promo := func(change func(*entity.Promotion)) *entity.Promotion {
+		promo := &entity.Promotion{ID: 1, Code: "PCT", Type: entity.PromotionPercentage, Value: 0.1, Currency: "USD", Active: true}
+		change(promo)
+		return promo
+	}
+
+	tests := []struct {
+		name   string
+		promos []*entity.Promotion
+		want   error // Any error if nil
+	}{
+		{"inactive", []*entity.Promotion{promo(func(p *entity.Promotion) { p.Active = false })}, nil},
+		{"not started", []*entity.Promotion{promo(func(p *entity.Promotion) { p.StartsAt = &tomorrow })}, nil},
+		{"expired", []*entity.Promotion{promo(func(p *entity.Promotion) { p.EndsAt = &yesterday })}, nil},
+		{"used up", []*entity.Promotion{promo(func(p *entity.Promotion) { p.MaxUses, p.TimesUsed = 5, 5 })}, nil},
+		{"min basket", []*entity.Promotion{promo(func(p *entity.Promotion) { p.MinBasket = money.New(4001, "USD") })}, nil},
+		{"buy 2 get 1 of 2", []*entity.Promotion{promo(func(p *entity.Promotion) {
+			p.Type, p.ProductID, p.BuyQuantity, p.GetQuantity = entity.PromotionBuyXGetY, 1, 2, 1
+		})}, nil},
+		{"not stackable", []*entity.Promotion{
+			promo(func(p *entity.Promotion) {}),
+			promo(func(p *entity.Promotion) { p.ID, p.Stackable = 2, true }),
+		}, promotion.ErrNotStackable},
+		{"duplicate", []*entity.Promotion{
+			promo(func(p *entity.Promotion) { p.Stackable = true }),
+			promo(func(p *entity.Promotion) { p.Stackable = true }),
+		}, promotion.ErrDuplicate},
+	}
+	for _, test := range tests {
+		_, _, err := promotion.Apply(test.promos, lines, subtotal, now)
+		if err == nil || test.want != nil && !errors.Is(err, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.want)
+		}
+	}
+}
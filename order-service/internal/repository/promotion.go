@@ -0,0 +1,181 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"order-service/internal/entity"
+	"shared/money"
+)
+
+// PromotionRepository stores promotions and their redemptions. Promotions are global, so they
+// live in a single database instead of being sharded by order.
+type PromotionRepository struct {
+	db *sql.DB
+}
+
+func NewPromotionRepository(db *sql.DB) *PromotionRepository {
+	return &PromotionRepository{db}
+}
+
+const promotionColumns = `id, code, type, currency, value, amount, product_id, buy_quantity, get_quantity, min_basket, max_uses, max_uses_per_user, times_used, stackable, active, starts_at, ends_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanPromotion(row rowScanner) (*entity.Promotion, error) {
+	promo := &entity.Promotion{}
+	var startsAt, endsAt sql.NullTime
+	err := row.Scan(&promo.ID, &promo.Code, &promo.Type, &promo.Currency, &promo.Value, money.ScanIn(&promo.Currency, &promo.Amount), &promo.ProductID, &promo.BuyQuantity, &promo.GetQuantity, money.ScanIn(&promo.Currency, &promo.MinBasket), &promo.MaxUses, &promo.MaxUsesPerUser, &promo.TimesUsed, &promo.Stackable, &promo.Active, &startsAt, &endsAt)
+	if err != nil {
+		return nil, err
+	}
+	if startsAt.Valid {
+		promo.StartsAt = &startsAt.Time
+	}
+	if endsAt.Valid {
+		promo.EndsAt = &endsAt.Time
+	}
+	return promo, nil
+}
+
+func (r *PromotionRepository) CreatePromotion(ctx context.Context, promo *entity.Promotion) (*entity.Promotion, error) {
+	query := `INSERT INTO promotions (code, type, currency, value, amount, product_id, buy_quantity, get_quantity, min_basket, max_uses, max_uses_per_user, stackable, active, starts_at, ends_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	res, err := r.db.ExecContext(ctx, query, promo.Code, promo.Type, promo.Currency, promo.Value, promo.Amount, promo.ProductID, promo.BuyQuantity, promo.GetQuantity, promo.MinBasket, promo.MaxUses, promo.MaxUsesPerUser, promo.Stackable, promo.Active, promo.StartsAt, promo.EndsAt)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	promo.ID = int(id)
+	return promo, nil
+}
+
+func (r *PromotionRepository) GetPromotionByCode(ctx context.Context, code string) (*entity.Promotion, error) {
+	query := `SELECT ` + promotionColumns + ` FROM promotions WHERE code = ?`
+	promo, err := scanPromotion(r.db.QueryRowContext(ctx, query, code))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("promotion %s not found", code)
+		}
+		return nil, err
+	}
+	return promo, nil
+}
+
+// Redeem records the redemption of each applied promotion for a stored order, under its ID. The
+// promotion rows are locked for the duration of the transaction so global and per-user limits
+// hold under concurrency.
+func (r *PromotionRepository) Redeem(ctx context.Context, order *entity.Order) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, applied := range order.AppliedPromotions {
+		query := `SELECT ` + promotionColumns + ` FROM promotions WHERE id = ? FOR UPDATE`
+		promo, err := scanPromotion(tx.QueryRowContext(ctx, query, applied.PromotionID))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if promo.MaxUses > 0 && promo.TimesUsed >= promo.MaxUses {
+			tx.Rollback()
+			return fmt.Errorf("promotion %s has reached its usage limit", promo.Code)
+		}
+
+		if promo.MaxUsesPerUser > 0 {
+			var userUses int
+			countQuery := `SELECT COUNT(*) FROM promotion_redemptions WHERE promotion_id = ? AND user_id = ?`
+			err = tx.QueryRowContext(ctx, countQuery, promo.ID, order.UserID).Scan(&userUses)
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+			if userUses >= promo.MaxUsesPerUser {
+				tx.Rollback()
+				return fmt.Errorf("promotion %s has reached its usage limit for this user", promo.Code)
+			}
+		}
+
+		insertQuery := `INSERT INTO promotion_redemptions (promotion_id, order_id, user_id, discount, currency) VALUES (?, ?, ?, ?, ?)`
+		_, err = tx.ExecContext(ctx, insertQuery, promo.ID, order.ID, order.UserID, applied.Discount, applied.Discount.Currency())
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		updateQuery := `UPDATE promotions SET times_used = times_used + 1 WHERE id = ?`
+		_, err = tx.ExecContext(ctx, updateQuery, promo.ID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Release removes the redemptions of the order with ID orderID and gives the uses back to their
+// promotions. It is called when an order is cancelled.
+func (r *PromotionRepository) Release(ctx context.Context, orderID int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	updateQuery := `UPDATE promotions p
+		JOIN (SELECT promotion_id, COUNT(*) AS uses FROM promotion_redemptions WHERE order_id = ? GROUP BY promotion_id) r
+		ON p.id = r.promotion_id
+		SET p.times_used = GREATEST(p.times_used - r.uses, 0)`
+	_, err = tx.ExecContext(ctx, updateQuery, orderID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	deleteQuery := `DELETE FROM promotion_redemptions WHERE order_id = ?`
+	_, err = tx.ExecContext(ctx, deleteQuery, orderID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *PromotionRepository) GetRedemptionsByOrder(ctx context.Context, orderID int) ([]entity.Redemption, error) {
+	query := `SELECT id, promotion_id, order_id, user_id, currency, discount, created_at FROM promotion_redemptions WHERE order_id = ?`
+	rows, err := r.db.QueryContext(ctx, query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var redemptions []entity.Redemption
+	for rows.Next() {
+		redemption := entity.Redemption{}
+		var currency string
+		err := rows.Scan(&redemption.ID, &redemption.PromotionID, &redemption.OrderID, &redemption.UserID, &currency, money.ScanIn(&currency, &redemption.Discount), &redemption.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		redemptions = append(redemptions, redemption)
+	}
+
+	return redemptions, rows.Err()
+}
+
+// EraseUser detaches a user's promotion redemptions from their account.
+func (r *PromotionRepository) EraseUser(ctx context.Context, userID int) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE promotion_redemptions SET user_id = ? WHERE user_id = ?`, entity.ErasedUserID, userID)
+	return err
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"order-service/internal/entity"
+	"regexp"
+	"shared/money"
+	"strings"
+	"testing"
+)
+
+func mockPromotions(t *testing.T) (*PromotionRepository, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	return NewPromotionRepository(db), mock
+}
+
+// promotionRow is promotion 3, TENOFF, with the given limits and uses.
+func promotionRow(maxUses, maxUsesPerUser, timesUsed int) *sqlmock.Rows {
+	return sqlmock.NewRows(strings.Split(promotionColumns, ", ")).
+		AddRow(3, "TENOFF", "percentage", "USD", 0.1, "0", 0, 0, 0, "0", maxUses, maxUsesPerUser, timesUsed, true, true, nil, nil)
+}
+
+// redeemedOrder is order 42 of user 7, stored with the order ID 1234.
+var redeemedOrder = &entity.Order{
+	ID:                42,
+	OrderID:           1234,
+	UserID:            7,
+	AppliedPromotions: []entity.AppliedPromotion{{PromotionID: 3, Code: "TENOFF", Type: entity.PromotionPercentage, Discount: money.New(500, "USD")}},
+}
+
+func TestRedeem(t *testing.T) {
+	repo, mock := mockPromotions(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM promotions WHERE id = ? FOR UPDATE")).WithArgs(3).WillReturnRows(promotionRow(10, 2, 9))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM promotion_redemptions WHERE promotion_id = ? AND user_id = ?")).
+		WithArgs(3, 7).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	// recorded under the order's ID, its order ID isn't unique
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO promotion_redemptions")).
+		WithArgs(3, 42, 7, money.New(500, "USD"), "USD").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE promotions SET times_used = times_used + 1 WHERE id = ?")).
+		WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := repo.Redeem(context.Background(), redeemedOrder); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRedeemGlobalLimit(t *testing.T) {
+	repo, mock := mockPromotions(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM promotions WHERE id = ? FOR UPDATE")).WithArgs(3).WillReturnRows(promotionRow(10, 0, 10))
+	mock.ExpectRollback()
+
+	err := repo.Redeem(context.Background(), redeemedOrder)
+	if err == nil || !strings.Contains(err.Error(), "usage limit") {
+		t.Fatalf("got %v, want the usage limit error", err)
+	}
+}
+
+func TestRedeemPerUserLimit(t *testing.T) {
+	repo, mock := mockPromotions(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM promotions WHERE id = ? FOR UPDATE")).WithArgs(3).WillReturnRows(promotionRow(0, 2, 50))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM promotion_redemptions WHERE promotion_id = ? AND user_id = ?")).
+		WithArgs(3, 7).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectRollback()
+
+	err := repo.Redeem(context.Background(), redeemedOrder)
+	if err == nil || !strings.Contains(err.Error(), "for this user") {
+		t.Fatalf("got %v, want the per-user limit error", err)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	repo, mock := mockPromotions(t)
+	// only the redemptions of order 42 are given back
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("FROM promotion_redemptions WHERE order_id = ? GROUP BY promotion_id")).
+		WithArgs(42).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM promotion_redemptions WHERE order_id = ?")).
+		WithArgs(42).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := repo.Release(context.Background(), 42); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"database/sql"
 	"order-service/internal/entity"
 	"order-service/internal/sharding"
+	"shared/money"
+	"sort"
+	"time"
 )
 
 type OrderRepository struct {
@@ -16,20 +19,35 @@ func NewOrderRepository(dbShards []*sql.DB, router *sharding.ShardRouter) *Order
 	return &OrderRepository{dbShards, router}
 }
 
+// locate returns the shard of an order and its ID there. Orders are placed on the shard of their
+// order ID, and their ID is unique across the shards and leads back to it.
+func (r *OrderRepository) locate(id int) (*sql.DB, int, error) {
+	if id < r.router.ShardCount {
+		return nil, 0, sql.ErrNoRows
+	}
+	return r.dbShards[r.router.GetShard(id)], r.router.LocalID(id), nil
+}
+
 func (r *OrderRepository) GetOrderByID(ctx context.Context, id int) (*entity.Order, error) {
-	orderQuery := `SELECT id, user_id, quantity, total, status, total_mark_up, total_discount, order_id FROM orders WHERE id = ?`
-	productRequestQuery := `SELECT product_id, quantity, mark_up, discount, final_price FROM product_requests WHERE order_id = ?`
+	orderQuery := `SELECT id, user_id, api_key_id, quantity, currency, exchange_rate, rate_version, subtotal, promotion_discount, tax_jurisdiction, prices_include_tax, tax_total, total, status, total_mark_up, total_discount, order_id, created_at FROM orders WHERE id = ?`
+	productRequestQuery := `SELECT product_id, quantity, mark_up, discount, final_price, exchange_rate, tax_category, tax_rate, tax FROM product_requests WHERE order_id = ?`
+	promotionQuery := `SELECT promotion_id, code, type, discount FROM order_promotions WHERE order_id = ?`
+	taxQuery := `SELECT category, rate, taxable, tax FROM order_taxes WHERE order_id = ?`
+	addressQuery := `SELECT kind, address_id, name, line1, line2, city, region, postal_code, country, phone FROM order_addresses WHERE order_id = ?`
 
-	dbIndex := r.router.GetShard(id)
-	db := r.dbShards[dbIndex]
+	db, localID, err := r.locate(id)
+	if err != nil {
+		return nil, err
+	}
 
 	order := &entity.Order{}
-	err := db.QueryRowContext(ctx, orderQuery, id).Scan(&order.ID, &order.UserID, &order.Quantity, &order.Total, &order.Status, &order.TotalMarkUp, &order.TotalDiscount, &order.OrderID)
+	err = db.QueryRowContext(ctx, orderQuery, localID).Scan(&order.ID, &order.UserID, &order.APIKeyID, &order.Quantity, &order.Currency, &order.ExchangeRate, &order.RateVersion, money.ScanIn(&order.Currency, &order.Subtotal), money.ScanIn(&order.Currency, &order.PromotionDiscount), &order.TaxJurisdiction, &order.PricesIncludeTax, money.ScanIn(&order.Currency, &order.TaxTotal), money.ScanIn(&order.Currency, &order.Total), &order.Status, &order.TotalMarkUp, &order.TotalDiscount, &order.OrderID, &order.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
+	order.ID = id
 
-	rows, err := db.QueryContext(ctx, productRequestQuery, id)
+	rows, err := db.QueryContext(ctx, productRequestQuery, localID)
 	if err != nil {
 		return nil, err
 	}
@@ -37,13 +55,66 @@ func (r *OrderRepository) GetOrderByID(ctx context.Context, id int) (*entity.Ord
 
 	for rows.Next() {
 		productRequest := entity.ProductRequest{}
-		err := rows.Scan(&productRequest.ProductID, &productRequest.Quantity, &productRequest.MarkUp, &productRequest.Discount, &productRequest.FinalPrice)
+		err := rows.Scan(&productRequest.ProductID, &productRequest.Quantity, &productRequest.MarkUp, &productRequest.Discount, money.ScanIn(&order.Currency, &productRequest.FinalPrice), &productRequest.ExchangeRate, &productRequest.TaxCategory, &productRequest.TaxRate, money.ScanIn(&order.Currency, &productRequest.Tax))
 		if err != nil {
 			return nil, err
 		}
 		order.ProductRequests = append(order.ProductRequests, productRequest)
 	}
 
+	promotionRows, err := db.QueryContext(ctx, promotionQuery, localID)
+	if err != nil {
+		return nil, err
+	}
+	defer promotionRows.Close()
+
+	for promotionRows.Next() {
+		applied := entity.AppliedPromotion{}
+		err := promotionRows.Scan(&applied.PromotionID, &applied.Code, &applied.Type, money.ScanIn(&order.Currency, &applied.Discount))
+		if err != nil {
+			return nil, err
+		}
+		order.AppliedPromotions = append(order.AppliedPromotions, applied)
+	}
+
+	taxRows, err := db.QueryContext(ctx, taxQuery, localID)
+	if err != nil {
+		return nil, err
+	}
+	defer taxRows.Close()
+
+	for taxRows.Next() {
+		taxLine := entity.TaxLine{}
+		err := taxRows.Scan(&taxLine.Category, &taxLine.Rate, money.ScanIn(&order.Currency, &taxLine.Taxable), money.ScanIn(&order.Currency, &taxLine.Tax))
+		if err != nil {
+			return nil, err
+		}
+		order.Taxes = append(order.Taxes, taxLine)
+	}
+
+	addressRows, err := db.QueryContext(ctx, addressQuery, localID)
+	if err != nil {
+		return nil, err
+	}
+	defer addressRows.Close()
+
+	for addressRows.Next() {
+		var kind string
+		address := &entity.Address{}
+		err := addressRows.Scan(&kind, &address.AddressID, &address.Name, &address.Line1, &address.Line2, &address.City, &address.Region, &address.PostalCode, &address.Country, &address.Phone)
+		if err != nil {
+			return nil, err
+		}
+		switch kind {
+		case entity.AddressShipping:
+			order.ShippingAddress = address
+			order.ShippingAddressID = address.AddressID
+		case entity.AddressBilling:
+			order.BillingAddress = address
+			order.BillingAddressID = address.AddressID
+		}
+	}
+
 	return order, nil
 }
 
@@ -58,8 +129,9 @@ func (r *OrderRepository) CreateOrder(ctx context.Context, order *entity.Order)
 	}
 
 	// Insert order
-	orderQuery := `INSERT INTO orders (user_id, order_id, quantity, total, status, total_mark_up, total_discount, idempotent_key) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
-	res, err := tx.ExecContext(ctx, orderQuery, order.UserID, order.OrderID, order.Quantity, order.Total, order.Status, order.TotalMarkUp, order.TotalDiscount, order.IdempotentKey)
+	order.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	orderQuery := `INSERT INTO orders (user_id, api_key_id, order_id, quantity, currency, exchange_rate, rate_version, subtotal, promotion_discount, tax_jurisdiction, prices_include_tax, tax_total, total, status, total_mark_up, total_discount, idempotent_key, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	res, err := tx.ExecContext(ctx, orderQuery, order.UserID, order.APIKeyID, order.OrderID, order.Quantity, order.Currency, order.ExchangeRate, order.RateVersion, order.Subtotal, order.PromotionDiscount, order.TaxJurisdiction, order.PricesIncludeTax, order.TaxTotal, order.Total, order.Status, order.TotalMarkUp, order.TotalDiscount, order.IdempotentKey, order.CreatedAt)
 	if err != nil {
 		tx.Rollback()
 		return nil, err
@@ -85,14 +157,14 @@ func (r *OrderRepository) CreateOrder(ctx context.Context, order *entity.Order)
 
 	// Insert product requests with batch
 	productQuery := `
-		INSERT INTO product_requests (order_id, product_id, quantity, mark_up, discount, final_price)
+		INSERT INTO product_requests (order_id, product_id, quantity, mark_up, discount, final_price, exchange_rate, tax_category, tax_rate, tax)
 		VALUES `
 
 	// Build the query
 	var values []interface{}
 	for _, product := range order.ProductRequests {
-		productQuery += "(?, ?, ?, ?, ?, ?),"
-		values = append(values, orderID, product.ProductID, product.Quantity, product.MarkUp, product.Discount, product.FinalPrice)
+		productQuery += "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?),"
+		values = append(values, orderID, product.ProductID, product.Quantity, product.MarkUp, product.Discount, product.FinalPrice, product.ExchangeRate, product.TaxCategory, product.TaxRate, product.Tax)
 	}
 
 	// Remove the trailing comma
@@ -105,19 +177,56 @@ func (r *OrderRepository) CreateOrder(ctx context.Context, order *entity.Order)
 		return nil, err
 	}
 
+	// Insert applied promotions
+	promotionQuery := `INSERT INTO order_promotions (order_id, promotion_id, code, type, discount) VALUES (?, ?, ?, ?, ?)`
+	for _, applied := range order.AppliedPromotions {
+		_, err := tx.ExecContext(ctx, promotionQuery, orderID, applied.PromotionID, applied.Code, applied.Type, applied.Discount)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	// Insert the tax breakdown
+	taxQuery := `INSERT INTO order_taxes (order_id, category, rate, taxable, tax) VALUES (?, ?, ?, ?, ?)`
+	for _, taxLine := range order.Taxes {
+		_, err := tx.ExecContext(ctx, taxQuery, orderID, taxLine.Category, taxLine.Rate, taxLine.Taxable, taxLine.Tax)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	// Insert the address copies
+	addressQuery := `INSERT INTO order_addresses (order_id, kind, address_id, name, line1, line2, city, region, postal_code, country, phone) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	for kind, address := range map[string]*entity.Address{entity.AddressShipping: order.ShippingAddress, entity.AddressBilling: order.BillingAddress} {
+		if address == nil {
+			continue
+		}
+		_, err := tx.ExecContext(ctx, addressQuery, orderID, kind, address.AddressID, address.Name, address.Line1, address.Line2, address.City, address.Region, address.PostalCode, address.Country, address.Phone)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
 	// Commit the transaction
 	err = tx.Commit()
 	if err != nil {
 		return nil, err
 	}
 
-	order.ID = int(orderID)
+	order.ID = r.router.GlobalID(dbIndex, int(orderID))
 	return order, nil
 }
 
+// UpdateOrder writes an order back to the shard its ID leads to, with its lines and tax
+// breakdown. The order ID, currency and addresses are left as stored.
 func (r *OrderRepository) UpdateOrder(ctx context.Context, order *entity.Order) (*entity.Order, error) {
-	dbIndex := r.router.GetShard(order.OrderID)
-	db := r.dbShards[dbIndex]
+	db, localID, err := r.locate(order.ID)
+	if err != nil {
+		return nil, err
+	}
 
 	// Start a transaction
 	tx, err := db.BeginTx(ctx, nil)
@@ -126,8 +235,8 @@ func (r *OrderRepository) UpdateOrder(ctx context.Context, order *entity.Order)
 	}
 
 	// Update order
-	orderQuery := `UPDATE orders SET user_id = ?, quantity = ?, total = ?, status = ?, total_mark_up = ?, total_discount = ? WHERE id = ?`
-	_, err = tx.ExecContext(ctx, orderQuery, order.UserID, order.Quantity, order.Total, order.Status, order.TotalMarkUp, order.TotalDiscount, order.ID)
+	orderQuery := `UPDATE orders SET user_id = ?, quantity = ?, subtotal = ?, promotion_discount = ?, tax_jurisdiction = ?, prices_include_tax = ?, tax_total = ?, total = ?, status = ?, total_mark_up = ?, total_discount = ? WHERE id = ?`
+	_, err = tx.ExecContext(ctx, orderQuery, order.UserID, order.Quantity, order.Subtotal, order.PromotionDiscount, order.TaxJurisdiction, order.PricesIncludeTax, order.TaxTotal, order.Total, order.Status, order.TotalMarkUp, order.TotalDiscount, localID)
 	if err != nil {
 		tx.Rollback()
 		return nil, err
@@ -135,7 +244,7 @@ func (r *OrderRepository) UpdateOrder(ctx context.Context, order *entity.Order)
 
 	// Delete existing product requests
 	deleteQuery := `DELETE FROM product_requests WHERE order_id = ?`
-	_, err = tx.ExecContext(ctx, deleteQuery, order.ID)
+	_, err = tx.ExecContext(ctx, deleteQuery, localID)
 	if err != nil {
 		tx.Rollback()
 		return nil, err
@@ -143,10 +252,29 @@ func (r *OrderRepository) UpdateOrder(ctx context.Context, order *entity.Order)
 
 	// Insert product requests
 	productQuery := `
-		INSERT INTO product_requests (order_id, product_id, quantity, mark_up, discount, final_price)
-		VALUES (?, ?, ?, ?, ?, ?)`
+		INSERT INTO product_requests (order_id, product_id, quantity, mark_up, discount, final_price, exchange_rate, tax_category, tax_rate, tax)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 	for _, product := range order.ProductRequests {
-		_, err := tx.ExecContext(ctx, productQuery, order.ID, product.ProductID, product.Quantity, product.MarkUp, product.Discount, product.FinalPrice)
+		exchangeRate := product.ExchangeRate
+		if exchangeRate == 0 {
+			exchangeRate = 1
+		}
+		_, err := tx.ExecContext(ctx, productQuery, localID, product.ProductID, product.Quantity, product.MarkUp, product.Discount, product.FinalPrice, exchangeRate, product.TaxCategory, product.TaxRate, product.Tax)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	// Replace the tax breakdown
+	_, err = tx.ExecContext(ctx, `DELETE FROM order_taxes WHERE order_id = ?`, localID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	taxQuery := `INSERT INTO order_taxes (order_id, category, rate, taxable, tax) VALUES (?, ?, ?, ?, ?)`
+	for _, taxLine := range order.Taxes {
+		_, err := tx.ExecContext(ctx, taxQuery, localID, taxLine.Category, taxLine.Rate, taxLine.Taxable, taxLine.Tax)
 		if err != nil {
 			tx.Rollback()
 			return nil, err
@@ -163,8 +291,10 @@ func (r *OrderRepository) UpdateOrder(ctx context.Context, order *entity.Order)
 }
 
 func (r *OrderRepository) DeleteOrder(ctx context.Context, id int) error {
-	dbIndex := r.router.GetShard(id)
-	db := r.dbShards[dbIndex]
+	db, localID, err := r.locate(id)
+	if err != nil {
+		return err
+	}
 
 	// Start a transaction
 	tx, err := db.BeginTx(ctx, nil)
@@ -174,7 +304,7 @@ func (r *OrderRepository) DeleteOrder(ctx context.Context, id int) error {
 
 	// Delete product requests
 	productQuery := `DELETE FROM product_requests WHERE order_id = ?`
-	_, err = tx.ExecContext(ctx, productQuery, id)
+	_, err = tx.ExecContext(ctx, productQuery, localID)
 	if err != nil {
 		tx.Rollback()
 		return err
@@ -182,7 +312,7 @@ func (r *OrderRepository) DeleteOrder(ctx context.Context, id int) error {
 
 	// Delete order
 	orderQuery := `DELETE FROM orders WHERE id = ?`
-	_, err = tx.ExecContext(ctx, orderQuery, id)
+	_, err = tx.ExecContext(ctx, orderQuery, localID)
 	if err != nil {
 		tx.Rollback()
 		return err
@@ -198,14 +328,98 @@ func (r *OrderRepository) DeleteOrder(ctx context.Context, id int) error {
 }
 
 func (r *OrderRepository) UpdateOrderStatus(ctx context.Context, id int, status string) error {
-	dbIndex := r.router.GetShard(id)
-	db := r.dbShards[dbIndex]
+	db, localID, err := r.locate(id)
+	if err != nil {
+		return err
+	}
 
 	query := `UPDATE orders SET status = ? WHERE id = ?`
-	_, err := db.ExecContext(ctx, query, status, id)
+	_, err = db.ExecContext(ctx, query, status, localID)
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// EraseUser detaches a user's orders from their account and deletes the addresses copied onto
+// them, on every shard, returning how many orders were changed. Orders are sharded by order ID,
+// so all shards are searched.
+func (r *OrderRepository) EraseUser(ctx context.Context, userID int) (int, error) {
+	erased := 0
+	for _, db := range r.dbShards {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return erased, err
+		}
+
+		addressQuery := `DELETE a FROM order_addresses a JOIN orders o ON o.id = a.order_id WHERE o.user_id = ?`
+		_, err = tx.ExecContext(ctx, addressQuery, userID)
+		if err != nil {
+			tx.Rollback()
+			return erased, err
+		}
+
+		res, err := tx.ExecContext(ctx, `UPDATE orders SET user_id = ?, api_key_id = 0 WHERE user_id = ?`, entity.ErasedUserID, userID)
+		if err != nil {
+			tx.Rollback()
+			return erased, err
+		}
+		count, err := res.RowsAffected()
+		if err != nil {
+			tx.Rollback()
+			return erased, err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return erased, err
+		}
+		erased += int(count)
+	}
+	return erased, nil
+}
+
+// OrderHistory returns the orders placed from from up to but excluding to, oldest first, with their
+// product requests. Promotions, taxes and addresses are left out. Orders are sharded by order ID,
+// so all shards are searched.
+func (r *OrderRepository) OrderHistory(ctx context.Context, from, to time.Time) ([]entity.Order, error) {
+	query := `SELECT o.id, o.user_id, o.order_id, o.quantity, o.currency, o.exchange_rate, o.rate_version, o.subtotal, o.promotion_discount, o.total, o.status, o.total_mark_up, o.total_discount, o.created_at, p.product_id, p.quantity, p.mark_up, p.discount, p.final_price, p.exchange_rate FROM orders o JOIN product_requests p ON p.order_id = o.id WHERE o.created_at >= ? AND o.created_at < ? ORDER BY o.created_at, o.id, p.id`
+
+	var orders []entity.Order
+	for shard, db := range r.dbShards {
+		rows, err := db.QueryContext(ctx, query, from.UTC(), to.UTC())
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+			order := entity.Order{}
+			productRequest := entity.ProductRequest{}
+			err := rows.Scan(&order.ID, &order.UserID, &order.OrderID, &order.Quantity, &order.Currency, &order.ExchangeRate, &order.RateVersion, money.ScanIn(&order.Currency, &order.Subtotal), money.ScanIn(&order.Currency, &order.PromotionDiscount), money.ScanIn(&order.Currency, &order.Total), &order.Status, &order.TotalMarkUp, &order.TotalDiscount, &order.CreatedAt, &productRequest.ProductID, &productRequest.Quantity, &productRequest.MarkUp, &productRequest.Discount, money.ScanIn(&order.Currency, &productRequest.FinalPrice), &productRequest.ExchangeRate)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			order.ID = r.router.GlobalID(shard, order.ID)
+
+			// the rows of an order follow each other
+			if last := len(orders) - 1; last >= 0 && orders[last].ID == order.ID {
+				orders[last].ProductRequests = append(orders[last].ProductRequests, productRequest)
+				continue
+			}
+			order.ProductRequests = []entity.ProductRequest{productRequest}
+			orders = append(orders, order)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the shards are merged by the time the orders were placed
+	sort.SliceStable(orders, func(i, j int) bool {
+		return orders[i].CreatedAt.Before(orders[j].CreatedAt)
+	})
+	return orders, nil
+}
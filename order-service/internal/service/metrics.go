@@ -0,0 +1,23 @@
+package service
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	ordersCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "orders_created_total",
+		Help: "Orders stored.",
+	})
+
+	ordersCancelled = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "orders_cancelled_total",
+		Help: "Orders cancelled.",
+	})
+
+	pricingFallbacks = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pricing_fallbacks_total",
+		Help: "Order lines priced at the last known price because the pricing was unavailable.",
+	})
+)
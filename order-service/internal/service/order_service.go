@@ -6,53 +6,73 @@ import (
 	"errors"
 	"fmt"
 	"github.com/go-redis/redis/v8"
-	"github.com/rs/zerolog"
 	"github.com/segmentio/kafka-go"
+	"math"
 	"math/rand"
 	"net/http"
 	"order-service/internal/entity"
 	"order-service/internal/repository"
+	"order-service/internal/tax"
 	"os"
+	"shared/logging"
+	"shared/metrics"
+	"shared/money"
+	"shared/pricing"
+	"shared/tracing"
+	"slices"
 	"time"
 )
 
-var logger = zerolog.New(os.Stdout).With().Timestamp().Logger()
+var logger = logging.Logger
+
+// lastKnownPricingTTL is how long a price can be used while pricing is unavailable.
+const lastKnownPricingTTL = 24 * time.Hour
 
 // OrderService is a service that provides order-related operations
 type OrderService struct {
 	orderRepo         repository.OrderRepository
 	productServiceURL string
-	pricingServiceURL string
+	userServiceURL    string
+	productClient     *http.Client
+	userClient        *http.Client
+	pricingClient     *pricing.Client
 	kafkaWriter       *kafka.Writer
 	rdb               *redis.Client
+	promotionService  *PromotionService
+	taxEngine         *tax.Engine
 }
 
 // NewOrderService creates a new instance of OrderService
-func NewOrderService(orderRepo repository.OrderRepository, productServiceURL, pricingServiceURL string, kafkaWriter *kafka.Writer, rdb *redis.Client) *OrderService {
+func NewOrderService(orderRepo repository.OrderRepository, productServiceURL, userServiceURL string, productClient, userClient *http.Client, pricingClient *pricing.Client, kafkaWriter *kafka.Writer, rdb *redis.Client, promotionService *PromotionService, taxEngine *tax.Engine) *OrderService {
 	return &OrderService{
 		orderRepo:         orderRepo,
 		productServiceURL: productServiceURL,
-		pricingServiceURL: pricingServiceURL,
+		userServiceURL:    userServiceURL,
+		productClient:     productClient,
+		userClient:        userClient,
+		pricingClient:     pricingClient,
 		kafkaWriter:       kafkaWriter,
 		rdb:               rdb,
+		promotionService:  promotionService,
+		taxEngine:         taxEngine,
 	}
 }
 
 /*
 To implement concurrency using goroutines and channels for the CreateOrder function,
-we need to perform the checkProductStock and getPricing for each product concurrently.
-Each of these functions can be executed in its own goroutine, and we'll use channels to collect the results for each product.
+we need to perform the checkProductStock for each product concurrently, while the whole cart is priced with priceCart.
+Each check can be executed in its own goroutine, and we'll use a channel to collect the results for each product.
 
 Approach:
 Asynchronous Execution:
 
-We will use goroutines for both s.checkProductStock and s.getPricing for each product in the order.
-This will allow the order creation to proceed without waiting for each product's availability check and pricing retrieval.
+We will use a goroutine for s.checkProductStock for each product in the order, and price the cart meanwhile.
+This will allow the order creation to proceed without waiting for each product's availability check.
 
 Channels for Communication:
 
-We will use channels to collect the results of the availability check (checkProductStock) and pricing (getPricing).
-Since both tasks are independent, they will be processed asynchronously using goroutines.
+We will use a channel to collect the results of the availability check (checkProductStock).
+Since pricing is independent of it, both are processed at the same time.
 
 Error Handling:
 
@@ -74,6 +94,19 @@ func (s *OrderService) CreateOrder(ctx context.Context, order *entity.Order) (*e
 	}
 
 	order.OrderID = randomOrderID()
+	ctx = logging.WithOrderID(ctx, order.OrderID)
+
+	// addresses are copied from the address book, so later edits don't change the order
+	err = s.resolveAddresses(ctx, order)
+	if err != nil {
+		logger.Warn().Ctx(ctx).Err(err).Msgf("Error resolving addresses for order %d", order.OrderID)
+		return nil, err
+	}
+
+	// all prices of the order are requested in its currency
+	order.Currency = money.Zero(order.Currency).Currency()
+	order.ExchangeRate = 1
+	order.RateVersion = 0
 
 	availabilityCh := make(chan struct {
 		ProductID int
@@ -81,31 +114,23 @@ func (s *OrderService) CreateOrder(ctx context.Context, order *entity.Order) (*e
 		Error     error
 	}, len(order.ProductRequests))
 
-	pricingCh := make(chan struct {
-		ProductID  int
-		FinalPrice float64
-		MarkUp     float64
-		Discount   float64
-		Error      error
-	}, len(order.ProductRequests))
-
 	for _, productRequest := range order.ProductRequests {
 		//// check product availability
 		//available, err := s.checkProductStock(productRequest.ProductID, productRequest.Quantity)
 		//if err != nil {
-		//	logger.Error().Err(err).Msgf("Error checking product stock for product %d", productRequest.ProductID)
+		//	logger.Error().Ctx(ctx).Err(err).Msgf("Error checking product stock for product %d", productRequest.ProductID)
 		//	return nil, err
 		//}
 		//
 		//// get pricing
 		//pricing, err := s.getPricing(productRequest.ProductID)
 		//if err != nil {
-		//	logger.Error().Err(err).Msgf("Error getting pricing for product %d", productRequest.ProductID)
+		//	logger.Error().Ctx(ctx).Err(err).Msgf("Error getting pricing for product %d", productRequest.ProductID)
 		//	return nil, err
 		//}
 		//
 		//if !available {
-		//	logger.Warn().Msgf("Product %d out of stock", productRequest.ProductID)
+		//	logger.Warn().Ctx(ctx).Msgf("Product %d out of stock", productRequest.ProductID)
 		//	return nil, fmt.Errorf("product out of stock")
 		//}
 		//
@@ -125,64 +150,87 @@ func (s *OrderService) CreateOrder(ctx context.Context, order *entity.Order) (*e
 				Error:     err,
 			}
 		}(&productRequest)
-
-		go func(productRequest *entity.ProductRequest) {
-			pricing, err := s.getPricing(ctx, productRequest.ProductID)
-			pricingCh <- struct {
-				ProductID  int
-				FinalPrice float64
-				MarkUp     float64
-				Discount   float64
-				Error      error
-			}{
-				ProductID:  productRequest.ProductID,
-				FinalPrice: pricing.FinalPrice,
-				MarkUp:     pricing.Markup,
-				Discount:   pricing.Discount,
-				Error:      err,
-			}
-		}(&productRequest)
 	}
 
+	// all converted prices of the cart use the same exchange rates
+	lines, pricingErr := s.priceCart(ctx, order)
+
 	for range order.ProductRequests {
 		availabilityResult := <-availabilityCh
-		pricingResult := <-pricingCh
 
 		if availabilityResult.Error != nil {
-			logger.Error().Err(availabilityResult.Error).Msgf("Error checking product stock for product %d", availabilityResult.ProductID)
+			logger.Error().Ctx(ctx).Err(availabilityResult.Error).Msgf("Error checking product stock for product %d", availabilityResult.ProductID)
 			return nil, availabilityResult.Error
 		}
 
 		if !availabilityResult.Available {
-			logger.Warn().Msgf("Product %d out of stock", availabilityResult.ProductID)
+			logger.Warn().Ctx(ctx).Msgf("Product %d out of stock", availabilityResult.ProductID)
 			return nil, fmt.Errorf("product out of stock")
 		}
+	}
+
+	if pricingErr != nil {
+		logger.Error().Ctx(ctx).Err(pricingErr).Msgf("Error getting pricing for order %d", order.OrderID)
+		return nil, pricingErr
+	}
 
-		if pricingResult.Error != nil {
-			logger.Error().Err(pricingResult.Error).Msgf("Error getting pricing for product %d", pricingResult.ProductID)
-			return nil, pricingResult.Error
+	// lines are in the order of the product requests
+	for i, line := range lines {
+		if line.UnitPrice.Currency() != order.Currency {
+			return nil, fmt.Errorf("pricing for product %d is in %s, not %s", line.ProductID, line.UnitPrice.Currency(), order.Currency)
 		}
 
-		for _, productRequest := range order.ProductRequests {
-			if productRequest.ProductID == availabilityResult.ProductID {
-				productRequest.FinalPrice = float64(productRequest.Quantity) * pricingResult.FinalPrice
-				productRequest.MarkUp = float64(productRequest.Quantity) * pricingResult.MarkUp
-				productRequest.Discount = float64(productRequest.Quantity) * pricingResult.Discount
+		// every converted price must come from the same rate version so the order can be reproduced
+		if line.RateVersion != 0 {
+			if order.RateVersion != 0 && order.RateVersion != line.RateVersion {
+				return nil, fmt.Errorf("exchange rates changed while pricing the order, please retry")
 			}
+			order.RateVersion = line.RateVersion
+			order.ExchangeRate = line.ExchangeRate
 		}
+		if line.ExchangeRate == 0 {
+			line.ExchangeRate = 1
+		}
+
+		productRequest := &order.ProductRequests[i]
+		productRequest.FinalPrice = line.Total
+		productRequest.MarkUp = float64(productRequest.Quantity) * line.Markup
+		productRequest.Discount = float64(productRequest.Quantity) * line.Discount
+		productRequest.ExchangeRate = line.ExchangeRate
 	}
 
-	order.Total = 0
-	for _, productRequest := range order.ProductRequests {
-		order.Total += productRequest.FinalPrice
+	// apply promotion codes and compute the total breakdown
+	err = s.promotionService.ApplyPromotions(ctx, order)
+	if err != nil {
+		logger.Warn().Ctx(ctx).Err(err).Msgf("Error applying promotions to order %d", order.OrderID)
+		return nil, err
+	}
+
+	// taxes apply to the discounted lines, so they are calculated after promotions
+	err = s.taxEngine.Apply(order)
+	if err != nil {
+		logger.Warn().Ctx(ctx).Err(err).Msgf("Error calculating taxes for order %d", order.OrderID)
+		return nil, err
 	}
 
 	createdOrder, err := s.orderRepo.CreateOrder(ctx, order)
 	if err != nil {
-		logger.Error().Err(err).Msg("Error creating order")
+		logger.Error().Ctx(ctx).Err(err).Msg("Error creating order")
 		return nil, err
 	}
 
+	// promotions are redeemed under the ID of the stored order, which is unique, so the order is
+	// removed again if one of them ran out in the meantime
+	err = s.promotionService.RedeemPromotions(ctx, createdOrder)
+	if err != nil {
+		logger.Warn().Ctx(ctx).Err(err).Msgf("Error redeeming promotions for order %d", order.OrderID)
+		if deleteErr := s.orderRepo.DeleteOrder(ctx, createdOrder.ID); deleteErr != nil {
+			logger.Error().Ctx(ctx).Err(deleteErr).Msgf("Error deleting order %d", createdOrder.ID)
+		}
+		return nil, err
+	}
+	ordersCreated.Inc()
+
 	// if env is set to test, return
 	if os.Getenv("ENV") == "test" {
 		return createdOrder, nil
@@ -195,26 +243,89 @@ func (s *OrderService) CreateOrder(ctx context.Context, order *entity.Order) (*e
 	return createdOrder, nil
 }
 
-// UpdateOrder updates an existing order
-func (s *OrderService) UpdateOrder(ctx context.Context, order *entity.Order) (*entity.Order, error) {
+// ErrInvalidUpdate is returned for order changes that aren't allowed or don't add up.
+var ErrInvalidUpdate = errors.New("invalid order update")
+
+// ownerTransitions are the status changes customers may make to their own orders. Any other
+// change needs the orders:write permission.
+var ownerTransitions = map[string][]string{
+	"created": {"cancelled"},
+	"paid":    {"cancelled"},
+}
+
+// OwnerMayChangeStatus reports whether the owner of an order may change its status from from to to.
+func OwnerMayChangeStatus(from, to string) bool {
+	return slices.Contains(ownerTransitions[from], to)
+}
+
+// UpdateOrder replaces the owner, status and product lines of an existing order with those of
+// update, keeping the ones update leaves empty. The subtotal, promotion discount, taxes and total
+// are recomputed from the lines, the ones sent are ignored.
+func (s *OrderService) UpdateOrder(ctx context.Context, existing, update *entity.Order) (*entity.Order, error) {
+	ctx = logging.WithOrderID(ctx, existing.OrderID)
+	if update.Status == "cancelled" && existing.Status != "cancelled" {
+		// cancelling gives the stock and promotion uses back
+		return s.CancelOrder(ctx, existing.ID)
+	}
+
+	order := *existing
+	if update.UserID != 0 {
+		order.UserID = update.UserID
+	}
+	if update.Status != "" {
+		order.Status = update.Status
+	}
+	if update.ProductRequests != nil {
+		order.ProductRequests = nil
+		for _, productRequest := range update.ProductRequests {
+			if productRequest.Quantity <= 0 || productRequest.FinalPrice.IsNegative() {
+				return nil, fmt.Errorf("%w: product %d needs a positive quantity and price", ErrInvalidUpdate, productRequest.ProductID)
+			}
+			if productRequest.FinalPrice.Currency() != order.Currency {
+				return nil, fmt.Errorf("%w: the price of product %d must be in %s", ErrInvalidUpdate, productRequest.ProductID, order.Currency)
+			}
+			if productRequest.ExchangeRate == 0 {
+				productRequest.ExchangeRate = 1
+			}
+			order.ProductRequests = append(order.ProductRequests, productRequest)
+		}
+	}
+	if len(order.ProductRequests) == 0 {
+		return nil, fmt.Errorf("%w: an order needs product requests", ErrInvalidUpdate)
+	}
+
+	// the promotions stay applied, but can't take off more than the new subtotal
+	order.Quantity = 0
+	order.Subtotal = money.Zero(order.Currency)
+	for _, productRequest := range order.ProductRequests {
+		order.Quantity += productRequest.Quantity
+		order.Subtotal = order.Subtotal.Add(productRequest.FinalPrice)
+	}
+	order.PromotionDiscount = money.Min(order.PromotionDiscount, order.Subtotal)
+	err := s.taxEngine.Apply(&order)
+	if err != nil {
+		logger.Warn().Ctx(ctx).Err(err).Msgf("Error calculating taxes for order %d", order.OrderID)
+		return nil, err
+	}
+
 	if order.Status == "paid" {
 		// check product availability
 		for _, productRequest := range order.ProductRequests {
 			available, err := s.checkProductStock(ctx, productRequest.ProductID, productRequest.Quantity)
 			if err != nil {
-				logger.Error().Err(err).Msgf("Error checking product stock for product %d", productRequest.ProductID)
+				logger.Error().Ctx(ctx).Err(err).Msgf("Error checking product stock for product %d", productRequest.ProductID)
 				return nil, err
 			}
 
 			if !available {
-				logger.Warn().Msgf("Product %d out of stock", productRequest.ProductID)
+				logger.Warn().Ctx(ctx).Msgf("Product %d out of stock", productRequest.ProductID)
 				return nil, fmt.Errorf("product out of stock")
 			}
 		}
 	}
-	updateOrder, err := s.orderRepo.UpdateOrder(ctx, order)
+	updateOrder, err := s.orderRepo.UpdateOrder(ctx, &order)
 	if err != nil {
-		logger.Error().Err(err).Msg("Error updating order")
+		logger.Error().Ctx(ctx).Err(err).Msg("Error updating order")
 		return nil, err
 	}
 
@@ -226,21 +337,45 @@ func (s *OrderService) UpdateOrder(ctx context.Context, order *entity.Order) (*e
 	return updateOrder, nil
 }
 
+// GetOrder retrieves an order by its ID
+func (s *OrderService) GetOrder(ctx context.Context, id int) (*entity.Order, error) {
+	order, err := s.orderRepo.GetOrderByID(ctx, id)
+	if err != nil {
+		logger.Error().Ctx(ctx).Err(err).Msgf("Error getting order by ID %d", id)
+		return nil, err
+	}
+
+	return order, nil
+}
+
 // CancelOrder cancels an existing order
 func (s *OrderService) CancelOrder(ctx context.Context, id int) (*entity.Order, error) {
 	order, err := s.orderRepo.GetOrderByID(ctx, id)
 	if err != nil {
-		logger.Error().Err(err).Msgf("Error getting order by ID %d", id)
+		logger.Error().Ctx(ctx).Err(err).Msgf("Error getting order by ID %d", id)
 		return nil, err
 	}
+	ctx = logging.WithOrderID(ctx, order.OrderID)
 
+	// the stock and promotion uses were already given back
+	if order.Status == "cancelled" {
+		return nil, fmt.Errorf("%w: order %d is already cancelled", ErrInvalidUpdate, id)
+	}
 	order.Status = "cancelled"
 
-	updatedOrder, err := s.orderRepo.UpdateOrder(ctx, order)
+	err = s.orderRepo.UpdateOrderStatus(ctx, order.ID, order.Status)
 	if err != nil {
-		logger.Error().Err(err).Msg("Error updating order")
+		logger.Error().Ctx(ctx).Err(err).Msg("Error updating order")
 		return nil, err
 	}
+	updatedOrder := order
+	ordersCancelled.Inc()
+
+	// give the promotion uses back so the codes can be redeemed again
+	err = s.promotionService.ReleasePromotions(ctx, updatedOrder)
+	if err != nil {
+		logger.Error().Ctx(ctx).Err(err).Msgf("Error releasing promotions for order %d", updatedOrder.OrderID)
+	}
 
 	err = s.publishOrderEvent(ctx, updatedOrder, "cancelled")
 	if err != nil {
@@ -250,6 +385,120 @@ func (s *OrderService) CancelOrder(ctx context.Context, id int) (*entity.Order,
 	return updatedOrder, nil
 }
 
+// OrderHistory returns the orders placed from from up to but excluding to, with their product
+// requests
+func (s *OrderService) OrderHistory(ctx context.Context, from, to time.Time) ([]entity.Order, error) {
+	orders, err := s.orderRepo.OrderHistory(ctx, from, to)
+	if err != nil {
+		logger.Error().Ctx(ctx).Err(err).Msgf("Error reading the order history from %s to %s", from, to)
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+// EraseUserData removes the references to a deleted user account from orders and promotion
+// redemptions, returning the number of orders that were anonymized
+func (s *OrderService) EraseUserData(ctx context.Context, userID int) (int, error) {
+	erased, err := s.orderRepo.EraseUser(ctx, userID)
+	if err != nil {
+		logger.Error().Ctx(ctx).Err(err).Msgf("Error erasing orders of user %d", userID)
+		return erased, err
+	}
+
+	err = s.promotionService.EraseUser(ctx, userID)
+	if err != nil {
+		logger.Error().Ctx(ctx).Err(err).Msgf("Error erasing promotion redemptions of user %d", userID)
+		return erased, err
+	}
+
+	logger.Info().Ctx(ctx).Msgf("Erased user %d from %d orders", userID, erased)
+	return erased, nil
+}
+
+// resolveAddresses copies the chosen shipping and billing addresses from the user's address book
+// onto the order, falling back to the default ones. Billing falls back to the shipping address.
+// Users without an address book get an order without addresses.
+func (s *OrderService) resolveAddresses(ctx context.Context, order *entity.Order) error {
+	order.ShippingAddress = nil
+	order.BillingAddress = nil
+	if order.UserID == entity.ErasedUserID || os.Getenv("ENV") == "test" {
+		return nil
+	}
+
+	addresses, err := s.getAddresses(ctx, order.UserID)
+	if err != nil {
+		return err
+	}
+
+	for i := range addresses {
+		address := &addresses[i]
+		if address.AddressID == order.ShippingAddressID || (order.ShippingAddressID == 0 && address.DefaultShipping) {
+			order.ShippingAddress = address
+		}
+		if address.AddressID == order.BillingAddressID || (order.BillingAddressID == 0 && address.DefaultBilling) {
+			order.BillingAddress = address
+		}
+	}
+
+	if order.ShippingAddressID != 0 && order.ShippingAddress == nil {
+		return fmt.Errorf("shipping address %d not found", order.ShippingAddressID)
+	}
+	if order.BillingAddressID != 0 && order.BillingAddress == nil {
+		return fmt.Errorf("billing address %d not found", order.BillingAddressID)
+	}
+	if order.BillingAddress == nil {
+		order.BillingAddress = order.ShippingAddress
+	}
+
+	for _, address := range []*entity.Address{order.ShippingAddress, order.BillingAddress} {
+		if address != nil {
+			address.DefaultShipping = false
+			address.DefaultBilling = false
+		}
+	}
+	if order.ShippingAddress != nil {
+		order.ShippingAddressID = order.ShippingAddress.AddressID
+	}
+	if order.BillingAddress != nil {
+		order.BillingAddressID = order.BillingAddress.AddressID
+	}
+	return nil
+}
+
+func (s *OrderService) getAddresses(ctx context.Context, userID int) ([]entity.Address, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/users/%d/addresses", s.userServiceURL, userID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.userClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get addresses")
+	}
+
+	// the address book calls the entry ID "id"
+	var entries []struct {
+		ID int `json:"id"`
+		entity.Address
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, err
+	}
+
+	addresses := make([]entity.Address, len(entries))
+	for i, entry := range entries {
+		addresses[i] = entry.Address
+		addresses[i].AddressID = entry.ID
+	}
+	return addresses, nil
+}
+
 func (s *OrderService) checkProductStock(ctx context.Context, productId int, quantity int) (bool, error) {
 	// if env is set to test, return true
 	if os.Getenv("ENV") == "test" {
@@ -260,7 +509,7 @@ func (s *OrderService) checkProductStock(ctx context.Context, productId int, qua
 		return false, err
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := s.productClient.Do(req)
 	if err != nil {
 		return false, err
 	}
@@ -280,36 +529,79 @@ func (s *OrderService) checkProductStock(ctx context.Context, productId int, qua
 	return availableStock >= quantity, nil
 }
 
-func (s *OrderService) getPricing(ctx context.Context, productId int) (*entity.Pricing, error) {
+// priceCart prices the product requests of the order in its currency with one call to
+// dynamic-pricing-service. While pricing is unavailable, the lines get the last known prices of
+// their products, if all of them have one.
+func (s *OrderService) priceCart(ctx context.Context, order *entity.Order) ([]pricing.CartLine, error) {
+	cartRequest := pricing.CartRequest{Currency: order.Currency}
+	for _, productRequest := range order.ProductRequests {
+		cartRequest.Items = append(cartRequest.Items, pricing.CartItem{ProductID: productRequest.ProductID, Quantity: productRequest.Quantity})
+	}
+
 	// if env is set to test, return a default pricing
 	if os.Getenv("ENV") == "test" {
-		return &entity.Pricing{
-			ProductID:  productId,
-			Markup:     0.1,
-			Discount:   0.05,
-			FinalPrice: 100,
-		}, nil
-	}
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/products/%d/pricing", s.productServiceURL, productId), nil)
-	if err != nil {
+		lines := make([]pricing.CartLine, len(cartRequest.Items))
+		for i, item := range cartRequest.Items {
+			quote := pricing.Quote{ProductID: item.ProductID, Markup: 0.1, Discount: 0.05, UnitPrice: money.New(10000, order.Currency), ExchangeRate: 1}
+			lines[i] = pricing.CartLine{Quote: quote, Quantity: item.Quantity, Total: quote.UnitPrice.MulInt(item.Quantity)}
+		}
+		return lines, nil
+	}
+
+	cart, err := s.pricingClient.PriceCart(ctx, cartRequest)
+	if err == nil {
+		for _, line := range cart.Lines {
+			s.rememberQuote(ctx, order.Currency, line.Quote)
+		}
+		return cart.Lines, nil
+	}
+	if !errors.Is(err, pricing.ErrUnavailable) || ctx.Err() != nil {
 		return nil, err
 	}
-	resp, err := http.DefaultClient.Do(req)
+
+	// an order placed at the prices last quoted beats no order while pricing is down
+	lines := make([]pricing.CartLine, len(cartRequest.Items))
+	for i, item := range cartRequest.Items {
+		quote, lastKnownErr := s.lastKnownQuote(ctx, item.ProductID, order.Currency)
+		if lastKnownErr != nil {
+			return nil, err
+		}
+		lines[i] = pricing.CartLine{Quote: *quote, Quantity: item.Quantity, Total: quote.UnitPrice.MulInt(item.Quantity)}
+	}
+	logger.Warn().Ctx(ctx).Err(err).Msgf("Pricing unavailable, using the last known prices for order %d", order.OrderID)
+	pricingFallbacks.Add(float64(len(lines)))
+	return lines, nil
+}
+
+// rememberQuote keeps quote as the last known price of its product, for lastKnownQuote.
+func (s *OrderService) rememberQuote(ctx context.Context, currency string, quote pricing.Quote) {
+	quoteJSON, err := json.Marshal(quote)
 	if err != nil {
-		return nil, err
+		return
 	}
-	defer resp.Body.Close()
+	err = s.rdb.Set(ctx, lastKnownQuoteKey(quote.ProductID, currency), quoteJSON, lastKnownPricingTTL).Err()
+	if err != nil {
+		logger.Warn().Ctx(ctx).Err(err).Msgf("Error remembering the pricing of product %d", quote.ProductID)
+	}
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get pricing")
+// lastKnownQuote returns the quote of the product last received in currency, redis.Nil if there
+// is none within lastKnownPricingTTL.
+func (s *OrderService) lastKnownQuote(ctx context.Context, productId int, currency string) (*pricing.Quote, error) {
+	quoteJSON, err := s.rdb.Get(ctx, lastKnownQuoteKey(productId, currency)).Bytes()
+	if err != nil {
+		return nil, err
 	}
 
-	var pricing entity.Pricing
-	if err := json.NewDecoder(resp.Body).Decode(&pricing); err != nil {
+	var quote pricing.Quote
+	if err := json.Unmarshal(quoteJSON, &quote); err != nil {
 		return nil, err
 	}
+	return &quote, nil
+}
 
-	return &pricing, nil
+func lastKnownQuoteKey(productId int, currency string) string {
+	return fmt.Sprintf("pricing:last:%d:%s", productId, currency)
 }
 
 func (s *OrderService) publishOrderEvent(ctx context.Context, order *entity.Order, key string) error {
@@ -324,7 +616,15 @@ func (s *OrderService) publishOrderEvent(ctx context.Context, order *entity.Orde
 		Value: orderJSON,
 	}
 
+	// product-catalog-service logs with the same request and order IDs, and continues the trace
+	logging.Inject(ctx, func(key, value string) {
+		msg.Headers = append(msg.Headers, kafka.Header{Key: key, Value: []byte(value)})
+	})
+	ctx, span := tracing.StartProduce(ctx, s.kafkaWriter.Topic, &msg)
+	start := time.Now()
 	err = s.kafkaWriter.WriteMessages(ctx, msg)
+	metrics.Produced(s.kafkaWriter.Topic, start, err)
+	tracing.End(span, err)
 	if err != nil {
 		return err
 	}
@@ -356,6 +656,7 @@ func (s *OrderService) validateIdempotentKey(ctx context.Context, key string) (b
 	return true, nil
 }
 
+// randomOrderID picks the order ID, which places the order on a shard. It has to fit the INT column.
 func randomOrderID() int {
-	return 1000 + rand.Intn(1000)
+	return 1000 + rand.Intn(math.MaxInt32-1000)
 }
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"order-service/internal/entity"
+	"order-service/internal/promotion"
+	"order-service/internal/repository"
+	"shared/money"
+	"strings"
+	"time"
+)
+
+// PromotionService manages promotion codes and applies them to orders
+type PromotionService struct {
+	promotionRepo *repository.PromotionRepository
+}
+
+// NewPromotionService creates a new instance of PromotionService
+func NewPromotionService(promotionRepo *repository.PromotionRepository) *PromotionService {
+	return &PromotionService{promotionRepo: promotionRepo}
+}
+
+// CreatePromotion creates a new promotion code
+func (s *PromotionService) CreatePromotion(ctx context.Context, promo *entity.Promotion) (*entity.Promotion, error) {
+	promo.Code = promotion.NormalizeCode(promo.Code)
+	if promo.Code == "" {
+		return nil, fmt.Errorf("promotion code is required")
+	}
+
+	// Amounts are in the promotion currency, which defaults to the currency they were sent in
+	if promo.Currency == "" {
+		promo.Currency = promo.Amount.Currency()
+		if promo.Amount.IsZero() {
+			promo.Currency = promo.MinBasket.Currency()
+		}
+	}
+	promo.Currency = strings.ToUpper(promo.Currency)
+	for _, amount := range []money.Money{promo.Amount, promo.MinBasket} {
+		if !amount.IsZero() && amount.Currency() != promo.Currency {
+			return nil, fmt.Errorf("promotion amounts must be in %s", promo.Currency)
+		}
+	}
+
+	switch promo.Type {
+	case entity.PromotionPercentage:
+		if promo.Value <= 0 || promo.Value > 1 {
+			return nil, fmt.Errorf("percentage promotions need a value between 0 and 1")
+		}
+	case entity.PromotionFixed:
+		if promo.Amount.IsZero() || promo.Amount.IsNegative() {
+			return nil, fmt.Errorf("fixed promotions need a positive amount")
+		}
+	case entity.PromotionBuyXGetY:
+		if promo.ProductID == 0 || promo.BuyQuantity <= 0 || promo.GetQuantity <= 0 {
+			return nil, fmt.Errorf("buy_x_get_y promotions need a product, buy quantity and get quantity")
+		}
+	default:
+		return nil, fmt.Errorf("unknown promotion type %s", promo.Type)
+	}
+
+	createdPromo, err := s.promotionRepo.CreatePromotion(ctx, promo)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Error creating promotion %s", promo.Code)
+		return nil, err
+	}
+
+	return createdPromo, nil
+}
+
+// GetPromotion retrieves a promotion by its code
+func (s *PromotionService) GetPromotion(ctx context.Context, code string) (*entity.Promotion, error) {
+	return s.promotionRepo.GetPromotionByCode(ctx, promotion.NormalizeCode(code))
+}
+
+// ApplyPromotions validates the order's promotion codes and fills in the total breakdown.
+// The order's product lines must already be priced.
+func (s *PromotionService) ApplyPromotions(ctx context.Context, order *entity.Order) error {
+	order.Subtotal = money.Zero(order.Currency)
+	for _, productRequest := range order.ProductRequests {
+		order.Subtotal = order.Subtotal.Add(productRequest.FinalPrice)
+	}
+	order.PromotionDiscount = money.Zero(order.Subtotal.Currency())
+	order.AppliedPromotions = nil
+	order.Total = order.Subtotal
+
+	if len(order.PromotionCodes) == 0 {
+		return nil
+	}
+
+	promos := make([]*entity.Promotion, 0, len(order.PromotionCodes))
+	for _, code := range order.PromotionCodes {
+		promo, err := s.GetPromotion(ctx, code)
+		if err != nil {
+			return err
+		}
+		promos = append(promos, promo)
+	}
+
+	applied, discount, err := promotion.Apply(promos, order.ProductRequests, order.Subtotal, time.Now())
+	if err != nil {
+		return err
+	}
+
+	order.AppliedPromotions = applied
+	order.PromotionDiscount = discount
+	order.Total = order.Subtotal.Sub(discount)
+	return nil
+}
+
+// RedeemPromotions records the applied promotions of a stored order against their usage limits
+func (s *PromotionService) RedeemPromotions(ctx context.Context, order *entity.Order) error {
+	if len(order.AppliedPromotions) == 0 {
+		return nil
+	}
+	return s.promotionRepo.Redeem(ctx, order)
+}
+
+// ReleasePromotions gives back the promotion uses of an order that failed or was cancelled
+func (s *PromotionService) ReleasePromotions(ctx context.Context, order *entity.Order) error {
+	if len(order.AppliedPromotions) == 0 {
+		return nil
+	}
+	return s.promotionRepo.Release(ctx, order.ID)
+}
+
+// EraseUser detaches a deleted user from their promotion redemptions
+func (s *PromotionService) EraseUser(ctx context.Context, userID int) error {
+	return s.promotionRepo.EraseUser(ctx, userID)
+}
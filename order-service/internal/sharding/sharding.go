@@ -13,3 +13,14 @@ func (r *ShardRouter) GetShard(id int) int {
 	shardIndex := id % r.ShardCount
 	return shardIndex
 }
+
+// GlobalID returns the ID of the row localID of a shard that is unique across shards. GetShard
+// returns the shard again for it, and LocalID the row.
+func (r *ShardRouter) GlobalID(shard, localID int) int {
+	return localID*r.ShardCount + shard
+}
+
+// LocalID returns the auto-increment ID within its shard of a global ID.
+func (r *ShardRouter) LocalID(id int) int {
+	return id / r.ShardCount
+}
@@ -0,0 +1,20 @@
+package sharding
+
+import "testing"
+
+func TestGlobalID(t *testing.T) {
+	router := NewShardRouter(3)
+	seen := make(map[int]bool)
+	for shard := 0; shard < 3; shard++ {
+		for localID := 1; localID <= 100; localID++ {
+			id := router.GlobalID(shard, localID)
+			if seen[id] {
+				t.Fatalf("ID %d of row %d on shard %d is taken", id, localID, shard)
+			}
+			seen[id] = true
+			if router.GetShard(id) != shard || router.LocalID(id) != localID {
+				t.Errorf("ID %d leads to row %d on shard %d, want %d on %d", id, router.LocalID(id), router.GetShard(id), localID, shard)
+			}
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package tax
+
+import (
+	"encoding/json"
+	"fmt"
+	"order-service/internal/entity"
+	"os"
+	"shared/money"
+	"sort"
+	"strings"
+)
+
+// DefaultCategory is the tax category of products that aren't listed in the table.
+const DefaultCategory = "standard"
+
+// Jurisdiction holds the tax rates of a country or region, per product tax category.
+type Jurisdiction struct {
+	Name             string             `json:"name"`
+	PricesIncludeTax bool               `json:"prices_include_tax"`
+	Rates            map[string]float64 `json:"rates"` // Tax category -> rate, e.g. "standard": 0.11
+}
+
+// Table is the tax configuration loaded from a data file.
+type Table struct {
+	DefaultJurisdiction string                   `json:"default_jurisdiction"`
+	Jurisdictions       map[string]*Jurisdiction `json:"jurisdictions"`
+	Categories          map[int]string           `json:"categories"` // Product ID -> tax category
+}
+
+// Engine calculates order taxes from a tax table.
+type Engine struct {
+	table *Table
+}
+
+// NewEngine creates an engine from a table, checking that it is consistent.
+func NewEngine(table *Table) (*Engine, error) {
+	normalized := make(map[string]*Jurisdiction, len(table.Jurisdictions))
+	for code, jurisdiction := range table.Jurisdictions {
+		for category, rate := range jurisdiction.Rates {
+			if rate < 0 || rate >= 1 {
+				return nil, fmt.Errorf("invalid tax rate %v for %s in %s", rate, category, code)
+			}
+		}
+		normalized[strings.ToUpper(code)] = jurisdiction
+	}
+	table.Jurisdictions = normalized
+	table.DefaultJurisdiction = strings.ToUpper(table.DefaultJurisdiction)
+
+	if _, ok := table.Jurisdictions[table.DefaultJurisdiction]; !ok {
+		return nil, fmt.Errorf("default jurisdiction %q is not in the tax table", table.DefaultJurisdiction)
+	}
+
+	return &Engine{table: table}, nil
+}
+
+// LoadFile creates an engine from a JSON tax table file, so rates can be changed without a deploy.
+func LoadFile(path string) (*Engine, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var table Table
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("could not parse tax table %s: %v", path, err)
+	}
+
+	return NewEngine(&table)
+}
+
+// Apply calculates the tax of every product line and the order tax breakdown, and updates the
+// order total. It must run after promotions, whose discount is spread over the lines in
+// proportion to their price before taxing them.
+func (e *Engine) Apply(order *entity.Order) error {
+	code := e.jurisdictionFor(order)
+	jurisdiction, ok := e.table.Jurisdictions[code]
+	if !ok {
+		return fmt.Errorf("no tax rates for jurisdiction %s", code)
+	}
+
+	order.TaxJurisdiction = code
+	order.PricesIncludeTax = jurisdiction.PricesIncludeTax
+	order.TaxTotal = money.Zero(order.Currency)
+	order.Taxes = nil
+
+	discounts, err := allocate(order.PromotionDiscount, order.ProductRequests)
+	if err != nil {
+		return err
+	}
+	breakdown := make(map[string]*entity.TaxLine)
+
+	for i := range order.ProductRequests {
+		line := &order.ProductRequests[i]
+
+		category, ok := e.table.Categories[line.ProductID]
+		if !ok {
+			category = DefaultCategory
+		}
+		rate, ok := jurisdiction.Rates[category]
+		if !ok {
+			return fmt.Errorf("no %s tax rate for jurisdiction %s", category, code)
+		}
+
+		// Inclusive prices contain the tax, so the net is price / (1 + rate)
+		discounted := line.FinalPrice.Sub(discounts[i])
+		taxable := discounted
+		if jurisdiction.PricesIncludeTax {
+			taxable, err = discounted.Div(1 + rate)
+			line.Tax = discounted.Sub(taxable)
+		} else {
+			line.Tax, err = discounted.Mul(rate)
+		}
+		if err != nil {
+			return fmt.Errorf("could not tax product %d at %v: %w", line.ProductID, rate, err)
+		}
+		line.TaxCategory = category
+		line.TaxRate = rate
+
+		key := fmt.Sprintf("%s:%v", category, rate)
+		summary, ok := breakdown[key]
+		if !ok {
+			summary = &entity.TaxLine{Category: category, Rate: rate, Taxable: money.Zero(order.Currency), Tax: money.Zero(order.Currency)}
+			breakdown[key] = summary
+		}
+		summary.Taxable = summary.Taxable.Add(taxable)
+		summary.Tax = summary.Tax.Add(line.Tax)
+		order.TaxTotal = order.TaxTotal.Add(line.Tax)
+	}
+
+	for _, summary := range breakdown {
+		order.Taxes = append(order.Taxes, *summary)
+	}
+	sort.Slice(order.Taxes, func(i, j int) bool {
+		return order.Taxes[i].Category < order.Taxes[j].Category
+	})
+
+	order.Total = order.Subtotal.Sub(order.PromotionDiscount)
+	if !jurisdiction.PricesIncludeTax {
+		order.Total = order.Total.Add(order.TaxTotal)
+	}
+	return nil
+}
+
+// jurisdictionFor returns the jurisdiction of the shipping address copied onto the order: its
+// country and region, e.g. "US-CA", if the table has rates for the region, or else its country.
+// Orders without a shipping address use the default jurisdiction. The jurisdiction sent by the
+// client is ignored, buyers could pick the lowest rates.
+func (e *Engine) jurisdictionFor(order *entity.Order) string {
+	address := order.ShippingAddress
+	if address == nil {
+		return e.table.DefaultJurisdiction
+	}
+
+	country := strings.ToUpper(strings.TrimSpace(address.Country))
+	if region := strings.ToUpper(strings.TrimSpace(address.Region)); region != "" {
+		if _, ok := e.table.Jurisdictions[country+"-"+region]; ok {
+			return country + "-" + region
+		}
+	}
+	return country
+}
+
+// allocate spreads an order-level discount over the product lines in proportion to their price.
+// Rounding leftovers go to the last line so the shares always add up to the discount.
+func allocate(discount money.Money, lines []entity.ProductRequest) ([]money.Money, error) {
+	shares := make([]money.Money, len(lines))
+	subtotal := money.Zero(discount.Currency())
+	for i, line := range lines {
+		shares[i] = money.Zero(discount.Currency())
+		subtotal = subtotal.Add(line.FinalPrice)
+	}
+	if discount.IsZero() || subtotal.IsZero() {
+		return shares, nil
+	}
+
+	allocated := money.Zero(discount.Currency())
+	for i, line := range lines {
+		if i == len(lines)-1 {
+			shares[i] = discount.Sub(allocated)
+			break
+		}
+		share, err := discount.MulFrac(line.FinalPrice.MinorUnits(), subtotal.MinorUnits())
+		if err != nil {
+			return nil, err
+		}
+		shares[i] = share
+		allocated = allocated.Add(share)
+	}
+	return shares, nil
+}
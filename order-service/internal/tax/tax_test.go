@@ -0,0 +1,148 @@
+package tax
+
+import (
+	"order-service/internal/entity"
+	"shared/money"
+	"testing"
+)
+
+func testEngine(t *testing.T) *Engine {
+	t.Helper()
+	engine, err := NewEngine(&Table{
+		DefaultJurisdiction: "us-ny",
+		Categories:          map[int]string{2: "reduced"},
+		Jurisdictions: map[string]*Jurisdiction{
+			"US-NY": {Rates: map[string]float64{"standard": 0.08875, "reduced": 0.04}},
+			"US-OR": {Rates: map[string]float64{"standard": 0, "reduced": 0}},
+			"DE":    {PricesIncludeTax: true, Rates: map[string]float64{"standard": 0.19, "reduced": 0.07}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return engine
+}
+
+func usd(cents int64) money.Money {
+	return money.New(cents, "USD")
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name     string
+		address  *entity.Address
+		lines    []money.Money // Final prices of products 1, 2, ...
+		discount money.Money
+		taxes    []money.Money // Per line
+		total    money.Money
+	}{
+		// exclusive prices get the tax added: 8.875% of 100.00 is 8.875
+		{"exclusive", &entity.Address{Country: "US", Region: "NY"}, []money.Money{usd(10000)}, usd(0), []money.Money{usd(888)}, usd(10888)},
+		// the reduced rate of product 2
+		{"exclusive reduced", &entity.Address{Country: "us", Region: "ny"}, []money.Money{usd(10000), usd(5000)}, usd(0), []money.Money{usd(888), usd(200)}, usd(16088)},
+		// inclusive prices contain the tax: 119.00 is 100.00 and 19% of it
+		{"inclusive", &entity.Address{Country: "DE", Region: "Berlin"}, []money.Money{usd(11900)}, usd(0), []money.Money{usd(1900)}, usd(11900)},
+		// 0.99 is 0.8319..., so the tax is 0.16 and the net 0.83
+		{"inclusive rounded", &entity.Address{Country: "DE"}, []money.Money{usd(99)}, usd(0), []money.Money{usd(16)}, usd(99)},
+		// the discount is spread 30/70 before taxing: 27.00 and 63.00 are left
+		{"exclusive discounted", &entity.Address{Country: "US", Region: "NY"}, []money.Money{usd(3000), usd(7000)}, usd(1000), []money.Money{usd(240), usd(252)}, usd(9492)},
+		{"inclusive discounted", &entity.Address{Country: "DE"}, []money.Money{usd(3000), usd(7000)}, usd(1000), []money.Money{usd(431), usd(412)}, usd(9000)},
+		{"no address", nil, []money.Money{usd(10000)}, usd(0), []money.Money{usd(888)}, usd(10888)},
+	}
+	for _, test := range tests {
+		order := &entity.Order{Currency: "USD", ShippingAddress: test.address, Subtotal: usd(0), PromotionDiscount: test.discount}
+		for i, price := range test.lines {
+			order.ProductRequests = append(order.ProductRequests, entity.ProductRequest{ProductID: i + 1, Quantity: 1, FinalPrice: price})
+			order.Subtotal = order.Subtotal.Add(price)
+		}
+
+		if err := testEngine(t).Apply(order); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		taxTotal := usd(0)
+		for i, want := range test.taxes {
+			if got := order.ProductRequests[i].Tax; got != want {
+				t.Errorf("%s: tax of line %d is %s, want %s", test.name, i+1, got, want)
+			}
+			taxTotal = taxTotal.Add(want)
+		}
+		if order.TaxTotal != taxTotal || order.Total != test.total {
+			t.Errorf("%s: tax %s and total %s, want %s and %s", test.name, order.TaxTotal, order.Total, taxTotal, test.total)
+		}
+	}
+}
+
+func TestApplyJurisdiction(t *testing.T) {
+	tests := []struct {
+		name    string
+		address *entity.Address
+		want    string
+	}{
+		{"region", &entity.Address{Country: "US", Region: "OR"}, "US-OR"},
+		{"country", &entity.Address{Country: "de", Region: "Bayern"}, "DE"},
+		{"no address", nil, "US-NY"},
+	}
+	for _, test := range tests {
+		// the client's choice of jurisdiction is ignored
+		order := &entity.Order{Currency: "USD", TaxJurisdiction: "US-OR", ShippingAddress: test.address, Subtotal: usd(1000), PromotionDiscount: usd(0),
+			ProductRequests: []entity.ProductRequest{{ProductID: 1, Quantity: 1, FinalPrice: usd(1000)}}}
+		if err := testEngine(t).Apply(order); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if order.TaxJurisdiction != test.want {
+			t.Errorf("%s: jurisdiction is %s, want %s", test.name, order.TaxJurisdiction, test.want)
+		}
+	}
+
+	// countries without rates can't be taxed
+	order := &entity.Order{Currency: "USD", ShippingAddress: &entity.Address{Country: "FR"}, Subtotal: usd(1000), PromotionDiscount: usd(0),
+		ProductRequests: []entity.ProductRequest{{ProductID: 1, Quantity: 1, FinalPrice: usd(1000)}}}
+	if err := testEngine(t).Apply(order); err == nil {
+		t.Error("order shipped to FR taxed")
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	lines := func(prices ...int64) []entity.ProductRequest {
+		var lines []entity.ProductRequest
+		for _, price := range prices {
+			lines = append(lines, entity.ProductRequest{FinalPrice: usd(price)})
+		}
+		return lines
+	}
+
+	tests := []struct {
+		name     string
+		discount money.Money
+		lines    []entity.ProductRequest
+		want     []int64
+	}{
+		{"proportional", usd(1000), lines(3000, 7000), []int64{300, 700}},
+		// a third each is 33.33..., the last line gets the cent left over
+		{"remainder to the last line", usd(100), lines(100, 100, 100), []int64{33, 33, 34}},
+		{"rounded half up", usd(5), lines(100, 100), []int64{3, 2}},
+		{"whole discount on one line", usd(250), lines(5000), []int64{250}},
+		{"free line", usd(100), lines(0, 1000), []int64{0, 100}},
+		{"no discount", usd(0), lines(1000, 2000), []int64{0, 0}},
+		{"nothing to discount", usd(100), lines(0, 0), []int64{0, 0}},
+	}
+	for _, test := range tests {
+		shares, err := allocate(test.discount, test.lines)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		sum := usd(0)
+		for i, want := range test.want {
+			if shares[i] != usd(want) {
+				t.Errorf("%s: share of line %d is %s, want %s", test.name, i+1, shares[i], usd(want))
+			}
+			sum = sum.Add(shares[i])
+		}
+		if !test.discount.IsZero() && !sum.IsZero() && sum != test.discount {
+			t.Errorf("%s: shares add up to %s, not %s", test.name, sum, test.discount)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package migrations
 
 import (
 	"database/sql"
+	"fmt"
+	"shared/money"
 	"time"
 )
 
@@ -11,13 +13,24 @@ func AutoMigrateOrders(retries int, dbs ...*sql.DB) error {
 		CREATE TABLE IF NOT EXISTS orders (
 			id INT AUTO_INCREMENT PRIMARY KEY,
 			user_id INT NOT NULL,
+			api_key_id INT NOT NULL DEFAULT 0,
 			order_id INT NOT NULL UNIQUE,
 			quantity INT NOT NULL,
-			total DOUBLE NOT NULL,
+			currency CHAR(3) NOT NULL DEFAULT 'USD',
+			exchange_rate DECIMAL(19,8) NOT NULL DEFAULT 1,
+			rate_version INT NOT NULL DEFAULT 0,
+			subtotal DECIMAL(19,4) NOT NULL DEFAULT 0,
+			promotion_discount DECIMAL(19,4) NOT NULL DEFAULT 0,
+			tax_jurisdiction VARCHAR(16) NOT NULL DEFAULT '',
+			prices_include_tax BOOLEAN NOT NULL DEFAULT FALSE,
+			tax_total DECIMAL(19,4) NOT NULL DEFAULT 0,
+			total DECIMAL(19,4) NOT NULL,
 			total_mark_up DOUBLE NOT NULL,
 			total_discount DOUBLE NOT NULL,
 			status VARCHAR(20) NOT NULL,
-			idempotent_key VARCHAR(255) UNIQUE NOT NULL
+			idempotent_key VARCHAR(255) UNIQUE NOT NULL,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			INDEX idx_orders_created_at (created_at)
 		);
 	`
 	for _, db := range dbs {
@@ -46,7 +59,11 @@ func AutoMigrateProductRequests(retries int, dbs ...*sql.DB) error {
 			quantity INT NOT NULL,
 			mark_up DOUBLE NOT NULL,
 			discount DOUBLE NOT NULL,
-			final_price DOUBLE NOT NULL,
+			final_price DECIMAL(19,4) NOT NULL,
+			exchange_rate DECIMAL(19,8) NOT NULL DEFAULT 1,
+			tax_category VARCHAR(32) NOT NULL DEFAULT '',
+			tax_rate DECIMAL(7,6) NOT NULL DEFAULT 0,
+			tax DECIMAL(19,4) NOT NULL DEFAULT 0,
 			FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE
 		);
 	`
@@ -65,3 +82,276 @@ func AutoMigrateProductRequests(retries int, dbs ...*sql.DB) error {
 	}
 	return nil
 }
+
+// AutoMigrateOrderBreakdown adds the total breakdown columns to orders tables created before they existed.
+func AutoMigrateOrderBreakdown(dbs ...*sql.DB) error {
+	for _, db := range dbs {
+		if err := addColumnIfMissing(db, "orders", "subtotal", money.DecimalColumn+" NOT NULL DEFAULT 0"); err != nil {
+			return err
+		}
+		if err := addColumnIfMissing(db, "orders", "promotion_discount", money.DecimalColumn+" NOT NULL DEFAULT 0"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AutoMigrateOrderCurrency adds the currency columns to orders, product_requests and promotions
+// tables created before orders had a currency. Existing rows are in the default currency.
+func AutoMigrateOrderCurrency(shards []*sql.DB, promotionsDB *sql.DB) error {
+	defaultCurrency := fmt.Sprintf("CHAR(3) NOT NULL DEFAULT '%s'", money.DefaultCurrency)
+	for _, db := range shards {
+		if err := addColumnIfMissing(db, "orders", "currency", defaultCurrency); err != nil {
+			return err
+		}
+		if err := addColumnIfMissing(db, "orders", "exchange_rate", "DECIMAL(19,8) NOT NULL DEFAULT 1"); err != nil {
+			return err
+		}
+		if err := addColumnIfMissing(db, "orders", "rate_version", "INT NOT NULL DEFAULT 0"); err != nil {
+			return err
+		}
+		if err := addColumnIfMissing(db, "product_requests", "exchange_rate", "DECIMAL(19,8) NOT NULL DEFAULT 1"); err != nil {
+			return err
+		}
+	}
+
+	if err := addColumnIfMissing(promotionsDB, "promotions", "currency", defaultCurrency); err != nil {
+		return err
+	}
+	return addColumnIfMissing(promotionsDB, "promotion_redemptions", "currency", defaultCurrency)
+}
+
+// AutoMigrateOrderPromotions creates the order_promotions table if it does not exist.
+func AutoMigrateOrderPromotions(retries int, dbs ...*sql.DB) error {
+	query := `
+		CREATE TABLE IF NOT EXISTS order_promotions (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			order_id INT NOT NULL,
+			promotion_id INT NOT NULL,
+			code VARCHAR(64) NOT NULL,
+			type VARCHAR(20) NOT NULL,
+			discount DECIMAL(19,4) NOT NULL,
+			FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE
+		);
+	`
+	for _, db := range dbs {
+		_, err := db.Exec(query)
+		if err != nil {
+			// Retry creating the table
+			for i := 0; i < retries; i++ {
+				time.Sleep(1 * time.Second)
+				_, err = db.Exec(query)
+				if err == nil {
+					break
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// AutoMigrateOrderTaxes creates the order_taxes table if it does not exist, and adds the tax
+// columns to orders and product_requests tables created before taxes were calculated.
+func AutoMigrateOrderTaxes(retries int, dbs ...*sql.DB) error {
+	query := `
+		CREATE TABLE IF NOT EXISTS order_taxes (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			order_id INT NOT NULL,
+			category VARCHAR(32) NOT NULL,
+			rate DECIMAL(7,6) NOT NULL,
+			taxable DECIMAL(19,4) NOT NULL,
+			tax DECIMAL(19,4) NOT NULL,
+			FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE
+		);
+	`
+	for _, db := range dbs {
+		_, err := db.Exec(query)
+		if err != nil {
+			// Retry creating the table
+			for i := 0; i < retries; i++ {
+				time.Sleep(1 * time.Second)
+				_, err = db.Exec(query)
+				if err == nil {
+					break
+				}
+			}
+		}
+
+		if err := addColumnIfMissing(db, "orders", "tax_jurisdiction", "VARCHAR(16) NOT NULL DEFAULT ''"); err != nil {
+			return err
+		}
+		if err := addColumnIfMissing(db, "orders", "prices_include_tax", "BOOLEAN NOT NULL DEFAULT FALSE"); err != nil {
+			return err
+		}
+		if err := addColumnIfMissing(db, "orders", "tax_total", money.DecimalColumn+" NOT NULL DEFAULT 0"); err != nil {
+			return err
+		}
+		if err := addColumnIfMissing(db, "product_requests", "tax_category", "VARCHAR(32) NOT NULL DEFAULT ''"); err != nil {
+			return err
+		}
+		if err := addColumnIfMissing(db, "product_requests", "tax_rate", "DECIMAL(7,6) NOT NULL DEFAULT 0"); err != nil {
+			return err
+		}
+		if err := addColumnIfMissing(db, "product_requests", "tax", money.DecimalColumn+" NOT NULL DEFAULT 0"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AutoMigratePromotions creates the promotions and promotion_redemptions tables if they do not exist.
+// Promotions are global, so this only runs against the database holding them.
+func AutoMigratePromotions(retries int, db *sql.DB) error {
+	queries := []string{`
+		CREATE TABLE IF NOT EXISTS promotions (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			code VARCHAR(64) NOT NULL UNIQUE,
+			type VARCHAR(20) NOT NULL,
+			value DOUBLE NOT NULL DEFAULT 0,
+			amount DECIMAL(19,4) NOT NULL DEFAULT 0,
+			product_id INT NOT NULL DEFAULT 0,
+			buy_quantity INT NOT NULL DEFAULT 0,
+			get_quantity INT NOT NULL DEFAULT 0,
+			min_basket DECIMAL(19,4) NOT NULL DEFAULT 0,
+			currency CHAR(3) NOT NULL DEFAULT 'USD',
+			max_uses INT NOT NULL DEFAULT 0,
+			max_uses_per_user INT NOT NULL DEFAULT 0,
+			times_used INT NOT NULL DEFAULT 0,
+			stackable BOOLEAN NOT NULL DEFAULT FALSE,
+			active BOOLEAN NOT NULL DEFAULT TRUE,
+			starts_at DATETIME NULL,
+			ends_at DATETIME NULL
+		);
+	`, `
+		CREATE TABLE IF NOT EXISTS promotion_redemptions (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			promotion_id INT NOT NULL,
+			order_id INT NOT NULL,
+			user_id INT NOT NULL,
+			discount DECIMAL(19,4) NOT NULL,
+			currency CHAR(3) NOT NULL DEFAULT 'USD',
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			INDEX promotion_user_idx (promotion_id, user_id),
+			INDEX order_idx (order_id),
+			FOREIGN KEY (promotion_id) REFERENCES promotions(id)
+		);
+	`}
+	for _, query := range queries {
+		_, err := db.Exec(query)
+		if err != nil {
+			// Retry creating the table
+			for i := 0; i < retries; i++ {
+				time.Sleep(1 * time.Second)
+				_, err = db.Exec(query)
+				if err == nil {
+					break
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// AutoMigrateMoneyColumns converts the money columns of tables created before they were DECIMAL.
+// It must run after the other migrations so every table exists.
+func AutoMigrateMoneyColumns(shards []*sql.DB, promotionsDB *sql.DB) error {
+	orderColumns := map[string][]string{
+		"orders":           {"subtotal", "promotion_discount", "total"},
+		"product_requests": {"final_price"},
+		"order_promotions": {"discount"},
+	}
+	for _, db := range shards {
+		for table, columns := range orderColumns {
+			for _, column := range columns {
+				if err := money.ConvertColumn(db, table, column); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if err := money.ConvertColumn(promotionsDB, "promotions", "min_basket"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(promotionsDB, "promotions", "amount", money.DecimalColumn+" NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	return money.ConvertColumn(promotionsDB, "promotion_redemptions", "discount")
+}
+
+// addColumnIfMissing adds a column to a table unless information_schema shows it already exists.
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	var count int
+	query := `SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?`
+	if err := db.QueryRow(query, table, column).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	_, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// AutoMigrateOrderAddresses creates the order_addresses table holding the shipping and billing
+// addresses copied onto orders.
+func AutoMigrateOrderAddresses(retries int, dbs ...*sql.DB) error {
+	query := `
+		CREATE TABLE IF NOT EXISTS order_addresses (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			order_id INT NOT NULL,
+			kind VARCHAR(10) NOT NULL,
+			address_id INT NOT NULL,
+			name VARCHAR(100) NOT NULL,
+			line1 VARCHAR(255) NOT NULL,
+			line2 VARCHAR(255) NOT NULL DEFAULT '',
+			city VARCHAR(100) NOT NULL,
+			region VARCHAR(100) NOT NULL DEFAULT '',
+			postal_code VARCHAR(20) NOT NULL DEFAULT '',
+			country CHAR(2) NOT NULL,
+			phone VARCHAR(30) NOT NULL DEFAULT '',
+			UNIQUE INDEX order_kind_idx (order_id, kind),
+			FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE
+		);
+	`
+	for _, db := range dbs {
+		_, err := db.Exec(query)
+		if err != nil {
+			// Retry creating the table
+			for i := 0; i < retries; i++ {
+				time.Sleep(1 * time.Second)
+				_, err = db.Exec(query)
+				if err == nil {
+					break
+				}
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// AutoMigrateOrderAPIKeys adds the column recording the API key an order was placed with to
+// orders tables created before orders could be placed with API keys.
+func AutoMigrateOrderAPIKeys(dbs ...*sql.DB) error {
+	for _, db := range dbs {
+		if err := addColumnIfMissing(db, "orders", "api_key_id", "INT NOT NULL DEFAULT 0"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AutoMigrateOrderCreatedAt adds the time orders were placed, so order history can be read by date.
+// Orders placed before the column existed get the time of the migration.
+func AutoMigrateOrderCreatedAt(dbs ...*sql.DB) error {
+	for _, db := range dbs {
+		if err := addColumnIfMissing(db, "orders", "created_at", "DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP, ADD INDEX idx_orders_created_at (created_at)"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,22 +1,35 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"github.com/go-redis/redis/v8"
 	_ "github.com/go-sql-driver/mysql"
-	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
-	"golang.org/x/time/rate"
 	"product-catalog-service/internal/api"
+	"product-catalog-service/internal/config"
 	consumer2 "product-catalog-service/internal/consumer"
 	"product-catalog-service/internal/repository"
 	"product-catalog-service/internal/service"
+	"product-catalog-service/migrations"
+	"shared/auth"
+	sharedconfig "shared/config"
+	"shared/health"
+	"shared/lifecycle"
+	"shared/logging"
+	"shared/metrics"
+	"shared/mtls"
+	"shared/ratelimit"
+	"shared/sqldb"
+	"shared/tracing"
 	"time"
 )
 
-func connectDB() (*sql.DB, error) {
-	db, err := sql.Open("mysql", "root:@tcp(127.0.0.1:3306)/product-db")
+var logger = logging.Logger
+
+func connectDB(database sharedconfig.Database) (*sql.DB, error) {
+	db, err := sqldb.Open("mysql", database.DSN(), database.Name)
 	if err != nil {
 		return nil, err
 	}
@@ -24,15 +37,50 @@ func connectDB() (*sql.DB, error) {
 }
 
 func main() {
+	configFile := sharedconfig.File("config.yaml")
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to load config")
+	}
+	logging.Setup("product-catalog-service", cfg.Log)
+
+	// on SIGTERM requests are drained, the consumer stops and connections are closed
+	app := lifecycle.New(time.Duration(cfg.Server.ShutdownTimeout), time.Duration(cfg.Server.ShutdownDelay))
+
+	// spans are flushed after everything else is closed
+	shutdownTracing, err := tracing.Setup("product-catalog-service", cfg.Tracing)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to set up tracing")
+	}
+	app.OnShutdown("tracing", shutdownTracing)
+
+	// Prometheus scrapes /metrics on its own port
+	app.Go(func(ctx context.Context) {
+		if err := metrics.Serve(ctx, cfg.Metrics.Addr()); err != nil {
+			logger.Error().Err(err).Msg("Metrics server stopped")
+		}
+	})
 
-	db, err := connectDB()
+	db, err := connectDB(cfg.Database)
 	if err != nil {
 		panic(err)
 	}
+	app.Close("database", db)
+
+	err = migrations.AutoMigrateMoneyColumns(db)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to migrate money columns")
+	}
 
 	rdb := redis.NewClient(&redis.Options{
-		Addr: "localhost:6379",
+		Addr:     cfg.Redis.Addr,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
 	})
+	app.Close("redis", rdb)
+	rdb.AddHook(tracing.RedisHook())
+	// hit ratio of the product cache
+	rdb.AddHook(metrics.CacheHook("product:"))
 
 	// Initialize product service
 	productRepo := repository.NewProductRepository(db)
@@ -40,55 +88,60 @@ func main() {
 	productHandler := api.NewProductHandler(*productService)
 
 	// consumer
-	consumer := consumer2.NewConsumer(productService)
-	go consumer.StartKafkaConsumer()
+	orderReader := config.NewKafkaReader(cfg.Kafka.Brokers, "order-topic", "product-service-group")
+	app.Close("kafka reader", orderReader)
+	metrics.ConsumerLag("order-topic", func() int64 {
+		return orderReader.Stats().Lag
+	})
+	consumer := consumer2.NewConsumer(productService, orderReader)
+	app.Go(consumer.StartKafkaConsumer)
 
 	// Initialize echo
 	e := echo.New()
+	// client IPs are only read from X-Forwarded-For when the gateway sends it
+	e.IPExtractor = cfg.Server.IPExtractor()
 
-	config := middleware.RateLimiterConfig{
-		Skipper: middleware.DefaultSkipper,
-		Store: middleware.NewRateLimiterMemoryStoreWithConfig(
-			middleware.RateLimiterMemoryStoreConfig{
-				Rate:      rate.Limit(1),
-				Burst:     3,
-				ExpiresIn: 3 * time.Minute,
-			}),
-		IdentifierExtractor: func(context echo.Context) (string, error) {
-			// for local
-			return context.Request().RemoteAddr, nil
-			// for production
-			// return context.Request().Header.Get(echo.HeaderXRealIP), nil
-			// return ctx.RealIP(), nil
-		},
-		ErrorHandler: func(context echo.Context, err error) error {
-			return context.JSON(429, map[string]string{"error": "rate limit exceeded"})
-		},
-		DenyHandler: func(context echo.Context, identifier string, err error) error {
-			return context.JSON(429, map[string]string{"error": "rate limit exceeded"})
-		},
-	}
+	// a backstop per client IP, the gateway applies the limits per caller
+	limiter := ratelimit.NewLimiter(rdb, "product-catalog-service", &cfg.RateLimits)
+
+	// the log level and rate limits can be changed without a restart
+	app.Go(func(ctx context.Context) {
+		sharedconfig.Watch(ctx, configFile, 10*time.Second, func(reloaded *config.Config) {
+			reloaded.Log.Apply()
+			limiter.SetConfig(&reloaded.RateLimits)
+		}, func(err error) {
+			logger.Error().Err(err).Msg("Failed to reload config, keeping the current one")
+		})
+	})
 
 	// Middleware
-	e.Use(middleware.Logger())
+	e.Use(logging.Middleware())
 	e.Use(middleware.Recover())
-	e.Use(echojwt.JWT([]byte("secret")))
-	e.Use(middleware.RateLimiterWithConfig(config))
+	e.Use(metrics.Middleware())
+	e.Use(tracing.Middleware())
+	e.Use(ratelimit.Middleware(limiter))
+	// access tokens are verified with the public keys of user-management-service
+	authenticated := auth.Verifier(auth.NewKeySet(cfg.Auth.JWKSURL), auth.NewRevocationList(rdb), "product-catalog-service")
 
 	// Routes
-	e.GET("/products/:id/stock", productHandler.GetProductStock)
-	e.POST("/products/reserve", productHandler.ReserveProductStock)
-	e.POST("/products/release", productHandler.ReleaseProductStock)
-	e.GET("/products/warmup-cache", productHandler.PreWarmupCache)
-
-	e.GET("/products/health", func(c echo.Context) error {
-		return c.JSON(200, map[string]interface{}{
-			"status":  "ok",
-			"service": "product-catalog-service",
-			"time":    time.Now().Format(time.RFC3339),
-		})
-	})
+	e.GET("/products/:id/stock", productHandler.GetProductStock, authenticated, auth.RequirePermission("inventory:read"))
+	e.POST("/products/reserve", productHandler.ReserveProductStock, authenticated, auth.RequirePermission("inventory:write"))
+	e.POST("/products/release", productHandler.ReleaseProductStock, authenticated, auth.RequirePermission("inventory:write"))
+	e.GET("/products/warmup-cache", productHandler.PreWarmupCache, authenticated, auth.RequirePermission("catalog:admin"))
+
+	// probes don't carry tokens, so the health endpoints are open
+	checker := health.NewChecker("product-catalog-service", app.Context())
+	checker.Add("mysql", true, health.DB(db))
+	checker.Add("redis", true, health.Redis(rdb))
+	// without Kafka stock still works, only order events wait
+	checker.Add("kafka", false, health.TCP(cfg.Kafka.Brokers...))
+	checker.Register(e, "/products/health")
 
 	// Start server
-	e.Logger.Fatal(e.Start(":8081"))
+	err = app.Serve(e, func() error {
+		return mtls.Start(e, cfg.Server.Addr(), cfg.TLS)
+	})
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Server stopped")
+	}
 }
@@ -0,0 +1,32 @@
+package config
+
+import (
+	sharedconfig "shared/config"
+	"shared/logging"
+	"shared/metrics"
+	"shared/mtls"
+	"shared/ratelimit"
+	"shared/tracing"
+)
+
+type Config struct {
+	Server     sharedconfig.Server   `yaml:"server"`
+	Metrics    metrics.Config        `yaml:"metrics"`
+	Tracing    tracing.Config        `yaml:"tracing"`
+	Log        logging.Config        `yaml:"log"`
+	Database   sharedconfig.Database `yaml:"database" env:"DB_"`
+	Redis      sharedconfig.Redis    `yaml:"redis"`
+	RateLimits ratelimit.Config      `yaml:"rate_limits"`
+	Kafka      sharedconfig.Kafka    `yaml:"kafka"`
+	Auth       sharedconfig.Auth     `yaml:"auth"`
+	TLS        mtls.Files            `yaml:"tls"`
+}
+
+// Load reads and checks the config file, see sharedconfig.Load.
+func Load(path string) (*Config, error) {
+	config := &Config{}
+	if err := sharedconfig.Load(path, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
@@ -3,43 +3,57 @@ package consumer
 import (
 	"context"
 	"encoding/json"
-	"github.com/rs/zerolog/log"
 	"github.com/segmentio/kafka-go"
 	"product-catalog-service/internal/entity"
 	"product-catalog-service/internal/service"
+	"shared/logging"
+	"shared/metrics"
+	"shared/tracing"
 	"strings"
 )
 
+var logger = logging.Logger
+
 type Consumer struct {
-	productSvc *service.ProductService
+	productSvc  *service.ProductService
+	orderReader *kafka.Reader
 }
 
-func NewConsumer(productSvc *service.ProductService) *Consumer {
-	return &Consumer{productSvc: productSvc}
+// NewConsumer creates a consumer of order events, read from orderReader.
+func NewConsumer(productSvc *service.ProductService, orderReader *kafka.Reader) *Consumer {
+	return &Consumer{productSvc: productSvc, orderReader: orderReader}
 }
 
-// StartKafkaConsumer starts a Kafka consumer to listen for order events
-func (c *Consumer) StartKafkaConsumer() {
-	// Create Kafka reader for order topic
-	orderReader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:  []string{"localhost:9092", "localhost:9093", "localhost:9094"},
-		Topic:    "order-topic",
-		GroupID:  "product-service-group",
-		MinBytes: 10e3, // 10KB
-		MaxBytes: 10e6, // 10MB
-	})
-
+// StartKafkaConsumer listens for order events until ctx is done. Offsets are committed once a
+// message is processed, so a message being processed during shutdown is finished and committed,
+// and one interrupted by a crash is read again.
+func (c *Consumer) StartKafkaConsumer(ctx context.Context) {
+	topic := c.orderReader.Config().Topic
 	for {
 		// Read message from order topic
-		ctx := context.Background()
-		msg, err := orderReader.ReadMessage(ctx)
+		msg, err := c.orderReader.FetchMessage(ctx)
 		if err != nil {
-			log.Error().Msgf("Error reading message: %v", err)
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Error().Ctx(ctx).Msgf("Error reading message: %v", err)
+			metrics.ConsumeFailed(topic, "fetch")
 			continue
 		}
+		metrics.Consumed(topic, msg.Time)
 
-		// Process message
-		c.processMessage(ctx, msg)
+		// Process message, without stopping halfway on shutdown, in the trace of the order
+		processCtx, span := tracing.StartConsume(context.WithoutCancel(ctx), msg)
+		processCtx = logging.Extract(processCtx, func(key string) string {
+			return header(msg, key)
+		})
+		c.processMessage(processCtx, msg)
+		err = c.orderReader.CommitMessages(processCtx, msg)
+		if err != nil {
+			logger.Error().Ctx(processCtx).Msgf("Error committing message offset: %v", err)
+			metrics.ConsumeFailed(topic, "commit")
+		}
+		tracing.End(span, err)
 	}
 }
 
@@ -50,10 +64,13 @@ func (c *Consumer) processMessage(ctx context.Context, msg kafka.Message) {
 
 	err := json.Unmarshal(msg.Value, &orderEvent)
 	if err != nil {
-		log.Error().Msgf("Error unmarshalling message: %v", err)
+		logger.Error().Ctx(ctx).Msgf("Error unmarshalling message: %v", err)
+		metrics.ConsumeFailed(msg.Topic, "decode")
 		return
 	}
 
+	ctx = logging.WithOrderID(ctx, orderEvent.OrderID)
+
 	// key -> "order.created.orderID" or "order.cancelled.orderID"
 	key := string(msg.Key)
 	listKey := strings.Split(key, ".")
@@ -66,7 +83,8 @@ func (c *Consumer) processMessage(ctx context.Context, msg kafka.Message) {
 		for _, item := range orderEvent.ProductRequests {
 			err := c.productSvc.ReserveProductStock(ctx, item.ProductID, item.Quantity)
 			if err != nil {
-				log.Error().Msgf("Error updating stock for product %d: %v", item.ProductID, err)
+				logger.Error().Ctx(ctx).Msgf("Error updating stock for product %d: %v", item.ProductID, err)
+				metrics.ConsumeFailed(msg.Topic, "process")
 			}
 		}
 	case "cancelled":
@@ -74,10 +92,22 @@ func (c *Consumer) processMessage(ctx context.Context, msg kafka.Message) {
 		for _, item := range orderEvent.ProductRequests {
 			err := c.productSvc.ReleaseProductStock(ctx, item.ProductID, item.Quantity)
 			if err != nil {
-				log.Error().Msgf("Error updating stock for product %d: %v", item.ProductID, err)
+				logger.Error().Ctx(ctx).Msgf("Error updating stock for product %d: %v", item.ProductID, err)
+				metrics.ConsumeFailed(msg.Topic, "process")
 			}
 		}
 	default:
-		log.Error().Msgf("Unknown order status: %s", orderEvent.Status)
+		logger.Error().Ctx(ctx).Msgf("Unknown order status: %s", orderEvent.Status)
+		metrics.ConsumeFailed(msg.Topic, "decode")
+	}
+}
+
+// header returns the value of the header key of msg, "" if it has none.
+func header(msg kafka.Message, key string) string {
+	for _, h := range msg.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
 	}
+	return ""
 }
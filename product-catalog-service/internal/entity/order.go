@@ -1,23 +1,25 @@
 package entity
 
+import "shared/money"
+
 type Order struct {
 	ID              int              `json:"id"`
 	UserID          int              `json:"user_id"`
 	OrderID         int              `json:"order_id"`
 	ProductRequests []ProductRequest `json:"product_requests"`
 	Quantity        int              `json:"quantity"`
-	Total           float64          `json:"total"`
+	Total           money.Money      `json:"total"`
 	TotalMarkUp     float64          `json:"total_mark_up"`
 	TotalDiscount   float64          `json:"total_discount"`
 	Status          string           `json:"status"` // e.g., "created", "paid", "canceled"
 }
 
 type ProductRequest struct {
-	ProductID  int     `json:"product_id"`
-	Quantity   int     `json:"quantity"`
-	MarkUp     float64 `json:"mark_up"`
-	Discount   float64 `json:"discount"`
-	FinalPrice float64 `json:"final_price"`
+	ProductID  int         `json:"product_id"`
+	Quantity   int         `json:"quantity"`
+	MarkUp     float64     `json:"mark_up"`
+	Discount   float64     `json:"discount"`
+	FinalPrice money.Money `json:"final_price"`
 }
 
 /*
@@ -27,7 +29,7 @@ CREATE TABLE orders (
 	id INT AUTO_INCREMENT PRIMARY KEY,
 	user_id INT NOT NULL,
 	quantity INT NOT NULL,
-	total DOUBLE NOT NULL,
+	total DECIMAL(19,4) NOT NULL,
 	status VARCHAR(50) NOT NULL,
 	total_mark_up DOUBLE NOT NULL,
 	total_discount DOUBLE NOT NULL
@@ -40,7 +42,7 @@ CREATE TABLE product_requests (
 	quantity INT NOT NULL,
 	mark_up DOUBLE NOT NULL,
 	discount DOUBLE NOT NULL,
-	final_price DOUBLE NOT NULL
+	final_price DECIMAL(19,4) NOT NULL
 );
 
 */
@@ -0,0 +1,13 @@
+package service
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// stockReservationsFailed counts reservations that failed, by reason: out_of_stock when there
+// isn't enough stock, error when the product couldn't be read or updated.
+var stockReservationsFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "stock_reservations_failed_total",
+	Help: "Failed stock reservations by reason (out_of_stock or error).",
+}, []string{"reason"})
@@ -6,14 +6,13 @@ import (
 	"errors"
 	"fmt"
 	"github.com/go-redis/redis/v8"
-	"github.com/rs/zerolog"
-	"os"
 	"product-catalog-service/internal/entity"
 	"product-catalog-service/internal/repository"
+	"shared/logging"
 	"time"
 )
 
-var logger = zerolog.New(os.Stdout).With().Timestamp().Logger()
+var logger = logging.Logger
 
 type ProductService struct {
 	productRepo repository.ProductRepository
@@ -35,9 +34,9 @@ func (p *ProductService) GetProductStock(ctx context.Context, productID int) (in
 	productCache, err := p.rdb.Get(ctx, key).Result()
 	if err != nil {
 		if errors.Is(err, redis.Nil) {
-			logger.Warn().Msgf("Stock for product %d not found in cache", productID)
+			logger.Warn().Ctx(ctx).Msgf("Stock for product %d not found in cache", productID)
 		} else {
-			logger.Error().Err(err).Msgf("Error getting stock for product %d from cache", productID)
+			logger.Error().Ctx(ctx).Err(err).Msgf("Error getting stock for product %d from cache", productID)
 			return 0, err
 		}
 	}
@@ -46,40 +45,51 @@ func (p *ProductService) GetProductStock(ctx context.Context, productID int) (in
 		var product entity.Product
 		err = json.Unmarshal([]byte(productCache), &product)
 		if err != nil {
-			logger.Error().Err(err).Msgf("Error unmarshalling product %d", productID)
+			logger.Error().Ctx(ctx).Err(err).Msgf("Error unmarshalling product %d", productID)
 			return 0, err
 		}
 
-		logger.Info().Msgf("Retrieved stock for product %d: %d", productID, product.Stock)
+		logger.Info().Ctx(ctx).Msgf("Retrieved stock for product %d: %d", productID, product.Stock)
 		return product.Stock, nil
 	}
 
 	product, err := p.productRepo.GetProductByID(ctx, productID)
 	if err != nil {
-		logger.Error().Err(err).Msgf("Error getting product by ID %d", productID)
+		logger.Error().Ctx(ctx).Err(err).Msgf("Error getting product by ID %d", productID)
 		return 0, err
 	}
 
 	// Write to cache
 	err = p.rdb.Set(ctx, key, product, 0).Err()
 	if err != nil {
-		logger.Error().Err(err).Msgf("Error setting product %d in cache", productID)
+		logger.Error().Ctx(ctx).Err(err).Msgf("Error setting product %d in cache", productID)
 		return 0, err
 	}
 
 	return product.Stock, nil
 }
 
+// ErrOutOfStock is returned when a reservation exceeds the available stock.
+var ErrOutOfStock = errors.New("product out of stock")
+
 // ReserveProductStock reserves stock for an order.
-func (p *ProductService) ReserveProductStock(ctx context.Context, productID int, quantity int) error {
+func (p *ProductService) ReserveProductStock(ctx context.Context, productID int, quantity int) (err error) {
+	defer func() {
+		if errors.Is(err, ErrOutOfStock) {
+			stockReservationsFailed.WithLabelValues("out_of_stock").Inc()
+		} else if err != nil {
+			stockReservationsFailed.WithLabelValues("error").Inc()
+		}
+	}()
+
 	// Get product from cache
 	key := fmt.Sprintf("product:%d", productID)
 	productCache, err := p.rdb.Get(ctx, key).Result()
 	if err != nil {
 		if errors.Is(err, redis.Nil) {
-			logger.Warn().Msgf("Product %d not found in cache", productID)
+			logger.Warn().Ctx(ctx).Msgf("Product %d not found in cache", productID)
 		} else {
-			logger.Error().Err(err).Msgf("Error getting product %d from cache", productID)
+			logger.Error().Ctx(ctx).Err(err).Msgf("Error getting product %d from cache", productID)
 			return err
 		}
 	}
@@ -87,42 +97,42 @@ func (p *ProductService) ReserveProductStock(ctx context.Context, productID int,
 	var productData entity.Product
 	err = json.Unmarshal([]byte(productCache), &productData)
 	if err != nil {
-		logger.Error().Err(err).Msgf("Error unmarshalling product %d", productID)
+		logger.Error().Ctx(ctx).Err(err).Msgf("Error unmarshalling product %d", productID)
 		return err
 	}
 
 	if productData.ID == 0 {
 		product, err := p.productRepo.GetProductByID(ctx, productID)
 		if err != nil {
-			logger.Error().Err(err).Msgf("Error getting product by ID %d", productData.ID)
+			logger.Error().Ctx(ctx).Err(err).Msgf("Error getting product by ID %d", productData.ID)
 			return err
 		}
 		productData = *product
 	}
 
 	if productData.Stock < quantity {
-		logger.Warn().Msgf("Product %d out of stock", productID)
-		return fmt.Errorf("product out of stock")
+		logger.Warn().Ctx(ctx).Msgf("Product %d out of stock", productID)
+		return ErrOutOfStock
 	}
 
 	productData.Stock -= quantity
 	_, err = p.productRepo.UpdateProduct(ctx, &productData)
 	if err != nil {
-		logger.Error().Err(err).Msgf("Error updating product %d", productID)
+		logger.Error().Ctx(ctx).Err(err).Msgf("Error updating product %d", productID)
 		return err
 	}
 
 	// Delete product from cache
 	//err = p.rdb.Del(ctx, key).Err()
 	//if err != nil {
-	//	logger.Error().Err(err).Msgf("Error deleting product %d from cache", productData.ID)
+	//	logger.Error().Ctx(ctx).Err(err).Msgf("Error deleting product %d from cache", productData.ID)
 	//	return err
 	//}
 
 	// Write to cache
 	err = p.rdb.Set(ctx, key, productData, 0).Err()
 	if err != nil {
-		logger.Error().Err(err).Msgf("Error setting product %d in cache", productID)
+		logger.Error().Ctx(ctx).Err(err).Msgf("Error setting product %d in cache", productID)
 	}
 
 	return nil
@@ -135,9 +145,9 @@ func (p *ProductService) ReleaseProductStock(ctx context.Context, productID int,
 	productCache, err := p.rdb.Get(ctx, key).Result()
 	if err != nil {
 		if errors.Is(err, redis.Nil) {
-			logger.Warn().Msgf("Product %d not found in cache", productID)
+			logger.Warn().Ctx(ctx).Msgf("Product %d not found in cache", productID)
 		} else {
-			logger.Error().Err(err).Msgf("Error getting product %d from cache", productID)
+			logger.Error().Ctx(ctx).Err(err).Msgf("Error getting product %d from cache", productID)
 			return err
 		}
 	}
@@ -145,14 +155,14 @@ func (p *ProductService) ReleaseProductStock(ctx context.Context, productID int,
 	var productData entity.Product
 	err = json.Unmarshal([]byte(productCache), &productData)
 	if err != nil {
-		logger.Error().Err(err).Msgf("Error unmarshalling product %d", productID)
+		logger.Error().Ctx(ctx).Err(err).Msgf("Error unmarshalling product %d", productID)
 		return err
 	}
 
 	if productData.ID == 0 {
 		product, err := p.productRepo.GetProductByID(ctx, productID)
 		if err != nil {
-			logger.Error().Err(err).Msgf("Error getting product by ID %d", productData.ID)
+			logger.Error().Ctx(ctx).Err(err).Msgf("Error getting product by ID %d", productData.ID)
 		}
 		productData = *product
 	}
@@ -160,21 +170,21 @@ func (p *ProductService) ReleaseProductStock(ctx context.Context, productID int,
 	productData.Stock += quantity
 	_, err = p.productRepo.UpdateProduct(ctx, &productData)
 	if err != nil {
-		logger.Error().Err(err).Msgf("Error updating product %d", productID)
+		logger.Error().Ctx(ctx).Err(err).Msgf("Error updating product %d", productID)
 		return err
 	}
 
 	// Delete product from cache
 	//err = p.rdb.Del(ctx, key).Err()
 	//if err != nil {
-	//	logger.Error().Err(err).Msgf("Error deleting product %d from cache", productData.ID)
+	//	logger.Error().Ctx(ctx).Err(err).Msgf("Error deleting product %d from cache", productData.ID)
 	//	return err
 	//}
 
 	// Write to cache
 	err = p.rdb.Set(ctx, key, productData, 0).Err()
 	if err != nil {
-		logger.Error().Err(err).Msgf("Error setting product %d in cache", productID)
+		logger.Error().Ctx(ctx).Err(err).Msgf("Error setting product %d in cache", productID)
 	}
 
 	return nil
@@ -184,7 +194,7 @@ func (p *ProductService) ReleaseProductStock(ctx context.Context, productID int,
 func (p *ProductService) PreWarmCache(ctx context.Context) error {
 	products, err := p.productRepo.GetProducts(ctx)
 	if err != nil {
-		logger.Error().Err(err).Msg("Error getting products")
+		logger.Error().Ctx(ctx).Err(err).Msg("Error getting products")
 		return err
 	}
 
@@ -192,7 +202,7 @@ func (p *ProductService) PreWarmCache(ctx context.Context) error {
 		key := fmt.Sprintf("product:%d", product.ID)
 		err := p.rdb.Set(ctx, key, product, 1*time.Minute).Err()
 		if err != nil {
-			logger.Error().Err(err).Msgf("Error setting product %d in cache", product.ID)
+			logger.Error().Ctx(ctx).Err(err).Msgf("Error setting product %d in cache", product.ID)
 		}
 	}
 
@@ -203,7 +213,7 @@ func (p *ProductService) PreWarmCache(ctx context.Context) error {
 func (p *ProductService) PreWarmCacheAsync(ctx context.Context) error {
 	products, err := p.productRepo.GetProducts(ctx)
 	if err != nil {
-		logger.Error().Err(err).Msg("Error getting products")
+		logger.Error().Ctx(ctx).Err(err).Msg("Error getting products")
 		return err
 	}
 
@@ -212,7 +222,7 @@ func (p *ProductService) PreWarmCacheAsync(ctx context.Context) error {
 			key := fmt.Sprintf("product:%d", product.ID)
 			err := p.rdb.Set(ctx, key, product, 1*time.Minute).Err()
 			if err != nil {
-				logger.Error().Err(err).Msgf("Error setting product %d in cache", product.ID)
+				logger.Error().Ctx(ctx).Err(err).Msgf("Error setting product %d in cache", product.ID)
 			}
 		}(*product)
 	}
@@ -0,0 +1,11 @@
+package migrations
+
+import (
+	"database/sql"
+	"shared/money"
+)
+
+// AutoMigrateMoneyColumns converts the products price column from DOUBLE to DECIMAL.
+func AutoMigrateMoneyColumns(db *sql.DB) error {
+	return money.ConvertColumn(db, "products", "price")
+}
@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIKeyPrefix starts every API key, so keys can be told apart from access tokens.
+const APIKeyPrefix = "mk_"
+
+// APIKeyHeader is the header API keys can be sent in, besides a bearer Authorization header.
+const APIKeyHeader = "X-API-Key"
+
+// APIKeyCacheTTL is how long services cache a resolved API key. Revoking a key puts it on the
+// revocation list for this long, so cached keys stop working right away too.
+const APIKeyCacheTTL = time.Minute
+
+// InvalidAPIKeyCacheTTL is how long services remember that an API key is invalid, so floods of
+// made up keys don't each cost a call to user-management-service. It is short, as a new key is
+// usable right away.
+const InvalidAPIKeyCacheTTL = 10 * time.Second
+
+// ErrInvalidAPIKey is returned for unknown, expired or revoked API keys.
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// APIKeyRevocationID is the revocation list entry of an API key.
+func APIKeyRevocationID(keyID string) string {
+	return "api_key:" + keyID
+}
+
+// APIKeyIntrospection is the response of the introspection endpoint of user-management-service.
+// Invalid keys are inactive rather than an error status, which is kept for failed calls.
+type APIKeyIntrospection struct {
+	Active bool    `json:"active"`
+	Claims *Claims `json:"claims,omitempty"`
+}
+
+// IsAPIKey reports whether a credential looks like an API key rather than an access token.
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
+
+// APIKeyResolver resolves API keys into the claims of their owner, limited to the key's scopes,
+// by asking user-management-service. Resolved keys are cached for APIKeyCacheTTL, invalid ones
+// for InvalidAPIKeyCacheTTL.
+type APIKeyResolver struct {
+	url    string
+	client *http.Client
+
+	mu      sync.Mutex
+	cache   map[string]cachedAPIKey
+	invalid map[string]cachedAPIKey // Kept apart, so made up keys can't evict valid ones
+}
+
+type cachedAPIKey struct {
+	claims  *Claims // nil for invalid keys
+	expires time.Time
+}
+
+// maxCachedAPIKeys bounds both caches. Once one is full its expired entries are dropped, and if
+// none had expired an arbitrary entry is evicted.
+const maxCachedAPIKeys = 1024
+
+// NewAPIKeyResolver creates a resolver calling the introspection endpoint at url. client must
+// send a service token for user-management-service, e.g. one made by httpclient.ForService.
+func NewAPIKeyResolver(url string, client *http.Client) *APIKeyResolver {
+	return &APIKeyResolver{
+		url:     url,
+		client:  client,
+		cache:   make(map[string]cachedAPIKey),
+		invalid: make(map[string]cachedAPIKey),
+	}
+}
+
+// Resolve returns the claims of an API key, or ErrInvalidAPIKey.
+func (r *APIKeyResolver) Resolve(ctx context.Context, key string) (*Claims, error) {
+	// keys are only held as hashes, like everywhere else
+	sum := sha256.Sum256([]byte(key))
+	cacheKey := hex.EncodeToString(sum[:])
+
+	now := time.Now()
+	r.mu.Lock()
+	cached, ok := r.cache[cacheKey]
+	invalid, isInvalid := r.invalid[cacheKey]
+	r.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.claims, nil
+	}
+	if isInvalid && now.Before(invalid.expires) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	claims, err := r.introspect(ctx, key)
+	if errors.Is(err, ErrInvalidAPIKey) {
+		r.mu.Lock()
+		store(r.invalid, cacheKey, cachedAPIKey{expires: time.Now().Add(InvalidAPIKeyCacheTTL)})
+		r.mu.Unlock()
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	store(r.cache, cacheKey, cachedAPIKey{claims: claims, expires: time.Now().Add(APIKeyCacheTTL)})
+	r.mu.Unlock()
+	return claims, nil
+}
+
+// store adds an entry to a cache, making room first if it holds maxCachedAPIKeys.
+func store(cache map[string]cachedAPIKey, key string, entry cachedAPIKey) {
+	if _, ok := cache[key]; !ok && len(cache) >= maxCachedAPIKeys {
+		now := time.Now()
+		for k, cached := range cache {
+			if now.After(cached.expires) {
+				delete(cache, k)
+			}
+		}
+		// map iteration starts at a random entry
+		for k := range cache {
+			if len(cache) < maxCachedAPIKeys {
+				break
+			}
+			delete(cache, k)
+		}
+	}
+	cache[key] = entry
+}
+
+func (r *APIKeyResolver) introspect(ctx context.Context, key string) (*Claims, error) {
+	body, err := json.Marshal(map[string]string{"key": key})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspecting API key: %s", resp.Status)
+	}
+
+	var introspection APIKeyIntrospection
+	if err := json.NewDecoder(resp.Body).Decode(&introspection); err != nil {
+		return nil, err
+	}
+	if !introspection.Active || introspection.Claims == nil || introspection.Claims.APIKeyID == "" {
+		return nil, ErrInvalidAPIKey
+	}
+	return introspection.Claims, nil
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// introspection answers like user-management-service: mk_valid is a key, mk_down fails and
+// every other key is inactive. It counts the calls.
+func introspection(t *testing.T) (*APIKeyResolver, *atomic.Int64) {
+	t.Helper()
+	var calls atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		switch body["key"] {
+		case "mk_valid":
+			json.NewEncoder(w).Encode(APIKeyIntrospection{Active: true, Claims: &Claims{APIKeyID: "7"}})
+		case "mk_down":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			json.NewEncoder(w).Encode(APIKeyIntrospection{})
+		}
+	}))
+	t.Cleanup(server.Close)
+	return NewAPIKeyResolver(server.URL, server.Client()), &calls
+}
+
+func TestResolveCachesValidKeys(t *testing.T) {
+	resolver, calls := introspection(t)
+	for i := 0; i < 3; i++ {
+		claims, err := resolver.Resolve(context.Background(), "mk_valid")
+		if err != nil || claims.APIKeyID != "7" {
+			t.Fatalf("got %+v, %v", claims, err)
+		}
+	}
+	if calls.Load() != 1 {
+		t.Errorf("introspected %d times, want once", calls.Load())
+	}
+}
+
+func TestResolveCachesInvalidKeys(t *testing.T) {
+	resolver, calls := introspection(t)
+	for i := 0; i < 3; i++ {
+		if _, err := resolver.Resolve(context.Background(), "mk_made_up"); !errors.Is(err, ErrInvalidAPIKey) {
+			t.Fatalf("got %v, want ErrInvalidAPIKey", err)
+		}
+	}
+	if calls.Load() != 1 {
+		t.Errorf("introspected %d times, want once", calls.Load())
+	}
+}
+
+func TestResolveDoesNotCacheFailures(t *testing.T) {
+	resolver, calls := introspection(t)
+	for i := 0; i < 2; i++ {
+		_, err := resolver.Resolve(context.Background(), "mk_down")
+		if err == nil || errors.Is(err, ErrInvalidAPIKey) {
+			t.Fatalf("got %v, want a failed call", err)
+		}
+	}
+	if calls.Load() != 2 {
+		t.Errorf("introspected %d times, want twice", calls.Load())
+	}
+}
+
+func TestResolveCacheIsBounded(t *testing.T) {
+	resolver, calls := introspection(t)
+	if _, err := resolver.Resolve(context.Background(), "mk_valid"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < maxCachedAPIKeys+100; i++ {
+		resolver.Resolve(context.Background(), fmt.Sprintf("mk_made_up_%d", i))
+	}
+	if len(resolver.invalid) > maxCachedAPIKeys {
+		t.Errorf("%d invalid keys cached, want at most %d", len(resolver.invalid), maxCachedAPIKeys)
+	}
+
+	// the flood of made up keys didn't evict the valid one
+	calls.Store(0)
+	if _, err := resolver.Resolve(context.Background(), "mk_valid"); err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 0 {
+		t.Error("valid key was evicted by invalid ones")
+	}
+}
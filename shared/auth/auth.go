@@ -0,0 +1,196 @@
+// Package auth holds the access token conventions shared by the service that issues tokens
+// (user-management-service) and the services that accept them.
+package auth
+
+import (
+	"context"
+	"errors"
+	"github.com/go-redis/redis/v8"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"shared/logging"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Claims are the claims of an access token. User tokens belong to a login session, so they can be
+// revoked before they expire by revoking the session. Service tokens, issued to other services by
+// the client credentials flow, have a client ID and an audience instead, and are revoked per client.
+// Requests made with an API key get the claims of the key's owner, with the key's ID.
+type Claims struct {
+	Name        string   `json:"name"`
+	Email       string   `json:"email"`
+	SessionID   string   `json:"sid,omitempty"`
+	ClientID    string   `json:"client_id,omitempty"`
+	APIKeyID    string   `json:"api_key_id,omitempty"`
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// RevocationList is the list of revoked sessions and service clients, kept in Redis so every
+// service sees it. Entries only need to live as long as the access tokens they revoke can.
+type RevocationList struct {
+	rdb *redis.Client
+}
+
+// NewRevocationList creates a revocation list on the given Redis client.
+func NewRevocationList(rdb *redis.Client) *RevocationList {
+	return &RevocationList{rdb: rdb}
+}
+
+func revokedKey(sessionID string) string {
+	return "revoked_session:" + sessionID
+}
+
+// Revoke marks a session as revoked for ttl, which should be the access token lifetime.
+func (l *RevocationList) Revoke(ctx context.Context, sessionID string, ttl time.Duration) error {
+	return l.rdb.Set(ctx, revokedKey(sessionID), time.Now().Unix(), ttl).Err()
+}
+
+// Clear removes an entry from the list, e.g. when a deactivated service client is reactivated.
+func (l *RevocationList) Clear(ctx context.Context, revocationID string) error {
+	return l.rdb.Del(ctx, revokedKey(revocationID)).Err()
+}
+
+// IsRevoked reports whether a session has been revoked.
+func (l *RevocationList) IsRevoked(ctx context.Context, sessionID string) (bool, error) {
+	err := l.rdb.Get(ctx, revokedKey(sessionID)).Err()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ClientRevocationID is the revocation list entry of a service client.
+func ClientRevocationID(clientID string) string {
+	return "client:" + clientID
+}
+
+// RevocationID returns the revocation list entry a parsed token is checked against: its session,
+// or its client for service tokens. It works whichever claims type the token was parsed into.
+func RevocationID(token *jwt.Token) string {
+	var sessionID, clientID string
+	switch claims := token.Claims.(type) {
+	case *Claims:
+		sessionID, clientID = claims.SessionID, claims.ClientID
+	case jwt.MapClaims:
+		sessionID, _ = claims["sid"].(string)
+		clientID, _ = claims["client_id"].(string)
+	}
+	if sessionID == "" && clientID != "" {
+		return ClientRevocationID(clientID)
+	}
+	return sessionID
+}
+
+// RejectRevoked returns a middleware that rejects tokens of revoked sessions. It must run after
+// the JWT middleware, which stores the parsed token in the context under "user".
+func RejectRevoked(list *RevocationList) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			token, ok := c.Get("user").(*jwt.Token)
+			if !ok {
+				return c.JSON(401, map[string]string{"error": "Unauthorized"})
+			}
+
+			revocationID := RevocationID(token)
+			if revocationID == "" {
+				return c.JSON(401, map[string]string{"error": "token has no session"})
+			}
+
+			revoked, err := list.IsRevoked(c.Request().Context(), revocationID)
+			if err != nil {
+				return c.JSON(503, map[string]string{"error": "could not check token revocation"})
+			}
+			if revoked {
+				return c.JSON(401, map[string]string{"error": "session has been revoked"})
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// Verifier returns a middleware that accepts requests with a bearer access token signed by one of
+// the keys in keys, whose session hasn't been revoked. Service tokens are only accepted if they
+// were issued for audience, the name of the verifying service. The parsed token is stored in the
+// context under "user" and its claims under "claims".
+func Verifier(keys *KeySet, revocations *RevocationList, audience string) echo.MiddlewareFunc {
+	return VerifierWithAPIKeys(keys, revocations, audience, nil)
+}
+
+// VerifierWithAPIKeys is Verifier also accepting API keys, resolved by apiKeys, in the X-API-Key
+// header or as a bearer token. Requests with an API key only have claims, no parsed token.
+func VerifierWithAPIKeys(keys *KeySet, revocations *RevocationList, audience string, apiKeys *APIKeyResolver) echo.MiddlewareFunc {
+	rejectRevoked := RejectRevoked(revocations)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		checked := rejectRevoked(next)
+		return func(c echo.Context) error {
+			tokenString, found := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+			if apiKey := c.Request().Header.Get(APIKeyHeader); apiKey != "" {
+				tokenString, found = apiKey, true
+			}
+			if !found || tokenString == "" {
+				return c.JSON(401, map[string]string{"error": "Unauthorized"})
+			}
+
+			if apiKeys != nil && IsAPIKey(tokenString) {
+				return verifyAPIKey(c, next, apiKeys, revocations, tokenString)
+			}
+
+			claims := &Claims{}
+			token, err := jwt.ParseWithClaims(tokenString, claims, keys.Keyfunc, jwt.WithValidMethods(SigningMethods), jwt.WithIssuer(Issuer))
+			if err != nil {
+				return c.JSON(401, map[string]string{"error": "invalid token"})
+			}
+			if claims.ClientID != "" && !slices.Contains(claims.Audience, audience) {
+				return c.JSON(401, map[string]string{"error": "token is not for this service"})
+			}
+
+			c.Set("user", token)
+			c.Set("claims", claims)
+			withUser(c, claims)
+			return checked(c)
+		}
+	}
+}
+
+func verifyAPIKey(c echo.Context, next echo.HandlerFunc, apiKeys *APIKeyResolver, revocations *RevocationList, key string) error {
+	ctx := c.Request().Context()
+	claims, err := apiKeys.Resolve(ctx, key)
+	if errors.Is(err, ErrInvalidAPIKey) {
+		return c.JSON(401, map[string]string{"error": "invalid API key"})
+	}
+	if err != nil {
+		return c.JSON(503, map[string]string{"error": "could not check API key"})
+	}
+
+	// the cached claims of a key revoked since are caught by the revocation list
+	revoked, err := revocations.IsRevoked(ctx, APIKeyRevocationID(claims.APIKeyID))
+	if err != nil {
+		return c.JSON(503, map[string]string{"error": "could not check token revocation"})
+	}
+	if revoked {
+		return c.JSON(401, map[string]string{"error": "API key has been revoked"})
+	}
+	if claims.ExpiresAt != nil && time.Now().After(claims.ExpiresAt.Time) {
+		return c.JSON(401, map[string]string{"error": "API key has expired"})
+	}
+
+	c.Set("claims", claims)
+	withUser(c, claims)
+	return next(c)
+}
+
+// withUser names the user in the log lines of the request. Service tokens act for no user.
+func withUser(c echo.Context, claims *Claims) {
+	if claims.ClientID == "" && claims.Subject != "" {
+		c.SetRequest(c.Request().WithContext(logging.WithUserID(c.Request().Context(), claims.Subject)))
+	}
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"github.com/labstack/echo/v4"
+	"strconv"
+	"strings"
+)
+
+// Permissions are named <resource>:<action>, optionally narrowed to the caller's own resources
+// with an ":own" suffix. A permission implies its ":own" variant, and "*" grants everything.
+const (
+	PermissionAll = "*"
+	ownSuffix     = ":own"
+)
+
+// HasPermission reports whether the claims grant a permission.
+func (c *Claims) HasPermission(permission string) bool {
+	broader := strings.TrimSuffix(permission, ownSuffix)
+	for _, granted := range c.Permissions {
+		if granted == PermissionAll || granted == permission || granted == broader {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccess reports whether the claims grant permission on a resource owned by ownerID: either
+// the permission itself, or its ":own" variant when the caller is the owner.
+func (c *Claims) CanAccess(permission string, ownerID int) bool {
+	if c.HasPermission(permission) {
+		return true
+	}
+	userID, err := c.UserID()
+	return err == nil && userID == ownerID && c.HasPermission(permission+ownSuffix)
+}
+
+// UserID returns the ID of the user the token was issued to.
+func (c *Claims) UserID() (int, error) {
+	return strconv.Atoi(c.Subject)
+}
+
+// ClaimsFrom returns the claims stored in the context by Verifier, or nil.
+func ClaimsFrom(c echo.Context) *Claims {
+	claims, _ := c.Get("claims").(*Claims)
+	return claims
+}
+
+// RequirePermission returns a middleware that only lets through callers granted at least one of
+// the permissions. Routes using an ":own" permission must still check ownership in the handler.
+func RequirePermission(permissions ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			claims := ClaimsFrom(c)
+			if claims == nil {
+				return c.JSON(401, map[string]string{"error": "Unauthorized"})
+			}
+
+			for _, permission := range permissions {
+				if claims.HasPermission(permission) {
+					return next(c)
+				}
+			}
+			return c.JSON(403, map[string]string{"error": "Forbidden"})
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokenSource obtains service tokens from user-management-service with the client credentials
+// flow, for calls to one audience. Tokens are cached and fetched again shortly before they expire.
+type TokenSource struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	audience     string
+	client       *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// refreshMargin is how long before expiry a cached token is replaced, so it can't expire in flight.
+const refreshMargin = 30 * time.Second
+
+// NewTokenSource creates a token source. client is used to call the token endpoint, and may be
+// nil for a default client.
+func NewTokenSource(tokenURL, clientID, clientSecret, audience string, client *http.Client) *TokenSource {
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Second}
+	}
+	return &TokenSource{
+		tokenURL:     tokenURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		audience:     audience,
+		client:       client,
+	}
+}
+
+// Token returns a valid service token, fetching a new one if needed.
+func (s *TokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && time.Until(s.expires) > refreshMargin {
+		return s.token, nil
+	}
+
+	form := url.Values{
+		"grant_type": {"client_credentials"},
+		"audience":   {s.audience},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(s.clientID), url.QueryEscape(s.clientSecret))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned %s", resp.Status)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+
+	s.token = body.AccessToken
+	s.expires = time.Now().Add(time.Duration(body.ExpiresIn) * time.Second)
+	return s.token, nil
+}
+
+// Invalidate drops the cached token, e.g. after a call was rejected with 401.
+func (s *TokenSource) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = ""
+}
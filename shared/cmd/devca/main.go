@@ -0,0 +1,133 @@
+// Command devca generates a local CA and a certificate per service for mutual TLS in development:
+//
+//	go run ./cmd/devca -out ../certs order-service product-catalog-service dynamic-pricing-service
+//
+// Each service certificate is valid as both server and client, for its name, localhost and 127.0.0.1.
+// An existing CA in the output directory is reused, so services can be added later.
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func main() {
+	out := flag.String("out", "certs", "output directory")
+	validity := flag.Duration("validity", 365*24*time.Hour, "certificate validity")
+	flag.Parse()
+
+	if err := os.MkdirAll(*out, 0o700); err != nil {
+		log.Fatal(err)
+	}
+
+	caCert, caKey, err := loadOrCreateCA(*out, *validity)
+	if err != nil {
+		log.Fatalf("CA: %v", err)
+	}
+
+	for _, name := range flag.Args() {
+		template := &x509.Certificate{
+			Subject:     pkix.Name{CommonName: name},
+			DNSNames:    []string{name, "localhost"},
+			IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+			KeyUsage:    x509.KeyUsageDigitalSignature,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		}
+		if err := issue(*out, name, template, caCert, caKey, *validity); err != nil {
+			log.Fatalf("%s: %v", name, err)
+		}
+		log.Printf("wrote %s.pem and %s-key.pem", name, name)
+	}
+}
+
+func loadOrCreateCA(dir string, validity time.Duration) (*x509.Certificate, crypto.Signer, error) {
+	certPEM, certErr := os.ReadFile(filepath.Join(dir, "ca.pem"))
+	keyPEM, keyErr := os.ReadFile(filepath.Join(dir, "ca-key.pem"))
+	if certErr == nil && keyErr == nil {
+		return parse(certPEM, keyPEM)
+	}
+
+	template := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "microservices dev CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	if err := issue(dir, "ca", template, nil, nil, validity); err != nil {
+		return nil, nil, err
+	}
+	log.Printf("wrote ca.pem and ca-key.pem")
+
+	certPEM, _ = os.ReadFile(filepath.Join(dir, "ca.pem"))
+	keyPEM, _ = os.ReadFile(filepath.Join(dir, "ca-key.pem"))
+	return parse(certPEM, keyPEM)
+}
+
+// issue writes <name>.pem and <name>-key.pem. A nil parent self-signs the certificate.
+func issue(dir, name string, template, parent *x509.Certificate, parentKey crypto.Signer, validity time.Duration) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	template.SerialNumber = serial
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(validity)
+
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(filepath.Join(dir, name+".pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, name+"-key.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600)
+}
+
+func parse(certPEM, keyPEM []byte) (*x509.Certificate, crypto.Signer, error) {
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+	if certBlock == nil || keyBlock == nil {
+		return nil, nil, errors.New("invalid CA files")
+	}
+
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, errors.New("CA key can't sign")
+	}
+	return cert, signer, nil
+}
@@ -0,0 +1,256 @@
+// Package config loads the typed configuration of a service. Values come from a YAML file,
+// overridden by the environment variables named in `env` tags, and settings left empty get the
+// value of their `default` tag. Fields tagged `validate:"required"` must be set in the end, and sections implementing Validator
+// check themselves, so a service fails at startup with every problem listed at once.
+//
+// The env tag of a struct field is a prefix for the variables of its fields, e.g. a Database
+// tagged `env:"DB_"` reads DB_HOST. On a slice of structs it is numbered from 1: DB1_HOST, DB2_HOST.
+package config
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Validator is implemented by config sections with checks of their own.
+type Validator interface {
+	Validate() error
+}
+
+// File returns the path of the config file, CONFIG_FILE or defaultPath.
+func File(defaultPath string) string {
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		return path
+	}
+	return defaultPath
+}
+
+// Load fills cfg, a pointer to a config struct, from the YAML file at path, the environment and
+// its defaults, and validates it.
+func Load(path string, cfg any) error {
+	value := reflect.ValueOf(cfg)
+	if value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config: %T is not a pointer to a struct", cfg)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read config: %v", err)
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("could not parse config %s: %v", path, err)
+	}
+
+	if err := walk(value.Elem(), "", "", setFromEnv); err != nil {
+		return err
+	}
+	if err := walk(value.Elem(), "", "", setDefault); err != nil {
+		return err
+	}
+
+	var problems []error
+	walk(value.Elem(), "", "", func(field reflect.Value, tag reflect.StructTag, name, env string) error {
+		if tag.Get("validate") == "required" && field.IsZero() {
+			problems = append(problems, fmt.Errorf("%s is required%s", name, envHint(env)))
+		}
+		return nil
+	})
+	validate(value.Elem(), "", &problems)
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid config %s: %w", path, errors.Join(problems...))
+	}
+	return nil
+}
+
+// visitFunc is called for every leaf field with its YAML path and environment variable.
+type visitFunc func(field reflect.Value, tag reflect.StructTag, name, env string) error
+
+// walk visits the leaf fields of a struct, descending into nested structs and slices of structs.
+func walk(value reflect.Value, path, envPrefix string, visit visitFunc) error {
+	for i := 0; i < value.NumField(); i++ {
+		fieldType := value.Type().Field(i)
+		if !fieldType.IsExported() {
+			continue
+		}
+		field := value.Field(i)
+		name := join(path, yamlName(fieldType))
+		env := fieldType.Tag.Get("env")
+
+		switch {
+		case isLeaf(field):
+			if env != "" {
+				env = envPrefix + env
+			}
+			if err := visit(field, fieldType.Tag, name, env); err != nil {
+				return err
+			}
+		case field.Kind() == reflect.Struct:
+			if err := walk(field, name, envPrefix+env, visit); err != nil {
+				return err
+			}
+		case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Struct:
+			for j := 0; j < field.Len(); j++ {
+				prefix := ""
+				if env != "" {
+					prefix = envPrefix + strings.TrimSuffix(env, "_") + strconv.Itoa(j+1) + "_"
+				}
+				if err := walk(field.Index(j), fmt.Sprintf("%s[%d]", name, j), prefix, visit); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// validate runs the Validate method of every section, deepest first.
+func validate(value reflect.Value, path string, problems *[]error) {
+	switch value.Kind() {
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			fieldType := value.Type().Field(i)
+			if fieldType.IsExported() && !isLeaf(value.Field(i)) {
+				validate(value.Field(i), join(path, yamlName(fieldType)), problems)
+			}
+		}
+	case reflect.Slice:
+		for j := 0; j < value.Len(); j++ {
+			validate(value.Index(j), fmt.Sprintf("%s[%d]", path, j), problems)
+		}
+	case reflect.Map:
+		iter := value.MapRange()
+		for iter.Next() {
+			validate(iter.Value(), fmt.Sprintf("%s.%v", path, iter.Key()), problems)
+		}
+	default:
+		return
+	}
+
+	var validator Validator
+	if v, ok := value.Interface().(Validator); ok {
+		validator = v
+	} else if value.CanAddr() {
+		validator, _ = value.Addr().Interface().(Validator)
+	}
+	if validator == nil {
+		return
+	}
+	if err := validator.Validate(); err != nil {
+		if path == "" {
+			*problems = append(*problems, err)
+		} else {
+			*problems = append(*problems, fmt.Errorf("%s: %v", path, err))
+		}
+	}
+}
+
+func setDefault(field reflect.Value, tag reflect.StructTag, name, _ string) error {
+	def, ok := tag.Lookup("default")
+	if !ok || !field.IsZero() {
+		return nil
+	}
+	if err := parse(field, def); err != nil {
+		return fmt.Errorf("config: bad default for %s: %v", name, err)
+	}
+	return nil
+}
+
+func setFromEnv(field reflect.Value, _ reflect.StructTag, name, env string) error {
+	if env == "" {
+		return nil
+	}
+	raw, ok := os.LookupEnv(env)
+	if !ok || raw == "" {
+		return nil
+	}
+	if err := parse(field, raw); err != nil {
+		return fmt.Errorf("invalid config: %s (from %s): %v", name, env, err)
+	}
+	return nil
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// isLeaf reports whether a field holds a single value, set from one variable.
+func isLeaf(field reflect.Value) bool {
+	if reflect.PointerTo(field.Type()).Implements(textUnmarshalerType) {
+		return true
+	}
+	switch field.Kind() {
+	case reflect.Struct, reflect.Map:
+		return false
+	case reflect.Slice:
+		return field.Type().Elem().Kind() != reflect.Struct
+	}
+	return true
+}
+
+// parse sets a field from its text form. Slices are comma separated.
+func parse(field reflect.Value, raw string) error {
+	if unmarshaler, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return unmarshaler.UnmarshalText([]byte(raw))
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		parts := strings.Split(raw, ",")
+		slice := reflect.MakeSlice(field.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			if err := parse(slice.Index(i), strings.TrimSpace(part)); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
+
+func yamlName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "" {
+		return strings.ToLower(field.Name)
+	}
+	return name
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func envHint(env string) string {
+	if env == "" {
+		return ""
+	}
+	return " (or set " + env + ")"
+}
@@ -0,0 +1,222 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testDatabase struct {
+	Host string `yaml:"host" env:"HOST" default:"127.0.0.1"`
+	Port int    `yaml:"port" env:"PORT" default:"3306"`
+	Name string `yaml:"name" env:"NAME" validate:"required"`
+}
+
+type testSection struct {
+	Limit    int    `yaml:"limit"`
+	Endpoint string `yaml:"endpoint" env:"TEST_ENDPOINT"`
+}
+
+func (s testSection) Validate() error {
+	if s.Limit < 0 {
+		return errors.New("limit can't be negative")
+	}
+	if s.Endpoint != "" {
+		return URL("endpoint", s.Endpoint)
+	}
+	return nil
+}
+
+type testConfig struct {
+	Server    Server         `yaml:"server"`
+	Database  testDatabase   `yaml:"database" env:"DB_"`
+	Shards    []testDatabase `yaml:"shards" env:"SHARD"`
+	Section   testSection    `yaml:"section"`
+	Debug     bool           `yaml:"debug" env:"TEST_DEBUG"`
+	Ratio     float64        `yaml:"ratio" env:"TEST_RATIO" default:"0.5"`
+	Brokers   []string       `yaml:"brokers" env:"TEST_BROKERS"`
+	Ports     []int          `yaml:"ports" env:"TEST_PORTS"`
+	Interval  Duration       `yaml:"interval" env:"TEST_INTERVAL" default:"10s"`
+	Undefined string         `yaml:"undefined"`
+}
+
+// writeConfig writes a config file and returns its path.
+func writeConfig(t *testing.T, yaml string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const minimalConfig = `
+server: {port: 8080}
+database: {name: app}
+`
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfig(t, `
+server: {port: 8080}
+database: {host: db.internal, name: app}
+ratio: 0.25
+`)
+	t.Setenv("DB_HOST", "db.override")
+	t.Setenv("PORT", "9090")
+	// empty variables leave the file's value
+	t.Setenv("DB_NAME", "")
+
+	var cfg testConfig
+	if err := Load(path, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		setting   string
+		got, want any
+	}{
+		{"environment over file", cfg.Database.Host, "db.override"},
+		{"environment over file, prefix of a top-level section", cfg.Server.Port, 9090},
+		{"file over default", cfg.Ratio, 0.25},
+		{"file with empty variable", cfg.Database.Name, "app"},
+		{"default", cfg.Database.Port, 3306},
+		{"default of a shared section", cfg.Server.ShutdownTimeout, Duration(20 * time.Second)},
+		{"no default", cfg.Undefined, ""},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s: got %v, want %v", test.setting, test.got, test.want)
+		}
+	}
+}
+
+func TestLoadTypes(t *testing.T) {
+	path := writeConfig(t, minimalConfig+`
+shards:
+  - {name: shard-1}
+  - {name: shard-2, port: 3307}
+`)
+	t.Setenv("TEST_DEBUG", "true")
+	t.Setenv("TEST_RATIO", "0.75")
+	t.Setenv("TEST_BROKERS", "kafka-1:9092, kafka-2:9092")
+	t.Setenv("TEST_PORTS", "9092,9093")
+	t.Setenv("TEST_INTERVAL", "1m30s")
+	t.Setenv("TEST_ENDPOINT", "https://collector.internal:4318/v1")
+	t.Setenv("SHARD2_HOST", "shard-2.internal")
+
+	var cfg testConfig
+	if err := Load(path, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Debug || cfg.Ratio != 0.75 || time.Duration(cfg.Interval) != 90*time.Second {
+		t.Errorf("got debug %v, ratio %v, interval %s", cfg.Debug, cfg.Ratio, time.Duration(cfg.Interval))
+	}
+	if strings.Join(cfg.Brokers, " ") != "kafka-1:9092 kafka-2:9092" || len(cfg.Ports) != 2 || cfg.Ports[1] != 9093 {
+		t.Errorf("got brokers %q and ports %v", cfg.Brokers, cfg.Ports)
+	}
+	if cfg.Section.Endpoint != "https://collector.internal:4318/v1" {
+		t.Errorf("got endpoint %s", cfg.Section.Endpoint)
+	}
+	// slices of sections are numbered from 1, and each element gets its defaults
+	if cfg.Shards[0].Host != "127.0.0.1" || cfg.Shards[1].Host != "shard-2.internal" || cfg.Shards[1].Port != 3307 {
+		t.Errorf("got shards %+v", cfg.Shards)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		env  map[string]string
+		want []string // In the error
+	}{
+		{"not a number", minimalConfig, map[string]string{"PORT": "http"}, []string{"server.port (from PORT)"}},
+		{"not a bool", minimalConfig, map[string]string{"TEST_DEBUG": "maybe"}, []string{"debug (from TEST_DEBUG)"}},
+		{"not a duration", minimalConfig, map[string]string{"TEST_INTERVAL": "10"}, []string{"interval (from TEST_INTERVAL)"}},
+		{"not a number in a list", minimalConfig, map[string]string{"TEST_PORTS": "9092,x"}, []string{"ports (from TEST_PORTS)"}},
+		{"wrong type in the file", "server: {port: http}\n", nil, []string{"could not parse config"}},
+		// every problem is reported at once
+		{"missing and invalid", "server: {port: 70000}\nsection: {limit: -1}\n", nil,
+			[]string{"database.name is required (or set DB_NAME)", "server: port 70000 is out of range", "section: limit can't be negative"}},
+		{"not a URL", minimalConfig, map[string]string{"TEST_ENDPOINT": "collector:4318"}, []string{"section: endpoint: not an http(s) URL"}},
+		{"invalid section of the shared config", "server: {port: 8080, shutdown_timeout: -1s}\ndatabase: {name: app}\n", nil, []string{"shutdown_timeout must be positive"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			var cfg testConfig
+			err := Load(writeConfig(t, test.yaml), &cfg)
+			if err == nil {
+				t.Fatal("invalid config loaded")
+			}
+			for _, want := range test.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q doesn't mention %q", err, want)
+				}
+			}
+		})
+	}
+
+	if err := Load(filepath.Join(t.TempDir(), "missing.yaml"), &testConfig{}); err == nil {
+		t.Error("missing file loaded")
+	}
+	if err := Load(writeConfig(t, minimalConfig), testConfig{}); err == nil {
+		t.Error("config loaded into a struct that isn't a pointer")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	path := writeConfig(t, minimalConfig)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	applied := make(chan *testConfig)
+	failed := make(chan error)
+	go Watch(ctx, path, 5*time.Millisecond, func(cfg *testConfig) { applied <- cfg }, func(err error) { failed <- err })
+	// let Watch note the version it starts with
+	time.Sleep(50 * time.Millisecond)
+
+	// changes are told apart by modification time, which may be coarse
+	modified := time.Now()
+	change := func(yaml string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		modified = modified.Add(time.Minute)
+		if err := os.Chtimes(path, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a change that doesn't validate keeps the current config
+	change("server: {port: 8080}\n")
+	select {
+	case err := <-failed:
+		if !strings.Contains(err.Error(), "database.name is required") {
+			t.Errorf("got %v, want the missing database name", err)
+		}
+	case cfg := <-applied:
+		t.Fatalf("invalid config applied: %+v", cfg)
+	case <-time.After(5 * time.Second):
+		t.Fatal("change not noticed")
+	}
+
+	// the next valid one is applied, with defaults like at startup
+	change(minimalConfig + "ratio: 0.9\n")
+	select {
+	case cfg := <-applied:
+		if cfg.Ratio != 0.9 || cfg.Database.Port != 3306 {
+			t.Errorf("reloaded ratio %v and port %d", cfg.Ratio, cfg.Database.Port)
+		}
+	case err := <-failed:
+		t.Fatalf("valid config failed: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("change not noticed")
+	}
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"net"
+	"net/url"
+	"time"
+)
+
+// Duration is a time.Duration written as a string like "10s" in config files.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Server is the HTTP listener of a service. On shutdown, it keeps serving for ShutdownDelay while
+// reporting it isn't ready, then in-flight requests, workers and closing connections get
+// ShutdownTimeout in total. Behind the gateway, TrustedProxies are its networks, whose
+// X-Forwarded-For header names the client.
+type Server struct {
+	Port            int      `yaml:"port" env:"PORT" validate:"required"`
+	ShutdownDelay   Duration `yaml:"shutdown_delay" env:"SHUTDOWN_DELAY"`
+	ShutdownTimeout Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" default:"20s"`
+	TrustedProxies  []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+}
+
+// Addr is the listen address, e.g. ":8080".
+func (s Server) Addr() string {
+	return fmt.Sprintf(":%d", s.Port)
+}
+
+func (s Server) Validate() error {
+	if s.Port < 0 || s.Port > 65535 {
+		return fmt.Errorf("port %d is out of range", s.Port)
+	}
+	if s.ShutdownTimeout <= 0 {
+		return errors.New("shutdown_timeout must be positive")
+	}
+	if s.ShutdownDelay < 0 {
+		return errors.New("shutdown_delay can't be negative")
+	}
+	for _, cidr := range s.TrustedProxies {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("trusted_proxies: %v", err)
+		}
+	}
+	return nil
+}
+
+// IPExtractor finds the client IP of a request, see echo.Echo.IPExtractor. Without trusted
+// proxies it is the address of the connection, so clients can't claim another IP with headers.
+// Otherwise it is taken from X-Forwarded-For, but only from requests sent by a trusted proxy;
+// private networks aren't trusted unless listed.
+func (s Server) IPExtractor() echo.IPExtractor {
+	if len(s.TrustedProxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, cidr := range s.TrustedProxies {
+		_, ipNet, _ := net.ParseCIDR(cidr)
+		options = append(options, echo.TrustIPRange(ipNet))
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
+// Database is a MySQL database. Tag the field with an env prefix, e.g. `env:"DB_"`.
+type Database struct {
+	Host     string `yaml:"host" env:"HOST" default:"127.0.0.1"`
+	Port     int    `yaml:"port" env:"PORT" default:"3306"`
+	User     string `yaml:"user" env:"USER" validate:"required"`
+	Password string `yaml:"password" env:"PASS"`
+	Name     string `yaml:"name" env:"NAME" validate:"required"`
+	Params   string `yaml:"params" env:"PARAMS" default:"parseTime=true"`
+}
+
+// DSN is the data source name for the mysql driver.
+func (d Database) DSN() string {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", d.User, d.Password, d.Host, d.Port, d.Name)
+	if d.Params != "" {
+		dsn += "?" + d.Params
+	}
+	return dsn
+}
+
+// Redis is a Redis server.
+type Redis struct {
+	Addr     string `yaml:"addr" env:"REDIS_ADDR" default:"localhost:6379"`
+	Password string `yaml:"password" env:"REDIS_PASSWORD"`
+	DB       int    `yaml:"db" env:"REDIS_DB"`
+}
+
+// Kafka is a Kafka cluster.
+type Kafka struct {
+	Brokers []string `yaml:"brokers" env:"KAFKA_BROKERS" default:"localhost:9092,localhost:9093,localhost:9094"`
+}
+
+// Auth locates the public keys access tokens are verified with.
+type Auth struct {
+	JWKSURL string `yaml:"jwks_url" env:"JWKS_URL" default:"http://localhost:8080/.well-known/jwks.json"`
+}
+
+func (a Auth) Validate() error {
+	return validURL(a.JWKSURL)
+}
+
+// URL checks that a service URL is absolute, for sections with a Validate method.
+func URL(name, raw string) error {
+	if err := validURL(raw); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	return nil
+}
+
+func validURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return errors.New("not an http(s) URL: " + raw)
+	}
+	return nil
+}
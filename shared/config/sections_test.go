@@ -0,0 +1,41 @@
+package config
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIPExtractor(t *testing.T) {
+	behindGateway := Server{Port: 8080, ShutdownTimeout: 1, TrustedProxies: []string{"10.0.1.0/24"}}
+	tests := []struct {
+		name         string
+		server       Server
+		remoteAddr   string
+		forwardedFor string
+		want         string
+	}{
+		{"direct", Server{}, "203.0.113.7:5000", "", "203.0.113.7"},
+		// without trusted proxies the header is ignored
+		{"direct spoofed", Server{}, "203.0.113.7:5000", "198.51.100.1", "203.0.113.7"},
+		{"from the gateway", behindGateway, "10.0.1.5:5000", "198.51.100.1", "198.51.100.1"},
+		// the gateway appends the address it saw to what the client sent
+		{"spoofed through the gateway", behindGateway, "10.0.1.5:5000", "192.0.2.9, 198.51.100.1", "198.51.100.1"},
+		{"not from the gateway", behindGateway, "10.0.2.5:5000", "198.51.100.1", "10.0.2.5"},
+		{"loopback not trusted", behindGateway, "127.0.0.1:5000", "198.51.100.1", "127.0.0.1"},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remoteAddr
+		if test.forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", test.forwardedFor)
+		}
+		if got := test.server.IPExtractor()(req); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.name, got, test.want)
+		}
+	}
+
+	behindGateway.TrustedProxies = []string{"10.0.1.0"}
+	if err := behindGateway.Validate(); err == nil {
+		t.Error("trusted proxy without a prefix length accepted")
+	}
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// Watch reloads the config file at path when it changes, checking every interval until ctx is
+// done. A config that loads and validates is passed to apply, which should only take over
+// settings that can change at runtime, like log levels and rate limits; anything else needs a
+// restart. Failed reloads go to failed and the previous config stays in effect.
+func Watch[T any](ctx context.Context, path string, interval time.Duration, apply func(*T), failed func(error)) {
+	last, _ := fileVersion(path)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// config maps are swapped in by replacing a symlink, so the file is read again by path
+		version, err := fileVersion(path)
+		if err != nil || version == last {
+			continue
+		}
+		last = version
+
+		cfg := new(T)
+		if err := Load(path, cfg); err != nil {
+			failed(err)
+			continue
+		}
+		apply(cfg)
+	}
+}
+
+type version struct {
+	modTime time.Time
+	size    int64
+}
+
+func fileVersion(path string) (version, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return version{}, err
+	}
+	return version{modTime: info.ModTime(), size: info.Size()}, nil
+}
@@ -0,0 +1,211 @@
+// Package health serves the liveness and readiness endpoints of a service. Liveness only says the
+// process is up, so an orchestrator restarts it when it hangs. Readiness checks the dependencies,
+// each with a timeout, and fails while a critical one is down or the service is shutting down, so
+// no traffic is routed to it.
+package health
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds every check.
+const DefaultTimeout = 2 * time.Second
+
+// Status of a check or a whole service.
+const (
+	StatusOK          = "ok"
+	StatusDegraded    = "degraded" // A non-critical dependency is down, the service is still ready
+	StatusUnavailable = "unavailable"
+	StatusDown        = "down"
+)
+
+// CheckFunc checks a dependency, returning an error when it can't be used.
+type CheckFunc func(ctx context.Context) error
+
+type check struct {
+	name     string
+	critical bool
+	run      CheckFunc
+}
+
+// Checker runs the readiness checks of a service.
+type Checker struct {
+	service  string
+	shutdown context.Context
+	timeout  time.Duration
+	checks   []check
+}
+
+// NewChecker creates a checker for service. Readiness is off once shutdown is done, e.g. the
+// context of a lifecycle.Lifecycle.
+func NewChecker(service string, shutdown context.Context) *Checker {
+	return &Checker{service: service, shutdown: shutdown, timeout: DefaultTimeout}
+}
+
+// Add adds a check. The service isn't ready while a critical check fails; other failures only
+// make it degraded, so an unavailable downstream service doesn't take its callers out as well.
+func (c *Checker) Add(name string, critical bool, run CheckFunc) {
+	c.checks = append(c.checks, check{name: name, critical: critical, run: run})
+}
+
+// Result is the outcome of one check.
+type Result struct {
+	Status    string  `json:"status"`
+	Critical  bool    `json:"critical"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the readiness of a service with the result of every check.
+type Report struct {
+	Status  string            `json:"status"`
+	Service string            `json:"service"`
+	Time    string            `json:"time"`
+	Checks  map[string]Result `json:"checks"`
+}
+
+// Ready reports whether the service is ready, running all checks concurrently.
+func (c *Checker) Ready(ctx context.Context) (bool, Report) {
+	report := Report{
+		Status:  StatusOK,
+		Service: c.service,
+		Time:    time.Now().Format(time.RFC3339),
+		Checks:  make(map[string]Result, len(c.checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, chk := range c.checks {
+		wg.Add(1)
+		go func(chk check) {
+			defer wg.Done()
+			result := c.run(ctx, chk)
+			mu.Lock()
+			report.Checks[chk.name] = result
+			mu.Unlock()
+		}(chk)
+	}
+	wg.Wait()
+
+	ready := true
+	for _, result := range report.Checks {
+		if result.Status == StatusOK {
+			continue
+		}
+		if result.Critical {
+			ready = false
+		} else if report.Status == StatusOK {
+			report.Status = StatusDegraded
+		}
+	}
+	if c.shutdown.Err() != nil {
+		ready = false
+	}
+	if !ready {
+		report.Status = StatusUnavailable
+	}
+	return ready, report
+}
+
+func (c *Checker) run(ctx context.Context, chk check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := chk.run(ctx)
+	result := Result{
+		Status:    StatusOK,
+		Critical:  chk.critical,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+		if errors.Is(err, context.DeadlineExceeded) {
+			result.Error = fmt.Sprintf("no answer within %s", c.timeout)
+		}
+	}
+	return result
+}
+
+// Register adds the endpoints under prefix, e.g. "/orders/health": prefix+"/live" for liveness,
+// prefix+"/ready" for readiness, and prefix itself, which is readiness as well. middlewares apply
+// to all of them.
+func (c *Checker) Register(e *echo.Echo, prefix string, middlewares ...echo.MiddlewareFunc) {
+	e.GET(prefix+"/live", c.live, middlewares...)
+	e.GET(prefix+"/ready", c.ready, middlewares...)
+	e.GET(prefix, c.ready, middlewares...)
+}
+
+func (c *Checker) live(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, map[string]interface{}{
+		"status":  StatusOK,
+		"service": c.service,
+		"time":    time.Now().Format(time.RFC3339),
+	})
+}
+
+func (c *Checker) ready(ctx echo.Context) error {
+	ready, report := c.Ready(ctx.Request().Context())
+	if !ready {
+		return ctx.JSON(http.StatusServiceUnavailable, report)
+	}
+	return ctx.JSON(http.StatusOK, report)
+}
+
+// DB checks a database pool.
+func DB(db *sql.DB) CheckFunc {
+	return db.PingContext
+}
+
+// Redis checks a Redis client.
+func Redis(rdb *redis.Client) CheckFunc {
+	return func(ctx context.Context) error {
+		return rdb.Ping(ctx).Err()
+	}
+}
+
+// TCP checks that at least one of addrs accepts connections, e.g. the brokers of a Kafka cluster.
+func TCP(addrs ...string) CheckFunc {
+	return func(ctx context.Context) error {
+		var dialer net.Dialer
+		var errs []error
+		for _, addr := range addrs {
+			conn, err := dialer.DialContext(ctx, "tcp", addr)
+			if err == nil {
+				return conn.Close()
+			}
+			errs = append(errs, err)
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// HTTP checks that a GET of url answers with a 2xx status, e.g. the liveness endpoint of a
+// downstream service.
+func HTTP(client *http.Client, url string) CheckFunc {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("%s answered %s", url, resp.Status)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,183 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"shared/metrics"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned for requests to an upstream whose circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// States of a circuit breaker, the values of the http_client_circuit_state metric.
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitHalfOpen
+	circuitOpen
+)
+
+func (s circuitState) String() string {
+	switch s {
+	case circuitHalfOpen:
+		return "half-open"
+	case circuitOpen:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+// outcome of a request, as far as the circuit breaker is concerned.
+type outcome int
+
+const (
+	succeeded outcome = iota
+	failed
+	abandoned // The caller gave up, which says nothing about the upstream
+)
+
+// breaker is the circuit breaker of an upstream. It opens after threshold failed requests in a
+// row, rejecting requests until openTimeout passed. Then it is half-open and lets one probe
+// through, which closes it again when it succeeds.
+type breaker struct {
+	upstream    string
+	threshold   int
+	openTimeout time.Duration
+
+	mu       sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newBreaker(upstream string, threshold int, openTimeout time.Duration) *breaker {
+	b := &breaker{upstream: upstream, threshold: threshold, openTimeout: openTimeout}
+	metrics.CircuitState(upstream, int(circuitClosed))
+	return b
+}
+
+// allow returns ErrCircuitOpen when a request mustn't be sent, and whether the request is the
+// probe of a half-open circuit. Every allowed request must be reported to done with it.
+func (b *breaker) allow() (probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if time.Since(b.openedAt) < b.openTimeout {
+			return false, ErrCircuitOpen
+		}
+		b.set(circuitHalfOpen)
+	case circuitHalfOpen:
+		if b.probing {
+			return false, ErrCircuitOpen
+		}
+	default:
+		return false, nil
+	}
+	b.probing = true
+	return true, nil
+}
+
+// done reports the outcome of an allowed request. Only the probe decides whether a half-open
+// circuit closes; requests allowed before the circuit opened and finishing late only count while
+// it is closed.
+func (b *breaker) done(probe bool, result outcome) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if probe {
+		b.probing = false
+		switch result {
+		case succeeded:
+			b.failures = 0
+			b.set(circuitClosed)
+		case failed:
+			b.failures++
+			b.openedAt = time.Now()
+			b.set(circuitOpen)
+		}
+		return
+	}
+
+	if b.state != circuitClosed {
+		return
+	}
+	switch result {
+	case succeeded:
+		b.failures = 0
+	case failed:
+		b.failures++
+		if b.failures >= b.threshold {
+			b.openedAt = time.Now()
+			b.set(circuitOpen)
+		}
+	}
+}
+
+func (b *breaker) set(state circuitState) {
+	if b.state == state {
+		return
+	}
+	b.state = state
+	metrics.CircuitState(b.upstream, int(state))
+}
+
+// check fails while the circuit isn't closed.
+func (b *breaker) check(context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == circuitClosed {
+		return nil
+	}
+	return fmt.Errorf("circuit breaker %s after %d failures, since %s", b.state, b.failures, b.openedAt.Format(time.RFC3339))
+}
+
+var (
+	upstreamsMu sync.Mutex
+	upstreams   = make(map[string]*upstream)
+)
+
+// upstream is the circuit breaker and bulkhead of an upstream service, shared by all clients
+// calling it.
+type upstream struct {
+	breaker *breaker
+	slots   chan struct{}
+}
+
+// upstreamFor returns the upstream named name, creating it with policy on first use.
+func upstreamFor(name string, policy Policy) *upstream {
+	upstreamsMu.Lock()
+	defer upstreamsMu.Unlock()
+
+	u, ok := upstreams[name]
+	if !ok {
+		u = &upstream{
+			breaker: newBreaker(name, policy.FailureThreshold, time.Duration(policy.OpenTimeout)),
+			slots:   make(chan struct{}, policy.MaxConcurrent),
+		}
+		upstreams[name] = u
+	}
+	return u
+}
+
+// Circuit checks the circuit breaker of the upstream named name, for health.Checker. It fails
+// while the circuit is open or half-open.
+func Circuit(name string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		upstreamsMu.Lock()
+		u, ok := upstreams[name]
+		upstreamsMu.Unlock()
+		if !ok {
+			return nil
+		}
+		return u.breaker.check(ctx)
+	}
+}
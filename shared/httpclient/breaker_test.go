@@ -0,0 +1,150 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// mustAllow returns whether the allowed request is the probe, failing if it is rejected.
+func mustAllow(t *testing.T, b *breaker) bool {
+	t.Helper()
+	probe, err := b.allow()
+	if err != nil {
+		t.Fatalf("request rejected in state %s: %v", b.state, err)
+	}
+	return probe
+}
+
+func mustReject(t *testing.T, b *breaker) {
+	t.Helper()
+	if _, err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("request allowed in state %s", b.state)
+	}
+}
+
+func expectState(t *testing.T, b *breaker, want circuitState) {
+	t.Helper()
+	if b.state != want {
+		t.Fatalf("circuit is %s, want %s", b.state, want)
+	}
+}
+
+// openedBreaker returns a breaker for 3 failures that has just opened.
+func openedBreaker(t *testing.T) *breaker {
+	t.Helper()
+	b := newBreaker("test", 3, time.Minute)
+	for i := 0; i < 3; i++ {
+		b.done(mustAllow(t, b), failed)
+	}
+	expectState(t, b, circuitOpen)
+	return b
+}
+
+// halfOpen lets the open timeout of b pass.
+func halfOpen(b *breaker) {
+	b.openedAt = time.Now().Add(-2 * b.openTimeout)
+}
+
+func TestBreakerOpensAfterFailuresInARow(t *testing.T) {
+	b := newBreaker("test", 3, time.Minute)
+	for i := 0; i < 2; i++ {
+		if probe := mustAllow(t, b); probe {
+			t.Fatal("request of a closed circuit allowed as probe")
+		}
+		b.done(false, failed)
+	}
+	// a success in between starts the count again, and giving up counts for nothing
+	b.done(mustAllow(t, b), succeeded)
+	b.done(mustAllow(t, b), failed)
+	b.done(mustAllow(t, b), failed)
+	b.done(mustAllow(t, b), abandoned)
+	expectState(t, b, circuitClosed)
+
+	b.done(mustAllow(t, b), failed)
+	expectState(t, b, circuitOpen)
+	mustReject(t, b)
+}
+
+func TestBreakerProbe(t *testing.T) {
+	tests := []struct {
+		name    string
+		outcome outcome
+		want    circuitState
+	}{
+		{"succeeded", succeeded, circuitClosed},
+		{"failed", failed, circuitOpen},
+		// the next request is the probe instead
+		{"abandoned", abandoned, circuitHalfOpen},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := openedBreaker(t)
+			halfOpen(b)
+
+			if probe := mustAllow(t, b); !probe {
+				t.Fatal("first request after the open timeout isn't the probe")
+			}
+			expectState(t, b, circuitHalfOpen)
+			// one probe at a time
+			mustReject(t, b)
+
+			b.done(true, test.outcome)
+			expectState(t, b, test.want)
+			switch test.want {
+			case circuitClosed:
+				if probe := mustAllow(t, b); probe || b.failures != 0 {
+					t.Errorf("closed circuit allowed a probe or kept %d failures", b.failures)
+				}
+			case circuitOpen:
+				// the open timeout starts again
+				mustReject(t, b)
+			case circuitHalfOpen:
+				if probe := mustAllow(t, b); !probe {
+					t.Error("request after an abandoned probe isn't the probe")
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerIgnoresLateRequests(t *testing.T) {
+	for _, late := range []outcome{succeeded, failed, abandoned} {
+		b := newBreaker("test", 3, time.Minute)
+		// allowed while closed, still in flight while the circuit opens
+		lateRequest := mustAllow(t, b)
+		for i := 0; i < 3; i++ {
+			b.done(mustAllow(t, b), failed)
+		}
+		openedAt := b.openedAt
+
+		// finishing while open, it neither closes the circuit nor pushes the timeout back
+		b.done(lateRequest, late)
+		expectState(t, b, circuitOpen)
+		if b.openedAt != openedAt {
+			t.Errorf("late %d request moved the open timeout", late)
+		}
+
+		// nor does it decide the probe's outcome while half-open
+		halfOpen(b)
+		probe := mustAllow(t, b)
+		b.done(lateRequest, late)
+		expectState(t, b, circuitHalfOpen)
+		mustReject(t, b)
+
+		b.done(probe, succeeded)
+		expectState(t, b, circuitClosed)
+	}
+}
+
+func TestBreakerCheck(t *testing.T) {
+	b := newBreaker("test", 1, time.Minute)
+	if err := b.check(context.Background()); err != nil {
+		t.Errorf("closed circuit failed the check: %v", err)
+	}
+	b.done(mustAllow(t, b), failed)
+	if err := b.check(context.Background()); err == nil {
+		t.Error("open circuit passed the check")
+	}
+}
@@ -0,0 +1,113 @@
+// Package httpclient builds the HTTP clients services use to call each other. Requests carry a
+// service token for the target service, the trace context and the request and order IDs of
+// the caller, and can use mutual TLS. Clients made Resilient retry, time out and fail fast while
+// an upstream is down.
+package httpclient
+
+import (
+	"crypto/tls"
+	"net/http"
+	"shared/auth"
+	"shared/logging"
+	"shared/mtls"
+	"shared/tracing"
+	"time"
+)
+
+// Config configures a client for one upstream service.
+type Config struct {
+	Timeout time.Duration
+	Tokens  *auth.TokenSource // Optional, adds a service token to every request
+	TLS     *tls.Config       // Optional, e.g. from mtls.ClientConfig
+}
+
+// New creates a client for an upstream service.
+func New(config Config) *http.Client {
+	if config.Timeout == 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config.TLS != nil {
+		transport.TLSClientConfig = config.TLS
+	}
+
+	var roundTripper http.RoundTripper = transport
+	if config.Tokens != nil {
+		roundTripper = &tokenTransport{tokens: config.Tokens, next: transport}
+	}
+
+	// a retry with a fresh token is part of the same call
+	return &http.Client{Timeout: config.Timeout, Transport: tracing.Transport(logging.Transport(roundTripper))}
+}
+
+// tokenTransport adds a bearer service token to requests. When the upstream rejects the token, it
+// is dropped and the request retried once with a fresh one, which covers signing key rotations.
+type tokenTransport struct {
+	tokens *auth.TokenSource
+	next   http.RoundTripper
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.send(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// only requests whose body can be replayed are retried
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		retry.Body = body
+	}
+	resp.Body.Close()
+
+	t.tokens.Invalidate()
+	return t.send(retry)
+}
+
+func (t *tokenTransport) send(req *http.Request) (*http.Response, error) {
+	token, err := t.tokens.Token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	// RoundTrippers must not modify the caller's request
+	authorized := req.Clone(req.Context())
+	authorized.Header.Set("Authorization", "Bearer "+token)
+	return t.next.RoundTrip(authorized)
+}
+
+// Credentials are the caller's service client and the token endpoint of user-management-service,
+// the service_client section of a service's config.
+type Credentials struct {
+	ClientID     string `yaml:"client_id" env:"SERVICE_CLIENT_ID"`
+	ClientSecret string `yaml:"client_secret" env:"SERVICE_CLIENT_SECRET"`
+	TokenURL     string `yaml:"token_url" env:"TOKEN_URL" default:"http://localhost:8080/oauth/token"`
+}
+
+// ForService creates a client for calls to the audience service. Requests carry a service token
+// when credentials has a client ID, and use mutual TLS when files are set.
+func ForService(credentials Credentials, files mtls.Files, audience string) (*http.Client, error) {
+	config := Config{}
+
+	if files.Enabled() {
+		tlsConfig, err := mtls.ClientConfig(files)
+		if err != nil {
+			return nil, err
+		}
+		config.TLS = tlsConfig
+	}
+
+	if credentials.ClientID != "" {
+		config.Tokens = auth.NewTokenSource(credentials.TokenURL, credentials.ClientID, credentials.ClientSecret, audience, nil)
+	}
+
+	return New(config), nil
+}
@@ -0,0 +1,61 @@
+package httpclient
+
+import (
+	"errors"
+	"shared/config"
+	"time"
+)
+
+// Policy is how calls to an upstream service are bounded, retried and cut off, the http_client
+// section of a service's config. Fields left zero get their default.
+type Policy struct {
+	Timeout        config.Duration `yaml:"timeout" env:"HTTP_CLIENT_TIMEOUT" default:"10s"`                // Of a whole call, with its retries
+	AttemptTimeout config.Duration `yaml:"attempt_timeout" env:"HTTP_CLIENT_ATTEMPT_TIMEOUT" default:"2s"` // Of every attempt, including reading the response
+	MaxAttempts    int             `yaml:"max_attempts" env:"HTTP_CLIENT_MAX_ATTEMPTS" default:"3"`        // Of idempotent requests, others are sent once
+	Backoff        config.Duration `yaml:"backoff" env:"HTTP_CLIENT_BACKOFF" default:"100ms"`              // Before the first retry, doubled for every further one
+	MaxBackoff     config.Duration `yaml:"max_backoff" env:"HTTP_CLIENT_MAX_BACKOFF" default:"1s"`
+
+	// the circuit opens after FailureThreshold failed requests in a row, and lets a single probe
+	// through after OpenTimeout
+	FailureThreshold int             `yaml:"failure_threshold" env:"HTTP_CLIENT_FAILURE_THRESHOLD" default:"5"`
+	OpenTimeout      config.Duration `yaml:"open_timeout" env:"HTTP_CLIENT_OPEN_TIMEOUT" default:"30s"`
+
+	// requests waiting for an upstream beyond MaxConcurrent fail right away, so a slow upstream
+	// can't tie up all goroutines of the caller
+	MaxConcurrent int `yaml:"max_concurrent" env:"HTTP_CLIENT_MAX_CONCURRENT" default:"50"`
+}
+
+func (p Policy) Validate() error {
+	if p.Timeout < 0 || p.AttemptTimeout < 0 || p.Backoff < 0 || p.MaxBackoff < 0 || p.OpenTimeout < 0 {
+		return errors.New("timeouts and backoffs can't be negative")
+	}
+	if p.MaxAttempts < 0 || p.FailureThreshold < 0 || p.MaxConcurrent < 0 {
+		return errors.New("max_attempts, failure_threshold and max_concurrent can't be negative")
+	}
+	return nil
+}
+
+// withDefaults fills in the fields left zero, for policies that weren't loaded from a config file.
+func (p Policy) withDefaults() Policy {
+	setDuration(&p.Timeout, 10*time.Second)
+	setDuration(&p.AttemptTimeout, 2*time.Second)
+	setDuration(&p.Backoff, 100*time.Millisecond)
+	setDuration(&p.MaxBackoff, time.Second)
+	setDuration(&p.OpenTimeout, 30*time.Second)
+	setInt(&p.MaxAttempts, 3)
+	setInt(&p.FailureThreshold, 5)
+	setInt(&p.MaxConcurrent, 50)
+	return p
+}
+
+func setDuration(d *config.Duration, value time.Duration) {
+	if *d == 0 {
+		*d = config.Duration(value)
+	}
+}
+
+func setInt(i *int, value int) {
+	if *i == 0 {
+		*i = value
+	}
+}
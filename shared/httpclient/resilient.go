@@ -0,0 +1,165 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"shared/metrics"
+	"time"
+)
+
+// ErrBulkheadFull is returned for requests to an upstream that already has the maximum number of
+// requests in flight.
+var ErrBulkheadFull = errors.New("too many requests in flight")
+
+// Resilient returns a copy of client for calls to the upstream service named name, bounded and
+// retried as policy says. Idempotent requests are retried with exponential backoff when the
+// upstream can't be reached, times out or answers 429, 502, 503 or 504. A circuit breaker and a
+// bulkhead per upstream make calls fail fast while it is down or overloaded, with ErrCircuitOpen
+// and ErrBulkheadFull.
+func Resilient(client *http.Client, name string, policy Policy) *http.Client {
+	policy = policy.withDefaults()
+
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	resilient := *client
+	resilient.Timeout = time.Duration(policy.Timeout)
+	resilient.Transport = &resilientTransport{
+		name:     name,
+		policy:   policy,
+		upstream: upstreamFor(name, policy),
+		next:     next,
+	}
+	return &resilient
+}
+
+type resilientTransport struct {
+	name     string
+	policy   Policy
+	upstream *upstream
+	next     http.RoundTripper
+}
+
+func (t *resilientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	select {
+	case t.upstream.slots <- struct{}{}:
+		defer func() { <-t.upstream.slots }()
+	default:
+		metrics.ClientRejected(t.name, "bulkhead_full")
+		return nil, fmt.Errorf("%s: %w", t.name, ErrBulkheadFull)
+	}
+
+	attempts := 1
+	if idempotent(req) {
+		attempts = t.policy.MaxAttempts
+	}
+	backoff := time.Duration(t.policy.Backoff)
+
+	for attempt := 1; ; attempt++ {
+		resp, err := t.attempt(req, attempt)
+		if attempt >= attempts || !retryable(resp, err) || req.Context().Err() != nil {
+			return resp, err
+		}
+		if resp != nil {
+			// the connection can be reused once the body is read
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		// half to all of the backoff, so callers that failed together don't retry together
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+		backoff = min(2*backoff, time.Duration(t.policy.MaxBackoff))
+		metrics.ClientRetried(t.name)
+	}
+}
+
+// attempt sends req once, unless the circuit is open. Its timeout covers reading the body as well.
+func (t *resilientTransport) attempt(req *http.Request, attempt int) (*http.Response, error) {
+	probe, err := t.upstream.breaker.allow()
+	if err != nil {
+		metrics.ClientRejected(t.name, "circuit_open")
+		return nil, fmt.Errorf("%s: %w", t.name, err)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), time.Duration(t.policy.AttemptTimeout))
+	// RoundTrippers must not modify the caller's request
+	try := req.WithContext(ctx)
+	if attempt > 1 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			cancel()
+			t.upstream.breaker.done(probe, abandoned)
+			return nil, err
+		}
+		try.Body = body
+	}
+
+	resp, err := t.next.RoundTrip(try)
+	switch {
+	case err != nil && req.Context().Err() != nil:
+		t.upstream.breaker.done(probe, abandoned)
+	case err != nil || resp.StatusCode >= http.StatusInternalServerError:
+		t.upstream.breaker.done(probe, failed)
+	default:
+		t.upstream.breaker.done(probe, succeeded)
+	}
+	if err != nil {
+		cancel()
+		if errors.Is(err, context.DeadlineExceeded) && req.Context().Err() == nil {
+			err = fmt.Errorf("%s: no response within %s: %w", t.name, time.Duration(t.policy.AttemptTimeout), err)
+		}
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// idempotent reports whether req can be sent again: its method is idempotent or it carries an
+// Idempotency-Key, and its body can be replayed.
+func idempotent(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+// retryable reports whether an attempt failed in a way another one might not.
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, ErrCircuitOpen)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// cancelBody ends the context of an attempt once its body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
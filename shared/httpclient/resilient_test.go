@@ -0,0 +1,150 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"shared/config"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testPolicy retries quickly and never opens the circuit unless a test says so.
+var testPolicy = Policy{
+	Backoff:          config.Duration(time.Millisecond),
+	MaxBackoff:       config.Duration(2 * time.Millisecond),
+	FailureThreshold: 100,
+}
+
+// testClient calls server as the upstream name, whose breaker and bulkhead are dropped when the
+// test ends.
+func testClient(t *testing.T, server *httptest.Server, name string, policy Policy) *http.Client {
+	t.Cleanup(func() {
+		upstreamsMu.Lock()
+		defer upstreamsMu.Unlock()
+		delete(upstreams, name)
+	})
+	return Resilient(server.Client(), name, policy)
+}
+
+// upstreamAnswering serves the statuses in turn, then 200, counting the requests.
+func upstreamAnswering(t *testing.T, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(requests.Add(1))
+		if n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		key      string // Idempotency-Key
+		statuses []int
+		want     int
+		attempts int32
+	}{
+		{"GET until it succeeds", http.MethodGet, "", []int{503, 502}, 200, 3},
+		{"GET up to max attempts", http.MethodGet, "", []int{503, 503, 503, 503}, 503, 3},
+		{"rate limited GET", http.MethodGet, "", []int{429}, 200, 2},
+		{"GET not retried on 500", http.MethodGet, "", []int{500}, 500, 1},
+		{"GET not retried on 404", http.MethodGet, "", []int{404}, 404, 1},
+		{"POST sent once", http.MethodPost, "", []int{503}, 503, 1},
+		{"POST with an idempotency key", http.MethodPost, "order-1", []int{503}, 200, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, requests := upstreamAnswering(t, test.statuses...)
+			client := testClient(t, server, test.name, testPolicy)
+
+			req, _ := http.NewRequest(test.method, server.URL, strings.NewReader("{}"))
+			if test.key != "" {
+				req.Header.Set("Idempotency-Key", test.key)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != test.want || requests.Load() != test.attempts {
+				t.Errorf("got %d after %d attempts, want %d after %d", resp.StatusCode, requests.Load(), test.want, test.attempts)
+			}
+		})
+	}
+}
+
+func TestOpenCircuitFailsFast(t *testing.T) {
+	server, requests := upstreamAnswering(t, 500, 500)
+	policy := testPolicy
+	policy.FailureThreshold = 2
+	client := testClient(t, server, "circuit", policy)
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	// the circuit is open, so the request isn't sent or retried
+	if _, err := client.Get(server.URL); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("got %v, want ErrCircuitOpen", err)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("upstream got %d requests, want 2", requests.Load())
+	}
+	if err := Circuit("circuit")(context.Background()); err == nil {
+		t.Error("health check passed with the circuit open")
+	}
+}
+
+func TestBulkhead(t *testing.T) {
+	release := make(chan struct{})
+	arrived := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-release
+	}))
+	defer server.Close()
+	policy := testPolicy
+	policy.MaxConcurrent = 1
+	client := testClient(t, server, "bulkhead", policy)
+
+	done := make(chan error)
+	go func() {
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		done <- err
+	}()
+	<-arrived
+
+	// the only slot is taken, so the request fails without waiting
+	if _, err := client.Get(server.URL); !errors.Is(err, ErrBulkheadFull) {
+		t.Errorf("got %v, want ErrBulkheadFull", err)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	// the slot is free again
+	go func() { <-arrived }()
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
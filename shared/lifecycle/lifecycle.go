@@ -0,0 +1,133 @@
+// Package lifecycle runs a service until it gets SIGINT or SIGTERM and then shuts it down in order:
+// the HTTP server stops accepting connections and drains in-flight requests, background workers
+// such as Kafka consumers finish, and finally connections are closed, all within a deadline.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Lifecycle tracks the workers and resources of a service.
+type Lifecycle struct {
+	ctx     context.Context
+	stop    context.CancelFunc // Also restores the default handling of the signals
+	timeout time.Duration
+	delay   time.Duration
+
+	// workers keep running while the server drains, requests in flight may still need them
+	workerCtx    context.Context
+	cancelWorker context.CancelFunc
+
+	workers sync.WaitGroup
+	hooks   []hook
+}
+
+type hook struct {
+	name  string
+	close func(ctx context.Context) error
+}
+
+// New creates a lifecycle whose context is done on SIGINT or SIGTERM. timeout bounds the whole
+// shutdown. The server keeps serving for delay after the signal while readiness is already off,
+// so load balancers stop sending requests before connections are refused. A second signal
+// kills the service without waiting for the shutdown.
+func New(timeout, delay time.Duration) *Lifecycle {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	workerCtx, cancelWorker := context.WithCancel(context.Background())
+	return &Lifecycle{ctx: ctx, stop: stop, timeout: timeout, delay: delay, workerCtx: workerCtx, cancelWorker: cancelWorker}
+}
+
+// Context is done once the service is shutting down.
+func (l *Lifecycle) Context() context.Context {
+	return l.ctx
+}
+
+// Go runs a background worker. Its ctx is done once the HTTP server has drained, and it should
+// return soon after; shutdown waits for it before any resource is closed.
+func (l *Lifecycle) Go(worker func(ctx context.Context)) {
+	l.workers.Add(1)
+	go func() {
+		defer l.workers.Done()
+		worker(l.workerCtx)
+	}()
+}
+
+// OnShutdown registers a function releasing a resource. They run in reverse order of
+// registration, like defers, so register a resource right after creating it.
+func (l *Lifecycle) OnShutdown(name string, close func(ctx context.Context) error) {
+	l.hooks = append(l.hooks, hook{name: name, close: close})
+}
+
+// Close registers a resource to close on shutdown, e.g. a *sql.DB, a Redis client or a
+// kafka.Writer, which flushes pending messages.
+func (l *Lifecycle) Close(name string, closer io.Closer) {
+	l.OnShutdown(name, func(context.Context) error {
+		return closer.Close()
+	})
+}
+
+// Serve runs the server of e with start, e.g. e.Start or mtls.Start, until the service is told
+// to stop or the server fails, and then shuts everything down. It returns the error of the server
+// or of the shutdown steps.
+func (l *Lifecycle) Serve(e *echo.Echo, start func() error) error {
+	served := make(chan error, 1)
+	go func() {
+		served <- start()
+	}()
+
+	var errs []error
+	select {
+	case <-l.ctx.Done():
+		// the next signal isn't caught anymore, it kills the service
+		l.stop()
+		time.Sleep(l.delay)
+	case err := <-served:
+		if !errors.Is(err, http.ErrServerClosed) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(append(errs, l.shutdown(e))...)
+}
+
+func (l *Lifecycle) shutdown(e *echo.Echo) error {
+	// readiness goes off as well when the server failed
+	l.stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+	defer cancel()
+
+	var errs []error
+	if err := e.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("draining HTTP requests: %w", err))
+	}
+	l.cancelWorker()
+
+	workersDone := make(chan struct{})
+	go func() {
+		l.workers.Wait()
+		close(workersDone)
+	}()
+	select {
+	case <-workersDone:
+	case <-ctx.Done():
+		errs = append(errs, fmt.Errorf("waiting for workers: %w", ctx.Err()))
+	}
+
+	// resources are closed even after the deadline, leaving them open doesn't help anyone
+	for i := len(l.hooks) - 1; i >= 0; i-- {
+		if err := l.hooks[i].close(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("closing %s: %w", l.hooks[i].name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,102 @@
+package logging
+
+import (
+	"context"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
+	"strconv"
+)
+
+// HeaderOrderID carries the order a request or Kafka message is about to the next service.
+const HeaderOrderID = "X-Order-ID"
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	userIDKey
+	orderIDKey
+)
+
+// WithRequestID returns ctx with the ID of the request, as set by the gateway.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// RequestID returns the request ID of ctx, if any.
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
+
+// WithUserID returns ctx with the ID of the authenticated user.
+func WithUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userIDKey, userID)
+}
+
+// UserID returns the user ID of ctx, if any.
+func UserID(ctx context.Context) string {
+	userID, _ := ctx.Value(userIDKey).(string)
+	return userID
+}
+
+// WithOrderID returns ctx with the public ID of the order being worked on.
+func WithOrderID(ctx context.Context, orderID int) context.Context {
+	return withOrderID(ctx, strconv.Itoa(orderID))
+}
+
+func withOrderID(ctx context.Context, orderID string) context.Context {
+	return context.WithValue(ctx, orderIDKey, orderID)
+}
+
+// OrderID returns the order ID of ctx, if any.
+func OrderID(ctx context.Context) string {
+	orderID, _ := ctx.Value(orderIDKey).(string)
+	return orderID
+}
+
+// Inject passes the request and order IDs of ctx to set, e.g. to add them to the headers of a
+// Kafka message. The user ID isn't passed on, services get it from the caller's token.
+func Inject(ctx context.Context, set func(key, value string)) {
+	if requestID := RequestID(ctx); requestID != "" {
+		set(echo.HeaderXRequestID, requestID)
+	}
+	if orderID := OrderID(ctx); orderID != "" {
+		set(HeaderOrderID, orderID)
+	}
+}
+
+// Extract returns ctx with the request and order IDs read with get, e.g. from headers.
+func Extract(ctx context.Context, get func(key string) string) context.Context {
+	if requestID := get(echo.HeaderXRequestID); requestID != "" {
+		ctx = WithRequestID(ctx, requestID)
+	}
+	if orderID := get(HeaderOrderID); orderID != "" {
+		ctx = withOrderID(ctx, orderID)
+	}
+	return ctx
+}
+
+// contextHook adds the service name and the IDs of the event's context to every line.
+type contextHook struct{}
+
+func (contextHook) Run(e *zerolog.Event, _ zerolog.Level, _ string) {
+	if service != "" {
+		e.Str("service", service)
+	}
+
+	ctx := e.GetCtx()
+	if requestID := RequestID(ctx); requestID != "" {
+		e.Str("request_id", requestID)
+	}
+	if userID := UserID(ctx); userID != "" {
+		e.Str("user_id", userID)
+	}
+	if orderID := OrderID(ctx); orderID != "" {
+		e.Str("order_id", orderID)
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		e.Str("trace_id", spanContext.TraceID().String()).Str("span_id", spanContext.SpanID().String())
+	}
+}
@@ -0,0 +1,69 @@
+package logging
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Middleware takes the request and order IDs of the caller from the headers into the request
+// context, and logs every request once it is answered. Health endpoints are only logged at debug
+// level, probes would drown the other lines.
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			c.SetRequest(req.WithContext(Extract(req.Context(), req.Header.Get)))
+
+			start := time.Now()
+			err := next(c)
+			if err != nil {
+				// the error handler writes the response, so its status is logged
+				c.Error(err)
+			}
+
+			res := c.Response()
+			var event *zerolog.Event
+			switch {
+			case strings.Contains(c.Path(), "/health"):
+				event = Logger.Debug()
+			case res.Status >= http.StatusInternalServerError:
+				event = Logger.Error().Err(err)
+			case res.Status >= http.StatusBadRequest:
+				event = Logger.Warn()
+			default:
+				event = Logger.Info()
+			}
+			// handlers and authentication replace the request, its context has all IDs by now
+			event.Ctx(c.Request().Context()).
+				Str("method", req.Method).
+				Str("route", c.Path()).
+				Str("uri", req.RequestURI).
+				Int("status", res.Status).
+				Dur("latency_ms", time.Since(start)).
+				Int64("bytes_out", res.Size).
+				Str("remote_ip", c.RealIP()).
+				Msg("request")
+			return err
+		}
+	}
+}
+
+// Transport passes the request and order IDs of a request's context to the next service in
+// headers.
+func Transport(next http.RoundTripper) http.RoundTripper {
+	return &transport{next: next}
+}
+
+type transport struct {
+	next http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the caller's request
+	correlated := req.Clone(req.Context())
+	Inject(req.Context(), correlated.Header.Set)
+	return t.next.RoundTrip(correlated)
+}
@@ -0,0 +1,92 @@
+// Package logging is the structured logging of the services. Every line is JSON (or console
+// output for local use) with the service name and, when logged with a context, the request ID,
+// user ID, order ID and trace ID of the request, so the lines of one order can be found across
+// services. Email addresses and passwords are redacted before lines are written.
+package logging
+
+import (
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"io"
+	stdlog "log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Formats lines can be written in.
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console" // Human-readable, for local use
+)
+
+// Config is the log section of a service's config. It can be changed while the service runs.
+type Config struct {
+	Level  string `yaml:"level" env:"LOG_LEVEL" default:"info"`
+	Format string `yaml:"format" env:"LOG_FORMAT" default:"json"`
+}
+
+func (c Config) Validate() error {
+	if _, err := zerolog.ParseLevel(c.Level); err != nil {
+		return fmt.Errorf("unknown level %q", c.Level)
+	}
+	if c.Format != FormatJSON && c.Format != FormatConsole {
+		return fmt.Errorf("unknown format %q", c.Format)
+	}
+	return nil
+}
+
+// Apply sets the level and format of all loggers.
+func (c Config) Apply() {
+	if level, err := zerolog.ParseLevel(c.Level); err == nil {
+		zerolog.SetGlobalLevel(level)
+	}
+
+	var w io.Writer = os.Stdout
+	if c.Format == FormatConsole {
+		w = zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339}
+	}
+	out.set(w)
+}
+
+// Logger is the logger of the service, e.g. `var logger = logging.Logger` in a package. Pass the
+// context of a request with Ctx, e.g. logger.Error().Ctx(ctx).Err(err).Msg("..."), to add its IDs.
+var Logger = zerolog.New(&out).Hook(contextHook{}).With().Timestamp().Logger()
+
+// service is the name added to every line, set once by Setup.
+var service string
+
+// Setup names the service on every line and applies config. The global zerolog logger and the
+// standard library's log package write through Logger as well.
+func Setup(name string, config Config) {
+	service = name
+	config.Apply()
+
+	log.Logger = Logger
+	stdlog.SetFlags(0)
+	stdlog.SetOutput(Logger)
+}
+
+var out = output{w: os.Stdout}
+
+// output redacts lines and writes them to a writer that changes with the format.
+type output struct {
+	mu sync.RWMutex
+	w  io.Writer
+}
+
+func (o *output) set(w io.Writer) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.w = w
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if _, err := o.w.Write(Redact(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
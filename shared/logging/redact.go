@@ -0,0 +1,19 @@
+package logging
+
+import "regexp"
+
+var (
+	// the first character of the local part is kept, so lines of one user can still be told apart
+	emailPattern = regexp.MustCompile(`([A-Za-z0-9])[A-Za-z0-9._%+\-]*@([A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,})`)
+
+	// JSON fields like "password" or "new_password", and password=... in messages
+	secretFieldPattern = regexp.MustCompile(`(?i)("[^"]*(?:password|passwd|secret)[^"]*"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+	secretParamPattern = regexp.MustCompile(`(?i)\b((?:password|passwd|secret)=)[^\s&"\\]+`)
+)
+
+// Redact masks the email addresses and passwords in a log line.
+func Redact(line []byte) []byte {
+	line = emailPattern.ReplaceAll(line, []byte("$1***@$2"))
+	line = secretFieldPattern.ReplaceAll(line, []byte(`$1"[REDACTED]"`))
+	return secretParamPattern.ReplaceAll(line, []byte("$1[REDACTED]"))
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"strings"
+)
+
+var cacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "cache_requests_total",
+	Help: "Cache lookups by key prefix and result (hit, miss or error).",
+}, []string{"cache", "result"})
+
+// CacheHook counts the GETs of keys starting with one of prefixes, e.g. "product:", as hits or
+// misses. Add it to a client with AddHook.
+func CacheHook(prefixes ...string) redis.Hook {
+	return cacheHook{prefixes: prefixes}
+}
+
+type cacheHook struct {
+	prefixes []string
+}
+
+func (h cacheHook) BeforeProcess(ctx context.Context, _ redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h cacheHook) AfterProcess(_ context.Context, cmd redis.Cmder) error {
+	h.record(cmd)
+	return nil
+}
+
+func (h cacheHook) BeforeProcessPipeline(ctx context.Context, _ []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h cacheHook) AfterProcessPipeline(_ context.Context, cmds []redis.Cmder) error {
+	for _, cmd := range cmds {
+		h.record(cmd)
+	}
+	return nil
+}
+
+func (h cacheHook) record(cmd redis.Cmder) {
+	args := cmd.Args()
+	if cmd.Name() != "get" || len(args) < 2 {
+		return
+	}
+	key, ok := args[1].(string)
+	if !ok {
+		return
+	}
+	for _, prefix := range h.prefixes {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		result := "hit"
+		if err := cmd.Err(); errors.Is(err, redis.Nil) {
+			result = "miss"
+		} else if err != nil {
+			result = "error"
+		}
+		cacheRequests.WithLabelValues(prefix, result).Inc()
+		return
+	}
+}
@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	clientCircuitState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "http_client_circuit_state",
+		Help: "State of the circuit breaker for an upstream service: 0 closed, 1 half-open, 2 open.",
+	}, []string{"upstream"})
+
+	clientRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_client_retries_total",
+		Help: "Requests to an upstream service sent again after a failed attempt.",
+	}, []string{"upstream"})
+
+	clientRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_client_rejected_total",
+		Help: "Requests to an upstream service failed without sending them, by reason (circuit_open or bulkhead_full).",
+	}, []string{"upstream", "reason"})
+)
+
+// CircuitState records the state of the circuit breaker for upstream, see the metric's help.
+func CircuitState(upstream string, state int) {
+	clientCircuitState.WithLabelValues(upstream).Set(float64(state))
+}
+
+// ClientRetried records a retry of a request to upstream.
+func ClientRetried(upstream string) {
+	clientRetries.WithLabelValues(upstream).Inc()
+}
+
+// ClientRejected records a request to upstream that wasn't sent for reason.
+func ClientRejected(upstream, reason string) {
+	clientRejected.WithLabelValues(upstream, reason).Inc()
+}
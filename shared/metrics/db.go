@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"time"
+)
+
+var (
+	dbQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "db_query_duration_seconds",
+		Help:    "Duration of database queries by database and statement type.",
+		Buckets: []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5},
+	}, []string{"db", "op"})
+
+	dbQueryErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "db_query_errors_total",
+		Help: "Failed database queries by database and statement type.",
+	}, []string{"db", "op"})
+)
+
+// ObserveQuery records a query of type op, e.g. "select", to the database db that took duration
+// and failed with err, if any.
+func ObserveQuery(db, op string, duration time.Duration, err error) {
+	dbQueryDuration.WithLabelValues(db, op).Observe(duration.Seconds())
+	if err != nil {
+		dbQueryErrors.WithLabelValues(db, op).Inc()
+	}
+}
+
+// DBStats reports the connection stats of the pool of the database db as go_sql_* metrics. A
+// pool opened again, e.g. on a reconnect, replaces the stats of the previous one.
+func DBStats(pool *sql.DB, db string) error {
+	stats := collectors.NewDBStatsCollector(pool, db)
+	if err := prometheus.Register(stats); err != nil {
+		var registered prometheus.AlreadyRegisteredError
+		if !errors.As(err, &registered) {
+			return err
+		}
+		prometheus.Unregister(registered.ExistingCollector)
+		return prometheus.Register(stats)
+	}
+	return nil
+}
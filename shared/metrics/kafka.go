@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"time"
+)
+
+var (
+	kafkaProduceDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kafka_produce_duration_seconds",
+		Help:    "Duration of writes to a Kafka topic, until the brokers acknowledged them.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"topic"})
+
+	kafkaProduceErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_produce_errors_total",
+		Help: "Failed writes to a Kafka topic.",
+	}, []string{"topic"})
+
+	kafkaConsumeLag = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kafka_consume_lag_seconds",
+		Help:    "Time between producing a message and consuming it.",
+		Buckets: []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300, 900},
+	}, []string{"topic"})
+
+	kafkaConsumeErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_consume_errors_total",
+		Help: "Failures while consuming a Kafka topic by stage (fetch, decode, process or commit).",
+	}, []string{"topic", "stage"})
+)
+
+// Produced records a write to topic that started at start and failed with err, if any.
+func Produced(topic string, start time.Time, err error) {
+	kafkaProduceDuration.WithLabelValues(topic).Observe(time.Since(start).Seconds())
+	if err != nil {
+		kafkaProduceErrors.WithLabelValues(topic).Inc()
+	}
+}
+
+// Consumed records a message of topic that was produced at produced.
+func Consumed(topic string, produced time.Time) {
+	if produced.IsZero() {
+		return
+	}
+	kafkaConsumeLag.WithLabelValues(topic).Observe(time.Since(produced).Seconds())
+}
+
+// ConsumeFailed records a failure consuming topic at stage.
+func ConsumeFailed(topic, stage string) {
+	kafkaConsumeErrors.WithLabelValues(topic, stage).Inc()
+}
+
+// ConsumerLag reports the number of messages of topic the consumer group is behind, read from
+// lag on every scrape, e.g. the Lag of a kafka.Reader's stats.
+func ConsumerLag(topic string, lag func() int64) {
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "kafka_consumer_lag_messages",
+		Help:        "Messages the consumer group is behind the end of the topic.",
+		ConstLabels: prometheus.Labels{"topic": topic},
+	}, func() float64 {
+		return float64(lag())
+	}))
+}
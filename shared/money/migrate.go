@@ -0,0 +1,29 @@
+package money
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// ConvertColumn migrates a float column holding amounts, e.g. a legacy DOUBLE price, to
+// DecimalColumn. Columns that are already DECIMAL are left alone, and a column with a default
+// gets DEFAULT 0.
+func ConvertColumn(db *sql.DB, table, column string) error {
+	var dataType string
+	var defaultValue sql.NullString
+	query := `SELECT DATA_TYPE, COLUMN_DEFAULT FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?`
+	err := db.QueryRow(query, table, column).Scan(&dataType, &defaultValue)
+	if err != nil {
+		return fmt.Errorf("could not inspect %s.%s: %v", table, column, err)
+	}
+	if dataType == "decimal" {
+		return nil
+	}
+
+	definition := DecimalColumn + " NOT NULL"
+	if defaultValue.Valid {
+		definition += " DEFAULT 0"
+	}
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s MODIFY %s %s", table, column, definition))
+	return err
+}
@@ -0,0 +1,381 @@
+// Package money provides an exact monetary amount type shared by all services.
+//
+// Amounts are stored as an integer number of minor units (e.g. cents) together with an ISO 4217
+// currency code, so sums never drift the way float64 prices do. Multiplying by a rate (markup,
+// discount, tax) is done with exact rational arithmetic and rounded once, half away from zero,
+// to the currency's minor unit.
+//
+// Rates can come from outside, e.g. a request or a config file, so the operations taking one
+// return an error for an invalid rate instead of panicking. Mixing currencies is a programming
+// error and panics: callers compare the currencies of amounts from outside before combining
+// them, e.g. promotion.Validate in order-service.
+package money
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is used for amounts that were stored or sent without a currency.
+const DefaultCurrency = "USD"
+
+// DecimalColumn is the SQL column type used to store amounts. Four decimal places hold every
+// currency's minor unit, including three-decimal currencies.
+const DecimalColumn = "DECIMAL(19,4)"
+
+// Errors of operations on amounts, to check for with errors.Is.
+var (
+	ErrInvalidRate = errors.New("money: invalid rate")
+	ErrOverflow    = errors.New("money: amount out of range")
+)
+
+// exponents lists the number of minor unit digits for currencies that don't use two.
+var exponents = map[string]int{
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0,
+	"PYG": 0, "RWF": 0, "UGX": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+}
+
+// Exponent returns the number of minor unit digits of a currency.
+func Exponent(currency string) int {
+	if exp, ok := exponents[currency]; ok {
+		return exp
+	}
+	return 2
+}
+
+// Money is an amount in minor units of a currency. The zero value is zero in the default currency.
+type Money struct {
+	amount   int64
+	currency string
+}
+
+// New returns an amount of minor units in the given currency.
+func New(minorUnits int64, currency string) Money {
+	return Money{amount: minorUnits, currency: normalizeCurrency(currency)}
+}
+
+// Zero returns a zero amount in the given currency.
+func Zero(currency string) Money {
+	return New(0, currency)
+}
+
+// Parse parses a decimal string such as "12.34" into an amount, rounding to the currency's minor unit.
+func Parse(s, currency string) (Money, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return Money{}, fmt.Errorf("money: invalid amount %q", s)
+	}
+	currency = normalizeCurrency(currency)
+	amount, err := roundRat(r, Exponent(currency))
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %s", err, s)
+	}
+	return Money{amount: amount, currency: currency}, nil
+}
+
+// FromFloat converts a float amount, using its shortest decimal representation so 0.1 stays 0.1.
+// It only exists for boundaries that still hand over floats.
+func FromFloat(f float64, currency string) Money {
+	m, _ := Parse(strconv.FormatFloat(f, 'f', -1, 64), currency)
+	return m
+}
+
+// MinorUnits returns the amount in minor units.
+func (m Money) MinorUnits() int64 {
+	return m.amount
+}
+
+// Currency returns the ISO 4217 currency code.
+func (m Money) Currency() string {
+	if m.currency == "" {
+		return DefaultCurrency
+	}
+	return m.currency
+}
+
+// IsZero reports whether the amount is zero.
+func (m Money) IsZero() bool {
+	return m.amount == 0
+}
+
+// IsNegative reports whether the amount is below zero.
+func (m Money) IsNegative() bool {
+	return m.amount < 0
+}
+
+// Cmp compares two amounts of the same currency and returns -1, 0 or +1.
+func (m Money) Cmp(other Money) int {
+	m.mustMatch(other)
+	switch {
+	case m.amount < other.amount:
+		return -1
+	case m.amount > other.amount:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Add returns m + other. Both amounts must be in the same currency.
+func (m Money) Add(other Money) Money {
+	currency := m.mustMatch(other)
+	return Money{amount: m.amount + other.amount, currency: currency}
+}
+
+// Sub returns m - other. Both amounts must be in the same currency.
+func (m Money) Sub(other Money) Money {
+	currency := m.mustMatch(other)
+	return Money{amount: m.amount - other.amount, currency: currency}
+}
+
+// MulInt returns the amount multiplied by a whole number, e.g. a unit price by a quantity.
+func (m Money) MulInt(n int) Money {
+	return Money{amount: m.amount * int64(n), currency: m.currency}
+}
+
+// Mul multiplies the amount by one or more rates, e.g. m.Mul(1+markup, 1-discount). The product is
+// computed exactly and rounded once at the end. NaN and infinite rates are invalid.
+func (m Money) Mul(factors ...float64) (Money, error) {
+	r := new(big.Rat).SetInt64(m.amount)
+	for _, factor := range factors {
+		f, err := rate(factor)
+		if err != nil {
+			return Money{}, err
+		}
+		r.Mul(r, f)
+	}
+	return m.rounded(r, 0)
+}
+
+// MulFrac returns the amount multiplied by num/den, rounded once. den can't be zero.
+func (m Money) MulFrac(num, den int64) (Money, error) {
+	if den == 0 {
+		return Money{}, fmt.Errorf("%w: %d/%d", ErrInvalidRate, num, den)
+	}
+	r := new(big.Rat).SetFrac(new(big.Int).Mul(big.NewInt(m.amount), big.NewInt(num)), big.NewInt(den))
+	return m.rounded(r, 0)
+}
+
+// Div divides the amount by a rate, e.g. m.Div(1+taxRate) to get the net of a tax-inclusive price.
+// The quotient is computed exactly and rounded once. The divisor can't be zero.
+func (m Money) Div(divisor float64) (Money, error) {
+	d, err := rate(divisor)
+	if err != nil {
+		return Money{}, err
+	}
+	if d.Sign() == 0 {
+		return Money{}, fmt.Errorf("%w: division by zero", ErrInvalidRate)
+	}
+	return m.rounded(new(big.Rat).Quo(new(big.Rat).SetInt64(m.amount), d), 0)
+}
+
+// Convert returns the amount in another currency, where rate is the number of units of the target
+// currency per unit of the source currency. The result is rounded once to the target's minor unit.
+// The rate has to be positive.
+func (m Money) Convert(currency string, exchangeRate float64) (Money, error) {
+	r, err := rate(exchangeRate)
+	if err != nil {
+		return Money{}, err
+	}
+	if r.Sign() <= 0 {
+		return Money{}, fmt.Errorf("%w: exchange rate %v", ErrInvalidRate, exchangeRate)
+	}
+
+	// minor units -> major units -> target currency
+	major := new(big.Rat).SetFrac(big.NewInt(m.amount), pow10(Exponent(m.Currency())))
+	target := Money{currency: normalizeCurrency(currency)}
+	return target.rounded(major.Mul(major, r), Exponent(target.currency))
+}
+
+// rate returns a float rate as the exact decimal it is written as, so 0.1 stays 0.1.
+func rate(f float64) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(f, 'f', -1, 64))
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRate, f)
+	}
+	return r, nil
+}
+
+// rounded returns r scaled by 10^exp and rounded, in m's currency.
+func (m Money) rounded(r *big.Rat, exp int) (Money, error) {
+	amount, err := roundRat(r, exp)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{amount: amount, currency: m.currency}, nil
+}
+
+// Min returns the smaller of two amounts of the same currency.
+func Min(a, b Money) Money {
+	if a.Cmp(b) <= 0 {
+		return a
+	}
+	return b
+}
+
+// Sum adds up amounts of the same currency. An empty list sums to zero in the given currency.
+func Sum(currency string, amounts ...Money) Money {
+	total := Zero(currency)
+	for _, amount := range amounts {
+		total = total.Add(amount)
+	}
+	return total
+}
+
+// String formats the amount as a decimal with its currency, e.g. "12.34 USD".
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency()
+}
+
+// Decimal formats the amount as a plain decimal string, e.g. "12.34".
+func (m Money) Decimal() string {
+	exp := Exponent(m.Currency())
+	return new(big.Rat).SetFrac(big.NewInt(m.amount), pow10(exp)).FloatString(exp)
+}
+
+// Float64 returns the amount as a float. It is lossy and only meant for metrics and reports.
+func (m Money) Float64() float64 {
+	f, _ := new(big.Rat).SetFrac(big.NewInt(m.amount), pow10(Exponent(m.Currency()))).Float64()
+	return f
+}
+
+type jsonMoney struct {
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// MarshalJSON encodes the amount as {"amount":"12.34","currency":"USD"}. The amount is a string so
+// JSON clients don't turn it back into a float.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonMoney{Amount: m.Decimal(), Currency: m.Currency()})
+}
+
+// UnmarshalJSON accepts the object form written by MarshalJSON, and also a bare number or string
+// in the default currency so older clients keep working.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	trimmed := strings.TrimSpace(string(data))
+	if trimmed == "null" {
+		return nil
+	}
+
+	if strings.HasPrefix(trimmed, "{") {
+		var v jsonMoney
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+		if v.Amount == "" {
+			v.Amount = "0"
+		}
+		parsed, err := Parse(v.Amount, v.Currency)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	}
+
+	parsed, err := Parse(strings.Trim(trimmed, `"`), m.currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Value stores the amount as a decimal string, for DECIMAL columns.
+func (m Money) Value() (driver.Value, error) {
+	return m.Decimal(), nil
+}
+
+// Scan reads a DECIMAL (or legacy DOUBLE) column. The currency is kept from the receiver, so set
+// it before scanning if the row isn't in the default currency.
+func (m *Money) Scan(src interface{}) error {
+	var parsed Money
+	var err error
+	switch v := src.(type) {
+	case nil:
+		parsed = Zero(m.currency)
+	case []byte:
+		parsed, err = Parse(string(v), m.currency)
+	case string:
+		parsed, err = Parse(v, m.currency)
+	case float64:
+		parsed = FromFloat(v, m.currency)
+	case int64:
+		parsed, err = Parse(strconv.FormatInt(v, 10), m.currency)
+	default:
+		return fmt.Errorf("money: cannot scan %T", src)
+	}
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// ScanIn returns a scanner that reads a DECIMAL column in the currency held by *currency at scan
+// time. Rows are scanned in column order, so select the currency column before the amounts.
+func ScanIn(currency *string, dst *Money) sql.Scanner {
+	return currencyScanner{currency: currency, dst: dst}
+}
+
+type currencyScanner struct {
+	currency *string
+	dst      *Money
+}
+
+func (s currencyScanner) Scan(src interface{}) error {
+	s.dst.currency = normalizeCurrency(*s.currency)
+	return s.dst.Scan(src)
+}
+
+// mustMatch returns the shared currency of two amounts. Mixing currencies is a programming error,
+// conversions have to be explicit, so it panics; see the package doc.
+func (m Money) mustMatch(other Money) string {
+	a, b := m.Currency(), other.Currency()
+	if a != b {
+		panic(fmt.Sprintf("money: currency mismatch %s and %s", a, b))
+	}
+	return a
+}
+
+func normalizeCurrency(currency string) string {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		return DefaultCurrency
+	}
+	return currency
+}
+
+func pow10(exp int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exp)), nil)
+}
+
+// roundRat scales r by 10^exp and rounds half away from zero to an integer. Results beyond int64
+// are ErrOverflow.
+func roundRat(r *big.Rat, exp int) (int64, error) {
+	scaled := new(big.Rat).Mul(r, new(big.Rat).SetInt(pow10(exp)))
+	num, den := scaled.Num(), scaled.Denom()
+
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	// Round half away from zero: compare 2*|rem| with the denominator.
+	rem.Abs(rem).Lsh(rem, 1)
+	if rem.Cmp(den) >= 0 {
+		if num.Sign() < 0 {
+			quo.Sub(quo, big.NewInt(1))
+		} else {
+			quo.Add(quo, big.NewInt(1))
+		}
+	}
+	if !quo.IsInt64() {
+		return 0, ErrOverflow
+	}
+	return quo.Int64(), nil
+}
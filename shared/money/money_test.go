@@ -0,0 +1,253 @@
+package money_test
+
+import (
+	"errors"
+	"math"
+	"shared/money"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		amount   string
+		currency string
+		want     money.Money
+	}{
+		// half away from zero, on both sides of zero
+		{"1.005", "USD", money.New(101, "USD")},
+		{"-1.005", "USD", money.New(-101, "USD")},
+		{"1.0049", "USD", money.New(100, "USD")},
+		{"-1.0049", "USD", money.New(-100, "USD")},
+		{"0.005", "USD", money.New(1, "USD")},
+		{"-0.005", "USD", money.New(-1, "USD")},
+		// no minor units
+		{"12.5", "JPY", money.New(13, "JPY")},
+		{"-12.5", "JPY", money.New(-13, "JPY")},
+		{"12.49", "JPY", money.New(12, "JPY")},
+		// three minor digits
+		{"1.0005", "KWD", money.New(1001, "KWD")},
+		{"-1.0005", "KWD", money.New(-1001, "KWD")},
+		{"1.234", "kwd", money.New(1234, "KWD")},
+		// the default currency
+		{" 2.50 ", "", money.New(250, "USD")},
+	}
+	for _, test := range tests {
+		got, err := money.Parse(test.amount, test.currency)
+		if err != nil {
+			t.Errorf("Parse(%q, %q): %v", test.amount, test.currency, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("Parse(%q, %q) = %s, want %s", test.amount, test.currency, got, test.want)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		amount string
+		want   error
+	}{
+		{"abc", nil},
+		{"", nil},
+		{"1e30", money.ErrOverflow},
+		{"-92233720368547758.09", money.ErrOverflow},
+	}
+	for _, test := range tests {
+		_, err := money.Parse(test.amount, "USD")
+		if err == nil || test.want != nil && !errors.Is(err, test.want) {
+			t.Errorf("Parse(%q) returned %v, want %v", test.amount, err, test.want)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		amount money.Money
+		want   string
+	}{
+		{money.New(1234, "USD"), "12.34 USD"},
+		{money.New(-5, "USD"), "-0.05 USD"},
+		{money.New(1234, "JPY"), "1234 JPY"},
+		{money.New(-1234, "JPY"), "-1234 JPY"},
+		{money.New(1234, "KWD"), "1.234 KWD"},
+		{money.New(-1, "KWD"), "-0.001 KWD"},
+		{money.Money{}, "0.00 USD"},
+	}
+	for _, test := range tests {
+		if got := test.amount.String(); got != test.want {
+			t.Errorf("String() = %q, want %q", got, test.want)
+		}
+	}
+}
+
+func TestMul(t *testing.T) {
+	tests := []struct {
+		amount  money.Money
+		factors []float64
+		want    money.Money
+	}{
+		// rounded once at the end: 10.00 * 1.1 * 0.95 = 10.45
+		{money.New(1000, "USD"), []float64{1.1, 0.95}, money.New(1045, "USD")},
+		// 0.1 is taken as written, not as the nearest float
+		{money.New(1, "USD"), []float64{0.1, 10}, money.New(1, "USD")},
+		{money.New(5, "USD"), []float64{0.5}, money.New(3, "USD")},
+		{money.New(-5, "USD"), []float64{0.5}, money.New(-3, "USD")},
+		{money.New(5, "USD"), []float64{0.4999}, money.New(2, "USD")},
+		{money.New(1, "JPY"), []float64{0.5}, money.New(1, "JPY")},
+		{money.New(1, "KWD"), []float64{1.5}, money.New(2, "KWD")},
+		{money.New(1999, "USD"), nil, money.New(1999, "USD")},
+		{money.New(1999, "USD"), []float64{0}, money.New(0, "USD")},
+	}
+	for _, test := range tests {
+		got, err := test.amount.Mul(test.factors...)
+		if err != nil {
+			t.Errorf("%s.Mul(%v): %v", test.amount, test.factors, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s.Mul(%v) = %s, want %s", test.amount, test.factors, got, test.want)
+		}
+	}
+}
+
+func TestMulFrac(t *testing.T) {
+	tests := []struct {
+		amount   money.Money
+		num, den int64
+		want     money.Money
+	}{
+		{money.New(1000, "USD"), 1, 3, money.New(333, "USD")},
+		{money.New(1000, "USD"), 2, 3, money.New(667, "USD")},
+		{money.New(5, "USD"), 1, 2, money.New(3, "USD")},
+		{money.New(-5, "USD"), 1, 2, money.New(-3, "USD")},
+		{money.New(5, "JPY"), 0, 2, money.New(0, "JPY")},
+	}
+	for _, test := range tests {
+		got, err := test.amount.MulFrac(test.num, test.den)
+		if err != nil {
+			t.Errorf("%s.MulFrac(%d, %d): %v", test.amount, test.num, test.den, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s.MulFrac(%d, %d) = %s, want %s", test.amount, test.num, test.den, got, test.want)
+		}
+	}
+}
+
+func TestDiv(t *testing.T) {
+	tests := []struct {
+		amount  money.Money
+		divisor float64
+		want    money.Money
+	}{
+		// the net of 11.00 including 10% tax
+		{money.New(1100, "USD"), 1.1, money.New(1000, "USD")},
+		{money.New(1000, "USD"), 1.1, money.New(909, "USD")},
+		{money.New(1, "USD"), 2, money.New(1, "USD")},
+		{money.New(-1, "USD"), 2, money.New(-1, "USD")},
+		{money.New(1, "USD"), 2.0001, money.New(0, "USD")},
+		{money.New(15, "JPY"), 2, money.New(8, "JPY")},
+		{money.New(1001, "KWD"), -2, money.New(-501, "KWD")},
+	}
+	for _, test := range tests {
+		got, err := test.amount.Div(test.divisor)
+		if err != nil {
+			t.Errorf("%s.Div(%v): %v", test.amount, test.divisor, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s.Div(%v) = %s, want %s", test.amount, test.divisor, got, test.want)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		amount   money.Money
+		currency string
+		rate     float64
+		want     money.Money
+	}{
+		{money.New(10000, "USD"), "EUR", 0.9, money.New(9000, "EUR")},
+		// rounded to the minor unit of the target currency
+		{money.New(100, "USD"), "JPY", 150.5, money.New(151, "JPY")},
+		{money.New(-100, "USD"), "JPY", 150.5, money.New(-151, "JPY")},
+		{money.New(100, "USD"), "JPY", 150.49, money.New(150, "JPY")},
+		{money.New(1, "JPY"), "USD", 0.0067, money.New(1, "USD")},
+		{money.New(1, "JPY"), "USD", 0.0049, money.New(0, "USD")},
+		{money.New(100, "USD"), "KWD", 0.30715, money.New(307, "KWD")},
+		{money.New(100, "USD"), "KWD", 0.30750, money.New(308, "KWD")},
+		{money.New(1000, "KWD"), "JPY", 489.5, money.New(490, "JPY")},
+		{money.New(-1, "USD"), "eur", 0.5, money.New(-1, "EUR")},
+	}
+	for _, test := range tests {
+		got, err := test.amount.Convert(test.currency, test.rate)
+		if err != nil {
+			t.Errorf("%s.Convert(%s, %v): %v", test.amount, test.currency, test.rate, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s.Convert(%s, %v) = %s, want %s", test.amount, test.currency, test.rate, got, test.want)
+		}
+	}
+}
+
+// TestInvalidRates covers rates that can come from a request or a config file.
+func TestInvalidRates(t *testing.T) {
+	amount := money.New(1000, "USD")
+	tests := []struct {
+		name string
+		op   func() (money.Money, error)
+		want error
+	}{
+		{"Mul NaN", func() (money.Money, error) { return amount.Mul(1.1, math.NaN()) }, money.ErrInvalidRate},
+		{"Mul Inf", func() (money.Money, error) { return amount.Mul(math.Inf(1)) }, money.ErrInvalidRate},
+		{"Mul overflow", func() (money.Money, error) { return money.New(math.MaxInt64, "USD").Mul(2) }, money.ErrOverflow},
+		{"MulFrac zero", func() (money.Money, error) { return amount.MulFrac(1, 0) }, money.ErrInvalidRate},
+		{"MulFrac overflow", func() (money.Money, error) { return money.New(math.MaxInt64, "USD").MulFrac(3, 2) }, money.ErrOverflow},
+		{"Div zero", func() (money.Money, error) { return amount.Div(0) }, money.ErrInvalidRate},
+		{"Div NaN", func() (money.Money, error) { return amount.Div(math.NaN()) }, money.ErrInvalidRate},
+		{"Div overflow", func() (money.Money, error) { return money.New(math.MaxInt64, "USD").Div(0.5) }, money.ErrOverflow},
+		{"Convert zero", func() (money.Money, error) { return amount.Convert("EUR", 0) }, money.ErrInvalidRate},
+		{"Convert negative", func() (money.Money, error) { return amount.Convert("EUR", -0.9) }, money.ErrInvalidRate},
+		{"Convert NaN", func() (money.Money, error) { return amount.Convert("EUR", math.NaN()) }, money.ErrInvalidRate},
+		{"Convert overflow", func() (money.Money, error) { return money.New(math.MaxInt64, "USD").Convert("KWD", 10) }, money.ErrOverflow},
+	}
+	for _, test := range tests {
+		if _, err := test.op(); !errors.Is(err, test.want) {
+			t.Errorf("%s returned %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+// TestCurrencyMismatch pins that mixing currencies panics: callers check the currencies of
+// amounts from outside first.
+func TestCurrencyMismatch(t *testing.T) {
+	usd, eur := money.New(100, "USD"), money.New(100, "EUR")
+	tests := []struct {
+		name string
+		op   func()
+	}{
+		{"Add", func() { usd.Add(eur) }},
+		{"Sub", func() { usd.Sub(eur) }},
+		{"Cmp", func() { usd.Cmp(eur) }},
+		{"Min", func() { money.Min(usd, eur) }},
+		{"Sum", func() { money.Sum("USD", usd, eur) }},
+	}
+	for _, test := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s of USD and EUR didn't panic", test.name)
+				}
+			}()
+			test.op()
+		}()
+	}
+
+	// the zero value is in the default currency, so it adds to USD amounts
+	if got := (money.Money{}).Add(usd); got != usd {
+		t.Errorf("zero value + %s = %s", usd, got)
+	}
+}
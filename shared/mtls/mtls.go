@@ -0,0 +1,95 @@
+// Package mtls loads the certificates for mutual TLS between services. Certificates are signed by
+// a local CA, see cmd/devca.
+package mtls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"os"
+)
+
+// Files are the PEM files of a service: its certificate and key, and the CA that signs its peers.
+// They are the tls section of a service's config.
+type Files struct {
+	Cert string `yaml:"cert_file" env:"TLS_CERT_FILE"`
+	Key  string `yaml:"key_file" env:"TLS_KEY_FILE"`
+	CA   string `yaml:"ca_file" env:"TLS_CA_FILE"`
+}
+
+// Enabled reports whether all files are set. Otherwise services talk plain HTTP.
+func (f Files) Enabled() bool {
+	return f.Cert != "" && f.Key != "" && f.CA != ""
+}
+
+// Validate rejects a partial configuration, which would silently fall back to plain HTTP.
+func (f Files) Validate() error {
+	if !f.Enabled() && (f.Cert != "" || f.Key != "" || f.CA != "") {
+		return errors.New("cert_file, key_file and ca_file must be set together")
+	}
+	return nil
+}
+
+// ServerConfig requires clients to present a certificate signed by the CA.
+func ServerConfig(files Files) (*tls.Config, error) {
+	cert, pool, err := load(files)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// ClientConfig presents the service's certificate and only trusts servers signed by the CA.
+func ClientConfig(files Files) (*tls.Config, error) {
+	cert, pool, err := load(files)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+func load(files Files) (tls.Certificate, *x509.CertPool, error) {
+	cert, err := tls.LoadX509KeyPair(files.Cert, files.Key)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("could not load certificate: %v", err)
+	}
+
+	caPEM, err := os.ReadFile(files.CA)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("could not load CA: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return tls.Certificate{}, nil, errors.New("no certificates in CA file")
+	}
+
+	return cert, pool, nil
+}
+
+// Start starts an internal service on addr, with mutual TLS when files are set and plain HTTP
+// otherwise.
+func Start(e *echo.Echo, addr string, files Files) error {
+	if !files.Enabled() {
+		return e.Start(addr)
+	}
+
+	tlsConfig, err := ServerConfig(files)
+	if err != nil {
+		return err
+	}
+	// e.TLSServer is the server e.Shutdown stops
+	e.TLSServer.Addr = addr
+	e.TLSServer.TLSConfig = tlsConfig
+	return e.StartServer(e.TLSServer)
+}
@@ -0,0 +1,79 @@
+package pricing
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Client calls dynamic-pricing-service.
+type Client struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewClient creates a client for the service at baseURL, e.g. "http://localhost:8083". client
+// sends the requests, e.g. one made with httpclient.ForService.
+func NewClient(baseURL string, client *http.Client) *Client {
+	return &Client{baseURL: baseURL, client: client}
+}
+
+// Quote returns the price of one unit of a product.
+func (c *Client) Quote(ctx context.Context, req QuoteRequest) (*Quote, error) {
+	var quote Quote
+	if err := c.post(ctx, QuotePath, req, &quote); err != nil {
+		return nil, err
+	}
+	return &quote, nil
+}
+
+// PriceCart returns the prices of all items of a cart.
+func (c *Client) PriceCart(ctx context.Context, req CartRequest) (*Cart, error) {
+	var cart Cart
+	if err := c.post(ctx, CartPath, req, &cart); err != nil {
+		return nil, err
+	}
+	if len(cart.Lines) != len(req.Items) {
+		return nil, fmt.Errorf("pricing returned %d lines for %d items", len(cart.Lines), len(req.Items))
+	}
+	return &cart, nil
+}
+
+func (c *Client) post(ctx context.Context, path string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// pricing doesn't change anything, so the request can be retried
+	req.Header.Set("Idempotency-Key", idempotencyKey())
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &Error{Status: resp.StatusCode}
+		if json.NewDecoder(resp.Body).Decode(apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = http.StatusText(resp.StatusCode)
+		}
+		return apiErr
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func idempotencyKey() string {
+	key := make([]byte, 16)
+	rand.Read(key)
+	return hex.EncodeToString(key)
+}
@@ -0,0 +1,96 @@
+// Package pricing is the contract of dynamic-pricing-service and a typed client for it. The
+// contract is versioned in its paths, e.g. /pricing/v1/quote, so a new version can be served next
+// to the old one while callers move over. Changes within a version only add optional fields.
+package pricing
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"shared/money"
+)
+
+// Version of the contract in this package.
+const Version = "v1"
+
+// Paths of the contract, all POST with a JSON body.
+const (
+	QuotePath = "/pricing/" + Version + "/quote"
+	CartPath  = "/pricing/" + Version + "/cart"
+)
+
+// QuoteRequest asks for the price of one unit of a product.
+type QuoteRequest struct {
+	ProductID   int    `json:"product_id"`
+	Currency    string `json:"currency,omitempty"`     // The currency of the product's pricing rule if empty
+	RateVersion int    `json:"rate_version,omitempty"` // Exchange rate version to convert with, 0 for the latest
+}
+
+// Quote is the price of one unit of a product.
+type Quote struct {
+	ProductID    int         `json:"product_id"`
+	Markup       float64     `json:"markup"`   // Markup percentage applied
+	Discount     float64     `json:"discount"` // Discount percentage applied
+	UnitPrice    money.Money `json:"unit_price"`
+	ExchangeRate float64     `json:"exchange_rate"` // Rate the price was converted with, 1 if it wasn't
+	RateVersion  int         `json:"rate_version"`  // Exchange rate version of the conversion, 0 if there was none
+}
+
+// CartRequest asks for the prices of all items of a cart at once, in one currency.
+type CartRequest struct {
+	Currency    string     `json:"currency,omitempty"`     // money.DefaultCurrency if empty
+	RateVersion int        `json:"rate_version,omitempty"` // Exchange rate version to convert with, 0 for the latest
+	Items       []CartItem `json:"items"`
+}
+
+// CartItem is a product and the number of units of it in a cart.
+type CartItem struct {
+	ProductID int `json:"product_id"`
+	Quantity  int `json:"quantity"`
+}
+
+// Cart is a priced cart. Every converted price uses the same exchange rate version, so the prices
+// of an order can be reproduced.
+type Cart struct {
+	Currency    string      `json:"currency"`
+	RateVersion int         `json:"rate_version"` // 0 if no price was converted
+	Lines       []CartLine  `json:"lines"`        // In the order of the items
+	Total       money.Money `json:"total"`
+}
+
+// CartLine is the price of one item of a cart.
+type CartLine struct {
+	Quote
+	Quantity int         `json:"quantity"`
+	Total    money.Money `json:"total"` // UnitPrice times Quantity
+}
+
+// Errors of calls, to check for with errors.Is.
+var (
+	ErrInvalidRequest = errors.New("invalid pricing request")
+	ErrNotFound       = errors.New("no pricing for product")
+	ErrUnavailable    = errors.New("pricing unavailable") // Not reached, timed out or failed, a retry might succeed
+)
+
+// Error is the body of a failed response, with its status.
+type Error struct {
+	Status  int    `json:"-"`
+	Message string `json:"error"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("pricing answered %d: %s", e.Status, e.Message)
+}
+
+// Is matches the error of e's status.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrInvalidRequest:
+		return e.Status == http.StatusBadRequest
+	case ErrNotFound:
+		return e.Status == http.StatusNotFound
+	case ErrUnavailable:
+		return e.Status >= http.StatusInternalServerError
+	}
+	return false
+}
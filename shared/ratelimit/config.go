@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"fmt"
+	"shared/config"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Policy allows Limit requests per Window on average, in bursts of up to Burst requests.
+type Policy struct {
+	Limit  int             `yaml:"limit"`
+	Window config.Duration `yaml:"window"`
+	Burst  int             `yaml:"burst"` // Limit if zero
+}
+
+// Rule applies a policy to the requests of a route, given by its Echo path pattern.
+type Rule struct {
+	Path    string   `yaml:"path"`
+	Methods []string `yaml:"methods"` // All methods if empty
+	Policy  string   `yaml:"policy"`
+}
+
+// Config names the policies and the routes they apply to. Routes without a rule get Default.
+// It is the rate_limits section of the gateway's and the services' configs, and can be swapped at
+// runtime with Limiter.SetConfig.
+type Config struct {
+	Default  Policy            `yaml:"default"`
+	Policies map[string]Policy `yaml:"policies"`
+	Rules    []Rule            `yaml:"rules"`
+}
+
+// Validate checks that every policy allows some requests and every rule names a policy.
+func (c *Config) Validate() error {
+	if err := c.Default.validate("default"); err != nil {
+		return err
+	}
+	for name, policy := range c.Policies {
+		if err := policy.validate(name); err != nil {
+			return err
+		}
+	}
+	for _, rule := range c.Rules {
+		if _, ok := c.Policies[rule.Policy]; !ok {
+			return fmt.Errorf("rate limit rule for %s: unknown policy %q", rule.Path, rule.Policy)
+		}
+	}
+	return nil
+}
+
+func (p Policy) validate(name string) error {
+	if p.Limit <= 0 || p.Window <= 0 || p.Burst < 0 {
+		return fmt.Errorf("rate limit policy %s needs a positive limit and window", name)
+	}
+	// the state is kept in milliseconds
+	if p.emissionInterval() < time.Millisecond {
+		return fmt.Errorf("rate limit policy %s allows more than one request per millisecond", name)
+	}
+	return nil
+}
+
+// policyFor returns the name and policy for a request to the route path with method.
+func (c *Config) policyFor(method, path string) (string, Policy) {
+	for _, rule := range c.Rules {
+		if rule.Path != path {
+			continue
+		}
+		if len(rule.Methods) > 0 && !slices.ContainsFunc(rule.Methods, func(m string) bool { return strings.EqualFold(m, method) }) {
+			continue
+		}
+		return rule.Policy, c.Policies[rule.Policy]
+	}
+	return "default", c.Default
+}
+
+// burst is the number of requests allowed at once.
+func (p Policy) burst() int {
+	if p.Burst == 0 {
+		return p.Limit
+	}
+	return p.Burst
+}
+
+// emissionInterval is the time one request uses up.
+func (p Policy) emissionInterval() time.Duration {
+	return time.Duration(p.Window) / time.Duration(p.Limit)
+}
+
+// header formats the policy for the RateLimit-Policy header, e.g. "100;w=60;burst=20".
+func (p Policy) header() string {
+	return fmt.Sprintf("%d;w=%d;burst=%d", p.Limit, int(time.Duration(p.Window).Seconds()), p.burst())
+}
@@ -0,0 +1,252 @@
+// Package ratelimit limits request rates across every instance of a service, with the state kept
+// in Redis. Limits use the generic cell rate algorithm (GCRA): each client has a theoretical
+// arrival time that every request pushes back, and requests arriving too far before it are
+// denied. This spreads requests evenly over the window while allowing bursts, in one Redis key
+// per client and policy.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+	"math"
+	"shared/auth"
+	"shared/logging"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var logger = logging.Logger
+
+// gcra updates the theoretical arrival time (TAT) of a client, in milliseconds of Redis server
+// time so instances with drifting clocks agree. It returns whether the request is allowed, how
+// many more requests would be right now, when the client may retry and when its limit resets.
+// Unless ARGV[3] is 1 the request is only checked, without counting it.
+var gcra = redis.NewScript(`
+local emission = tonumber(ARGV[1])
+local tolerance = tonumber(ARGV[2])
+local count = ARGV[3] == "1"
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local tat = tonumber(redis.call("GET", KEYS[1]) or now)
+if tat < now then
+	tat = now
+end
+
+local allow_at = tat + emission - tolerance
+if now < allow_at then
+	return {0, 0, allow_at - now, tat - now}
+end
+
+if not count then
+	return {1, math.floor((now - allow_at) / emission) + 1, 0, tat - now}
+end
+
+local new_tat = tat + emission
+redis.call("SET", KEYS[1], new_tat, "PX", new_tat - now)
+return {1, math.floor((now - allow_at) / emission), 0, new_tat - now}
+`)
+
+// Result is the outcome of a rate limited request.
+type Result struct {
+	Allowed    bool
+	Policy     string
+	Limit      int // Requests allowed at once
+	Remaining  int
+	RetryAfter time.Duration // Zero if allowed
+	ResetAfter time.Duration // Until the full burst is available again
+}
+
+// Limiter applies the policies of a config. The config can be replaced while serving, e.g. when
+// the config file changes.
+type Limiter struct {
+	rdb  *redis.Client
+	name string
+
+	mu     sync.RWMutex
+	config *Config
+}
+
+// NewLimiter creates a limiter keeping its state in rdb, under keys named after the service, so
+// the gateway and services sharing a Redis count separately.
+func NewLimiter(rdb *redis.Client, name string, config *Config) *Limiter {
+	return &Limiter{rdb: rdb, name: name, config: config}
+}
+
+// SetConfig replaces the policies. Clients keep their state under policies that still exist.
+func (l *Limiter) SetConfig(config *Config) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.config = config
+}
+
+// Config returns the current policies.
+func (l *Limiter) Config() *Config {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.config
+}
+
+// Take counts a request of client against the named policy.
+func (l *Limiter) Take(ctx context.Context, policyName string, policy Policy, client string) (*Result, error) {
+	return l.run(ctx, policyName, policy, client, true)
+}
+
+// Check returns whether client could make a request under the named policy, without counting it.
+func (l *Limiter) Check(ctx context.Context, policyName string, policy Policy, client string) (*Result, error) {
+	return l.run(ctx, policyName, policy, client, false)
+}
+
+func (l *Limiter) run(ctx context.Context, policyName string, policy Policy, client string, count bool) (*Result, error) {
+	emission := policy.emissionInterval()
+	tolerance := emission * time.Duration(policy.burst())
+	countArg := 0
+	if count {
+		countArg = 1
+	}
+
+	values, err := gcra.Run(ctx, l.rdb, []string{"rate_limit:" + l.name + ":" + policyName + ":" + client},
+		emission.Milliseconds(), tolerance.Milliseconds(), countArg).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != 4 {
+		return nil, fmt.Errorf("unexpected rate limit result %v", values)
+	}
+
+	return &Result{
+		Allowed:    values[0] == 1,
+		Policy:     policyName,
+		Limit:      policy.burst(),
+		Remaining:  int(values[1]),
+		RetryAfter: time.Duration(values[2]) * time.Millisecond,
+		ResetAfter: time.Duration(values[3]) * time.Millisecond,
+	}, nil
+}
+
+// Store is one policy of a limiter as an Echo RateLimiterStore, for use with Echo's RateLimiter
+// middleware. Middleware is preferred, it also sends the RateLimit headers.
+type Store struct {
+	limiter *Limiter
+	policy  string
+}
+
+// Store returns the named policy, or the default one, as an Echo RateLimiterStore.
+func (l *Limiter) Store(policy string) *Store {
+	return &Store{limiter: l, policy: policy}
+}
+
+// Allow implements echo's middleware.RateLimiterStore.
+func (s *Store) Allow(identifier string) (bool, error) {
+	config := s.limiter.Config()
+	policy, ok := config.Policies[s.policy]
+	if !ok {
+		policy = config.Default
+	}
+
+	result, err := s.limiter.Take(context.Background(), s.policy, policy, identifier)
+	if err != nil {
+		return false, err
+	}
+	return result.Allowed, nil
+}
+
+// countedKey marks requests Middleware has counted, so BeforeAuth doesn't count them again.
+const countedKey = "rate_limit_counted"
+
+// Middleware limits requests by the policy of their route. It runs after authentication, so
+// callers are limited per user, API key or service client, and anonymous callers per IP. The
+// limits are reported in RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and
+// RateLimit-Policy headers. When Redis is unreachable requests are let through.
+func Middleware(limiter *Limiter) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			policyName, policy := limiter.Config().policyFor(c.Request().Method, c.Path())
+
+			result, err := limiter.Take(c.Request().Context(), policyName, policy, Identify(c))
+			if err != nil {
+				logger.Error().Ctx(c.Request().Context()).Err(err).Msgf("Rate limiting %s failed, letting the request through", c.Path())
+				return next(c)
+			}
+			c.Set(countedKey, true)
+
+			if !result.Allowed {
+				return deny(c, policy, result)
+			}
+			setHeaders(c, policy, result)
+			return next(c)
+		}
+	}
+}
+
+// BeforeAuth limits callers per IP before authentication, so failed attempts are limited too.
+// It runs before the authentication middleware, with Middleware after it: requests that don't
+// reach Middleware, such as those failing authentication, are counted per IP under the route's
+// policy, and once that runs out the IP is denied before its credentials are checked.
+func BeforeAuth(limiter *Limiter) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx := c.Request().Context()
+			policyName, policy := limiter.Config().policyFor(c.Request().Method, c.Path())
+			client := "ip:" + c.RealIP()
+
+			result, err := limiter.Check(ctx, policyName, policy, client)
+			if err != nil {
+				logger.Error().Ctx(ctx).Err(err).Msgf("Rate limiting %s failed, letting the request through", c.Path())
+				return next(c)
+			}
+			if !result.Allowed {
+				return deny(c, policy, result)
+			}
+
+			err = next(c)
+			if counted, _ := c.Get(countedKey).(bool); !counted {
+				if _, err := limiter.Take(ctx, policyName, policy, client); err != nil {
+					logger.Error().Ctx(ctx).Err(err).Msgf("Rate limiting %s failed", c.Path())
+				}
+			}
+			return err
+		}
+	}
+}
+
+// setHeaders reports the limits of the caller.
+func setHeaders(c echo.Context, policy Policy, result *Result) {
+	header := c.Response().Header()
+	header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	header.Set("RateLimit-Reset", strconv.Itoa(seconds(result.ResetAfter)))
+	header.Set("RateLimit-Policy", policy.header())
+}
+
+// deny answers 429 with the limits and when to retry.
+func deny(c echo.Context, policy Policy, result *Result) error {
+	setHeaders(c, policy, result)
+	c.Response().Header().Set("Retry-After", strconv.Itoa(seconds(result.RetryAfter)))
+	return c.JSON(429, map[string]string{"error": "rate limit exceeded"})
+}
+
+// Identify returns who a request is limited as: its API key, user or service client when it is
+// authenticated, or else the client IP, which relies on Echo's IPExtractor being set up for the
+// proxies in front of the service.
+func Identify(c echo.Context) string {
+	if claims := auth.ClaimsFrom(c); claims != nil {
+		switch {
+		case claims.APIKeyID != "":
+			return "api_key:" + claims.APIKeyID
+		case claims.ClientID != "":
+			return "client:" + claims.ClientID
+		case claims.Subject != "":
+			return "user:" + claims.Subject
+		}
+	}
+	return "ip:" + c.RealIP()
+}
+
+// seconds rounds up, so clients don't retry a moment too early.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
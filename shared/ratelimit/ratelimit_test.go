@@ -0,0 +1,188 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"net/http/httptest"
+	"shared/auth"
+	"shared/config"
+	"testing"
+	"time"
+)
+
+// testLimiter limits every route to 3 requests at once, then one every 20 seconds.
+func testLimiter(t *testing.T) (*Limiter, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return NewLimiter(rdb, "test", &Config{Default: Policy{Limit: 3, Window: config.Duration(time.Minute)}}), mr
+}
+
+// fakeAuth lets through requests with the token "good", as user 1, like auth.Verifier.
+func fakeAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if c.Request().Header.Get("Authorization") != "Bearer good" {
+			return echo.NewHTTPError(http.StatusUnauthorized, "invalid token")
+		}
+		c.Set("claims", &auth.Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "1"}})
+		return next(c)
+	}
+}
+
+// gateway routes like the api-gateway does for routes needing authentication.
+func gateway(limiter *Limiter) *echo.Echo {
+	e := echo.New()
+	e.IPExtractor = echo.ExtractIPDirect()
+	e.GET("/orders", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, BeforeAuth(limiter), fakeAuth, Middleware(limiter))
+	return e
+}
+
+func get(e *echo.Echo, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestFailedAuthIsLimited(t *testing.T) {
+	limiter, _ := testLimiter(t)
+	e := gateway(limiter)
+
+	for i := 0; i < 3; i++ {
+		if rec := get(e, "bad"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: got %d, want 401", i+1, rec.Code)
+		}
+	}
+	rec := get(e, "bad")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("attempt 4: got %d, want 429", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") != "20" {
+		t.Errorf("Retry-After is %q, want 20", rec.Header().Get("Retry-After"))
+	}
+	// anonymous requests are limited per IP as well
+	if rec := get(e, ""); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("anonymous request: got %d, want 429", rec.Code)
+	}
+}
+
+func TestAuthenticatedNotCountedPerIP(t *testing.T) {
+	limiter, _ := testLimiter(t)
+	e := gateway(limiter)
+
+	// the user's requests count against the user, leaving the IP's limit to failed attempts
+	for i := 0; i < 3; i++ {
+		if rec := get(e, "good"); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: got %d, want 200", i+1, rec.Code)
+		}
+	}
+	if rec := get(e, "good"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("request 4: got %d, want 429", rec.Code)
+	}
+	if rec := get(e, "bad"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("failed attempt: got %d, want 401", rec.Code)
+	}
+}
+
+func TestTake(t *testing.T) {
+	limiter, mr := testLimiter(t)
+	now := time.Unix(1700000000, 0)
+	mr.SetTime(now)
+	// 6 a minute is one every 10 seconds, in bursts of 2
+	policy := Policy{Limit: 6, Window: config.Duration(time.Minute), Burst: 2}
+	take := func() *Result {
+		t.Helper()
+		result, err := limiter.Take(context.Background(), "test", policy, "user:1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	// the burst is allowed, counting down
+	for _, remaining := range []int{1, 0} {
+		result := take()
+		if !result.Allowed || result.Remaining != remaining || result.Limit != 2 {
+			t.Fatalf("got %+v, want allowed with %d remaining", result, remaining)
+		}
+	}
+	result := take()
+	if result.Allowed || result.Remaining != 0 || result.RetryAfter != 10*time.Second || result.ResetAfter != 20*time.Second {
+		t.Fatalf("got %+v, want denied for 10s", result)
+	}
+
+	// a request is allowed again after the emission interval, but not a moment before
+	mr.SetTime(now.Add(10*time.Second - time.Millisecond))
+	if result := take(); result.Allowed || result.RetryAfter != time.Millisecond {
+		t.Fatalf("got %+v before the interval, want denied", result)
+	}
+	mr.SetTime(now.Add(10 * time.Second))
+	if result := take(); !result.Allowed || result.Remaining != 0 {
+		t.Fatalf("got %+v after the interval, want allowed", result)
+	}
+
+	// idle for the window, the full burst is back
+	mr.SetTime(now.Add(time.Minute))
+	if result := take(); !result.Allowed || result.Remaining != 1 {
+		t.Fatalf("got %+v after the window, want allowed with 1 remaining", result)
+	}
+
+	// other clients and policies have their own state
+	other, err := limiter.Take(context.Background(), "test", policy, "user:2")
+	if err != nil || !other.Allowed || other.Remaining != 1 {
+		t.Errorf("other client got %+v, %v", other, err)
+	}
+}
+
+func TestCheckDoesNotCount(t *testing.T) {
+	limiter, _ := testLimiter(t)
+	policy := Policy{Limit: 1, Window: config.Duration(time.Minute)}
+	for i := 0; i < 3; i++ {
+		result, err := limiter.Check(context.Background(), "test", policy, "ip:192.0.2.1")
+		if err != nil || !result.Allowed || result.Remaining != 1 {
+			t.Fatalf("check %d got %+v, %v", i+1, result, err)
+		}
+	}
+	if result, _ := limiter.Take(context.Background(), "test", policy, "ip:192.0.2.1"); !result.Allowed {
+		t.Fatal("request denied after checks")
+	}
+	if result, _ := limiter.Check(context.Background(), "test", policy, "ip:192.0.2.1"); result.Allowed {
+		t.Error("check allowed after the limit ran out")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	limiter, mr := testLimiter(t)
+	e := gateway(limiter)
+
+	for _, remaining := range []string{"2", "1", "0"} {
+		rec := get(e, "good")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("got %d, want 200", rec.Code)
+		}
+		header := rec.Header()
+		if header.Get("RateLimit-Limit") != "3" || header.Get("RateLimit-Remaining") != remaining || header.Get("RateLimit-Policy") != "3;w=60;burst=3" {
+			t.Errorf("headers %v, want %s remaining", header, remaining)
+		}
+	}
+	rec := get(e, "good")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "20" || rec.Header().Get("RateLimit-Reset") != "60" {
+		t.Errorf("got %d with headers %v, want 429 retrying after 20s", rec.Code, rec.Header())
+	}
+
+	// requests are let through while Redis is down
+	mr.Close()
+	if rec := get(e, "good"); rec.Code != http.StatusOK {
+		t.Errorf("got %d with Redis down, want 200", rec.Code)
+	}
+}
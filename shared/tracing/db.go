@@ -0,0 +1,24 @@
+package tracing
+
+import (
+	"context"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+// Query records the span of a query to the database db, e.g. a shard, that ran from start until
+// now within the trace of ctx. op is the statement type, e.g. "select". The query is recorded
+// with its placeholders, without the arguments.
+func Query(ctx context.Context, system, db, op, query string, start time.Time, err error) {
+	_, span := startChild(ctx, op+" "+db,
+		trace.WithTimestamp(start),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemKey.String(system),
+			semconv.DBNamespace(db),
+			semconv.DBOperationName(op),
+			semconv.DBQueryText(query),
+		))
+	End(span, err)
+}
@@ -1,19 +1,41 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"github.com/go-redis/redis/v8"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
-	"golang.org/x/time/rate"
+	"path/filepath"
+	"shared/auth"
+	sharedconfig "shared/config"
+	"shared/health"
+	"shared/httpclient"
+	"shared/lifecycle"
+	"shared/logging"
+	"shared/metrics"
+	"shared/ratelimit"
+	"shared/sqldb"
+	"shared/tracing"
 	"time"
+	"user-management-service/internal/address"
 	"user-management-service/internal/api"
+	"user-management-service/internal/audit"
+	"user-management-service/internal/config"
+	"user-management-service/internal/keys"
+	"user-management-service/internal/loginguard"
+	"user-management-service/internal/notify"
 	"user-management-service/internal/repository"
 	"user-management-service/internal/service"
+	"user-management-service/internal/totp"
+	"user-management-service/migrations"
 )
 
-func connectDB() (*sql.DB, error) {
-	db, err := sql.Open("mysql", "root:@tcp(127.0.0.1:3306)/user-db")
+var logger = logging.Logger
+
+func connectDB(database sharedconfig.Database) (*sql.DB, error) {
+	db, err := sqldb.Open("mysql", database.DSN(), database.Name)
 	if err != nil {
 		return nil, err
 	}
@@ -21,60 +43,225 @@ func connectDB() (*sql.DB, error) {
 }
 
 func main() {
-	db, err := connectDB()
+	configFile := sharedconfig.File("config.yaml")
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to load config")
+	}
+	logging.Setup("user-management-service", cfg.Log)
+
+	// on SIGTERM requests are drained and connections closed
+	app := lifecycle.New(time.Duration(cfg.Server.ShutdownTimeout), time.Duration(cfg.Server.ShutdownDelay))
+
+	// spans are flushed after everything else is closed
+	shutdownTracing, err := tracing.Setup("user-management-service", cfg.Tracing)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to set up tracing")
+	}
+	app.OnShutdown("tracing", shutdownTracing)
+
+	// Prometheus scrapes /metrics on its own port
+	app.Go(func(ctx context.Context) {
+		if err := metrics.Serve(ctx, cfg.Metrics.Addr()); err != nil {
+			logger.Error().Err(err).Msg("Metrics server stopped")
+		}
+	})
+
+	db, err := connectDB(cfg.Database)
 	if err != nil {
 		panic(err)
 	}
+	app.Close("database", db)
+
+	err = migrations.AutoMigrateUsers(3, db)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to migrate users table")
+	}
+
+	err = migrations.AutoMigratePasswordHashes(db)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to migrate password hashes")
+	}
+
+	err = migrations.AutoMigrateRoles(3, db)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to migrate roles tables")
+	}
+
+	err = migrations.AutoMigrateServiceClients(3, db)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to migrate service_clients table")
+	}
+
+	err = migrations.AutoMigrateAccountTokens(3, db)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to migrate user_tokens table")
+	}
+
+	err = migrations.AutoMigrateAddresses(3, db)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to migrate addresses table")
+	}
+
+	err = migrations.AutoMigrateTwoFactor(3, db)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to migrate two-factor tables")
+	}
+
+	err = migrations.AutoMigrateAPIKeys(3, db)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to migrate API keys table")
+	}
 
 	// Initialize UserService
+	rdb := redis.NewClient(&redis.Options{
+		Addr:     cfg.Redis.Addr,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+	})
+	app.Close("redis", rdb)
+	rdb.AddHook(tracing.RedisHook())
+
 	userRepo := repository.NewUserRepository(db)
-	userService := service.NewUserService(*userRepo)
+	sessionRepo := repository.NewSessionRepository(rdb)
+	keyring, err := keys.Load(cfg.KeysDir, cfg.SigningKeyID)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to load signing keys")
+	}
+
+	notifier := notify.New(cfg.Notifier)
+	orderClient, err := httpclient.ForService(cfg.ServiceClient, cfg.TLS, "order-service")
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to create order-service client")
+	}
+
+	addressValidator, err := address.LoadFile(cfg.AddressRulesFile)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to load address rules")
+	}
+
+	// failed logins are counted in Redis, so lockouts hold across instances
+	captcha := loginguard.NewCaptchaVerifier(cfg.Captcha)
+	if captcha == nil {
+		logger.Warn().Msg("No CAPTCHA secret is configured, CAPTCHAs are signalled but not verified")
+	}
+	guard := loginguard.NewGuard(repository.NewAttemptRepository(rdb), captcha, audit.NewLogRecorder(logger), loginguard.DefaultPolicy)
+
+	// TOTP secrets are sealed with a key kept next to the signing keys
+	totpKeyFile := cfg.TOTPKeyFile
+	if totpKeyFile == "" {
+		totpKeyFile = filepath.Join(cfg.KeysDir, "totp.key")
+	}
+	totpSealer, err := totp.LoadSealer(totpKeyFile)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to load TOTP key")
+	}
+
+	userService := service.NewUserService(*userRepo, sessionRepo, auth.NewRevocationList(rdb), keyring, guard, totpSealer, notifier, cfg.AppURL, cfg.OrderServiceURL, httpclient.Resilient(orderClient, "order-service", cfg.HTTPClient), addressValidator)
 	userHandler := api.NewUserHandler(*userService)
 
+	// provision the credentials of the other services
+	if clientsFile := cfg.ServiceClientsFile; clientsFile != "" {
+		count, err := userService.LoadClientsFile(context.Background(), clientsFile)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to load service clients")
+		}
+		logger.Info().Msgf("Loaded %d service clients from %s", count, clientsFile)
+	}
+
 	e := echo.New()
+	// client IPs, e.g. of logins, are only read from X-Forwarded-For when the gateway sends it
+	e.IPExtractor = cfg.Server.IPExtractor()
 
-	config := middleware.RateLimiterConfig{
-		Skipper: middleware.DefaultSkipper,
-		Store: middleware.NewRateLimiterMemoryStoreWithConfig(
-			middleware.RateLimiterMemoryStoreConfig{
-				Rate:      rate.Limit(1),
-				Burst:     3,
-				ExpiresIn: 3 * time.Minute,
-			}),
-		IdentifierExtractor: func(context echo.Context) (string, error) {
-			// for local
-			return context.Request().RemoteAddr, nil
-			// for production
-			// return context.Request().Header.Get(echo.HeaderXRealIP), nil
-			// return ctx.RealIP(), nil
-		},
-		ErrorHandler: func(context echo.Context, err error) error {
-			return context.JSON(429, map[string]string{"error": "rate limit exceeded"})
-		},
-		DenyHandler: func(context echo.Context, identifier string, err error) error {
-			return context.JSON(429, map[string]string{"error": "rate limit exceeded"})
-		},
-	}
+	// a backstop per client IP, the gateway applies the limits per caller
+	limiter := ratelimit.NewLimiter(rdb, "user-management-service", &cfg.RateLimits)
+
+	// the log level and rate limits can be changed without a restart
+	app.Go(func(ctx context.Context) {
+		sharedconfig.Watch(ctx, configFile, 10*time.Second, func(reloaded *config.Config) {
+			reloaded.Log.Apply()
+			limiter.SetConfig(&reloaded.RateLimits)
+		}, func(err error) {
+			logger.Error().Err(err).Msg("Failed to reload config, keeping the current one")
+		})
+	})
 
 	// Middleware
 	e.Use(middleware.Recover())
-	e.Use(middleware.Logger())
-	e.Use(middleware.RateLimiterWithConfig(config))
+	e.Use(metrics.Middleware())
+	e.Use(tracing.Middleware())
+	e.Use(logging.Middleware())
+	e.Use(ratelimit.Middleware(limiter))
 
 	// Routes
+	e.GET("/users/me", userHandler.GetMe, userHandler.Authenticate)
+	e.PUT("/users/me", userHandler.UpdateProfile, userHandler.Authenticate)
+	e.DELETE("/users/me", userHandler.DeleteAccount, userHandler.Authenticate)
 	e.GET("/users/:id", userHandler.GetUserByID)
 	e.POST("/users", userHandler.CreateUser)
+	e.GET("/.well-known/jwks.json", userHandler.JWKS)
 	e.POST("/login", userHandler.Login)
-	e.GET("/users/validate", userHandler.ValidateSession)
+	e.POST("/login/2fa", userHandler.CompleteLogin)
+	e.POST("/login/2fa/enroll", userHandler.EnrollDuringLogin)
+	e.POST("/login/2fa/confirm", userHandler.ConfirmDuringLogin)
+	e.POST("/token/refresh", userHandler.RefreshToken)
+	e.GET("/users/validate", userHandler.ValidateSession, userHandler.Authenticate)
+	e.POST("/logout", userHandler.Logout, userHandler.Authenticate)
+	e.POST("/logout/all", userHandler.LogoutAll, userHandler.Authenticate)
+	e.GET("/sessions", userHandler.ListSessions, userHandler.Authenticate)
+	e.DELETE("/sessions/:id", userHandler.RevokeSession, userHandler.Authenticate)
 
-	e.GET("/users/health", func(c echo.Context) error {
-		return c.JSON(200, map[string]interface{}{
-			"status":  "ok",
-			"service": "user-service",
-			"time":    time.Now().Format(time.RFC3339),
-		})
-	})
+	// Account lifecycle
+	e.POST("/users/verify-email", userHandler.VerifyEmail)
+	e.POST("/users/verify-email/resend", userHandler.ResendVerification, userHandler.Authenticate)
+	e.POST("/password/forgot", userHandler.ForgotPassword)
+	e.POST("/password/reset", userHandler.ResetPassword)
+
+	// Two-factor authentication
+	e.GET("/2fa", userHandler.GetTwoFactorStatus, userHandler.Authenticate)
+	e.POST("/2fa/enroll", userHandler.EnrollTwoFactor, userHandler.Authenticate)
+	e.POST("/2fa/confirm", userHandler.ConfirmTwoFactor, userHandler.Authenticate)
+	e.POST("/2fa/disable", userHandler.DisableTwoFactor, userHandler.Authenticate)
+	e.POST("/2fa/recovery-codes", userHandler.RegenerateRecoveryCodes, userHandler.Authenticate)
+
+	// API keys for partner integrations, resolved by the other services through introspection
+	e.GET("/users/me/api-keys", userHandler.ListAPIKeys, userHandler.Authenticate)
+	e.POST("/users/me/api-keys", userHandler.CreateAPIKey, userHandler.Authenticate)
+	e.DELETE("/users/me/api-keys/:id", userHandler.RevokeAPIKey, userHandler.Authenticate)
+	e.POST("/api-keys/introspect", userHandler.IntrospectAPIKey, userHandler.Authenticate, auth.RequirePermission("api_keys:introspect"))
+
+	// Address book
+	e.GET("/users/me/addresses", userHandler.ListAddresses, userHandler.Authenticate)
+	e.POST("/users/me/addresses", userHandler.CreateAddress, userHandler.Authenticate)
+	e.GET("/users/me/addresses/:id", userHandler.GetAddress, userHandler.Authenticate)
+	e.PUT("/users/me/addresses/:id", userHandler.UpdateAddress, userHandler.Authenticate)
+	e.DELETE("/users/me/addresses/:id", userHandler.DeleteAddress, userHandler.Authenticate)
+	e.GET("/users/:id/addresses", userHandler.ListUserAddresses, userHandler.Authenticate, auth.RequirePermission("addresses:read"))
+
+	// Role management
+	usersAdmin := []echo.MiddlewareFunc{userHandler.Authenticate, auth.RequirePermission("users:admin")}
+	e.GET("/roles", userHandler.ListRoles, usersAdmin...)
+	e.POST("/users/:id/roles", userHandler.AssignRole, usersAdmin...)
+	e.DELETE("/users/:id/roles/:role", userHandler.RemoveRole, usersAdmin...)
+
+	// Service clients
+	e.POST("/oauth/token", userHandler.Token)
+	e.POST("/clients", userHandler.RegisterClient, usersAdmin...)
+	e.DELETE("/clients/:client_id", userHandler.DeactivateClient, usersAdmin...)
+
+	checker := health.NewChecker("user-service", app.Context())
+	checker.Add("mysql", true, health.DB(db))
+	checker.Add("redis", true, health.Redis(rdb))
+	// only account deletion needs order-service
+	checker.Add("order-service", false, health.HTTP(orderClient, cfg.OrderServiceURL+"/orders/health/live"))
+	checker.Add("circuit:order-service", false, httpclient.Circuit("order-service"))
+	checker.Register(e, "/users/health")
 
 	// Start server
-	e.Logger.Fatal(e.Start(":8080"))
+	err = app.Serve(e, func() error {
+		return e.Start(cfg.Server.Addr())
+	})
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Server stopped")
+	}
 }
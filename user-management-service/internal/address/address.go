@@ -0,0 +1,144 @@
+// Package address validates addresses against per-country rules loaded from a data file, so
+// countries can be added or corrected without a deploy.
+package address
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"user-management-service/internal/entity"
+)
+
+// CountryRules are the address requirements of one country.
+type CountryRules struct {
+	Name               string   `json:"name"`
+	PostalCodeRequired bool     `json:"postal_code_required"`
+	PostalCodePattern  string   `json:"postal_code_pattern"` // Regular expression the whole postal code must match
+	RegionRequired     bool     `json:"region_required"`
+	Regions            []string `json:"regions"` // Allowed region codes, any region is accepted when empty
+
+	postalCode *regexp.Regexp
+}
+
+// Rules is the address configuration loaded from a data file.
+type Rules struct {
+	Countries map[string]*CountryRules `json:"countries"` // ISO 3166-1 alpha-2 code -> rules
+	Default   *CountryRules            `json:"default"`   // Rules of unlisted countries, which are rejected when nil
+}
+
+// ValidationError lists the invalid fields of an address.
+type ValidationError struct {
+	Fields map[string]string `json:"fields"` // Field -> problem
+}
+
+func (e *ValidationError) Error() string {
+	problems := make([]string, 0, len(e.Fields))
+	for field, problem := range e.Fields {
+		problems = append(problems, field+" "+problem)
+	}
+	slices.Sort(problems)
+	return "invalid address: " + strings.Join(problems, ", ")
+}
+
+// Validator checks addresses against the rules of their country.
+type Validator struct {
+	rules *Rules
+}
+
+// NewValidator creates a validator from rules, compiling their postal code patterns.
+func NewValidator(rules *Rules) (*Validator, error) {
+	normalized := make(map[string]*CountryRules, len(rules.Countries))
+	for code, country := range rules.Countries {
+		if err := country.compile(); err != nil {
+			return nil, fmt.Errorf("invalid postal code pattern for %s: %v", code, err)
+		}
+		normalized[strings.ToUpper(code)] = country
+	}
+	rules.Countries = normalized
+
+	if rules.Default != nil {
+		if err := rules.Default.compile(); err != nil {
+			return nil, fmt.Errorf("invalid default postal code pattern: %v", err)
+		}
+	}
+
+	return &Validator{rules: rules}, nil
+}
+
+// LoadFile creates a validator from a JSON rules file.
+func LoadFile(path string) (*Validator, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules Rules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("could not parse address rules %s: %v", path, err)
+	}
+
+	return NewValidator(&rules)
+}
+
+func (c *CountryRules) compile() error {
+	if c.PostalCodePattern == "" {
+		return nil
+	}
+	pattern, err := regexp.Compile("^(?:" + c.PostalCodePattern + ")$")
+	if err != nil {
+		return err
+	}
+	c.postalCode = pattern
+	return nil
+}
+
+// Validate normalizes an address (trimmed fields, upper case country, region and postal code)
+// and checks it against the rules of its country.
+func (v *Validator) Validate(address *entity.Address) error {
+	address.Name = strings.TrimSpace(address.Name)
+	address.Line1 = strings.TrimSpace(address.Line1)
+	address.Line2 = strings.TrimSpace(address.Line2)
+	address.City = strings.TrimSpace(address.City)
+	address.Region = strings.ToUpper(strings.TrimSpace(address.Region))
+	address.PostalCode = strings.ToUpper(strings.TrimSpace(address.PostalCode))
+	address.Country = strings.ToUpper(strings.TrimSpace(address.Country))
+	address.Phone = strings.TrimSpace(address.Phone)
+
+	problems := make(map[string]string)
+	for field, value := range map[string]string{"name": address.Name, "line1": address.Line1, "city": address.City} {
+		if value == "" {
+			problems[field] = "is required"
+		}
+	}
+
+	rules, ok := v.rules.Countries[address.Country]
+	if !ok {
+		rules = v.rules.Default
+	}
+	if rules == nil {
+		problems["country"] = "is not supported"
+		return &ValidationError{Fields: problems}
+	}
+
+	switch {
+	case address.PostalCode == "" && rules.PostalCodeRequired:
+		problems["postal_code"] = "is required"
+	case address.PostalCode != "" && rules.postalCode != nil && !rules.postalCode.MatchString(address.PostalCode):
+		problems["postal_code"] = "has an invalid format"
+	}
+
+	switch {
+	case address.Region == "" && rules.RegionRequired:
+		problems["region"] = "is required"
+	case address.Region != "" && len(rules.Regions) > 0 && !slices.Contains(rules.Regions, address.Region):
+		problems["region"] = "is not a valid region"
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Fields: problems}
+	}
+	return nil
+}
@@ -1,10 +1,19 @@
 package api
 
 import (
+	"errors"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
+	"math"
+	"net/url"
+	"shared/auth"
 	"strconv"
+	"strings"
+	"time"
+	"user-management-service/internal/address"
 	"user-management-service/internal/entity"
+	"user-management-service/internal/loginguard"
+	"user-management-service/internal/repository"
 	"user-management-service/internal/service"
 )
 
@@ -53,44 +62,797 @@ func (h *UserHandler) CreateUser(c echo.Context) error {
 	return c.JSON(200, createdUser)
 }
 
-// Login logs in a user --> /users/login
+// Login logs in a user and opens a session for the device --> /login
 func (h *UserHandler) Login(c echo.Context) error {
 	ctx := c.Request().Context()
 
 	login := struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email        string `json:"email"`
+		Password     string `json:"password"`
+		Device       string `json:"device"`
+		CaptchaToken string `json:"captcha_token"`
 	}{}
 
 	if err := c.Bind(&login); err != nil {
 		return c.JSON(400, map[string]string{"error": "Invalid request payload"})
 	}
 
-	token, err := h.userService.Login(ctx, login.Email, login.Password)
+	device := entity.DeviceInfo{
+		Device:    login.Device,
+		UserAgent: c.Request().UserAgent(),
+		IP:        c.RealIP(),
+	}
+	result, err := h.userService.Login(ctx, login.Email, login.Password, login.CaptchaToken, device)
+	if err != nil {
+		var throttled *loginguard.ThrottledError
+		switch {
+		case errors.As(err, &throttled):
+			c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+			return c.JSON(429, map[string]string{"error": err.Error()})
+		case errors.Is(err, loginguard.ErrCaptchaRequired):
+			return c.JSON(401, map[string]interface{}{"error": err.Error(), "captcha_required": true})
+		case errors.Is(err, service.ErrInvalidCredentials):
+			return c.JSON(401, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	// a result with a challenge token instead of tokens asks for the second factor
+	return c.JSON(200, result)
+}
+
+// RefreshToken exchanges a refresh token for new tokens --> /token/refresh
+func (h *UserHandler) RefreshToken(c echo.Context) error {
+	request := struct {
+		RefreshToken string `json:"refresh_token"`
+	}{}
+
+	if err := c.Bind(&request); err != nil || request.RefreshToken == "" {
+		return c.JSON(400, map[string]string{"error": "Invalid request payload"})
+	}
+
+	tokens, err := h.userService.Refresh(c.Request().Context(), request.RefreshToken)
 	if err != nil {
 		return c.JSON(401, map[string]string{"error": err.Error()})
 	}
 
-	return c.JSON(200, map[string]string{"token": token})
+	return c.JSON(200, tokens)
 }
 
-// ValidateSession validates a session token --> /users/validate
+// JWKS publishes the public keys access tokens are signed with --> /.well-known/jwks.json
+func (h *UserHandler) JWKS(c echo.Context) error {
+	set, err := h.userService.JWKS()
+	if err != nil {
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	// verifiers cache the keys, but not for longer than it takes to roll out a new key
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.JSON(200, set)
+}
+
+// Authenticate is a middleware that accepts requests with a valid access token of an active
+// session, and stores its claims in the context under "claims".
+func (h *UserHandler) Authenticate(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		token, found := strings.CutPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
+		if !found || token == "" {
+			return c.JSON(401, map[string]string{"error": "Unauthorized"})
+		}
+
+		claims, err := h.userService.ValidateToken(c.Request().Context(), token)
+		if err != nil {
+			return c.JSON(401, map[string]string{"error": err.Error()})
+		}
+
+		c.Set("claims", claims)
+		return next(c)
+	}
+}
+
+// ValidateSession validates an access token --> /users/validate
 func (h *UserHandler) ValidateSession(c echo.Context) error {
-	ctx := c.Request().Context()
+	claims := c.Get("claims").(*auth.Claims)
+
+	return c.JSON(200, map[string]interface{}{
+		"message":    "Session is valid",
+		"user_id":    claims.Subject,
+		"session_id": claims.SessionID,
+		"expires_at": claims.ExpiresAt,
+	})
+}
+
+// Logout ends the session of the access token --> /logout
+func (h *UserHandler) Logout(c echo.Context) error {
+	claims := c.Get("claims").(*auth.Claims)
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return c.JSON(401, map[string]string{"error": "Unauthorized"})
+	}
+
+	err = h.userService.RevokeSession(c.Request().Context(), userID, claims.SessionID)
+	if err != nil {
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(200, map[string]string{"message": "Logged out"})
+}
+
+// LogoutAll ends every session of the user --> /logout/all
+func (h *UserHandler) LogoutAll(c echo.Context) error {
+	claims := c.Get("claims").(*auth.Claims)
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return c.JSON(401, map[string]string{"error": "Unauthorized"})
+	}
+
+	err = h.userService.RevokeAllSessions(c.Request().Context(), userID)
+	if err != nil {
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(200, map[string]string{"message": "Logged out of all sessions"})
+}
+
+// ListSessions lists the user's active sessions --> /sessions
+func (h *UserHandler) ListSessions(c echo.Context) error {
+	claims := c.Get("claims").(*auth.Claims)
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return c.JSON(401, map[string]string{"error": "Unauthorized"})
+	}
+
+	sessions, err := h.userService.ListSessions(c.Request().Context(), userID, claims.SessionID)
+	if err != nil {
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(200, sessions)
+}
+
+// RevokeSession ends one of the user's sessions --> /sessions/:id
+func (h *UserHandler) RevokeSession(c echo.Context) error {
+	claims := c.Get("claims").(*auth.Claims)
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return c.JSON(401, map[string]string{"error": "Unauthorized"})
+	}
+
+	err = h.userService.RevokeSession(c.Request().Context(), userID, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, repository.ErrSessionNotFound) {
+			return c.JSON(404, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(200, map[string]string{"message": "Session revoked"})
+}
+
+// ListRoles lists the roles and their permissions --> /roles
+func (h *UserHandler) ListRoles(c echo.Context) error {
+	roles, err := h.userService.ListRoles(c.Request().Context())
+	if err != nil {
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(200, roles)
+}
+
+// AssignRole gives a role to a user --> /users/:id/roles
+func (h *UserHandler) AssignRole(c echo.Context) error {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid ID"})
+	}
+
+	request := struct {
+		Role string `json:"role"`
+	}{}
+	if err := c.Bind(&request); err != nil || request.Role == "" {
+		return c.JSON(400, map[string]string{"error": "Invalid request payload"})
+	}
+
+	err = h.userService.AssignRole(c.Request().Context(), userID, request.Role)
+	if err != nil {
+		if errors.Is(err, repository.ErrRoleNotFound) {
+			return c.JSON(404, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(200, map[string]string{"message": "Role assigned"})
+}
+
+// RemoveRole takes a role away from a user --> /users/:id/roles/:role
+func (h *UserHandler) RemoveRole(c echo.Context) error {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid ID"})
+	}
+
+	err = h.userService.RemoveRole(c.Request().Context(), userID, c.Param("role"))
+	if err != nil {
+		if errors.Is(err, repository.ErrRoleNotFound) {
+			return c.JSON(404, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(200, map[string]string{"message": "Role removed"})
+}
+
+// Token issues service tokens with the client credentials grant --> /oauth/token
+// Credentials are read from HTTP basic auth, or from the client_id and client_secret form fields.
+func (h *UserHandler) Token(c echo.Context) error {
+	if c.FormValue("grant_type") != "client_credentials" {
+		return c.JSON(400, map[string]string{"error": "unsupported_grant_type"})
+	}
+
+	clientID, secret, ok := c.Request().BasicAuth()
+	if ok {
+		// RFC 6749 form-encodes the credentials before basic auth
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID, secret = c.FormValue("client_id"), c.FormValue("client_secret")
+	}
+
+	audience := c.FormValue("audience")
+	if audience == "" {
+		return c.JSON(400, map[string]string{"error": "invalid_request", "error_description": "audience is required"})
+	}
+
+	token, err := h.userService.IssueServiceToken(c.Request().Context(), clientID, secret, audience, c.FormValue("scope"))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidClient):
+			return c.JSON(401, map[string]string{"error": err.Error()})
+		case errors.Is(err, service.ErrInvalidTarget), errors.Is(err, service.ErrInvalidScope):
+			return c.JSON(400, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(200, token)
+}
+
+// RegisterClient registers a service client --> /clients
+func (h *UserHandler) RegisterClient(c echo.Context) error {
+	client := entity.ServiceClient{}
+	if err := c.Bind(&client); err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid request payload"})
+	}
+
+	createdClient, err := h.userService.RegisterClient(c.Request().Context(), &client)
+	if err != nil {
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(200, createdClient)
+}
+
+// DeactivateClient deactivates a service client and revokes its tokens --> /clients/:client_id
+func (h *UserHandler) DeactivateClient(c echo.Context) error {
+	err := h.userService.DeactivateClient(c.Request().Context(), c.Param("client_id"))
+	if err != nil {
+		if errors.Is(err, repository.ErrClientNotFound) {
+			return c.JSON(404, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(200, map[string]string{"message": "Client deactivated"})
+}
+
+// GetMe returns the caller's account --> /users/me
+func (h *UserHandler) GetMe(c echo.Context) error {
+	userID, err := auth.ClaimsFrom(c).UserID()
+	if err != nil {
+		return c.JSON(401, map[string]string{"error": "Unauthorized"})
+	}
+
+	user, err := h.userService.GetMe(c.Request().Context(), userID)
+	if err != nil {
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(200, user)
+}
+
+// UpdateProfile changes the caller's username, email or password --> /users/me
+func (h *UserHandler) UpdateProfile(c echo.Context) error {
+	claims := auth.ClaimsFrom(c)
+	userID, err := claims.UserID()
+	if err != nil {
+		return c.JSON(401, map[string]string{"error": "Unauthorized"})
+	}
+
+	update := entity.ProfileUpdate{}
+	if err := c.Bind(&update); err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid request payload"})
+	}
+
+	user, err := h.userService.UpdateProfile(c.Request().Context(), userID, claims.SessionID, update)
+	if err != nil {
+		if errors.Is(err, service.ErrWrongPassword) {
+			return c.JSON(403, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(200, user)
+}
+
+// DeleteAccount deletes the caller's account and erases their order data --> /users/me
+func (h *UserHandler) DeleteAccount(c echo.Context) error {
+	userID, err := auth.ClaimsFrom(c).UserID()
+	if err != nil {
+		return c.JSON(401, map[string]string{"error": "Unauthorized"})
+	}
+
+	request := struct {
+		Password string `json:"password"`
+	}{}
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid request payload"})
+	}
+
+	err = h.userService.DeleteAccount(c.Request().Context(), userID, request.Password)
+	if err != nil {
+		if errors.Is(err, service.ErrWrongPassword) {
+			return c.JSON(403, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(200, map[string]string{"message": "Account deleted"})
+}
+
+// VerifyEmail confirms an email address with the token sent to it --> /users/verify-email
+func (h *UserHandler) VerifyEmail(c echo.Context) error {
+	request := struct {
+		Token string `json:"token"`
+	}{}
+	if err := c.Bind(&request); err != nil || request.Token == "" {
+		return c.JSON(400, map[string]string{"error": "Invalid request payload"})
+	}
+
+	err := h.userService.VerifyEmail(c.Request().Context(), request.Token)
+	if err != nil {
+		if errors.Is(err, repository.ErrTokenInvalid) {
+			return c.JSON(400, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(200, map[string]string{"message": "Email verified"})
+}
+
+// ResendVerification sends a new verification email to the caller --> /users/verify-email/resend
+func (h *UserHandler) ResendVerification(c echo.Context) error {
+	userID, err := auth.ClaimsFrom(c).UserID()
+	if err != nil {
+		return c.JSON(401, map[string]string{"error": "Unauthorized"})
+	}
+
+	err = h.userService.ResendVerification(c.Request().Context(), userID)
+	if err != nil {
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(200, map[string]string{"message": "Verification email sent"})
+}
+
+// ForgotPassword sends a password reset link --> /password/forgot
+// The response is the same whether or not the email belongs to an account.
+func (h *UserHandler) ForgotPassword(c echo.Context) error {
+	request := struct {
+		Email string `json:"email"`
+	}{}
+	if err := c.Bind(&request); err != nil || request.Email == "" {
+		return c.JSON(400, map[string]string{"error": "Invalid request payload"})
+	}
+
+	err := h.userService.ForgotPassword(c.Request().Context(), request.Email)
+	if err != nil {
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(200, map[string]string{"message": "If the email belongs to an account, a reset link has been sent"})
+}
+
+// ResetPassword sets a new password with a reset token --> /password/reset
+func (h *UserHandler) ResetPassword(c echo.Context) error {
+	request := struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}{}
+	if err := c.Bind(&request); err != nil || request.Token == "" {
+		return c.JSON(400, map[string]string{"error": "Invalid request payload"})
+	}
+
+	err := h.userService.ResetPassword(c.Request().Context(), request.Token, request.Password)
+	if err != nil {
+		if errors.Is(err, repository.ErrTokenInvalid) {
+			return c.JSON(400, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(200, map[string]string{"message": "Password reset, please log in again"})
+}
+
+// ListAddresses lists the caller's address book --> /users/me/addresses
+func (h *UserHandler) ListAddresses(c echo.Context) error {
+	userID, err := auth.ClaimsFrom(c).UserID()
+	if err != nil {
+		return c.JSON(401, map[string]string{"error": "Unauthorized"})
+	}
+
+	addresses, err := h.userService.ListAddresses(c.Request().Context(), userID)
+	if err != nil {
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(200, addresses)
+}
+
+// GetAddress returns one of the caller's addresses --> /users/me/addresses/:id
+func (h *UserHandler) GetAddress(c echo.Context) error {
+	userID, err := auth.ClaimsFrom(c).UserID()
+	if err != nil {
+		return c.JSON(401, map[string]string{"error": "Unauthorized"})
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid ID"})
+	}
+
+	address, err := h.userService.GetAddress(c.Request().Context(), userID, id)
+	if err != nil {
+		return addressError(c, err)
+	}
+
+	return c.JSON(200, address)
+}
+
+// CreateAddress adds an address to the caller's address book --> /users/me/addresses
+func (h *UserHandler) CreateAddress(c echo.Context) error {
+	userID, err := auth.ClaimsFrom(c).UserID()
+	if err != nil {
+		return c.JSON(401, map[string]string{"error": "Unauthorized"})
+	}
+
+	address := entity.Address{}
+	if err := c.Bind(&address); err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid request payload"})
+	}
+
+	created, err := h.userService.CreateAddress(c.Request().Context(), userID, &address)
+	if err != nil {
+		return addressError(c, err)
+	}
+
+	return c.JSON(200, created)
+}
+
+// UpdateAddress changes one of the caller's addresses --> /users/me/addresses/:id
+func (h *UserHandler) UpdateAddress(c echo.Context) error {
+	userID, err := auth.ClaimsFrom(c).UserID()
+	if err != nil {
+		return c.JSON(401, map[string]string{"error": "Unauthorized"})
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid ID"})
+	}
+
+	address := entity.Address{}
+	if err := c.Bind(&address); err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid request payload"})
+	}
+
+	updated, err := h.userService.UpdateAddress(c.Request().Context(), userID, id, &address)
+	if err != nil {
+		return addressError(c, err)
+	}
+
+	return c.JSON(200, updated)
+}
+
+// DeleteAddress removes one of the caller's addresses --> /users/me/addresses/:id
+func (h *UserHandler) DeleteAddress(c echo.Context) error {
+	userID, err := auth.ClaimsFrom(c).UserID()
+	if err != nil {
+		return c.JSON(401, map[string]string{"error": "Unauthorized"})
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid ID"})
+	}
+
+	err = h.userService.DeleteAddress(c.Request().Context(), userID, id)
+	if err != nil {
+		return addressError(c, err)
+	}
+
+	return c.JSON(200, map[string]string{"message": "Address deleted"})
+}
+
+// ListUserAddresses lists the address book of any user, for support staff and for order-service
+// copying addresses onto orders --> /users/:id/addresses
+func (h *UserHandler) ListUserAddresses(c echo.Context) error {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid ID"})
+	}
+
+	addresses, err := h.userService.ListAddresses(c.Request().Context(), userID)
+	if err != nil {
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(200, addresses)
+}
+
+func addressError(c echo.Context, err error) error {
+	var invalid *address.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		return c.JSON(400, map[string]interface{}{"error": err.Error(), "fields": invalid.Fields})
+	case errors.Is(err, repository.ErrAddressNotFound):
+		return c.JSON(404, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(500, map[string]string{"error": err.Error()})
+}
+
+// CompleteLogin finishes a login with a TOTP or recovery code --> /login/2fa
+func (h *UserHandler) CompleteLogin(c echo.Context) error {
+	request := struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+	}{}
+	if err := c.Bind(&request); err != nil || request.ChallengeToken == "" || request.Code == "" {
+		return c.JSON(400, map[string]string{"error": "Invalid request payload"})
+	}
+
+	result, err := h.userService.CompleteLogin(c.Request().Context(), request.ChallengeToken, request.Code)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.JSON(200, result)
+}
+
+// EnrollDuringLogin starts the 2FA setup required to finish a login --> /login/2fa/enroll
+func (h *UserHandler) EnrollDuringLogin(c echo.Context) error {
+	request := struct {
+		ChallengeToken string `json:"challenge_token"`
+	}{}
+	if err := c.Bind(&request); err != nil || request.ChallengeToken == "" {
+		return c.JSON(400, map[string]string{"error": "Invalid request payload"})
+	}
+
+	enrollment, err := h.userService.EnrollDuringLogin(c.Request().Context(), request.ChallengeToken)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.JSON(200, enrollment)
+}
+
+// ConfirmDuringLogin enables 2FA and finishes the login --> /login/2fa/confirm
+func (h *UserHandler) ConfirmDuringLogin(c echo.Context) error {
+	request := struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+	}{}
+	if err := c.Bind(&request); err != nil || request.ChallengeToken == "" || request.Code == "" {
+		return c.JSON(400, map[string]string{"error": "Invalid request payload"})
+	}
+
+	result, err := h.userService.ConfirmDuringLogin(c.Request().Context(), request.ChallengeToken, request.Code)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.JSON(200, result)
+}
+
+// GetTwoFactorStatus tells whether the caller has 2FA and must have it --> /2fa
+func (h *UserHandler) GetTwoFactorStatus(c echo.Context) error {
+	userID, err := auth.ClaimsFrom(c).UserID()
+	if err != nil {
+		return c.JSON(401, map[string]string{"error": "Unauthorized"})
+	}
+
+	status, err := h.userService.GetTwoFactorStatus(c.Request().Context(), userID)
+	if err != nil {
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(200, status)
+}
 
-	token := c.Request().Header.Get("Authorization")
-	if token == "" {
+// EnrollTwoFactor starts setting up an authenticator app for the caller --> /2fa/enroll
+func (h *UserHandler) EnrollTwoFactor(c echo.Context) error {
+	userID, err := auth.ClaimsFrom(c).UserID()
+	if err != nil {
 		return c.JSON(401, map[string]string{"error": "Unauthorized"})
 	}
 
-	validateToken, err := h.userService.ValidateToken(ctx, token)
+	enrollment, err := h.userService.EnrollTwoFactor(c.Request().Context(), userID)
 	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.JSON(200, enrollment)
+}
+
+// ConfirmTwoFactor enables the caller's 2FA with a first code --> /2fa/confirm
+func (h *UserHandler) ConfirmTwoFactor(c echo.Context) error {
+	userID, err := auth.ClaimsFrom(c).UserID()
+	if err != nil {
+		return c.JSON(401, map[string]string{"error": "Unauthorized"})
+	}
+
+	request := struct {
+		Code string `json:"code"`
+	}{}
+	if err := c.Bind(&request); err != nil || request.Code == "" {
+		return c.JSON(400, map[string]string{"error": "Invalid request payload"})
+	}
+
+	codes, err := h.userService.ConfirmTwoFactor(c.Request().Context(), userID, request.Code)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.JSON(200, map[string][]string{"recovery_codes": codes})
+}
+
+// DisableTwoFactor removes the caller's 2FA --> /2fa/disable
+func (h *UserHandler) DisableTwoFactor(c echo.Context) error {
+	userID, err := auth.ClaimsFrom(c).UserID()
+	if err != nil {
+		return c.JSON(401, map[string]string{"error": "Unauthorized"})
+	}
+
+	request := struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}{}
+	if err := c.Bind(&request); err != nil || request.Code == "" {
+		return c.JSON(400, map[string]string{"error": "Invalid request payload"})
+	}
+
+	err = h.userService.DisableTwoFactor(c.Request().Context(), userID, request.Password, request.Code)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.JSON(200, map[string]string{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces the caller's recovery codes --> /2fa/recovery-codes
+func (h *UserHandler) RegenerateRecoveryCodes(c echo.Context) error {
+	userID, err := auth.ClaimsFrom(c).UserID()
+	if err != nil {
+		return c.JSON(401, map[string]string{"error": "Unauthorized"})
+	}
+
+	request := struct {
+		Code string `json:"code"`
+	}{}
+	if err := c.Bind(&request); err != nil || request.Code == "" {
+		return c.JSON(400, map[string]string{"error": "Invalid request payload"})
+	}
+
+	codes, err := h.userService.RegenerateRecoveryCodes(c.Request().Context(), userID, request.Code)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.JSON(200, map[string][]string{"recovery_codes": codes})
+}
+
+func twoFactorError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidChallenge), errors.Is(err, service.ErrInvalidTwoFactorCode):
 		return c.JSON(401, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrWrongPassword), errors.Is(err, service.ErrTwoFactorRequired):
+		return c.JSON(403, map[string]string{"error": err.Error()})
+	case errors.Is(err, repository.ErrTwoFactorNotFound):
+		return c.JSON(404, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrTwoFactorEnabled):
+		return c.JSON(409, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(500, map[string]string{"error": err.Error()})
+}
+
+// ListAPIKeys lists the caller's API keys --> /users/me/api-keys
+func (h *UserHandler) ListAPIKeys(c echo.Context) error {
+	userID, err := auth.ClaimsFrom(c).UserID()
+	if err != nil {
+		return c.JSON(401, map[string]string{"error": "Unauthorized"})
+	}
+
+	keys, err := h.userService.ListAPIKeys(c.Request().Context(), userID)
+	if err != nil {
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(200, keys)
+}
+
+// CreateAPIKey issues an API key for the caller, returned only in this response --> /users/me/api-keys
+func (h *UserHandler) CreateAPIKey(c echo.Context) error {
+	userID, err := auth.ClaimsFrom(c).UserID()
+	if err != nil {
+		return c.JSON(401, map[string]string{"error": "Unauthorized"})
+	}
+
+	request := struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}{}
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid request payload"})
+	}
+
+	key, err := h.userService.CreateAPIKey(c.Request().Context(), userID, request.Name, request.Scopes, request.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidScope) {
+			return c.JSON(403, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(400, map[string]string{"error": err.Error()})
 	}
 
-	if validateToken != token {
+	return c.JSON(201, key)
+}
+
+// RevokeAPIKey revokes one of the caller's API keys --> /users/me/api-keys/:id
+func (h *UserHandler) RevokeAPIKey(c echo.Context) error {
+	userID, err := auth.ClaimsFrom(c).UserID()
+	if err != nil {
 		return c.JSON(401, map[string]string{"error": "Unauthorized"})
 	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(400, map[string]string{"error": "Invalid ID"})
+	}
+
+	err = h.userService.RevokeAPIKey(c.Request().Context(), userID, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrAPIKeyNotFound) {
+			return c.JSON(404, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(200, map[string]string{"message": "API key revoked"})
+}
+
+// IntrospectAPIKey resolves an API key for the other services. Invalid keys are reported as
+// inactive, not as an error --> /api-keys/introspect
+func (h *UserHandler) IntrospectAPIKey(c echo.Context) error {
+	request := struct {
+		Key string `json:"key"`
+	}{}
+	if err := c.Bind(&request); err != nil || request.Key == "" {
+		return c.JSON(400, map[string]string{"error": "Invalid request payload"})
+	}
+
+	claims, err := h.userService.IntrospectAPIKey(c.Request().Context(), request.Key)
+	if errors.Is(err, auth.ErrInvalidAPIKey) {
+		return c.JSON(200, auth.APIKeyIntrospection{Active: false})
+	}
+	if err != nil {
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
 
-	return c.JSON(200, map[string]string{"message": "Session is valid"})
+	return c.JSON(200, auth.APIKeyIntrospection{Active: true, Claims: claims})
 }
@@ -0,0 +1,54 @@
+// Package config is the configuration of user-management-service.
+package config
+
+import (
+	sharedconfig "shared/config"
+	"shared/httpclient"
+	"shared/logging"
+	"shared/metrics"
+	"shared/mtls"
+	"shared/ratelimit"
+	"shared/tracing"
+	"user-management-service/internal/loginguard"
+	"user-management-service/internal/notify"
+)
+
+type Config struct {
+	Server        sharedconfig.Server      `yaml:"server"`
+	Metrics       metrics.Config           `yaml:"metrics"`
+	Tracing       tracing.Config           `yaml:"tracing"`
+	Log           logging.Config           `yaml:"log"`
+	Database      sharedconfig.Database    `yaml:"database" env:"DB_"`
+	Redis         sharedconfig.Redis       `yaml:"redis"`
+	RateLimits    ratelimit.Config         `yaml:"rate_limits"`
+	TLS           mtls.Files               `yaml:"tls"` // For calls to the other services
+	ServiceClient httpclient.Credentials   `yaml:"service_client"`
+	HTTPClient    httpclient.Policy        `yaml:"http_client"`
+	Notifier      notify.Config            `yaml:"notifier"`
+	Captcha       loginguard.CaptchaConfig `yaml:"captcha"`
+
+	KeysDir          string `yaml:"jwt_keys_dir" env:"JWT_KEYS_DIR" default:"keys"`
+	SigningKeyID     string `yaml:"jwt_signing_kid" env:"JWT_SIGNING_KID"` // The last kid if empty, see keys.Load
+	TOTPKeyFile      string `yaml:"totp_key_file" env:"TOTP_KEY_FILE"`     // totp.key in KeysDir if empty
+	AppURL           string `yaml:"app_url" env:"APP_URL" default:"http://localhost:8080"`
+	OrderServiceURL  string `yaml:"order_service_url" env:"ORDER_SERVICE_URL" default:"http://localhost:8082"`
+	AddressRulesFile string `yaml:"address_rules_file" env:"ADDRESS_RULES_FILE" default:"data/address_rules.json"`
+	// Optional, clients to provision at startup
+	ServiceClientsFile string `yaml:"service_clients_file" env:"SERVICE_CLIENTS_FILE"`
+}
+
+// Load reads and checks the config file, see sharedconfig.Load.
+func Load(path string) (*Config, error) {
+	config := &Config{}
+	if err := sharedconfig.Load(path, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (c *Config) Validate() error {
+	if err := sharedconfig.URL("app_url", c.AppURL); err != nil {
+		return err
+	}
+	return sharedconfig.URL("order_service_url", c.OrderServiceURL)
+}
@@ -0,0 +1,48 @@
+package entity
+
+import "time"
+
+// Address is an entry of a user's address book. Orders copy the address they ship to, so editing
+// or deleting it later doesn't change past orders.
+type Address struct {
+	ID              int       `json:"id"`
+	UserID          int       `json:"user_id"`
+	Label           string    `json:"label"` // e.g. "Home" or "Office"
+	Name            string    `json:"name"`  // Recipient
+	Line1           string    `json:"line1"`
+	Line2           string    `json:"line2"`
+	City            string    `json:"city"`
+	Region          string    `json:"region"` // State, province or prefecture, as required by the country
+	PostalCode      string    `json:"postal_code"`
+	Country         string    `json:"country"` // ISO 3166-1 alpha-2 code
+	Phone           string    `json:"phone"`
+	DefaultShipping bool      `json:"default_shipping"`
+	DefaultBilling  bool      `json:"default_billing"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+/*
+Mysql Schema:
+
+CREATE TABLE addresses (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	user_id INT NOT NULL,
+	label VARCHAR(50) NOT NULL DEFAULT '',
+	name VARCHAR(100) NOT NULL,
+	line1 VARCHAR(255) NOT NULL,
+	line2 VARCHAR(255) NOT NULL DEFAULT '',
+	city VARCHAR(100) NOT NULL,
+	region VARCHAR(100) NOT NULL DEFAULT '',
+	postal_code VARCHAR(20) NOT NULL DEFAULT '',
+	country CHAR(2) NOT NULL,
+	phone VARCHAR(30) NOT NULL DEFAULT '',
+	default_shipping BOOLEAN NOT NULL DEFAULT FALSE,
+	default_billing BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+	INDEX user_idx (user_id),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+*/
@@ -0,0 +1,38 @@
+package entity
+
+import "time"
+
+// APIKey lets a partner integration act as the user who created it, limited to the key's scopes.
+// Only the hash of the secret is stored; the key itself is only returned when it's created.
+type APIKey struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // Public part of the key, to tell keys apart
+	Key        string     `json:"key,omitempty"`
+	SecretHash string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+/*
+Mysql Schema:
+
+CREATE TABLE api_keys (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	user_id INT NOT NULL,
+	name VARCHAR(100) NOT NULL,
+	prefix VARCHAR(16) NOT NULL UNIQUE,
+	secret_hash CHAR(64) NOT NULL, -- SHA-256, the secrets are random
+	scopes TEXT NOT NULL, -- space separated
+	expires_at DATETIME NOT NULL,
+	last_used_at DATETIME NULL,
+	revoked_at DATETIME NULL, -- revoked keys are kept so orders made with them stay explained
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	INDEX user_idx (user_id),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+*/
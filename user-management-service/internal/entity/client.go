@@ -0,0 +1,39 @@
+package entity
+
+import "time"
+
+// ServiceClient is another service allowed to get service tokens with the client credentials flow.
+type ServiceClient struct {
+	ID          int       `json:"id"`
+	ClientID    string    `json:"client_id"`
+	Name        string    `json:"name"`
+	Secret      string    `json:"secret,omitempty"` // Only returned when the client is registered
+	SecretHash  string    `json:"-"`
+	Permissions []string  `json:"permissions"`
+	Audiences   []string  `json:"audiences"` // Services the client may call
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ServiceToken is the client credentials token response.
+type ServiceToken struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+/*
+Mysql Schema:
+
+CREATE TABLE service_clients (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	client_id VARCHAR(100) NOT NULL UNIQUE,
+	name VARCHAR(100) NOT NULL,
+	secret_hash VARCHAR(255) NOT NULL,
+	permissions TEXT NOT NULL, -- space separated
+	audiences TEXT NOT NULL, -- space separated
+	active BOOLEAN NOT NULL DEFAULT TRUE,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+*/
@@ -0,0 +1,45 @@
+package entity
+
+// Role is a named set of permissions assigned to users.
+type Role struct {
+	ID          int      `json:"id"`
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+}
+
+// DefaultRole is assigned to every new user.
+const DefaultRole = "customer"
+
+// DefaultRoles are created on startup if they don't exist. Permissions follow the
+// <resource>:<action>[:own] convention of shared/auth.
+var DefaultRoles = []Role{
+	{Name: "customer", Permissions: []string{"orders:read:own", "orders:write:own", "pricing:read", "inventory:read"}},
+	{Name: "support", Permissions: []string{"orders:read", "orders:write", "addresses:read", "pricing:read", "inventory:read"}},
+	{Name: "inventory_manager", Permissions: []string{"inventory:read", "inventory:write", "catalog:admin"}},
+	{Name: "pricing_admin", Permissions: []string{"pricing:read", "pricing:admin", "promotions:admin"}},
+	{Name: "admin", Permissions: []string{"*"}},
+}
+
+/*
+Mysql Schema:
+
+CREATE TABLE roles (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	name VARCHAR(50) NOT NULL UNIQUE
+);
+
+CREATE TABLE role_permissions (
+	role_id INT NOT NULL,
+	permission VARCHAR(100) NOT NULL,
+	PRIMARY KEY (role_id, permission),
+	FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE
+);
+
+CREATE TABLE user_roles (
+	user_id INT NOT NULL,
+	role_id INT NOT NULL,
+	PRIMARY KEY (user_id, role_id),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE
+);
+*/
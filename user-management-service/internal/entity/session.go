@@ -0,0 +1,43 @@
+package entity
+
+import "time"
+
+// Session is a login on one device. Its refresh token is rotated on every use and only its
+// hash is kept.
+type Session struct {
+	ID                  string    `json:"id"`
+	UserID              int       `json:"user_id"`
+	Device              string    `json:"device"`
+	UserAgent           string    `json:"user_agent"`
+	IP                  string    `json:"ip"`
+	CreatedAt           time.Time `json:"created_at"`
+	LastUsedAt          time.Time `json:"last_used_at"`
+	ExpiresAt           time.Time `json:"expires_at"`
+	Current             bool      `json:"current"` // Whether the session is the one making the request
+	RefreshHash         string    `json:"-"`
+	PreviousRefreshHash string    `json:"-"` // Used to detect reuse of a rotated token
+}
+
+// DeviceInfo describes the device a login comes from.
+type DeviceInfo struct {
+	Device    string
+	UserAgent string
+	IP        string
+}
+
+// TokenPair is returned by login and refresh.
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"` // Access token lifetime in seconds
+	SessionID    string `json:"session_id"`
+}
+
+/*
+Redis keys:
+
+session:<id>          JSON encoded Session, expires with the session
+user_sessions:<uid>   set of the user's session IDs
+revoked_session:<id>  revoked session, kept for the access token lifetime (see shared/auth)
+*/
@@ -0,0 +1,81 @@
+package entity
+
+import (
+	"strings"
+	"time"
+)
+
+// TwoFactor is the TOTP second factor of a user. It is pending until the user confirms it with a
+// first code.
+type TwoFactor struct {
+	UserID       int        `json:"user_id"`
+	Secret       string     `json:"-"` // Base32 TOTP secret, sealed in the database
+	Enabled      bool       `json:"enabled"`
+	LastUsedStep int64      `json:"-"` // Time step of the last accepted code, to reject replays
+	EnabledAt    *time.Time `json:"enabled_at,omitempty"`
+}
+
+// TwoFactorEnrollment is returned when a user starts enrolling an authenticator app.
+type TwoFactorEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"` // otpauth:// URI, usually shown as a QR code
+}
+
+// LoginChallenge is a login whose password was correct but which still needs a second factor.
+// It is referenced by a short-lived challenge token.
+type LoginChallenge struct {
+	UserID        int        `json:"user_id"`
+	Device        DeviceInfo `json:"device"`
+	SetupRequired bool       `json:"setup_required"` // The user must enroll first, their role requires 2FA
+	ExpiresAt     time.Time  `json:"expires_at"`
+}
+
+// LoginResult is the answer to a login: the tokens of the new session, or a challenge token when
+// a second factor is needed.
+type LoginResult struct {
+	*TokenPair
+	TwoFactorRequired      bool     `json:"two_factor_required,omitempty"`
+	TwoFactorSetupRequired bool     `json:"two_factor_setup_required,omitempty"`
+	ChallengeToken         string   `json:"challenge_token,omitempty"`
+	ChallengeExpiresIn     int      `json:"challenge_expires_in,omitempty"`
+	RecoveryCodes          []string `json:"recovery_codes,omitempty"` // Only when 2FA was just set up
+}
+
+// RequiresTwoFactor reports whether permissions are powerful enough that their holder must use a
+// second factor: the wildcard and any admin permission.
+func RequiresTwoFactor(permissions []string) bool {
+	for _, permission := range permissions {
+		if permission == "*" || strings.HasSuffix(permission, ":admin") {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Mysql Schema:
+
+CREATE TABLE user_two_factor (
+	user_id INT PRIMARY KEY,
+	secret VARCHAR(255) NOT NULL, -- AES-GCM sealed, base64
+	enabled BOOLEAN NOT NULL DEFAULT FALSE,
+	last_used_step BIGINT NOT NULL DEFAULT 0,
+	enabled_at DATETIME NULL,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+// single-use recovery codes, only their SHA-256 is stored
+CREATE TABLE user_recovery_codes (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	user_id INT NOT NULL,
+	code_hash CHAR(64) NOT NULL,
+	used_at DATETIME NULL,
+	UNIQUE INDEX user_code_idx (user_id, code_hash),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+Redis:
+
+login_challenge:<sha256 of token> -> JSON LoginChallenge, expires with the challenge
+login_challenge_attempts:<sha256 of token> -> wrong codes entered for the challenge
+*/
@@ -1,10 +1,28 @@
 package entity
 
 type User struct {
-	ID       int    `json:"id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Password string `json:"password"` // In production, you'd store hashed passwords.
+	ID            int      `json:"id"`
+	Username      string   `json:"username"`
+	Email         string   `json:"email"`
+	Password      string   `json:"password,omitempty"` // Only accepted on input, never returned
+	PasswordHash  string   `json:"-"`                  // argon2id hash stored in the password column
+	EmailVerified bool     `json:"email_verified"`
+	Roles         []string `json:"roles,omitempty"`
+}
+
+// Token purposes of single-use account tokens.
+const (
+	TokenVerifyEmail   = "verify_email"
+	TokenResetPassword = "reset_password"
+)
+
+// ProfileUpdate is a change to the caller's own account. Empty fields are left unchanged.
+// Changing the email or password requires the current password.
+type ProfileUpdate struct {
+	Username        string `json:"username"`
+	Email           string `json:"email"`
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
 }
 
 /*
@@ -16,12 +34,24 @@ CREATE TABLE users (
 	id INT AUTO_INCREMENT PRIMARY KEY,
 	username VARCHAR(50) NOT NULL,
 	email VARCHAR(50) NOT NULL,
-	password VARCHAR(255) NOT NULL
+	password VARCHAR(255) NOT NULL, -- argon2id hash in PHC format, never plaintext
+	email_verified BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+// single-use tokens sent by email, only their SHA-256 is stored
+CREATE TABLE user_tokens (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	user_id INT NOT NULL,
+	purpose VARCHAR(20) NOT NULL,
+	token_hash CHAR(64) NOT NULL UNIQUE,
+	expires_at DATETIME NOT NULL,
+	used_at DATETIME NULL,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 );
 
-// create index for email and password
+// create index for email
 CREATE UNIQUE INDEX email_idx ON users(email);
-CREATE INDEX password_idx ON users(password);
 
 
 
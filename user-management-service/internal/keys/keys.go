@@ -0,0 +1,156 @@
+// Package keys holds the private keys user-management-service signs access tokens with.
+//
+// Keys are PKCS#8 PEM files named <kid>.pem in a directory, Ed25519 or RSA. Tokens are signed
+// with the active key, and every key in the directory is published in the JWKS, so rotating a
+// key is: add the new file, make it active, and remove the old file once the tokens it signed
+// have expired.
+package keys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"os"
+	"path/filepath"
+	"shared/auth"
+	"sort"
+	"strings"
+	"time"
+)
+
+type signingKey struct {
+	method jwt.SigningMethod
+	key    crypto.Signer
+}
+
+// Keyring is the set of signing keys, one of which is active.
+type Keyring struct {
+	keys      map[string]signingKey
+	activeKid string
+}
+
+// Load reads the keys in dir. activeKid picks the signing key; when empty the last kid in
+// lexical order is used, so date based kids like "2024-06-01" rotate by adding a file. An empty
+// directory gets a freshly generated Ed25519 key.
+func Load(dir, activeKid string) (*Keyring, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		path, err := generate(dir)
+		if err != nil {
+			return nil, err
+		}
+		paths = []string{path}
+	}
+
+	ring := &Keyring{keys: make(map[string]signingKey, len(paths))}
+	kids := make([]string, 0, len(paths))
+	for _, path := range paths {
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		key, err := readKey(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not load key %s: %v", kid, err)
+		}
+		ring.keys[kid] = key
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	if activeKid == "" {
+		activeKid = kids[len(kids)-1]
+	}
+	if _, ok := ring.keys[activeKid]; !ok {
+		return nil, fmt.Errorf("active key %s is not in %s", activeKid, dir)
+	}
+	ring.activeKid = activeKid
+
+	return ring, nil
+}
+
+// Sign signs claims with the active key and sets the kid header.
+func (r *Keyring) Sign(claims jwt.Claims) (string, error) {
+	active := r.keys[r.activeKid]
+	token := jwt.NewWithClaims(active.method, claims)
+	token.Header["kid"] = r.activeKid
+	return token.SignedString(active.key)
+}
+
+// Keyfunc returns the public key of a token's kid, for jwt.Parse.
+func (r *Keyring) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := r.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	return key.key.Public(), nil
+}
+
+// JWKS returns the public keys of the keyring.
+func (r *Keyring) JWKS() (auth.JWKS, error) {
+	set := auth.JWKS{Keys: make([]auth.JWK, 0, len(r.keys))}
+	for kid, key := range r.keys {
+		jwk, err := auth.NewJWK(kid, key.key.Public())
+		if err != nil {
+			return auth.JWKS{}, err
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return set.Keys[i].Kid < set.Keys[j].Kid
+	})
+	return set, nil
+}
+
+func readKey(path string) (signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return signingKey{}, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return signingKey{}, errors.New("no PEM block")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return signingKey{}, err
+	}
+
+	switch key := parsed.(type) {
+	case ed25519.PrivateKey:
+		return signingKey{method: jwt.SigningMethodEdDSA, key: key}, nil
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < 2048 {
+			return signingKey{}, errors.New("RSA keys must be at least 2048 bits")
+		}
+		return signingKey{method: jwt.SigningMethodRS256, key: key}, nil
+	}
+	return signingKey{}, fmt.Errorf("unsupported key type %T", parsed)
+}
+
+// generate writes a new Ed25519 key to dir, named after the current date.
+func generate(dir string) (string, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, time.Now().UTC().Format("2006-01-02")+".pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	return path, os.WriteFile(path, data, 0o600)
+}
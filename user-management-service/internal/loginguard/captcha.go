@@ -0,0 +1,70 @@
+package loginguard
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// CaptchaVerifier checks the token of a solved CAPTCHA.
+type CaptchaVerifier interface {
+	Verify(ctx context.Context, token, ip string) (bool, error)
+}
+
+// SiteVerifier verifies CAPTCHA tokens with a siteverify endpoint. reCAPTCHA, hCaptcha and
+// Turnstile share this API.
+type SiteVerifier struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+func NewSiteVerifier(verifyURL, secret string) *SiteVerifier {
+	return &SiteVerifier{url: verifyURL, secret: secret, client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+func (v *SiteVerifier) Verify(ctx context.Context, token, ip string) (bool, error) {
+	form := url.Values{"secret": {v.secret}, "response": {token}, "remoteip": {ip}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("captcha verification returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, err
+	}
+	return result.Success, nil
+}
+
+// CaptchaConfig is the captcha section of the service's config.
+type CaptchaConfig struct {
+	Secret    string `yaml:"secret" env:"CAPTCHA_SECRET"`
+	VerifyURL string `yaml:"verify_url" env:"CAPTCHA_VERIFY_URL" default:"https://www.google.com/recaptcha/api/siteverify"`
+}
+
+// NewCaptchaVerifier creates a verifier from config. It returns nil without a secret, in which
+// case CAPTCHAs are signalled but not checked.
+func NewCaptchaVerifier(config CaptchaConfig) CaptchaVerifier {
+	if config.Secret == "" {
+		return nil
+	}
+	return NewSiteVerifier(config.VerifyURL, config.Secret)
+}
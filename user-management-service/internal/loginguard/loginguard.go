@@ -0,0 +1,222 @@
+// Package loginguard protects logins against password guessing and credential stuffing. Failed
+// logins are counted per account and per IP: repeated failures slow the account down with an
+// exponential backoff, then require a CAPTCHA, then lock the account or IP for a while.
+package loginguard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"user-management-service/internal/audit"
+	"user-management-service/internal/repository"
+)
+
+// ErrCaptchaRequired is returned when a login needs a solved CAPTCHA, because of the failures
+// before it.
+var ErrCaptchaRequired = errors.New("captcha required")
+
+// ThrottledError is returned for logins attempted during a backoff or lockout.
+type ThrottledError struct {
+	RetryAfter time.Duration
+	Locked     bool // A lockout rather than a backoff
+}
+
+func (e *ThrottledError) Error() string {
+	if e.Locked {
+		return "too many failed logins, try again later"
+	}
+	return fmt.Sprintf("too many failed logins, retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+// Policy sets the thresholds of the guard. Account thresholds count the failures of one email,
+// IP thresholds the failures from one address across all emails.
+type Policy struct {
+	Window         time.Duration // Failures are forgotten after this long without another one
+	BackoffAfter   int           // Account failures before logins are slowed down
+	BackoffBase    time.Duration // First backoff, doubled with every further failure
+	BackoffMax     time.Duration
+	CaptchaAfter   int // Account failures before a CAPTCHA is required
+	IPCaptchaAfter int // IP failures before a CAPTCHA is required
+	LockAfter      int // Account failures before the account is locked
+	LockDuration   time.Duration
+	IPLockAfter    int // IP failures before the IP is locked
+	IPLockDuration time.Duration
+}
+
+// DefaultPolicy tolerates a few typos, and locks accounts long enough to make guessing useless
+// without locking their owners out for long.
+var DefaultPolicy = Policy{
+	Window:         time.Hour,
+	BackoffAfter:   3,
+	BackoffBase:    time.Second,
+	BackoffMax:     time.Minute,
+	CaptchaAfter:   5,
+	IPCaptchaAfter: 20,
+	LockAfter:      10,
+	LockDuration:   15 * time.Minute,
+	IPLockAfter:    100,
+	IPLockDuration: time.Hour,
+}
+
+// Attempt is a login attempt.
+type Attempt struct {
+	Email        string
+	IP           string
+	UserAgent    string
+	CaptchaToken string
+}
+
+// Guard applies a policy to login attempts.
+type Guard struct {
+	attempts *repository.AttemptRepository
+	captcha  CaptchaVerifier // Optional, CAPTCHAs are only signalled without one
+	audit    audit.Recorder
+	policy   Policy
+}
+
+func NewGuard(attempts *repository.AttemptRepository, captcha CaptchaVerifier, recorder audit.Recorder, policy Policy) *Guard {
+	return &Guard{attempts: attempts, captcha: captcha, audit: recorder, policy: policy}
+}
+
+// Check is called before the credentials are checked. It rejects attempts from a locked IP or
+// for an account in backoff or lockout, and attempts without a valid CAPTCHA when one is required.
+// Unknown emails are treated like existing ones, so the answers don't reveal which accounts exist.
+func (g *Guard) Check(ctx context.Context, attempt Attempt) error {
+	email := normalizeEmail(attempt.Email)
+
+	for _, scope := range []struct{ name, id string }{{repository.ScopeIP, attempt.IP}, {repository.ScopeAccount, email}} {
+		retryAfter, reason, err := g.attempts.BlockedFor(ctx, scope.name, scope.id)
+		if err != nil {
+			return err
+		}
+		if retryAfter > 0 {
+			g.record(ctx, audit.LoginBlocked, attempt, map[string]interface{}{"scope": scope.name, "reason": reason})
+			return &ThrottledError{RetryAfter: retryAfter, Locked: reason == "locked"}
+		}
+	}
+
+	required, err := g.captchaRequired(ctx, email, attempt.IP)
+	if err != nil || !required || g.captcha == nil {
+		return err
+	}
+	if attempt.CaptchaToken == "" {
+		return ErrCaptchaRequired
+	}
+
+	ok, err := g.captcha.Verify(ctx, attempt.CaptchaToken, attempt.IP)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		g.record(ctx, audit.CaptchaFailed, attempt, nil)
+		return ErrCaptchaRequired
+	}
+	return nil
+}
+
+// Failure records a failed login, starting a backoff or lockout when a threshold is reached. It
+// returns whether the next attempt needs a CAPTCHA.
+func (g *Guard) Failure(ctx context.Context, attempt Attempt) (bool, error) {
+	email := normalizeEmail(attempt.Email)
+
+	accountFailures, err := g.attempts.AddFailure(ctx, repository.ScopeAccount, email, g.policy.Window)
+	if err != nil {
+		return false, err
+	}
+	ipFailures, err := g.attempts.AddFailure(ctx, repository.ScopeIP, attempt.IP, g.policy.Window)
+	if err != nil {
+		return false, err
+	}
+	g.record(ctx, audit.LoginFailed, attempt, map[string]interface{}{"account_failures": accountFailures, "ip_failures": ipFailures})
+
+	switch {
+	case accountFailures >= g.policy.LockAfter:
+		// every further failure renews the lock
+		if err := g.attempts.Block(ctx, repository.ScopeAccount, email, "locked", g.policy.LockDuration); err != nil {
+			return false, err
+		}
+		g.record(ctx, audit.AccountLocked, attempt, map[string]interface{}{"failures": accountFailures, "duration": g.policy.LockDuration.String()})
+	case accountFailures >= g.policy.BackoffAfter:
+		if err := g.attempts.Block(ctx, repository.ScopeAccount, email, "backoff", g.backoff(accountFailures)); err != nil {
+			return false, err
+		}
+	}
+
+	if ipFailures >= g.policy.IPLockAfter {
+		if err := g.attempts.Block(ctx, repository.ScopeIP, attempt.IP, "locked", g.policy.IPLockDuration); err != nil {
+			return false, err
+		}
+		g.record(ctx, audit.IPLocked, attempt, map[string]interface{}{"failures": ipFailures, "duration": g.policy.IPLockDuration.String()})
+	}
+
+	required := accountFailures >= g.policy.CaptchaAfter || ipFailures >= g.policy.IPCaptchaAfter
+	if accountFailures == g.policy.CaptchaAfter || ipFailures == g.policy.IPCaptchaAfter {
+		g.record(ctx, audit.CaptchaRequired, attempt, nil)
+	}
+	return required, nil
+}
+
+// Success records a successful login of a user, resetting the account's failures. Logging in
+// after many failures may mean the password was guessed, so it is audited.
+func (g *Guard) Success(ctx context.Context, attempt Attempt, userID int) error {
+	email := normalizeEmail(attempt.Email)
+
+	failures, err := g.attempts.Failures(ctx, repository.ScopeAccount, email)
+	if err != nil {
+		return err
+	}
+	if failures >= g.policy.BackoffAfter {
+		event := audit.Event{Type: audit.LoginAfterFailures, UserID: userID, Email: email, IP: attempt.IP, UserAgent: attempt.UserAgent, Details: map[string]interface{}{"failures": failures}}
+		g.audit.Record(ctx, event)
+	}
+
+	return g.attempts.ResetFailures(ctx, repository.ScopeAccount, email)
+}
+
+// Reset clears the failures and any lockout of an account, e.g. once its password was reset.
+func (g *Guard) Reset(ctx context.Context, email string) error {
+	email = normalizeEmail(email)
+	if err := g.attempts.ResetFailures(ctx, repository.ScopeAccount, email); err != nil {
+		return err
+	}
+	return g.attempts.Unblock(ctx, repository.ScopeAccount, email)
+}
+
+func (g *Guard) captchaRequired(ctx context.Context, email, ip string) (bool, error) {
+	accountFailures, err := g.attempts.Failures(ctx, repository.ScopeAccount, email)
+	if err != nil {
+		return false, err
+	}
+	ipFailures, err := g.attempts.Failures(ctx, repository.ScopeIP, ip)
+	if err != nil {
+		return false, err
+	}
+	return accountFailures >= g.policy.CaptchaAfter || ipFailures >= g.policy.IPCaptchaAfter, nil
+}
+
+// backoff returns the delay after the given number of account failures.
+func (g *Guard) backoff(failures int) time.Duration {
+	exponent := failures - g.policy.BackoffAfter
+	delay := time.Duration(float64(g.policy.BackoffBase) * math.Pow(2, float64(exponent)))
+	if delay > g.policy.BackoffMax || delay <= 0 {
+		return g.policy.BackoffMax
+	}
+	return delay
+}
+
+func (g *Guard) record(ctx context.Context, eventType string, attempt Attempt, details map[string]interface{}) {
+	g.audit.Record(ctx, audit.Event{
+		Type:      eventType,
+		Email:     normalizeEmail(attempt.Email),
+		IP:        attempt.IP,
+		UserAgent: attempt.UserAgent,
+		Details:   details,
+	})
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,123 @@
+// Package notify sends account emails such as verification and password reset links.
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is an email to a single recipient.
+type Message struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Notifier delivers messages to users.
+type Notifier interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTPConfig configures the SMTP notifier.
+type SMTPConfig struct {
+	Host     string `yaml:"host" env:"SMTP_HOST"`
+	Port     string `yaml:"port" env:"SMTP_PORT" default:"587"`
+	Username string `yaml:"username" env:"SMTP_USERNAME"` // Optional, no authentication when empty
+	Password string `yaml:"password" env:"SMTP_PASSWORD"`
+	From     string `yaml:"from" env:"SMTP_FROM"`
+}
+
+// SMTPNotifier sends messages through an SMTP server.
+type SMTPNotifier struct {
+	config SMTPConfig
+}
+
+func NewSMTPNotifier(config SMTPConfig) *SMTPNotifier {
+	if config.Port == "" {
+		config.Port = "587"
+	}
+	return &SMTPNotifier{config: config}
+}
+
+func (n *SMTPNotifier) Send(ctx context.Context, msg Message) error {
+	var auth smtp.Auth
+	if n.config.Username != "" {
+		auth = smtp.PlainAuth("", n.config.Username, n.config.Password, n.config.Host)
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "From: %s\r\n", n.config.From)
+	fmt.Fprintf(&body, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&body, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&body, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	body.WriteString("MIME-Version: 1.0\r\n")
+	body.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	body.WriteString(msg.Body)
+
+	addr := n.config.Host + ":" + n.config.Port
+	return smtp.SendMail(addr, auth, n.config.From, []string{msg.To}, []byte(body.String()))
+}
+
+// FileNotifier writes messages as JSON lines to a file, so the links can be followed when testing
+// locally. They aren't logged, logs are kept and shipped where the links must not end up.
+type FileNotifier struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{path: path}
+}
+
+func (n *FileNotifier) Send(ctx context.Context, msg Message) error {
+	line, err := json.Marshal(struct {
+		Message
+		SentAt time.Time `json:"sent_at"`
+	}{msg, time.Now()})
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	file, err := os.OpenFile(n.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+// Config selects the notifier, it is the notifier section of the service's config.
+type Config struct {
+	Kind string     `yaml:"kind" env:"NOTIFIER"` // "smtp", anything else is the file notifier
+	File string     `yaml:"file" env:"NOTIFY_FILE"`
+	SMTP SMTPConfig `yaml:"smtp"`
+}
+
+func (c Config) Validate() error {
+	if c.Kind == "smtp" && (c.SMTP.Host == "" || c.SMTP.From == "") {
+		return fmt.Errorf("smtp.host and smtp.from are required for the smtp notifier")
+	}
+	if c.Kind != "smtp" && c.File == "" {
+		return fmt.Errorf("file is required for the file notifier, or set kind to smtp")
+	}
+	return nil
+}
+
+// New creates the notifier selected by config.
+func New(config Config) Notifier {
+	if config.Kind != "smtp" {
+		return NewFileNotifier(config.File)
+	}
+	return NewSMTPNotifier(config.SMTP)
+}
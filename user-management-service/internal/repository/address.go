@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"user-management-service/internal/entity"
+)
+
+// ErrAddressNotFound is returned for addresses that don't exist or belong to another user.
+var ErrAddressNotFound = errors.New("address not found")
+
+const addressColumns = `id, user_id, label, name, line1, line2, city, region, postal_code, country, phone, default_shipping, default_billing, created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAddress(row rowScanner) (*entity.Address, error) {
+	address := &entity.Address{}
+	err := row.Scan(&address.ID, &address.UserID, &address.Label, &address.Name, &address.Line1, &address.Line2, &address.City, &address.Region, &address.PostalCode, &address.Country, &address.Phone, &address.DefaultShipping, &address.DefaultBilling, &address.CreatedAt, &address.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return address, nil
+}
+
+func (r *UserRepository) ListAddresses(ctx context.Context, userID int) ([]entity.Address, error) {
+	query := `SELECT ` + addressColumns + ` FROM addresses WHERE user_id = ? ORDER BY id`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	addresses := []entity.Address{}
+	for rows.Next() {
+		address, err := scanAddress(rows)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, *address)
+	}
+	return addresses, rows.Err()
+}
+
+func (r *UserRepository) GetAddress(ctx context.Context, userID, id int) (*entity.Address, error) {
+	query := `SELECT ` + addressColumns + ` FROM addresses WHERE id = ? AND user_id = ?`
+	address, err := scanAddress(r.db.QueryRowContext(ctx, query, id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAddressNotFound
+	}
+	return address, err
+}
+
+// CreateAddress adds an address to a user's address book. A user has at most one default
+// shipping and one default billing address, so setting a default clears the previous one.
+func (r *UserRepository) CreateAddress(ctx context.Context, address *entity.Address) (*entity.Address, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := clearDefaults(ctx, tx, address); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	query := `INSERT INTO addresses (user_id, label, name, line1, line2, city, region, postal_code, country, phone, default_shipping, default_billing) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	res, err := tx.ExecContext(ctx, query, address.UserID, address.Label, address.Name, address.Line1, address.Line2, address.City, address.Region, address.PostalCode, address.Country, address.Phone, address.DefaultShipping, address.DefaultBilling)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return r.GetAddress(ctx, address.UserID, int(id))
+}
+
+// UpdateAddress replaces an existing address of a user's address book, keeping it the only
+// default of its kind like CreateAddress.
+func (r *UserRepository) UpdateAddress(ctx context.Context, address *entity.Address) (*entity.Address, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := clearDefaults(ctx, tx, address); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	query := `UPDATE addresses SET label = ?, name = ?, line1 = ?, line2 = ?, city = ?, region = ?, postal_code = ?, country = ?, phone = ?, default_shipping = ?, default_billing = ? WHERE id = ? AND user_id = ?`
+	_, err = tx.ExecContext(ctx, query, address.Label, address.Name, address.Line1, address.Line2, address.City, address.Region, address.PostalCode, address.Country, address.Phone, address.DefaultShipping, address.DefaultBilling, address.ID, address.UserID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return r.GetAddress(ctx, address.UserID, address.ID)
+}
+
+func (r *UserRepository) DeleteAddress(ctx context.Context, userID, id int) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM addresses WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrAddressNotFound
+	}
+	return nil
+}
+
+// clearDefaults removes the default flags the address is about to take from the user's other
+// addresses.
+func clearDefaults(ctx context.Context, tx *sql.Tx, address *entity.Address) error {
+	if address.DefaultShipping {
+		_, err := tx.ExecContext(ctx, `UPDATE addresses SET default_shipping = FALSE WHERE user_id = ? AND id <> ?`, address.UserID, address.ID)
+		if err != nil {
+			return err
+		}
+	}
+	if address.DefaultBilling {
+		_, err := tx.ExecContext(ctx, `UPDATE addresses SET default_billing = FALSE WHERE user_id = ? AND id <> ?`, address.UserID, address.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	"user-management-service/internal/entity"
+)
+
+// ErrAPIKeyNotFound is returned for API keys that don't exist, belong to another user or are
+// already revoked.
+var ErrAPIKeyNotFound = errors.New("API key not found")
+
+const apiKeyColumns = `id, user_id, name, prefix, secret_hash, scopes, expires_at, last_used_at, revoked_at, created_at`
+
+func scanAPIKey(row rowScanner) (*entity.APIKey, error) {
+	key := &entity.APIKey{}
+	var scopes string
+	var lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.SecretHash, &scopes, &key.ExpiresAt, &lastUsedAt, &revokedAt, &key.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	key.Scopes = strings.Fields(scopes)
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return key, nil
+}
+
+func (r *UserRepository) CreateAPIKey(ctx context.Context, key *entity.APIKey) (*entity.APIKey, error) {
+	query := `INSERT INTO api_keys (user_id, name, prefix, secret_hash, scopes, expires_at) VALUES (?, ?, ?, ?, ?, ?)`
+	res, err := r.db.ExecContext(ctx, query, key.UserID, key.Name, key.Prefix, key.SecretHash, strings.Join(key.Scopes, " "), key.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	key.ID = int(id)
+	key.CreatedAt = time.Now()
+	return key, nil
+}
+
+func (r *UserRepository) ListAPIKeys(ctx context.Context, userID int) ([]entity.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE user_id = ? ORDER BY id`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []entity.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+// GetAPIKeyByPrefix looks a key up by the public part of the key presented by a caller.
+func (r *UserRepository) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*entity.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE prefix = ?`
+	key, err := scanAPIKey(r.db.QueryRowContext(ctx, query, prefix))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAPIKeyNotFound
+	}
+	return key, err
+}
+
+// RevokeAPIKey marks one of a user's keys as revoked. Revoked keys are kept for the record.
+func (r *UserRepository) RevokeAPIKey(ctx context.Context, userID, id int) error {
+	query := `UPDATE api_keys SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL`
+	res, err := r.db.ExecContext(ctx, query, time.Now(), id, userID)
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// TouchAPIKey records when a key was last used.
+func (r *UserRepository) TouchAPIKey(ctx context.Context, id int, usedAt time.Time) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE api_keys SET last_used_at = ? WHERE id = ?`, usedAt, id)
+	return err
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/go-redis/redis/v8"
+	"time"
+)
+
+// Scopes of failed login counters and login blocks.
+const (
+	ScopeAccount = "account"
+	ScopeIP      = "ip"
+)
+
+// AttemptRepository counts failed logins per account and per IP, and holds temporary login
+// blocks. Both live in Redis so every instance sees them, and expire on their own.
+type AttemptRepository struct {
+	rdb *redis.Client
+}
+
+func NewAttemptRepository(rdb *redis.Client) *AttemptRepository {
+	return &AttemptRepository{rdb}
+}
+
+func failuresKey(scope, id string) string {
+	return "login_failures:" + scope + ":" + id
+}
+
+func blockKey(scope, id string) string {
+	return "login_block:" + scope + ":" + id
+}
+
+// AddFailure counts a failed login and returns the number of failures. The count is forgotten
+// once no failure happened for window.
+func (r *AttemptRepository) AddFailure(ctx context.Context, scope, id string, window time.Duration) (int, error) {
+	var incr *redis.IntCmd
+	_, err := r.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, failuresKey(scope, id))
+		pipe.Expire(ctx, failuresKey(scope, id), window)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(incr.Val()), nil
+}
+
+// Failures returns the number of recent failed logins.
+func (r *AttemptRepository) Failures(ctx context.Context, scope, id string) (int, error) {
+	count, err := r.rdb.Get(ctx, failuresKey(scope, id)).Int()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return count, err
+}
+
+// ResetFailures forgets the failed logins, e.g. after a successful one.
+func (r *AttemptRepository) ResetFailures(ctx context.Context, scope, id string) error {
+	return r.rdb.Del(ctx, failuresKey(scope, id)).Err()
+}
+
+// Block rejects logins for ttl. The reason is returned by BlockedFor.
+func (r *AttemptRepository) Block(ctx context.Context, scope, id, reason string, ttl time.Duration) error {
+	return r.rdb.Set(ctx, blockKey(scope, id), reason, ttl).Err()
+}
+
+// BlockedFor returns how much longer logins are blocked and why, or 0 if they aren't.
+func (r *AttemptRepository) BlockedFor(ctx context.Context, scope, id string) (time.Duration, string, error) {
+	var reason *redis.StringCmd
+	var ttl *redis.DurationCmd
+	_, err := r.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		reason = pipe.Get(ctx, blockKey(scope, id))
+		ttl = pipe.PTTL(ctx, blockKey(scope, id))
+		return nil
+	})
+	if errors.Is(err, redis.Nil) {
+		return 0, "", nil
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	if ttl.Val() <= 0 {
+		return 0, "", nil
+	}
+	return ttl.Val(), reason.Val(), nil
+}
+
+// Unblock lifts a block, e.g. once the account's password has been reset.
+func (r *AttemptRepository) Unblock(ctx context.Context, scope, id string) error {
+	return r.rdb.Del(ctx, blockKey(scope, id)).Err()
+}
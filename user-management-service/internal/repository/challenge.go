@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-redis/redis/v8"
+	"time"
+	"user-management-service/internal/entity"
+)
+
+// ErrChallengeNotFound is returned for login challenges that expired, were completed or failed
+// too often.
+var ErrChallengeNotFound = errors.New("login challenge not found")
+
+func challengeKey(tokenHash string) string {
+	return "login_challenge:" + tokenHash
+}
+
+func challengeAttemptsKey(tokenHash string) string {
+	return "login_challenge_attempts:" + tokenHash
+}
+
+// SaveChallenge stores a login challenge until it expires.
+func (r *SessionRepository) SaveChallenge(ctx context.Context, tokenHash string, challenge *entity.LoginChallenge) error {
+	data, err := json.Marshal(challenge)
+	if err != nil {
+		return err
+	}
+	return r.rdb.Set(ctx, challengeKey(tokenHash), data, time.Until(challenge.ExpiresAt)).Err()
+}
+
+func (r *SessionRepository) GetChallenge(ctx context.Context, tokenHash string) (*entity.LoginChallenge, error) {
+	data, err := r.rdb.Get(ctx, challengeKey(tokenHash)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrChallengeNotFound
+		}
+		return nil, err
+	}
+
+	challenge := &entity.LoginChallenge{}
+	if err := json.Unmarshal(data, challenge); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// ChallengeFailed counts a wrong code entered for a challenge and returns the number of wrong
+// codes so far.
+func (r *SessionRepository) ChallengeFailed(ctx context.Context, tokenHash string, ttl time.Duration) (int, error) {
+	var incr *redis.IntCmd
+	_, err := r.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, challengeAttemptsKey(tokenHash))
+		pipe.Expire(ctx, challengeAttemptsKey(tokenHash), ttl)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(incr.Val()), nil
+}
+
+// DeleteChallenge ends a challenge. It returns false if it was already gone, so a challenge
+// completed twice at the same time only opens one session.
+func (r *SessionRepository) DeleteChallenge(ctx context.Context, tokenHash string) (bool, error) {
+	deleted, err := r.rdb.Del(ctx, challengeKey(tokenHash), challengeAttemptsKey(tokenHash)).Result()
+	if err != nil {
+		return false, err
+	}
+	return deleted > 0, nil
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"user-management-service/internal/entity"
+)
+
+// ErrClientNotFound is returned for unknown service clients.
+var ErrClientNotFound = errors.New("client not found")
+
+func (r *UserRepository) CreateClient(ctx context.Context, client *entity.ServiceClient) (*entity.ServiceClient, error) {
+	query := `INSERT INTO service_clients (client_id, name, secret_hash, permissions, audiences, active) VALUES (?, ?, ?, ?, ?, ?)`
+	res, err := r.db.ExecContext(ctx, query, client.ClientID, client.Name, client.SecretHash, strings.Join(client.Permissions, " "), strings.Join(client.Audiences, " "), client.Active)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	client.ID = int(id)
+	return client, nil
+}
+
+// UpsertClient creates a client or replaces the secret, permissions and audiences of an existing one.
+func (r *UserRepository) UpsertClient(ctx context.Context, client *entity.ServiceClient) error {
+	query := `INSERT INTO service_clients (client_id, name, secret_hash, permissions, audiences, active) VALUES (?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE name = VALUES(name), secret_hash = VALUES(secret_hash), permissions = VALUES(permissions), audiences = VALUES(audiences), active = VALUES(active)`
+	_, err := r.db.ExecContext(ctx, query, client.ClientID, client.Name, client.SecretHash, strings.Join(client.Permissions, " "), strings.Join(client.Audiences, " "), client.Active)
+	return err
+}
+
+func (r *UserRepository) GetClientByClientID(ctx context.Context, clientID string) (*entity.ServiceClient, error) {
+	client := &entity.ServiceClient{}
+	var permissions, audiences string
+	query := `SELECT id, client_id, name, secret_hash, permissions, audiences, active, created_at FROM service_clients WHERE client_id = ?`
+	err := r.db.QueryRowContext(ctx, query, clientID).Scan(&client.ID, &client.ClientID, &client.Name, &client.SecretHash, &permissions, &audiences, &client.Active, &client.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrClientNotFound
+		}
+		return nil, err
+	}
+
+	client.Permissions = strings.Fields(permissions)
+	client.Audiences = strings.Fields(audiences)
+	return client, nil
+}
+
+func (r *UserRepository) SetClientActive(ctx context.Context, clientID string, active bool) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE service_clients SET active = ? WHERE client_id = ?`, active, clientID)
+	return err
+}
@@ -15,9 +15,9 @@ func NewUserRepository(db *sql.DB) *UserRepository {
 }
 
 func (r *UserRepository) GetUserByID(ctx context.Context, id int) (*entity.User, error) {
-	var user *entity.User
-	query := `SELECT id, username, email, password FROM users WHERE id = ?`
-	err := r.db.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.Username, &user.Email, &user.Password)
+	user := &entity.User{}
+	query := `SELECT id, username, email, password, email_verified FROM users WHERE id = ?`
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.EmailVerified)
 	if err != nil {
 		return nil, err
 	}
@@ -27,7 +27,7 @@ func (r *UserRepository) GetUserByID(ctx context.Context, id int) (*entity.User,
 
 func (r *UserRepository) CreateUser(ctx context.Context, user *entity.User) (*entity.User, error) {
 	query := `INSERT INTO users (username, email, password) VALUES (?, ?, ?)`
-	res, err := r.db.ExecContext(ctx, query, user.Username, user.Email, user.Password)
+	res, err := r.db.ExecContext(ctx, query, user.Username, user.Email, user.PasswordHash)
 	if err != nil {
 		return nil, err
 	}
@@ -42,9 +42,9 @@ func (r *UserRepository) CreateUser(ctx context.Context, user *entity.User) (*en
 }
 
 func (r *UserRepository) GetUserByEmail(ctx context.Context, email string) (*entity.User, error) {
-	var user *entity.User
-	query := `SELECT id, username, email, password FROM users WHERE email = ?`
-	err := r.db.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.Username, &user.Email, &user.Password)
+	user := &entity.User{}
+	query := `SELECT id, username, email, password, email_verified FROM users WHERE email = ?`
+	err := r.db.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.EmailVerified)
 	if err != nil {
 		return nil, err
 	}
@@ -52,13 +52,28 @@ func (r *UserRepository) GetUserByEmail(ctx context.Context, email string) (*ent
 	return user, nil
 }
 
-func (r *UserRepository) GetUserByEmailAndPassword(ctx context.Context, email, password string) (*entity.User, error) {
-	var user *entity.User
-	query := `SELECT id, username, email, password FROM users WHERE email = ? AND password = ?`
-	err := r.db.QueryRowContext(ctx, query, email, password).Scan(&user.ID, &user.Username, &user.Email, &user.Password)
-	if err != nil {
-		return nil, err
-	}
+// UpdatePasswordHash replaces the stored hash of a user, e.g. after rehashing with new parameters.
+func (r *UserRepository) UpdatePasswordHash(ctx context.Context, id int, hash string) error {
+	query := `UPDATE users SET password = ? WHERE id = ?`
+	_, err := r.db.ExecContext(ctx, query, hash, id)
+	return err
+}
 
-	return user, nil
+// UpdateProfile saves the username, email and email verification state of a user.
+func (r *UserRepository) UpdateProfile(ctx context.Context, user *entity.User) error {
+	query := `UPDATE users SET username = ?, email = ?, email_verified = ? WHERE id = ?`
+	_, err := r.db.ExecContext(ctx, query, user.Username, user.Email, user.EmailVerified, user.ID)
+	return err
+}
+
+func (r *UserRepository) SetEmailVerified(ctx context.Context, id int, verified bool) error {
+	query := `UPDATE users SET email_verified = ? WHERE id = ?`
+	_, err := r.db.ExecContext(ctx, query, verified, id)
+	return err
+}
+
+// DeleteUser deletes a user. Roles and account tokens are deleted with it by their foreign keys.
+func (r *UserRepository) DeleteUser(ctx context.Context, id int) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM users WHERE id = ?`, id)
+	return err
 }
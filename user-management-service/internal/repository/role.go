@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"user-management-service/internal/entity"
+)
+
+// ErrRoleNotFound is returned for role names that don't exist.
+var ErrRoleNotFound = errors.New("role not found")
+
+func (r *UserRepository) ListRoles(ctx context.Context) ([]entity.Role, error) {
+	query := `SELECT r.id, r.name, COALESCE(p.permission, '') FROM roles r LEFT JOIN role_permissions p ON p.role_id = r.id ORDER BY r.name, p.permission`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []entity.Role
+	for rows.Next() {
+		var id int
+		var name, permission string
+		if err := rows.Scan(&id, &name, &permission); err != nil {
+			return nil, err
+		}
+		if len(roles) == 0 || roles[len(roles)-1].ID != id {
+			roles = append(roles, entity.Role{ID: id, Name: name, Permissions: []string{}})
+		}
+		if permission != "" {
+			roles[len(roles)-1].Permissions = append(roles[len(roles)-1].Permissions, permission)
+		}
+	}
+	return roles, rows.Err()
+}
+
+// GetUserRoles returns the role names of a user and the union of their permissions.
+func (r *UserRepository) GetUserRoles(ctx context.Context, userID int) (roles []string, permissions []string, err error) {
+	query := `SELECT r.name, COALESCE(p.permission, '') FROM user_roles ur
+		JOIN roles r ON r.id = ur.role_id
+		LEFT JOIN role_permissions p ON p.role_id = r.id
+		WHERE ur.user_id = ? ORDER BY r.name, p.permission`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	seen := make(map[string]bool)
+	for rows.Next() {
+		var role, permission string
+		if err := rows.Scan(&role, &permission); err != nil {
+			return nil, nil, err
+		}
+		if len(roles) == 0 || roles[len(roles)-1] != role {
+			roles = append(roles, role)
+		}
+		if permission != "" && !seen[permission] {
+			seen[permission] = true
+			permissions = append(permissions, permission)
+		}
+	}
+	return roles, permissions, rows.Err()
+}
+
+func (r *UserRepository) AssignRole(ctx context.Context, userID int, role string) error {
+	query := `INSERT IGNORE INTO user_roles (user_id, role_id) SELECT ?, id FROM roles WHERE name = ?`
+	res, err := r.db.ExecContext(ctx, query, userID, role)
+	if err != nil {
+		return err
+	}
+	return r.checkRoleExists(ctx, res, role)
+}
+
+func (r *UserRepository) RemoveRole(ctx context.Context, userID int, role string) error {
+	query := `DELETE ur FROM user_roles ur JOIN roles r ON r.id = ur.role_id WHERE ur.user_id = ? AND r.name = ?`
+	res, err := r.db.ExecContext(ctx, query, userID, role)
+	if err != nil {
+		return err
+	}
+	return r.checkRoleExists(ctx, res, role)
+}
+
+// checkRoleExists tells an unknown role apart from a no-op when a statement affected no rows.
+func (r *UserRepository) checkRoleExists(ctx context.Context, res sql.Result, role string) error {
+	affected, err := res.RowsAffected()
+	if err != nil || affected > 0 {
+		return err
+	}
+
+	var exists int
+	err = r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM roles WHERE name = ?`, role).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists == 0 {
+		return fmt.Errorf("%w: %s", ErrRoleNotFound, role)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"strconv"
+	"time"
+	"user-management-service/internal/entity"
+)
+
+// ErrSessionNotFound is returned for sessions that expired or were logged out.
+var ErrSessionNotFound = errors.New("session not found")
+
+// ErrRefreshTokenChanged is returned when a session's refresh token was rotated concurrently.
+var ErrRefreshTokenChanged = errors.New("refresh token already used")
+
+// SessionRepository stores login sessions in Redis, where they expire on their own.
+type SessionRepository struct {
+	rdb *redis.Client
+}
+
+func NewSessionRepository(rdb *redis.Client) *SessionRepository {
+	return &SessionRepository{rdb}
+}
+
+// storedSession adds the refresh token hashes, which the API never returns, to the stored JSON.
+type storedSession struct {
+	*entity.Session
+	RefreshHash         string `json:"refresh_hash"`
+	PreviousRefreshHash string `json:"previous_refresh_hash"`
+}
+
+func sessionKey(id string) string {
+	return "session:" + id
+}
+
+func userSessionsKey(userID int) string {
+	return "user_sessions:" + strconv.Itoa(userID)
+}
+
+func encodeSession(session *entity.Session) ([]byte, error) {
+	return json.Marshal(storedSession{Session: session, RefreshHash: session.RefreshHash, PreviousRefreshHash: session.PreviousRefreshHash})
+}
+
+func decodeSession(data []byte) (*entity.Session, error) {
+	stored := storedSession{Session: &entity.Session{}}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+	stored.Session.RefreshHash = stored.RefreshHash
+	stored.Session.PreviousRefreshHash = stored.PreviousRefreshHash
+	return stored.Session, nil
+}
+
+func (r *SessionRepository) SaveSession(ctx context.Context, session *entity.Session) error {
+	data, err := encodeSession(session)
+	if err != nil {
+		return err
+	}
+
+	pipe := r.rdb.TxPipeline()
+	pipe.Set(ctx, sessionKey(session.ID), data, time.Until(session.ExpiresAt))
+	pipe.SAdd(ctx, userSessionsKey(session.UserID), session.ID)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (r *SessionRepository) GetSession(ctx context.Context, id string) (*entity.Session, error) {
+	data, err := r.rdb.Get(ctx, sessionKey(id)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+	return decodeSession(data)
+}
+
+// RotateRefreshToken replaces the refresh token hash of a session, provided it still is
+// expectedHash. The check and the write happen in one Redis transaction, so a refresh token can
+// only be exchanged once even when it is presented twice at the same time.
+func (r *SessionRepository) RotateRefreshToken(ctx context.Context, id, expectedHash, newHash string, usedAt time.Time) (*entity.Session, error) {
+	var session *entity.Session
+	err := r.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		data, err := tx.Get(ctx, sessionKey(id)).Bytes()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				return ErrSessionNotFound
+			}
+			return err
+		}
+		session, err = decodeSession(data)
+		if err != nil {
+			return err
+		}
+		if session.RefreshHash != expectedHash {
+			return ErrRefreshTokenChanged
+		}
+
+		session.PreviousRefreshHash = session.RefreshHash
+		session.RefreshHash = newHash
+		session.LastUsedAt = usedAt
+		data, err = encodeSession(session)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, sessionKey(id), data, time.Until(session.ExpiresAt))
+			return nil
+		})
+		return err
+	}, sessionKey(id))
+	if errors.Is(err, redis.TxFailedErr) {
+		return nil, ErrRefreshTokenChanged
+	}
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// ListSessions returns the active sessions of a user, dropping the IDs of expired ones.
+func (r *SessionRepository) ListSessions(ctx context.Context, userID int) ([]*entity.Session, error) {
+	ids, err := r.rdb.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]*entity.Session, 0, len(ids))
+	for _, id := range ids {
+		session, err := r.GetSession(ctx, id)
+		if errors.Is(err, ErrSessionNotFound) {
+			r.rdb.SRem(ctx, userSessionsKey(userID), id)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not load session %s: %v", id, err)
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+func (r *SessionRepository) DeleteSession(ctx context.Context, userID int, id string) error {
+	pipe := r.rdb.TxPipeline()
+	pipe.Del(ctx, sessionKey(id))
+	pipe.SRem(ctx, userSessionsKey(userID), id)
+	_, err := pipe.Exec(ctx)
+	return err
+}
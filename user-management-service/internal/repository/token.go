@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrTokenInvalid is returned for account tokens that are unknown, expired or already used.
+var ErrTokenInvalid = errors.New("invalid or expired token")
+
+// CreateUserToken stores the hash of a single-use account token.
+func (r *UserRepository) CreateUserToken(ctx context.Context, userID int, purpose, tokenHash string, expiresAt time.Time) error {
+	query := `INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at) VALUES (?, ?, ?, ?)`
+	_, err := r.db.ExecContext(ctx, query, userID, purpose, tokenHash, expiresAt)
+	return err
+}
+
+// ConsumeUserToken marks a token as used and returns its user. The row is locked while it is
+// checked, so a token can only be consumed once.
+func (r *UserRepository) ConsumeUserToken(ctx context.Context, purpose, tokenHash string) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var id, userID int
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+	query := `SELECT id, user_id, expires_at, used_at FROM user_tokens WHERE token_hash = ? AND purpose = ? FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, tokenHash, purpose).Scan(&id, &userID, &expiresAt, &usedAt)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrTokenInvalid
+		}
+		return 0, err
+	}
+
+	if usedAt.Valid || time.Now().After(expiresAt) {
+		tx.Rollback()
+		return 0, ErrTokenInvalid
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE user_tokens SET used_at = ? WHERE id = ?`, time.Now(), id)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return userID, tx.Commit()
+}
+
+// DeleteUserTokens deletes a user's tokens of one purpose, e.g. the other reset links once the
+// password has been reset.
+func (r *UserRepository) DeleteUserTokens(ctx context.Context, userID int, purpose string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM user_tokens WHERE user_id = ? AND purpose = ?`, userID, purpose)
+	return err
+}
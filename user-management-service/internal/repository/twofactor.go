@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+	"user-management-service/internal/entity"
+)
+
+// ErrTwoFactorNotFound is returned for users who haven't enrolled a second factor.
+var ErrTwoFactorNotFound = errors.New("two-factor authentication is not set up")
+
+// GetTwoFactor returns the second factor of a user, with its secret still sealed.
+func (r *UserRepository) GetTwoFactor(ctx context.Context, userID int) (*entity.TwoFactor, error) {
+	twoFactor := &entity.TwoFactor{}
+	var enabledAt sql.NullTime
+	query := `SELECT user_id, secret, enabled, last_used_step, enabled_at FROM user_two_factor WHERE user_id = ?`
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&twoFactor.UserID, &twoFactor.Secret, &twoFactor.Enabled, &twoFactor.LastUsedStep, &enabledAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTwoFactorNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if enabledAt.Valid {
+		twoFactor.EnabledAt = &enabledAt.Time
+	}
+	return twoFactor, nil
+}
+
+// SavePendingTwoFactor stores a new, not yet enabled, sealed secret for a user, replacing any
+// pending one. Enabled second factors are left alone.
+func (r *UserRepository) SavePendingTwoFactor(ctx context.Context, userID int, sealedSecret string) error {
+	query := `INSERT INTO user_two_factor (user_id, secret) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE secret = IF(enabled, secret, VALUES(secret)), last_used_step = IF(enabled, last_used_step, 0)`
+	_, err := r.db.ExecContext(ctx, query, userID, sealedSecret)
+	return err
+}
+
+// EnableTwoFactor enables a pending second factor, recording the step of the code that confirmed
+// it, and replaces the user's recovery codes.
+func (r *UserRepository) EnableTwoFactor(ctx context.Context, userID int, step int64, recoveryHashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE user_two_factor SET enabled = TRUE, last_used_step = ?, enabled_at = ? WHERE user_id = ?`
+	_, err = tx.ExecContext(ctx, query, step, time.Now(), userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, recoveryHashes); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DisableTwoFactor removes the second factor and the recovery codes of a user.
+func (r *UserRepository) DisableTwoFactor(ctx context.Context, userID int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = ?`, userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_two_factor WHERE user_id = ?`, userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseTwoFactorStep records that the code of a time step was accepted. It returns false if that
+// step or a later one was already used, which means the code is being replayed.
+func (r *UserRepository) UseTwoFactorStep(ctx context.Context, userID int, step int64) (bool, error) {
+	query := `UPDATE user_two_factor SET last_used_step = ? WHERE user_id = ? AND last_used_step < ?`
+	res, err := r.db.ExecContext(ctx, query, step, userID, step)
+	if err != nil {
+		return false, err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return count == 1, nil
+}
+
+// ReplaceRecoveryCodes replaces all recovery codes of a user.
+func (r *UserRepository) ReplaceRecoveryCodes(ctx context.Context, userID int, hashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, hashes); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseRecoveryCode marks a recovery code as used. It returns false for unknown or used codes.
+func (r *UserRepository) UseRecoveryCode(ctx context.Context, userID int, hash string) (bool, error) {
+	query := `UPDATE user_recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`
+	res, err := r.db.ExecContext(ctx, query, time.Now(), userID, hash)
+	if err != nil {
+		return false, err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return count == 1, nil
+}
+
+// CountRecoveryCodes returns the number of unused recovery codes of a user.
+func (r *UserRepository) CountRecoveryCodes(ctx context.Context, userID int) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = ? AND used_at IS NULL`
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int, hashes []string) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range hashes {
+		_, err := tx.ExecContext(ctx, `INSERT INTO user_recovery_codes (user_id, code_hash) VALUES (?, ?)`, userID, hash)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,290 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+	"user-management-service/internal/entity"
+	"user-management-service/internal/notify"
+	"user-management-service/internal/password"
+)
+
+const (
+	verifyEmailTTL   = 24 * time.Hour
+	resetPasswordTTL = time.Hour
+)
+
+// ErrWrongPassword is returned when the current password given to change the account is wrong.
+var ErrWrongPassword = errors.New("current password is incorrect")
+
+// GetMe returns the account of the caller.
+func (s *UserService) GetMe(ctx context.Context, userID int) (*entity.User, error) {
+	return s.GetUserByID(ctx, userID)
+}
+
+// VerifyEmail marks the email of a verification token's user as verified.
+func (s *UserService) VerifyEmail(ctx context.Context, token string) error {
+	userID, err := s.repo.ConsumeUserToken(ctx, entity.TokenVerifyEmail, hashToken(token))
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.SetEmailVerified(ctx, userID, true); err != nil {
+		logger.Error().Err(err).Msgf("Error verifying email of user %d", userID)
+		return err
+	}
+	return nil
+}
+
+// ResendVerification sends a new verification link, unless the email is already verified.
+func (s *UserService) ResendVerification(ctx context.Context, userID int) error {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return nil
+	}
+
+	return s.sendVerification(ctx, user)
+}
+
+// ForgotPassword sends a password reset link. Unknown emails succeed silently, so the endpoint
+// doesn't reveal which accounts exist.
+func (s *UserService) ForgotPassword(ctx context.Context, email string) error {
+	user, err := s.repo.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	token, err := s.createUserToken(ctx, user.ID, entity.TokenResetPassword, resetPasswordTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.notifier.Send(ctx, notify.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nReset your password by opening this link within an hour:\n%s\n\nIf you didn't ask for a reset, you can ignore this email.\n",
+			user.Username, s.link("/reset-password", token)),
+	})
+}
+
+// ResetPassword sets a new password with a reset token. All sessions are ended, since whoever
+// knew the old password may still be logged in.
+func (s *UserService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	if len(newPassword) < minPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+
+	userID, err := s.repo.ConsumeUserToken(ctx, entity.TokenResetPassword, hashToken(token))
+	if err != nil {
+		return err
+	}
+
+	if err := s.setPassword(ctx, userID, newPassword); err != nil {
+		return err
+	}
+
+	// the other reset links sent before are no longer needed
+	if err := s.repo.DeleteUserTokens(ctx, userID, entity.TokenResetPassword); err != nil {
+		logger.Error().Err(err).Msgf("Error deleting reset tokens of user %d", userID)
+	}
+
+	// whoever reset the password owns the email, so a lockout no longer protects anything
+	if user, err := s.repo.GetUserByID(ctx, userID); err == nil {
+		if err := s.guard.Reset(ctx, user.Email); err != nil {
+			logger.Error().Err(err).Msgf("Error clearing failed logins of user %d", userID)
+		}
+	}
+
+	return s.RevokeAllSessions(ctx, userID)
+}
+
+// UpdateProfile changes the caller's username, email or password. Changing the email or password
+// takes the current password, so a stolen session can't take over the account through a reset
+// link. A new email has to be verified again. A new password ends every session except the one
+// making the change.
+func (s *UserService) UpdateProfile(ctx context.Context, userID int, sessionID string, update entity.ProfileUpdate) (*entity.User, error) {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.NewPassword != "" && len(update.NewPassword) < minPasswordLength {
+		return nil, fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	emailChanged := update.Email != "" && update.Email != user.Email
+	if update.NewPassword != "" || emailChanged {
+		if err := s.checkPassword(user, update.CurrentPassword); err != nil {
+			return nil, err
+		}
+	}
+
+	if update.Username != "" {
+		user.Username = update.Username
+	}
+	if emailChanged {
+		user.Email = update.Email
+		user.EmailVerified = false
+	}
+
+	if err := s.repo.UpdateProfile(ctx, user); err != nil {
+		logger.Error().Err(err).Msgf("Error updating profile of user %d", userID)
+		return nil, err
+	}
+
+	if update.NewPassword != "" {
+		if err := s.setPassword(ctx, userID, update.NewPassword); err != nil {
+			return nil, err
+		}
+		if err := s.revokeOtherSessions(ctx, userID, sessionID); err != nil {
+			return nil, err
+		}
+	}
+
+	if emailChanged {
+		if err := s.sendVerification(ctx, user); err != nil {
+			logger.Error().Err(err).Msgf("Error sending verification email to user %d", userID)
+		}
+	}
+
+	return s.GetUserByID(ctx, userID)
+}
+
+// DeleteAccount deletes the caller's account after checking their password. Their orders are
+// kept for accounting but anonymized by order-service first, so a failed erasure can be retried
+// before the account is gone.
+func (s *UserService) DeleteAccount(ctx context.Context, userID int, currentPassword string) error {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkPassword(user, currentPassword); err != nil {
+		return err
+	}
+
+	if err := s.eraseOrderData(ctx, userID); err != nil {
+		logger.Error().Err(err).Msgf("Error erasing order data of user %d", userID)
+		return err
+	}
+
+	if err := s.RevokeAllSessions(ctx, userID); err != nil {
+		return err
+	}
+	if err := s.revokeAllAPIKeys(ctx, userID); err != nil {
+		return err
+	}
+
+	if err := s.repo.DeleteUser(ctx, userID); err != nil {
+		logger.Error().Err(err).Msgf("Error deleting user %d", userID)
+		return err
+	}
+
+	logger.Info().Msgf("Deleted account of user %d", userID)
+	return nil
+}
+
+func (s *UserService) sendVerification(ctx context.Context, user *entity.User) error {
+	token, err := s.createUserToken(ctx, user.ID, entity.TokenVerifyEmail, verifyEmailTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.notifier.Send(ctx, notify.Message{
+		To:      user.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("Hi %s,\n\nConfirm your email address by opening this link:\n%s\n",
+			user.Username, s.link("/verify-email", token)),
+	})
+}
+
+// createUserToken stores a new single-use token and returns it. Only its hash is stored, like
+// refresh tokens.
+func (s *UserService) createUserToken(ctx context.Context, userID int, purpose string, ttl time.Duration) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.repo.CreateUserToken(ctx, userID, purpose, hashToken(token), time.Now().Add(ttl))
+	if err != nil {
+		logger.Error().Err(err).Msgf("Error creating %s token for user %d", purpose, userID)
+		return "", err
+	}
+	return token, nil
+}
+
+func (s *UserService) link(path, token string) string {
+	return s.appURL + path + "?token=" + url.QueryEscape(token)
+}
+
+func (s *UserService) checkPassword(user *entity.User, plaintext string) error {
+	if !password.IsHash(user.PasswordHash) {
+		// plaintext passwords are rehashed on the next login, which is required first
+		return ErrWrongPassword
+	}
+
+	ok, _, err := password.Verify(plaintext, user.PasswordHash, password.DefaultParams)
+	if err != nil || !ok {
+		return ErrWrongPassword
+	}
+	return nil
+}
+
+func (s *UserService) setPassword(ctx context.Context, userID int, plaintext string) error {
+	hash, err := password.Hash(plaintext, password.DefaultParams)
+	if err != nil {
+		logger.Error().Err(err).Msg("Error hashing password")
+		return err
+	}
+
+	if err := s.repo.UpdatePasswordHash(ctx, userID, hash); err != nil {
+		logger.Error().Err(err).Msgf("Error updating password of user %d", userID)
+		return err
+	}
+	return nil
+}
+
+func (s *UserService) revokeOtherSessions(ctx context.Context, userID int, currentSessionID string) error {
+	sessions, err := s.sessionRepo.ListSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if session.ID == currentSessionID {
+			continue
+		}
+		if err := s.revokeSession(ctx, userID, session.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eraseOrderData asks order-service to anonymize the user's orders.
+func (s *UserService) eraseOrderData(ctx context.Context, userID int) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/users/%d/erase", s.orderURL, userID), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.orderClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("order-service returned status %d", resp.StatusCode)
+	}
+	return nil
+}
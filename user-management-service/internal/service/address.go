@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"user-management-service/internal/entity"
+)
+
+// ListAddresses returns a user's address book.
+func (s *UserService) ListAddresses(ctx context.Context, userID int) ([]entity.Address, error) {
+	addresses, err := s.repo.ListAddresses(ctx, userID)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Error listing addresses of user %d", userID)
+	}
+	return addresses, err
+}
+
+// GetAddress returns one of a user's addresses.
+func (s *UserService) GetAddress(ctx context.Context, userID, id int) (*entity.Address, error) {
+	return s.repo.GetAddress(ctx, userID, id)
+}
+
+// CreateAddress validates an address and adds it to the user's address book. The first address
+// becomes the default shipping and billing address.
+func (s *UserService) CreateAddress(ctx context.Context, userID int, address *entity.Address) (*entity.Address, error) {
+	address.ID = 0
+	address.UserID = userID
+	if err := s.addressValidator.Validate(address); err != nil {
+		return nil, err
+	}
+
+	existing, err := s.repo.ListAddresses(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) == 0 {
+		address.DefaultShipping = true
+		address.DefaultBilling = true
+	}
+
+	created, err := s.repo.CreateAddress(ctx, address)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Error creating address for user %d", userID)
+		return nil, err
+	}
+	return created, nil
+}
+
+// UpdateAddress validates and saves changes to one of a user's addresses. Orders placed before
+// keep their copy of the old address.
+func (s *UserService) UpdateAddress(ctx context.Context, userID, id int, address *entity.Address) (*entity.Address, error) {
+	if _, err := s.repo.GetAddress(ctx, userID, id); err != nil {
+		return nil, err
+	}
+
+	address.ID = id
+	address.UserID = userID
+	if err := s.addressValidator.Validate(address); err != nil {
+		return nil, err
+	}
+
+	updated, err := s.repo.UpdateAddress(ctx, address)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Error updating address %d of user %d", id, userID)
+		return nil, err
+	}
+	return updated, nil
+}
+
+// DeleteAddress removes an address from a user's address book.
+func (s *UserService) DeleteAddress(ctx context.Context, userID, id int) error {
+	return s.repo.DeleteAddress(ctx, userID, id)
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"shared/auth"
+	"strings"
+	"time"
+	"user-management-service/internal/entity"
+	"user-management-service/internal/repository"
+)
+
+const (
+	// defaultAPIKeyTTL is the lifetime of keys created without an expiry, so forgotten keys
+	// don't stay valid forever.
+	defaultAPIKeyTTL = 365 * 24 * time.Hour
+	// apiKeyTouchInterval limits how often last_used_at is written for a busy key.
+	apiKeyTouchInterval = time.Minute
+)
+
+// CreateAPIKey issues an API key acting as the user with the given scopes, which must be among
+// the user's own permissions. Admin permissions are refused, since they require a second factor
+// that API keys can't provide. The key is only returned this once.
+func (s *UserService) CreateAPIKey(ctx context.Context, userID int, name string, scopes []string, expiresAt *time.Time) (*entity.APIKey, error) {
+	if name == "" || len(scopes) == 0 {
+		return nil, fmt.Errorf("name and scopes are required")
+	}
+	now := time.Now()
+	if expiresAt == nil {
+		expiry := now.Add(defaultAPIKeyTTL)
+		expiresAt = &expiry
+	}
+	if !expiresAt.After(now) {
+		return nil, fmt.Errorf("expires_at must be in the future")
+	}
+
+	_, permissions, err := s.repo.GetUserRoles(ctx, userID)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Error getting roles of user %d", userID)
+		return nil, err
+	}
+	granted := &auth.Claims{Permissions: permissions}
+	for _, scope := range scopes {
+		if !granted.HasPermission(scope) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidScope, scope)
+		}
+	}
+	if entity.RequiresTwoFactor(scopes) {
+		return nil, fmt.Errorf("%w: API keys can't have admin permissions", ErrInvalidScope)
+	}
+
+	prefix, err := randomToken(9)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := s.repo.CreateAPIKey(ctx, &entity.APIKey{
+		UserID:     userID,
+		Name:       name,
+		Prefix:     prefix,
+		SecretHash: hashToken(secret),
+		Scopes:     scopes,
+		ExpiresAt:  *expiresAt,
+	})
+	if err != nil {
+		logger.Error().Err(err).Msgf("Error creating API key for user %d", userID)
+		return nil, err
+	}
+
+	key.Key = auth.APIKeyPrefix + prefix + "." + secret
+	return key, nil
+}
+
+// ListAPIKeys returns the user's API keys, including revoked and expired ones, without secrets.
+func (s *UserService) ListAPIKeys(ctx context.Context, userID int) ([]entity.APIKey, error) {
+	keys, err := s.repo.ListAPIKeys(ctx, userID)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Error listing API keys of user %d", userID)
+		return nil, err
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey revokes one of the user's keys. It's also put on the revocation list, so services
+// that cached the key stop accepting it right away.
+func (s *UserService) RevokeAPIKey(ctx context.Context, userID, id int) error {
+	if err := s.repo.RevokeAPIKey(ctx, userID, id); err != nil {
+		return err
+	}
+	return s.revocations.Revoke(ctx, auth.APIKeyRevocationID(fmt.Sprint(id)), auth.APIKeyCacheTTL)
+}
+
+// revokeAllAPIKeys revokes every key of a user, e.g. when the account is deleted.
+func (s *UserService) revokeAllAPIKeys(ctx context.Context, userID int) error {
+	keys, err := s.repo.ListAPIKeys(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if key.RevokedAt != nil {
+			continue
+		}
+		if err := s.RevokeAPIKey(ctx, userID, key.ID); err != nil && !errors.Is(err, repository.ErrAPIKeyNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// IntrospectAPIKey resolves an API key into the claims of its owner, for the other services. The
+// key's scopes are narrowed to the permissions the owner still has, so removing a role also
+// takes it away from the user's keys.
+func (s *UserService) IntrospectAPIKey(ctx context.Context, presented string) (*auth.Claims, error) {
+	prefix, secret, ok := strings.Cut(strings.TrimPrefix(presented, auth.APIKeyPrefix), ".")
+	if !ok || !auth.IsAPIKey(presented) {
+		return nil, auth.ErrInvalidAPIKey
+	}
+
+	key, err := s.repo.GetAPIKeyByPrefix(ctx, prefix)
+	if errors.Is(err, repository.ErrAPIKeyNotFound) {
+		return nil, auth.ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(key.SecretHash)) != 1 || key.RevokedAt != nil || now.After(key.ExpiresAt) {
+		return nil, auth.ErrInvalidAPIKey
+	}
+
+	user, err := s.repo.GetUserByID(ctx, key.UserID)
+	if err != nil {
+		return nil, err
+	}
+	_, permissions, err := s.repo.GetUserRoles(ctx, key.UserID)
+	if err != nil {
+		return nil, err
+	}
+	owner := &auth.Claims{Permissions: permissions}
+	var scopes []string
+	for _, scope := range key.Scopes {
+		if owner.HasPermission(scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > apiKeyTouchInterval {
+		if err := s.repo.TouchAPIKey(ctx, key.ID, now); err != nil {
+			logger.Error().Err(err).Msgf("Error recording use of API key %d", key.ID)
+		}
+	}
+
+	return &auth.Claims{
+		Name:        user.Username,
+		Email:       user.Email,
+		APIKeyID:    fmt.Sprint(key.ID),
+		Permissions: scopes,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    auth.Issuer,
+			Subject:   fmt.Sprint(key.UserID),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(key.ExpiresAt),
+		},
+	}, nil
+}
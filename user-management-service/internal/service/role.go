@@ -0,0 +1,29 @@
+package service
+
+import (
+	"context"
+	"user-management-service/internal/entity"
+)
+
+// ListRoles returns every role with its permissions.
+func (s *UserService) ListRoles(ctx context.Context) ([]entity.Role, error) {
+	return s.repo.ListRoles(ctx)
+}
+
+// AssignRole gives a role to a user. It applies to the user's tokens from their next refresh.
+func (s *UserService) AssignRole(ctx context.Context, userID int, role string) error {
+	err := s.repo.AssignRole(ctx, userID, role)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Error assigning role %s to user %d", role, userID)
+	}
+	return err
+}
+
+// RemoveRole takes a role away from a user. It applies to the user's tokens from their next refresh.
+func (s *UserService) RemoveRole(ctx context.Context, userID int, role string) error {
+	err := s.repo.RemoveRole(ctx, userID, role)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Error removing role %s from user %d", role, userID)
+	}
+	return err
+}
@@ -0,0 +1,288 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"shared/auth"
+	"slices"
+	"strings"
+	"time"
+	"user-management-service/internal/entity"
+	"user-management-service/internal/loginguard"
+	"user-management-service/internal/repository"
+)
+
+const (
+	// accessTokenTTL is kept short because access tokens are checked without a session lookup,
+	// only against the revocation list.
+	accessTokenTTL = 15 * time.Minute
+	// sessionTTL is how long a session lives, however often its refresh token is rotated.
+	sessionTTL = 30 * 24 * time.Hour
+)
+
+// ErrInvalidRefreshToken is returned for unknown, expired or already used refresh tokens.
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// Login checks the credentials and opens a new session for the device. Failed logins are counted
+// by the login guard, which slows down, challenges or locks out repeated failures. Users with a
+// second factor, or whose role requires one, get a challenge token instead of a session.
+func (s *UserService) Login(ctx context.Context, email, plaintext, captchaToken string, device entity.DeviceInfo) (*entity.LoginResult, error) {
+	attempt := loginguard.Attempt{Email: email, IP: device.IP, UserAgent: device.UserAgent, CaptchaToken: captchaToken}
+	if err := s.guard.Check(ctx, attempt); err != nil {
+		return nil, err
+	}
+
+	user, err := s.authenticate(ctx, email, plaintext)
+	if errors.Is(err, ErrInvalidCredentials) {
+		captchaRequired, guardErr := s.guard.Failure(ctx, attempt)
+		if guardErr != nil {
+			logger.Error().Err(guardErr).Msg("Error recording failed login")
+		}
+		if captchaRequired {
+			return nil, fmt.Errorf("%w: %w", err, loginguard.ErrCaptchaRequired)
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the failures are only reset once the second factor is checked too
+	challenge, err := s.twoFactorChallenge(ctx, user.ID, device)
+	if err != nil || challenge != nil {
+		return challenge, err
+	}
+
+	if err := s.guard.Success(ctx, attempt, user.ID); err != nil {
+		logger.Error().Err(err).Msgf("Error resetting failed logins of user %d", user.ID)
+	}
+
+	tokens, err := s.openSession(ctx, user, device)
+	if err != nil {
+		return nil, err
+	}
+	return &entity.LoginResult{TokenPair: tokens}, nil
+}
+
+// openSession opens a new session for an authenticated user and issues its tokens.
+func (s *UserService) openSession(ctx context.Context, user *entity.User, device entity.DeviceInfo) (*entity.TokenPair, error) {
+	sessionID, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := &entity.Session{
+		ID:          sessionID,
+		UserID:      user.ID,
+		Device:      device.Device,
+		UserAgent:   device.UserAgent,
+		IP:          device.IP,
+		CreatedAt:   now,
+		LastUsedAt:  now,
+		ExpiresAt:   now.Add(sessionTTL),
+		RefreshHash: hashToken(secret),
+	}
+	if err := s.sessionRepo.SaveSession(ctx, session); err != nil {
+		logger.Error().Err(err).Msgf("Error saving session for user %d", user.ID)
+		return nil, err
+	}
+
+	return s.issueTokens(ctx, user, session, secret)
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh token. Presenting a
+// refresh token that was already exchanged means it leaked, so the whole session is revoked.
+func (s *UserService) Refresh(ctx context.Context, refreshToken string) (*entity.TokenPair, error) {
+	sessionID, secret, ok := strings.Cut(refreshToken, ".")
+	if !ok {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	session, err := s.sessionRepo.GetSession(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, repository.ErrSessionNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	presented := hashToken(secret)
+	if subtle.ConstantTimeCompare([]byte(presented), []byte(session.RefreshHash)) != 1 {
+		if subtle.ConstantTimeCompare([]byte(presented), []byte(session.PreviousRefreshHash)) == 1 {
+			logger.Warn().Msgf("Refresh token reuse on session %s of user %d, revoking it", session.ID, session.UserID)
+			if err := s.revokeSession(ctx, session.UserID, session.ID); err != nil {
+				return nil, err
+			}
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+
+	newSecret, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	session, err = s.sessionRepo.RotateRefreshToken(ctx, session.ID, presented, hashToken(newSecret), time.Now())
+	if err != nil {
+		if errors.Is(err, repository.ErrSessionNotFound) || errors.Is(err, repository.ErrRefreshTokenChanged) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	user, err := s.repo.GetUserByID(ctx, session.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(ctx, user, session, newSecret)
+}
+
+// ValidateToken verifies an access token and checks that its session is still active. Service
+// tokens are accepted if they were issued for this service and their client isn't revoked.
+func (s *UserService) ValidateToken(ctx context.Context, token string) (*auth.Claims, error) {
+	claims := &auth.Claims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, s.keyring.Keyfunc, jwt.WithValidMethods(auth.SigningMethods), jwt.WithIssuer(auth.Issuer))
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %v", err)
+	}
+	if claims.ClientID != "" && !slices.Contains(claims.Audience, serviceAudience) {
+		return nil, fmt.Errorf("token is not for this service")
+	}
+	revocationID := auth.RevocationID(parsed)
+	if revocationID == "" {
+		return nil, fmt.Errorf("token has no session")
+	}
+
+	revoked, err := s.revocations.IsRevoked(ctx, revocationID)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, fmt.Errorf("session has been revoked")
+	}
+
+	return claims, nil
+}
+
+// ListSessions returns the active sessions of a user, marking the one the request comes from.
+func (s *UserService) ListSessions(ctx context.Context, userID int, currentSessionID string) ([]*entity.Session, error) {
+	sessions, err := s.sessionRepo.ListSessions(ctx, userID)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Error listing sessions of user %d", userID)
+		return nil, err
+	}
+
+	for _, session := range sessions {
+		session.Current = session.ID == currentSessionID
+	}
+	return sessions, nil
+}
+
+// RevokeSession ends one of the user's sessions, e.g. a lost device or a logout.
+func (s *UserService) RevokeSession(ctx context.Context, userID int, sessionID string) error {
+	session, err := s.sessionRepo.GetSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	// users can only end their own sessions
+	if session.UserID != userID {
+		return repository.ErrSessionNotFound
+	}
+
+	return s.revokeSession(ctx, userID, sessionID)
+}
+
+// RevokeAllSessions ends every session of a user, logging them out on all devices.
+func (s *UserService) RevokeAllSessions(ctx context.Context, userID int) error {
+	sessions, err := s.sessionRepo.ListSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if err := s.revokeSession(ctx, userID, session.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revokeSession adds the session to the revocation list before deleting it, so its access tokens
+// stop working everywhere and its refresh token can't be used again.
+func (s *UserService) revokeSession(ctx context.Context, userID int, sessionID string) error {
+	if err := s.revocations.Revoke(ctx, sessionID, accessTokenTTL); err != nil {
+		logger.Error().Err(err).Msgf("Error revoking session %s", sessionID)
+		return err
+	}
+	return s.sessionRepo.DeleteSession(ctx, userID, sessionID)
+}
+
+// issueTokens signs an access token carrying the user's current roles and permissions, so role
+// changes reach the other services at the latest when the token is refreshed.
+func (s *UserService) issueTokens(ctx context.Context, user *entity.User, session *entity.Session, refreshSecret string) (*entity.TokenPair, error) {
+	now := time.Now()
+	jti, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	roles, permissions, err := s.repo.GetUserRoles(ctx, user.ID)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Error getting roles of user %d", user.ID)
+		return nil, err
+	}
+
+	claims := &auth.Claims{
+		Name:        user.Username,
+		Email:       user.Email,
+		SessionID:   session.ID,
+		Roles:       roles,
+		Permissions: permissions,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Issuer:    auth.Issuer,
+			Subject:   fmt.Sprint(user.ID),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(accessTokenTTL)),
+		},
+	}
+
+	accessToken, err := s.keyring.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entity.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: session.ID + "." + refreshSecret,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(accessTokenTTL.Seconds()),
+		SessionID:    session.ID,
+	}, nil
+}
+
+func randomToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken hashes a refresh token secret. The secrets are random, so a fast hash is enough.
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
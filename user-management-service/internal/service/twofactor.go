@@ -0,0 +1,405 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+	"user-management-service/internal/entity"
+	"user-management-service/internal/loginguard"
+	"user-management-service/internal/repository"
+	"user-management-service/internal/totp"
+)
+
+const (
+	// challengeTTL is how long a user has to enter their second factor after their password.
+	challengeTTL = 5 * time.Minute
+	// maxChallengeAttempts is the number of wrong codes after which a challenge is dropped. Wrong
+	// codes also count as failed logins, so guessing ends in a lockout.
+	maxChallengeAttempts = 5
+	// recoveryCodeCount is the number of recovery codes generated at once.
+	recoveryCodeCount = 10
+	// totpIssuer is shown next to the account in authenticator apps.
+	totpIssuer = "microservices"
+)
+
+// ErrInvalidChallenge is returned for challenge tokens that are unknown, expired or used up.
+var ErrInvalidChallenge = errors.New("invalid or expired challenge token")
+
+// ErrInvalidTwoFactorCode is returned for wrong, reused or expired codes and recovery codes.
+var ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+
+// ErrTwoFactorEnabled is returned when enrolling a user who already has a second factor.
+var ErrTwoFactorEnabled = errors.New("two-factor authentication is already enabled")
+
+// ErrTwoFactorRequired is returned when a user whose role requires a second factor tries to
+// disable it, or to complete a login without setting it up.
+var ErrTwoFactorRequired = errors.New("two-factor authentication is required for your role")
+
+// TwoFactorStatus describes the second factor of a user.
+type TwoFactorStatus struct {
+	Enabled           bool `json:"enabled"`
+	Required          bool `json:"required"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
+
+// GetTwoFactorStatus tells whether a user has a second factor, and whether they must have one.
+func (s *UserService) GetTwoFactorStatus(ctx context.Context, userID int) (*TwoFactorStatus, error) {
+	_, permissions, err := s.repo.GetUserRoles(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	status := &TwoFactorStatus{Required: entity.RequiresTwoFactor(permissions)}
+
+	twoFactor, err := s.repo.GetTwoFactor(ctx, userID)
+	if errors.Is(err, repository.ErrTwoFactorNotFound) {
+		return status, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	status.Enabled = twoFactor.Enabled
+
+	if status.Enabled {
+		status.RecoveryCodesLeft, err = s.repo.CountRecoveryCodes(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// EnrollTwoFactor starts setting up an authenticator app. The second factor is only enabled once
+// ConfirmTwoFactor receives a code from the app.
+func (s *UserService) EnrollTwoFactor(ctx context.Context, userID int) (*entity.TwoFactorEnrollment, error) {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	twoFactor, err := s.repo.GetTwoFactor(ctx, userID)
+	if err != nil && !errors.Is(err, repository.ErrTwoFactorNotFound) {
+		return nil, err
+	}
+	if twoFactor != nil && twoFactor.Enabled {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := s.totpSealer.Seal(secret)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SavePendingTwoFactor(ctx, userID, sealed); err != nil {
+		logger.Error().Err(err).Msgf("Error saving two-factor secret of user %d", userID)
+		return nil, err
+	}
+
+	return &entity.TwoFactorEnrollment{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(totpIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTwoFactor enables a pending second factor with a code from the app, and returns the
+// recovery codes. They are only shown this once.
+func (s *UserService) ConfirmTwoFactor(ctx context.Context, userID int, code string) ([]string, error) {
+	twoFactor, err := s.repo.GetTwoFactor(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if twoFactor.Enabled {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	secret, err := s.totpSealer.Open(twoFactor.Secret)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.EnableTwoFactor(ctx, userID, step, hashes); err != nil {
+		logger.Error().Err(err).Msgf("Error enabling two-factor authentication of user %d", userID)
+		return nil, err
+	}
+
+	logger.Info().Msgf("Enabled two-factor authentication of user %d", userID)
+	return codes, nil
+}
+
+// DisableTwoFactor removes a user's second factor after checking their password and a code.
+// Users whose role requires a second factor can't remove it.
+func (s *UserService) DisableTwoFactor(ctx context.Context, userID int, currentPassword, code string) error {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkPassword(user, currentPassword); err != nil {
+		return err
+	}
+
+	_, permissions, err := s.repo.GetUserRoles(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if entity.RequiresTwoFactor(permissions) {
+		return ErrTwoFactorRequired
+	}
+
+	if err := s.verifySecondFactor(ctx, userID, code); err != nil {
+		return err
+	}
+
+	if err := s.repo.DisableTwoFactor(ctx, userID); err != nil {
+		logger.Error().Err(err).Msgf("Error disabling two-factor authentication of user %d", userID)
+		return err
+	}
+
+	logger.Info().Msgf("Disabled two-factor authentication of user %d", userID)
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces a user's recovery codes after checking a code.
+func (s *UserService) RegenerateRecoveryCodes(ctx context.Context, userID int, code string) ([]string, error) {
+	if err := s.verifySecondFactor(ctx, userID, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		logger.Error().Err(err).Msgf("Error replacing recovery codes of user %d", userID)
+		return nil, err
+	}
+	return codes, nil
+}
+
+// CompleteLogin finishes a login challenged for a second factor. The code is a TOTP code or a
+// recovery code.
+func (s *UserService) CompleteLogin(ctx context.Context, challengeToken, code string) (*entity.LoginResult, error) {
+	tokenHash := hashToken(challengeToken)
+	challenge, err := s.sessionRepo.GetChallenge(ctx, tokenHash)
+	if err != nil {
+		if errors.Is(err, repository.ErrChallengeNotFound) {
+			return nil, ErrInvalidChallenge
+		}
+		return nil, err
+	}
+	if challenge.SetupRequired {
+		return nil, ErrTwoFactorRequired
+	}
+
+	if err := s.verifySecondFactor(ctx, challenge.UserID, code); err != nil {
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			s.challengeFailed(ctx, tokenHash, challenge)
+		}
+		return nil, err
+	}
+
+	return s.finishChallenge(ctx, tokenHash, challenge, nil)
+}
+
+// EnrollDuringLogin starts setting up a second factor for a login challenged because the user's
+// role requires one.
+func (s *UserService) EnrollDuringLogin(ctx context.Context, challengeToken string) (*entity.TwoFactorEnrollment, error) {
+	challenge, err := s.sessionRepo.GetChallenge(ctx, hashToken(challengeToken))
+	if err != nil {
+		if errors.Is(err, repository.ErrChallengeNotFound) {
+			return nil, ErrInvalidChallenge
+		}
+		return nil, err
+	}
+	if !challenge.SetupRequired {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	return s.EnrollTwoFactor(ctx, challenge.UserID)
+}
+
+// ConfirmDuringLogin enables the second factor set up with EnrollDuringLogin and finishes the
+// login, returning the session tokens and the recovery codes.
+func (s *UserService) ConfirmDuringLogin(ctx context.Context, challengeToken, code string) (*entity.LoginResult, error) {
+	tokenHash := hashToken(challengeToken)
+	challenge, err := s.sessionRepo.GetChallenge(ctx, tokenHash)
+	if err != nil {
+		if errors.Is(err, repository.ErrChallengeNotFound) {
+			return nil, ErrInvalidChallenge
+		}
+		return nil, err
+	}
+	if !challenge.SetupRequired {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	codes, err := s.ConfirmTwoFactor(ctx, challenge.UserID, code)
+	if err != nil {
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			s.challengeFailed(ctx, tokenHash, challenge)
+		}
+		return nil, err
+	}
+
+	return s.finishChallenge(ctx, tokenHash, challenge, codes)
+}
+
+// twoFactorChallenge returns a challenge for users who must enter a second factor, or set one up
+// because their role requires it, and nil for everyone else.
+func (s *UserService) twoFactorChallenge(ctx context.Context, userID int, device entity.DeviceInfo) (*entity.LoginResult, error) {
+	status, err := s.GetTwoFactorStatus(ctx, userID)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Error getting two-factor status of user %d", userID)
+		return nil, err
+	}
+	if !status.Enabled && !status.Required {
+		return nil, nil
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	challenge := &entity.LoginChallenge{
+		UserID:        userID,
+		Device:        device,
+		SetupRequired: !status.Enabled,
+		ExpiresAt:     time.Now().Add(challengeTTL),
+	}
+	if err := s.sessionRepo.SaveChallenge(ctx, hashToken(token), challenge); err != nil {
+		logger.Error().Err(err).Msgf("Error saving login challenge of user %d", userID)
+		return nil, err
+	}
+
+	return &entity.LoginResult{
+		TwoFactorRequired:      status.Enabled,
+		TwoFactorSetupRequired: !status.Enabled,
+		ChallengeToken:         token,
+		ChallengeExpiresIn:     int(challengeTTL.Seconds()),
+	}, nil
+}
+
+// finishChallenge ends a challenge that was passed and opens the session.
+func (s *UserService) finishChallenge(ctx context.Context, tokenHash string, challenge *entity.LoginChallenge, recoveryCodes []string) (*entity.LoginResult, error) {
+	deleted, err := s.sessionRepo.DeleteChallenge(ctx, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+	if !deleted {
+		return nil, ErrInvalidChallenge
+	}
+
+	user, err := s.repo.GetUserByID(ctx, challenge.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	attempt := loginguard.Attempt{Email: user.Email, IP: challenge.Device.IP, UserAgent: challenge.Device.UserAgent}
+	if err := s.guard.Success(ctx, attempt, user.ID); err != nil {
+		logger.Error().Err(err).Msgf("Error resetting failed logins of user %d", user.ID)
+	}
+
+	tokens, err := s.openSession(ctx, user, challenge.Device)
+	if err != nil {
+		return nil, err
+	}
+	return &entity.LoginResult{TokenPair: tokens, RecoveryCodes: recoveryCodes}, nil
+}
+
+// challengeFailed counts a wrong code as a failed login, and drops the challenge after too many.
+func (s *UserService) challengeFailed(ctx context.Context, tokenHash string, challenge *entity.LoginChallenge) {
+	attempts, err := s.sessionRepo.ChallengeFailed(ctx, tokenHash, time.Until(challenge.ExpiresAt))
+	if err != nil {
+		logger.Error().Err(err).Msgf("Error counting failed challenge of user %d", challenge.UserID)
+	}
+	if attempts >= maxChallengeAttempts {
+		if _, err := s.sessionRepo.DeleteChallenge(ctx, tokenHash); err != nil {
+			logger.Error().Err(err).Msgf("Error deleting login challenge of user %d", challenge.UserID)
+		}
+	}
+
+	user, err := s.repo.GetUserByID(ctx, challenge.UserID)
+	if err != nil {
+		return
+	}
+	attempt := loginguard.Attempt{Email: user.Email, IP: challenge.Device.IP, UserAgent: challenge.Device.UserAgent}
+	if _, err := s.guard.Failure(ctx, attempt); err != nil {
+		logger.Error().Err(err).Msg("Error recording failed login")
+	}
+}
+
+// verifySecondFactor checks a TOTP code, or else a recovery code, of a user with an enabled
+// second factor. Accepted codes can't be used again.
+func (s *UserService) verifySecondFactor(ctx context.Context, userID int, code string) error {
+	twoFactor, err := s.repo.GetTwoFactor(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !twoFactor.Enabled {
+		return repository.ErrTwoFactorNotFound
+	}
+
+	secret, err := s.totpSealer.Open(twoFactor.Secret)
+	if err != nil {
+		return err
+	}
+	if step, ok := totp.Validate(secret, code, time.Now()); ok {
+		fresh, err := s.repo.UseTwoFactorStep(ctx, userID, step)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return ErrInvalidTwoFactorCode
+		}
+		return nil
+	}
+
+	used, err := s.repo.UseRecoveryCode(ctx, userID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidTwoFactorCode
+	}
+	logger.Info().Msgf("User %d logged in with a recovery code", userID)
+	return nil
+}
+
+// recoveryAlphabet leaves out characters that are easily confused when read from paper.
+const recoveryAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// generateRecoveryCodes returns new recovery codes like "k7m2p-x9q4r" and their hashes. They are
+// random enough for a fast hash, like refresh tokens.
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 10)
+		for j := range b {
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(recoveryAlphabet))))
+			if err != nil {
+				return nil, nil, err
+			}
+			b[j] = recoveryAlphabet[n.Int64()]
+		}
+		codes[i] = string(b[:5]) + "-" + string(b[5:])
+		hashes[i] = hashToken(normalizeRecoveryCode(codes[i]))
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
@@ -2,53 +2,116 @@ package service
 
 import (
 	"context"
+	"crypto/subtle"
+	"database/sql"
 	"errors"
 	"fmt"
-	"github.com/go-redis/redis/v8"
-	"github.com/golang-jwt/jwt/v5"
-	"github.com/rs/zerolog"
-	"os"
-	"time"
+	"net/http"
+	"shared/auth"
+	"shared/logging"
+	"user-management-service/internal/address"
 	"user-management-service/internal/entity"
+	"user-management-service/internal/keys"
+	"user-management-service/internal/loginguard"
+	"user-management-service/internal/notify"
+	"user-management-service/internal/password"
 	"user-management-service/internal/repository"
+	"user-management-service/internal/totp"
 )
 
-var logger = zerolog.New(os.Stdout).With().Timestamp().Logger()
+var logger = logging.Logger
+
+// ErrInvalidCredentials is returned for both unknown emails and wrong passwords, so logins
+// don't reveal which accounts exist.
+var ErrInvalidCredentials = errors.New("invalid email or password")
+
+// minPasswordLength is the shortest password accepted for new accounts.
+const minPasswordLength = 8
 
 type UserService struct {
-	repo repository.UserRepository
-	rdb  *redis.Client
+	repo             repository.UserRepository
+	sessionRepo      *repository.SessionRepository
+	revocations      *auth.RevocationList
+	keyring          *keys.Keyring
+	guard            *loginguard.Guard
+	totpSealer       *totp.Sealer
+	notifier         notify.Notifier
+	appURL           string // Base URL of the links sent by email
+	orderURL         string
+	orderClient      *http.Client
+	addressValidator *address.Validator
 }
 
 // NewUserService creates a new instance of UserService.
-func NewUserService(repo repository.UserRepository) *UserService {
-	return &UserService{repo: repo}
+func NewUserService(repo repository.UserRepository, sessionRepo *repository.SessionRepository, revocations *auth.RevocationList, keyring *keys.Keyring, guard *loginguard.Guard, totpSealer *totp.Sealer, notifier notify.Notifier, appURL, orderURL string, orderClient *http.Client, addressValidator *address.Validator) *UserService {
+	return &UserService{
+		repo:             repo,
+		sessionRepo:      sessionRepo,
+		revocations:      revocations,
+		keyring:          keyring,
+		guard:            guard,
+		totpSealer:       totpSealer,
+		notifier:         notifier,
+		appURL:           appURL,
+		orderURL:         orderURL,
+		orderClient:      orderClient,
+		addressValidator: addressValidator,
+	}
 }
 
-type JwtCustomClaims struct {
-	Name  string `json:"name"`
-	Email string `json:"email"`
-	jwt.RegisteredClaims
+// JWKS returns the public keys access tokens are signed with.
+func (s *UserService) JWKS() (auth.JWKS, error) {
+	return s.keyring.JWKS()
 }
 
 // GetUserByID retrieves a user by ID (stub for now).
 func (s *UserService) GetUserByID(ctx context.Context, id int) (*entity.User, error) {
 	user, err := s.repo.GetUserByID(ctx, id)
 	if err != nil {
-		logger.Error().Err(err).Msgf("Error getting user by ID %d", id)
+		logger.Error().Ctx(ctx).Err(err).Msgf("Error getting user by ID %d", id)
+		return nil, err
+	}
+
+	user.Roles, _, err = s.repo.GetUserRoles(ctx, id)
+	if err != nil {
+		logger.Error().Ctx(ctx).Err(err).Msgf("Error getting roles of user %d", id)
 		return nil, err
 	}
 
 	return user, nil
 }
 
-// CreateUser creates a new user (stub for now).
+// CreateUser creates a new user, storing only the hash of its password.
 func (s *UserService) CreateUser(ctx context.Context, user *entity.User) (*entity.User, error) {
+	if len(user.Password) < minPasswordLength {
+		return nil, fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+
+	hash, err := password.Hash(user.Password, password.DefaultParams)
+	if err != nil {
+		logger.Error().Ctx(ctx).Err(err).Msg("Error hashing password")
+		return nil, err
+	}
+	user.PasswordHash = hash
+	user.Password = ""
+
 	createdUser, err := s.repo.CreateUser(ctx, user)
 	if err != nil {
-		logger.Error().Err(err).Msg("Error creating user")
+		logger.Error().Ctx(ctx).Err(err).Msg("Error creating user")
+		return nil, err
+	}
+
+	err = s.repo.AssignRole(ctx, createdUser.ID, entity.DefaultRole)
+	if err != nil {
+		logger.Error().Ctx(ctx).Err(err).Msgf("Error assigning default role to user %d", createdUser.ID)
 		return nil, err
 	}
+	createdUser.Roles = []string{entity.DefaultRole}
+
+	// the account works without a verified email, so a failed send can be retried with a resend
+	if err := s.sendVerification(ctx, createdUser); err != nil {
+		logger.Error().Ctx(ctx).Err(err).Msgf("Error sending verification email to user %d", createdUser.ID)
+	}
 
 	return createdUser, nil
 }
@@ -57,53 +120,53 @@ func (s *UserService) CreateUser(ctx context.Context, user *entity.User) (*entit
 //func (s *UserService) Login(email string, password string) (*entity.User, error) {
 //	user, err := s.repo.GetUserByEmailAndPassword(email, password)
 //	if err != nil {
-//		logger.Error().Err(err).Msg("Error logging in user")
+//		logger.Error().Ctx(ctx).Err(err).Msg("Error logging in user")
 //		return nil, err
 //	}
 //
 //	return user, nil
 //}
 
-func (s *UserService) Login(ctx context.Context, email, password string) (token string, err error) {
-	user, err := s.repo.GetUserByEmailAndPassword(ctx, email, password)
+// authenticate checks an email and password. Hashes made with outdated parameters, and plaintext
+// passwords left from before hashing, are replaced with a fresh hash on success.
+func (s *UserService) authenticate(ctx context.Context, email, plaintext string) (*entity.User, error) {
+	user, err := s.repo.GetUserByEmail(ctx, email)
 	if err != nil {
-		return "", err
-	}
-
-	// After validation, generate JWT token
-	claims := &JwtCustomClaims{
-		Name:  user.Username,
-		Email: user.Email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 24)),
-		},
+		if errors.Is(err, sql.ErrNoRows) {
+			password.VerifyDummy(plaintext)
+			return nil, ErrInvalidCredentials
+		}
+		logger.Error().Ctx(ctx).Err(err).Msgf("Error getting user by email %s", email)
+		return nil, err
 	}
 
-	tkn := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	t, err := tkn.SignedString([]byte("secret"))
-	if err != nil {
-		return "", err
+	var ok, needsRehash bool
+	if password.IsHash(user.PasswordHash) {
+		ok, needsRehash, err = password.Verify(plaintext, user.PasswordHash, password.DefaultParams)
+		if err != nil {
+			logger.Error().Ctx(ctx).Err(err).Msgf("Error verifying password of user %d", user.ID)
+			return nil, ErrInvalidCredentials
+		}
+	} else {
+		ok = subtle.ConstantTimeCompare([]byte(plaintext), []byte(user.PasswordHash)) == 1
+		needsRehash = true
 	}
-
-	// Store the JWT token in Redis with the user email as the key
-	err = s.rdb.Set(ctx, email, t, time.Hour*24).Err() // Set expiration to 24 hours
-	if err != nil {
-		return "", err
+	if !ok {
+		return nil, ErrInvalidCredentials
 	}
 
-	// Return the user and the generated JWT token
-	return t, nil
-}
-
-func (s *UserService) ValidateToken(ctx context.Context, email string) (string, error) {
-	// Retrieve the JWT token from Redis
-	token, err := s.rdb.Get(ctx, email).Result()
-	if err != nil {
-		if errors.Is(err, redis.Nil) {
-			return "", fmt.Errorf("session not found")
+	if needsRehash {
+		hash, err := password.Hash(plaintext, password.DefaultParams)
+		if err == nil {
+			err = s.repo.UpdatePasswordHash(ctx, user.ID, hash)
+		}
+		if err != nil {
+			// the login is still valid, the rehash is retried next time
+			logger.Error().Ctx(ctx).Err(err).Msgf("Error rehashing password of user %d", user.ID)
+		} else {
+			user.PasswordHash = hash
 		}
-		return "", err
 	}
 
-	return token, nil
+	return user, nil
 }
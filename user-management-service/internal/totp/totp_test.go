@@ -0,0 +1,143 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// The test vectors of RFC 6238 appendix B for HMAC-SHA1, whose key is the ASCII string
+// "12345678901234567890".
+var rfc6238 = []struct {
+	unix int64
+	code string // 8 digits, the 6 digit code is its end
+}{
+	{59, "94287082"},
+	{1111111109, "07081804"},
+	{1111111111, "14050471"},
+	{1234567890, "89005924"},
+	{2000000000, "69279037"},
+	{20000000000, "65353130"},
+}
+
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestHOTPVectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+	for _, vector := range rfc6238 {
+		step := Step(time.Unix(vector.unix, 0))
+		if got := hotp(key, step, 8); got != vector.code {
+			t.Errorf("code at %d is %s, want %s", vector.unix, got, vector.code)
+		}
+	}
+}
+
+func TestCodeVectors(t *testing.T) {
+	for _, vector := range rfc6238 {
+		got, err := Code(rfc6238Secret, Step(time.Unix(vector.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := vector.code[2:]; got != want {
+			t.Errorf("code at %d is %s, want %s", vector.unix, got, want)
+		}
+	}
+
+	// secrets are accepted in lower case, as some apps show them
+	if got, _ := Code("gezdgnbvgy3tqojqgezdgnbvgy3tqojq", Step(time.Unix(59, 0))); got != "287082" {
+		t.Errorf("lower case secret gives %s, want 287082", got)
+	}
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("invalid secret accepted")
+	}
+}
+
+func TestStep(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want int64
+	}{
+		{0, 0},
+		{29, 0},
+		{30, 1},
+		{59, 1},
+		{60, 2},
+		{1111111109, 37037036},
+		{1111111111, 37037037},
+	}
+	for _, test := range tests {
+		if got := Step(time.Unix(test.unix, 0)); got != test.want {
+			t.Errorf("step of %d is %d, want %d", test.unix, got, test.want)
+		}
+	}
+}
+
+// TestValidateSkew checks that exactly one period before and after the current one is accepted,
+// at both ends of the current period.
+func TestValidateSkew(t *testing.T) {
+	const step = 37037037
+	start := time.Unix(step*30, 0)
+	end := start.Add(Period - time.Second)
+
+	tests := []struct {
+		name   string
+		at     time.Time
+		offset int64 // of the code's step from step
+		valid  bool
+	}{
+		{"current at start", start, 0, true},
+		{"current at end", end, 0, true},
+		{"previous at start", start, -1, true},
+		{"previous at end", end, -1, true},
+		{"next at start", start, 1, true},
+		{"next at end", end, 1, true},
+		{"two before at start", start, -2, false},
+		{"two before at end", end, -2, false},
+		{"two after at start", start, 2, false},
+		{"two after at end", end, 2, false},
+		// a second later the period after is current, so the code of step-1 is two behind
+		{"previous after end", end.Add(time.Second), -1, false},
+		{"next after end", end.Add(time.Second), 2, true},
+		// a second earlier the period before is current
+		{"next before start", start.Add(-time.Second), 1, false},
+		{"previous before start", start.Add(-time.Second), -2, true},
+	}
+	for _, test := range tests {
+		code, err := Code(rfc6238Secret, step+test.offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := Validate(rfc6238Secret, code, test.at)
+		if ok != test.valid {
+			t.Errorf("%s: valid is %v, want %v", test.name, ok, test.valid)
+			continue
+		}
+		if ok && got != step+test.offset {
+			t.Errorf("%s: step is %d, want %d", test.name, got, step+test.offset)
+		}
+	}
+}
+
+func TestValidateFormat(t *testing.T) {
+	at := time.Unix(1111111111, 0)
+	tests := []struct {
+		code  string
+		valid bool
+	}{
+		{"050471", true},
+		{" 050 471 ", true},
+		{"50471", false},
+		{"0050471", false},
+		{"14050471", false},
+		{"050472", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		if _, ok := Validate(rfc6238Secret, test.code, at); ok != test.valid {
+			t.Errorf("Validate(%q) is %v, want %v", test.code, ok, test.valid)
+		}
+	}
+
+	if _, ok := Validate("not base32!", "050471", at); ok {
+		t.Error("code accepted for an invalid secret")
+	}
+}
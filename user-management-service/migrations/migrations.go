@@ -0,0 +1,329 @@
+package migrations
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+	"user-management-service/internal/entity"
+	"user-management-service/internal/password"
+)
+
+// AutoMigrateUsers creates the users table if it does not exist.
+func AutoMigrateUsers(retries int, db *sql.DB) error {
+	query := `
+		CREATE TABLE IF NOT EXISTS users (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			username VARCHAR(50) NOT NULL,
+			email VARCHAR(50) NOT NULL,
+			password VARCHAR(255) NOT NULL,
+			email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+			UNIQUE INDEX email_idx (email)
+		);
+	`
+	_, err := db.Exec(query)
+	if err != nil {
+		// Retry creating the table
+		for i := 0; i < retries; i++ {
+			time.Sleep(1 * time.Second)
+			_, err = db.Exec(query)
+			if err == nil {
+				break
+			}
+		}
+	}
+	return err
+}
+
+// AutoMigratePasswordHashes replaces the plaintext passwords of users created before passwords
+// were hashed, and drops the index that allowed looking users up by password.
+func AutoMigratePasswordHashes(db *sql.DB) error {
+	var indexes int
+	query := `SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = 'users' AND index_name = 'password_idx'`
+	if err := db.QueryRow(query).Scan(&indexes); err != nil {
+		return err
+	}
+	if indexes > 0 {
+		if _, err := db.Exec(`DROP INDEX password_idx ON users`); err != nil {
+			return err
+		}
+	}
+
+	rows, err := db.Query(`SELECT id, password FROM users WHERE password NOT LIKE '$argon2id$%'`)
+	if err != nil {
+		return err
+	}
+
+	plaintexts := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var plaintext string
+		if err := rows.Scan(&id, &plaintext); err != nil {
+			rows.Close()
+			return err
+		}
+		plaintexts[id] = plaintext
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, plaintext := range plaintexts {
+		hash, err := password.Hash(plaintext, password.DefaultParams)
+		if err != nil {
+			return err
+		}
+		// only replace the value that was read, in case the user logged in and was rehashed meanwhile
+		_, err = db.Exec(`UPDATE users SET password = ? WHERE id = ? AND password = ?`, hash, id, plaintext)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AutoMigrateRoles creates the roles tables, adds the default roles and their permissions if
+// they are missing, and gives the default role to users that have none.
+func AutoMigrateRoles(retries int, db *sql.DB) error {
+	queries := []string{`
+		CREATE TABLE IF NOT EXISTS roles (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			name VARCHAR(50) NOT NULL UNIQUE
+		);
+	`, `
+		CREATE TABLE IF NOT EXISTS role_permissions (
+			role_id INT NOT NULL,
+			permission VARCHAR(100) NOT NULL,
+			PRIMARY KEY (role_id, permission),
+			FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE
+		);
+	`, `
+		CREATE TABLE IF NOT EXISTS user_roles (
+			user_id INT NOT NULL,
+			role_id INT NOT NULL,
+			PRIMARY KEY (user_id, role_id),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE
+		);
+	`}
+	for _, query := range queries {
+		_, err := db.Exec(query)
+		if err != nil {
+			// Retry creating the table
+			for i := 0; i < retries; i++ {
+				time.Sleep(1 * time.Second)
+				_, err = db.Exec(query)
+				if err == nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, role := range entity.DefaultRoles {
+		if _, err := db.Exec(`INSERT IGNORE INTO roles (name) VALUES (?)`, role.Name); err != nil {
+			return err
+		}
+		for _, permission := range role.Permissions {
+			query := `INSERT IGNORE INTO role_permissions (role_id, permission) SELECT id, ? FROM roles WHERE name = ?`
+			if _, err := db.Exec(query, permission, role.Name); err != nil {
+				return err
+			}
+		}
+	}
+
+	query := `INSERT IGNORE INTO user_roles (user_id, role_id)
+		SELECT u.id, r.id FROM users u JOIN roles r ON r.name = ?
+		WHERE NOT EXISTS (SELECT 1 FROM user_roles ur WHERE ur.user_id = u.id)`
+	_, err := db.Exec(query, entity.DefaultRole)
+	return err
+}
+
+// AutoMigrateServiceClients creates the service_clients table if it does not exist.
+func AutoMigrateServiceClients(retries int, db *sql.DB) error {
+	query := `
+		CREATE TABLE IF NOT EXISTS service_clients (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			client_id VARCHAR(100) NOT NULL UNIQUE,
+			name VARCHAR(100) NOT NULL,
+			secret_hash VARCHAR(255) NOT NULL,
+			permissions TEXT NOT NULL,
+			audiences TEXT NOT NULL,
+			active BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+	`
+	_, err := db.Exec(query)
+	if err != nil {
+		// Retry creating the table
+		for i := 0; i < retries; i++ {
+			time.Sleep(1 * time.Second)
+			_, err = db.Exec(query)
+			if err == nil {
+				break
+			}
+		}
+	}
+	return err
+}
+
+// AutoMigrateAccountTokens adds the email verification flag to users and creates the user_tokens
+// table for verification and password reset links.
+func AutoMigrateAccountTokens(retries int, db *sql.DB) error {
+	if err := addColumnIfMissing(db, "users", "email_verified", "BOOLEAN NOT NULL DEFAULT FALSE"); err != nil {
+		return err
+	}
+
+	query := `
+		CREATE TABLE IF NOT EXISTS user_tokens (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			user_id INT NOT NULL,
+			purpose VARCHAR(20) NOT NULL,
+			token_hash CHAR(64) NOT NULL UNIQUE,
+			expires_at DATETIME NOT NULL,
+			used_at DATETIME NULL,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			INDEX user_purpose_idx (user_id, purpose),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+	`
+	_, err := db.Exec(query)
+	if err != nil {
+		// Retry creating the table
+		for i := 0; i < retries; i++ {
+			time.Sleep(1 * time.Second)
+			_, err = db.Exec(query)
+			if err == nil {
+				break
+			}
+		}
+	}
+	return err
+}
+
+// addColumnIfMissing adds a column to a table unless information_schema shows it already exists.
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	var count int
+	query := `SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?`
+	if err := db.QueryRow(query, table, column).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	_, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// AutoMigrateAddresses creates the addresses table of the users' address books.
+func AutoMigrateAddresses(retries int, db *sql.DB) error {
+	query := `
+		CREATE TABLE IF NOT EXISTS addresses (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			user_id INT NOT NULL,
+			label VARCHAR(50) NOT NULL DEFAULT '',
+			name VARCHAR(100) NOT NULL,
+			line1 VARCHAR(255) NOT NULL,
+			line2 VARCHAR(255) NOT NULL DEFAULT '',
+			city VARCHAR(100) NOT NULL,
+			region VARCHAR(100) NOT NULL DEFAULT '',
+			postal_code VARCHAR(20) NOT NULL DEFAULT '',
+			country CHAR(2) NOT NULL,
+			phone VARCHAR(30) NOT NULL DEFAULT '',
+			default_shipping BOOLEAN NOT NULL DEFAULT FALSE,
+			default_billing BOOLEAN NOT NULL DEFAULT FALSE,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+			INDEX user_idx (user_id),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+	`
+	_, err := db.Exec(query)
+	if err != nil {
+		// Retry creating the table
+		for i := 0; i < retries; i++ {
+			time.Sleep(1 * time.Second)
+			_, err = db.Exec(query)
+			if err == nil {
+				break
+			}
+		}
+	}
+	return err
+}
+
+// AutoMigrateTwoFactor creates the tables of TOTP second factors and their recovery codes.
+func AutoMigrateTwoFactor(retries int, db *sql.DB) error {
+	queries := []string{`
+		CREATE TABLE IF NOT EXISTS user_two_factor (
+			user_id INT PRIMARY KEY,
+			secret VARCHAR(255) NOT NULL,
+			enabled BOOLEAN NOT NULL DEFAULT FALSE,
+			last_used_step BIGINT NOT NULL DEFAULT 0,
+			enabled_at DATETIME NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+	`, `
+		CREATE TABLE IF NOT EXISTS user_recovery_codes (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			user_id INT NOT NULL,
+			code_hash CHAR(64) NOT NULL,
+			used_at DATETIME NULL,
+			UNIQUE INDEX user_code_idx (user_id, code_hash),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+	`}
+	for _, query := range queries {
+		_, err := db.Exec(query)
+		if err != nil {
+			// Retry creating the table
+			for i := 0; i < retries; i++ {
+				time.Sleep(1 * time.Second)
+				_, err = db.Exec(query)
+				if err == nil {
+					break
+				}
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// AutoMigrateAPIKeys creates the api_keys table if it does not exist.
+func AutoMigrateAPIKeys(retries int, db *sql.DB) error {
+	query := `
+		CREATE TABLE IF NOT EXISTS api_keys (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			user_id INT NOT NULL,
+			name VARCHAR(100) NOT NULL,
+			prefix VARCHAR(16) NOT NULL UNIQUE,
+			secret_hash CHAR(64) NOT NULL,
+			scopes TEXT NOT NULL,
+			expires_at DATETIME NOT NULL,
+			last_used_at DATETIME NULL,
+			revoked_at DATETIME NULL,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			INDEX user_idx (user_id),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+	`
+	_, err := db.Exec(query)
+	if err != nil {
+		// Retry creating the table
+		for i := 0; i < retries; i++ {
+			time.Sleep(1 * time.Second)
+			_, err = db.Exec(query)
+			if err == nil {
+				break
+			}
+		}
+	}
+	return err
+}